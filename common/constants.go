@@ -200,6 +200,8 @@ const (
 	TokenStatusDisabled  = 2 // also don't use 0
 	TokenStatusExpired   = 3
 	TokenStatusExhausted = 4
+	// TokenStatusQuarantined 疑似泄露被隔离，需轮换密钥或管理员审核后恢复
+	TokenStatusQuarantined = 5
 )
 
 const (
@@ -0,0 +1,251 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 敏感字段的信封加密：每个值使用随机生成的数据密钥（DEK）以 AES-256-GCM 加密，
+// DEK 再由主密钥（KEK）加密后与密文一同保存。密文格式：
+//
+//	enc:v1:<主密钥 ID>:<加密后的 DEK>:<加密后的值>
+//
+// 主密钥从环境变量 SECRET_MASTER_KEY 或 SECRET_MASTER_KEY_FILE 指定的文件读取。
+// 轮换主密钥时将旧主密钥放入 SECRET_MASTER_KEY_PREVIOUS（逗号分隔）或
+// SECRET_MASTER_KEY_PREVIOUS_FILE（每行一个），旧密文仍可解密，执行 --migrate-secrets 后改由新主密钥加密。
+// 未配置主密钥时不加密，已有的密文无法解密。
+
+const secretPrefix = "enc:v1:"
+
+type secretMasterKey struct {
+	id  string
+	kek []byte
+}
+
+var (
+	secretCurrentKey *secretMasterKey
+	secretKeys       = map[string]*secretMasterKey{}
+)
+
+func newSecretMasterKey(material string) *secretMasterKey {
+	kek := sha256.Sum256([]byte(material))
+	id := sha256.Sum256(kek[:])
+	return &secretMasterKey{id: hex.EncodeToString(id[:4]), kek: kek[:]}
+}
+
+func readSecretKeyMaterial(envName string) (string, error) {
+	if value := strings.TrimSpace(os.Getenv(envName)); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(envName + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", envName, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// InitSecretEncryption 加载主密钥，未配置时不启用加密
+func InitSecretEncryption() error {
+	current, err := readSecretKeyMaterial("SECRET_MASTER_KEY")
+	if err != nil {
+		return err
+	}
+	previous, err := readSecretKeyMaterial("SECRET_MASTER_KEY_PREVIOUS")
+	if err != nil {
+		return err
+	}
+	var previousKeys []string
+	for _, line := range strings.FieldsFunc(previous, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if line = strings.TrimSpace(line); line != "" {
+			previousKeys = append(previousKeys, line)
+		}
+	}
+	SetSecretMasterKeys(current, previousKeys...)
+	if current == "" && len(previousKeys) > 0 {
+		return errors.New("SECRET_MASTER_KEY_PREVIOUS is set but SECRET_MASTER_KEY is empty")
+	}
+	return nil
+}
+
+// SetSecretMasterKeys 设置当前主密钥与仍可用于解密的旧主密钥，current 为空时关闭加密
+func SetSecretMasterKeys(current string, previous ...string) {
+	keys := map[string]*secretMasterKey{}
+	for _, material := range previous {
+		key := newSecretMasterKey(material)
+		keys[key.id] = key
+	}
+	secretCurrentKey = nil
+	if current != "" {
+		secretCurrentKey = newSecretMasterKey(current)
+		keys[secretCurrentKey.id] = secretCurrentKey
+	}
+	secretKeys = keys
+}
+
+// SecretEncryptionEnabled 是否配置了主密钥
+func SecretEncryptionEnabled() bool {
+	return secretCurrentKey != nil
+}
+
+// IsEncryptedSecret 判断值是否为加密后的密文
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func sealAESGCM(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAESGCM(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// parseSecret 解析密文，返回主密钥 ID、加密后的 DEK 与加密后的值
+func parseSecret(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, secretPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("invalid encrypted secret format")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parts[0], wrappedKey, sealed, nil
+}
+
+func formatSecret(keyId string, wrappedKey []byte, sealed []byte) string {
+	return secretPrefix + keyId + ":" + base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// unwrapSecretKey 使用对应的主密钥解密 DEK
+func unwrapSecretKey(keyId string, wrappedKey []byte) ([]byte, error) {
+	masterKey, ok := secretKeys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("master key %s for encrypted secret is not configured", keyId)
+	}
+	dek, err := openAESGCM(masterKey.kek, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key with master key %s: %w", keyId, err)
+	}
+	return dek, nil
+}
+
+// SecretLookupDigest 计算敏感值的 HMAC-SHA256 摘要，供加密字段做等值查询。
+// 摘要密钥由当前主密钥派生，未启用加密或值为空时返回空字符串
+func SecretLookupDigest(plaintext string) string {
+	if secretCurrentKey == nil || plaintext == "" {
+		return ""
+	}
+	lookupKey := sha256.Sum256(append([]byte("lookup:"), secretCurrentKey.kek...))
+	mac := hmac.New(sha256.New, lookupKey[:])
+	mac.Write([]byte(plaintext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EncryptSecret 加密敏感值。未启用加密、值为空或已是密文时原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if secretCurrentKey == nil || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	sealed, err := sealAESGCM(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealAESGCM(secretCurrentKey.kek, dek)
+	if err != nil {
+		return "", err
+	}
+	return formatSecret(secretCurrentKey.id, wrappedKey, sealed), nil
+}
+
+// DecryptSecret 解密敏感值，非密文原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	keyId, wrappedKey, sealed, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrapSecretKey(keyId, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openAESGCM(dek, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// ReencryptSecret 用于迁移存量数据：明文加密，旧主密钥加密的密文改由当前主密钥重新加密 DEK。
+// 返回新值以及是否发生了变化
+func ReencryptSecret(value string) (string, bool, error) {
+	if secretCurrentKey == nil || value == "" {
+		return value, false, nil
+	}
+	if !IsEncryptedSecret(value) {
+		encrypted, err := EncryptSecret(value)
+		return encrypted, err == nil, err
+	}
+	keyId, wrappedKey, sealed, err := parseSecret(value)
+	if err != nil {
+		return value, false, err
+	}
+	if keyId == secretCurrentKey.id {
+		return value, false, nil
+	}
+	dek, err := unwrapSecretKey(keyId, wrappedKey)
+	if err != nil {
+		return value, false, err
+	}
+	wrappedKey, err = sealAESGCM(secretCurrentKey.kek, dek)
+	if err != nil {
+		return value, false, err
+	}
+	return formatSecret(secretCurrentKey.id, wrappedKey, sealed), true, nil
+}
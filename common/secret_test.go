@@ -0,0 +1,72 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretEncryptDecrypt(t *testing.T) {
+	t.Cleanup(func() { SetSecretMasterKeys("") })
+
+	SetSecretMasterKeys("")
+	plain, err := EncryptSecret("sk-plain")
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain", plain)
+
+	SetSecretMasterKeys("master-key-1")
+	encrypted, err := EncryptSecret("sk-secret")
+	require.NoError(t, err)
+	require.True(t, IsEncryptedSecret(encrypted))
+	require.NotContains(t, encrypted, "sk-secret")
+
+	again, err := EncryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, encrypted, again)
+
+	decrypted, err := DecryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", decrypted)
+
+	// 明文原样返回，兼容尚未迁移的数据
+	decrypted, err = DecryptSecret("sk-legacy")
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", decrypted)
+
+	SetSecretMasterKeys("other-key")
+	_, err = DecryptSecret(encrypted)
+	require.Error(t, err)
+}
+
+func TestReencryptSecretRotatesMasterKey(t *testing.T) {
+	t.Cleanup(func() { SetSecretMasterKeys("") })
+
+	SetSecretMasterKeys("master-key-1")
+	encrypted, err := EncryptSecret("sk-secret")
+	require.NoError(t, err)
+
+	SetSecretMasterKeys("master-key-2", "master-key-1")
+	decrypted, err := DecryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", decrypted)
+
+	rotated, changed, err := ReencryptSecret(encrypted)
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, changed, err = ReencryptSecret(rotated)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// 轮换完成后移除旧主密钥，新密文仍可解密
+	SetSecretMasterKeys("master-key-2")
+	decrypted, err = DecryptSecret(rotated)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", decrypted)
+	_, err = DecryptSecret(encrypted)
+	require.Error(t, err)
+
+	migrated, changed, err := ReencryptSecret("sk-legacy")
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, IsEncryptedSecret(migrated))
+}
@@ -65,4 +65,10 @@ const (
 
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	// ContextKeyPayloadCapture stores the payload capture session when the request is selected for capture
+	ContextKeyPayloadCapture ContextKey = "payload_capture"
+
+	// ContextKeyRealtimeSession stores the realtime session control (duration, idle, concurrency and budget limits)
+	ContextKeyRealtimeSession ContextKey = "realtime_session"
 )
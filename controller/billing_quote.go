@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// billingQuote 请求报价结果，额度单位与日志一致，*_amount 为按 QuotaPerUnit 换算的金额
+type billingQuote struct {
+	Object             string                     `json:"object"`
+	Model              string                     `json:"model"`
+	Group              string                     `json:"group"`
+	RelayFormat        string                     `json:"relay_format"`
+	PromptTokens       int                        `json:"prompt_tokens"`
+	MaxTokens          int                        `json:"max_tokens"`
+	UsePrice           bool                       `json:"use_price"`
+	FreeModel          bool                       `json:"free_model"`
+	ModelPrice         float64                    `json:"model_price"`
+	ModelRatio         float64                    `json:"model_ratio"`
+	CompletionRatio    float64                    `json:"completion_ratio"`
+	GroupRatio         float64                    `json:"group_ratio"`
+	CacheRatio         float64                    `json:"cache_ratio"`
+	CacheCreationRatio float64                    `json:"cache_creation_ratio"`
+	ImageRatio         float64                    `json:"image_ratio"`
+	ImagePriceRatio    float64                    `json:"image_price_ratio,omitempty"`
+	AudioRatio         float64                    `json:"audio_ratio"`
+	ServiceTier        string                     `json:"service_tier,omitempty"`
+	PricingTier        *types.PricingTierInfo     `json:"pricing_tier,omitempty"`
+	PricingSchedule    *types.PricingScheduleInfo `json:"pricing_schedule,omitempty"`
+	PreConsumeQuota    int                        `json:"pre_consume_quota"`
+	PreConsumeAmount   float64                    `json:"pre_consume_amount"`
+	// WorstCaseQuota 请求未限制输出长度（max_tokens）时无法给出上限，此时为 null 且 WorstCaseUnbounded 为 true
+	WorstCaseQuota     *int     `json:"worst_case_quota"`
+	WorstCaseAmount    *float64 `json:"worst_case_amount"`
+	WorstCaseUnbounded bool     `json:"worst_case_unbounded"`
+}
+
+// quoteRelayFormat 根据 relay 路径判断请求格式，与 relay 路由保持一致
+func quoteRelayFormat(path string) (types.RelayFormat, bool) {
+	switch {
+	case strings.HasPrefix(path, "/v1/messages"):
+		return types.RelayFormatClaude, true
+	case strings.HasPrefix(path, "/v1/chat/completions"),
+		strings.HasPrefix(path, "/v1/completions"),
+		strings.HasPrefix(path, "/v1/moderations"):
+		return types.RelayFormatOpenAI, true
+	case strings.HasPrefix(path, "/v1/responses/compact"):
+		return types.RelayFormatOpenAIResponsesCompaction, true
+	case strings.HasPrefix(path, "/v1/responses"):
+		return types.RelayFormatOpenAIResponses, true
+	case strings.HasPrefix(path, "/v1/images/generations"),
+		strings.HasPrefix(path, "/v1/images/edits"),
+		strings.HasPrefix(path, "/v1/edits"):
+		return types.RelayFormatOpenAIImage, true
+	case strings.HasPrefix(path, "/v1/embeddings"):
+		return types.RelayFormatEmbedding, true
+	case strings.HasPrefix(path, "/v1/audio/"):
+		return types.RelayFormatOpenAIAudio, true
+	case strings.HasPrefix(path, "/v1/rerank"):
+		return types.RelayFormatRerank, true
+	case strings.HasPrefix(path, "/v1beta/models/"),
+		strings.HasPrefix(path, "/v1/models/"),
+		strings.HasPrefix(path, "/v1/engines/"):
+		return types.RelayFormatGemini, true
+	}
+	return "", false
+}
+
+// quoteWorstCaseQuota 计算按 max_tokens 全部输出、且无缓存命中时的最高额度。输入与输出 token 均按
+// 可能适用的最高倍率计算（图片、音频、缓存写入），未指定 max_tokens 时输出无上限，返回 false
+func quoteWorstCaseQuota(priceData types.PriceData, promptTokens int, maxTokens int) (int, bool) {
+	groupRatio := priceData.GroupRatioInfo.GroupRatio
+	if priceData.UsePrice {
+		return int(priceData.ModelPrice * common.QuotaPerUnit * groupRatio), true
+	}
+	if maxTokens <= 0 {
+		return 0, false
+	}
+	inputRatio := max(1, priceData.ImageRatio, priceData.AudioRatio,
+		priceData.CacheCreationRatio, priceData.CacheCreation5mRatio, priceData.CacheCreation1hRatio)
+	outputRatio := max(priceData.CompletionRatio, priceData.AudioRatio*priceData.AudioCompletionRatio)
+	tokens := float64(promptTokens)*inputRatio + float64(maxTokens)*outputRatio
+	return int(tokens * priceData.ModelRatio * groupRatio), true
+}
+
+// RelayQuote 按 relay 请求体预估费用：执行请求解析、token 预估与计价，但不预扣费也不转发上游
+func RelayQuote(c *gin.Context) {
+	relayFormat, ok := quoteRelayFormat(c.Request.URL.Path)
+	if !ok {
+		quoteError(c, types.NewErrorWithStatusCode(errors.New("unsupported relay path: "+c.Request.URL.Path), types.ErrorCodeInvalidRequest, http.StatusNotFound))
+		return
+	}
+
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		if common.IsRequestBodyTooLargeError(err) || errors.Is(err, common.ErrRequestBodyTooLarge) {
+			quoteError(c, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge))
+		} else {
+			quoteError(c, types.NewError(err, types.ErrorCodeInvalidRequest))
+		}
+		return
+	}
+
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		quoteError(c, types.NewError(err, types.ErrorCodeGenRelayInfoFailed))
+		return
+	}
+
+	meta := request.GetTokenCountMeta()
+	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
+	if err != nil {
+		quoteError(c, types.NewError(err, types.ErrorCodeCountTokenFailed))
+		return
+	}
+	relayInfo.SetEstimatePromptTokens(tokens)
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+	if err != nil {
+		quoteError(c, types.NewError(err, types.ErrorCodeModelPriceError))
+		return
+	}
+
+	quote := billingQuote{
+		Object:             "billing.quote",
+		Model:              relayInfo.OriginModelName,
+		Group:              relayInfo.UsingGroup,
+		RelayFormat:        string(relayFormat),
+		PromptTokens:       tokens,
+		MaxTokens:          meta.MaxTokens,
+		UsePrice:           priceData.UsePrice,
+		FreeModel:          priceData.FreeModel,
+		ModelPrice:         priceData.ModelPrice,
+		ModelRatio:         priceData.ModelRatio,
+		CompletionRatio:    priceData.CompletionRatio,
+		GroupRatio:         priceData.GroupRatioInfo.GroupRatio,
+		CacheRatio:         priceData.CacheRatio,
+		CacheCreationRatio: priceData.CacheCreationRatio,
+		ImageRatio:         priceData.ImageRatio,
+		ImagePriceRatio:    meta.ImagePriceRatio,
+		AudioRatio:         priceData.AudioRatio,
+		ServiceTier:        priceData.ServiceTier,
+		PricingTier:        priceData.PricingTier,
+		PricingSchedule:    priceData.PricingSchedule,
+		PreConsumeQuota:    priceData.QuotaToPreConsume,
+		PreConsumeAmount:   float64(priceData.QuotaToPreConsume) / common.QuotaPerUnit,
+	}
+	if worstCaseQuota, bounded := quoteWorstCaseQuota(priceData, tokens, meta.MaxTokens); bounded {
+		worstCaseAmount := float64(worstCaseQuota) / common.QuotaPerUnit
+		quote.WorstCaseQuota = &worstCaseQuota
+		quote.WorstCaseAmount = &worstCaseAmount
+	} else {
+		quote.WorstCaseUnbounded = true
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+func quoteError(c *gin.Context, newAPIError *types.NewAPIError) {
+	newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), c.GetString(common.RequestIdKey)))
+	c.JSON(newAPIError.StatusCode, gin.H{
+		"error": newAPIError.ToOpenAIError(),
+	})
+}
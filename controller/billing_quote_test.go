@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteRelayFormat(t *testing.T) {
+	cases := map[string]types.RelayFormat{
+		"/v1/chat/completions":   types.RelayFormatOpenAI,
+		"/v1/messages":           types.RelayFormatClaude,
+		"/v1/responses":          types.RelayFormatOpenAIResponses,
+		"/v1/responses/compact":  types.RelayFormatOpenAIResponsesCompaction,
+		"/v1/images/generations": types.RelayFormatOpenAIImage,
+		"/v1/audio/speech":       types.RelayFormatOpenAIAudio,
+		"/v1beta/models/gemini-2.0-flash:generateContent": types.RelayFormatGemini,
+	}
+	for path, expected := range cases {
+		format, ok := quoteRelayFormat(path)
+		require.True(t, ok, path)
+		require.Equal(t, expected, format, path)
+	}
+
+	_, ok := quoteRelayFormat("/v1/files")
+	require.False(t, ok)
+}
+
+func TestQuoteWorstCaseQuota(t *testing.T) {
+	ratioPrice := types.PriceData{
+		ModelRatio:      2,
+		CompletionRatio: 4,
+		GroupRatioInfo:  types.GroupRatioInfo{GroupRatio: 0.5},
+	}
+	// (1000 + 500*4) * 2 * 0.5
+	quota, bounded := quoteWorstCaseQuota(ratioPrice, 1000, 500)
+	require.True(t, bounded)
+	require.Equal(t, 3000, quota)
+	// 未指定 max_tokens 时输出无上限
+	_, bounded = quoteWorstCaseQuota(ratioPrice, 1000, 0)
+	require.False(t, bounded)
+
+	// 图片与音频输入、音频输出按最高倍率计算：(1000*3 + 500*max(4, 2*5)) * 2 * 0.5
+	ratioPrice.ImageRatio = 3
+	ratioPrice.AudioRatio = 2
+	ratioPrice.AudioCompletionRatio = 5
+	quota, bounded = quoteWorstCaseQuota(ratioPrice, 1000, 500)
+	require.True(t, bounded)
+	require.Equal(t, 8000, quota)
+
+	fixedPrice := types.PriceData{
+		UsePrice:       true,
+		ModelPrice:     0.04,
+		GroupRatioInfo: types.GroupRatioInfo{GroupRatio: 1},
+	}
+	quota, bounded = quoteWorstCaseQuota(fixedPrice, 1000, 0)
+	require.True(t, bounded)
+	require.Equal(t, int(0.04*common.QuotaPerUnit), quota)
+}
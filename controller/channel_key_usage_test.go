@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 渠道密钥可能是 env://、file://、vault:// 等外部引用，作为凭证发往上游前必须经过
+// GetNextEnabledKey / GetResolvedKey / GetFirstResolvedKey 解析
+var rawChannelKeyCredentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`Split\((ch|\w*(?i:channel))\.Key, "\\n"\)\[0\]`),
+	regexp.MustCompile(`"Bearer "\s*\+\s*\w*(?i:channel)\.Key\b`),
+	regexp.MustCompile(`Bearer %s", \w*(?i:channel)\.Key\)`),
+	regexp.MustCompile(`FetchTask\([^)]*\b(ch|\w*(?i:channel))\.Key\b`),
+	regexp.MustCompile(`"(mj-api-secret|Authorization|x-api-key|api-key)", \w*(?i:channel)\.Key\)`),
+	regexp.MustCompile(`GetAuthHeader\(\w*(?i:channel)\.Key\)`),
+	regexp.MustCompile(`api_key=%s", \w*(?i:channel)\.Key\)`),
+	regexp.MustCompile(`\.Add\("[\w-]+", \w*(?i:channel)\.Key\)`),
+	regexp.MustCompile(`ApiKey = \w*(?i:channel)\.Key$`),
+	regexp.MustCompile(`ParseOAuthKey\([^)]*\b(ch|\w*(?i:channel))\.Key\b`),
+}
+
+func TestChannelKeyNotUsedRawAsCredential(t *testing.T) {
+	var violations []string
+	for _, dir := range []string{".", "../service", "../relay"} {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for i, line := range strings.Split(string(data), "\n") {
+				trimmed := strings.TrimSpace(line)
+				if strings.HasPrefix(trimmed, "//") {
+					continue
+				}
+				for _, pattern := range rawChannelKeyCredentialPatterns {
+					if pattern.MatchString(trimmed) {
+						violations = append(violations, fmt.Sprintf("%s:%d: %s", filepath.ToSlash(path), i+1, trimmed))
+						break
+					}
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	require.Empty(t, violations, "channel key used as credential without resolving secret references")
+}
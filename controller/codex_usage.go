@@ -42,7 +42,13 @@ func GetCodexChannelUsage(c *gin.Context) {
 		return
 	}
 
-	oauthKey, err := codex.ParseOAuthKey(strings.TrimSpace(ch.Key))
+	rawKey, err := ch.GetResolvedKey()
+	if err != nil {
+		common.SysError("failed to resolve oauth key: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "解析凭证失败，请检查渠道配置"})
+		return
+	}
+	oauthKey, err := codex.ParseOAuthKey(strings.TrimSpace(rawKey))
 	if err != nil {
 		common.SysError("failed to parse oauth key: " + err.Error())
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "解析凭证失败，请检查渠道配置"})
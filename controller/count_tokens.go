@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayCountTokens 处理 Anthropic /v1/messages/count_tokens 与 Gemini :countTokens 请求。
+// 默认免费；配置 count_tokens_setting.price 后按次计费。
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	var newAPIError *types.NewAPIError
+	defer func() {
+		if newAPIError == nil {
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("count tokens error: %s", newAPIError.Error()))
+		newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), c.GetString(common.RequestIdKey)))
+		if relayFormat == types.RelayFormatClaude {
+			c.JSON(newAPIError.StatusCode, gin.H{
+				"type":  "error",
+				"error": newAPIError.ToClaudeError(),
+			})
+			return
+		}
+		c.JSON(newAPIError.StatusCode, gin.H{
+			"error": newAPIError.ToOpenAIError(),
+		})
+	}()
+
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		if common.IsRequestBodyTooLargeError(err) || errors.Is(err, common.ErrRequestBodyTooLarge) {
+			newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+		} else {
+			newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
+		}
+		return
+	}
+
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+
+	price := operation_setting.GetCountTokensSetting().Price
+	groupRatioInfo := helper.HandleGroupRatio(c, relayInfo)
+	relayInfo.PriceData = types.PriceData{
+		ModelPrice:     price,
+		UsePrice:       true,
+		GroupRatioInfo: groupRatioInfo,
+	}
+	quota := service.CalcCountTokensQuota(price, groupRatioInfo.GroupRatio)
+	if quota > 0 {
+		newAPIError = service.PreConsumeBilling(c, quota, relayInfo)
+		if newAPIError != nil {
+			return
+		}
+	}
+
+	tokens, upstream, apiErr := relay.CountTokensHelper(c, relayInfo)
+	if apiErr != nil {
+		if relayInfo.Billing != nil {
+			relayInfo.Billing.Refund(c)
+		}
+		newAPIError = apiErr
+		return
+	}
+	if quota > 0 {
+		service.PostCountTokensConsumeQuota(c, relayInfo, quota, tokens, upstream)
+	}
+
+	if relayFormat == types.RelayFormatClaude {
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+		return
+	}
+	c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+}
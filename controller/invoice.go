@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type invoiceDetail struct {
+	*model.Invoice
+	CreditNotes []*model.Invoice `json:"credit_notes,omitempty"`
+}
+
+func getInvoices(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	invoices, total, err := model.GetInvoices(userId, c.Query("type"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(invoices)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetAllInvoices 管理员查看发票列表
+func GetAllInvoices(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	getInvoices(c, userId)
+}
+
+// GetSelfInvoices 用户查看自己的发票
+func GetSelfInvoices(c *gin.Context) {
+	getInvoices(c, c.GetInt("id"))
+}
+
+func getInvoice(c *gin.Context, userId int) *model.Invoice {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return nil
+	}
+	invoice, err := model.GetInvoiceById(id, userId)
+	if err != nil {
+		common.ApiErrorMsg(c, "发票不存在")
+		return nil
+	}
+	return invoice
+}
+
+func getInvoiceDetail(c *gin.Context, userId int) {
+	invoice := getInvoice(c, userId)
+	if invoice == nil {
+		return
+	}
+	detail := invoiceDetail{Invoice: invoice}
+	if invoice.Type == model.InvoiceTypeInvoice {
+		notes, err := model.GetCreditNotesByInvoiceId(invoice.Id)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		detail.CreditNotes = notes
+	}
+	common.ApiSuccess(c, detail)
+}
+
+// GetInvoice 管理员查看发票详情
+func GetInvoice(c *gin.Context) {
+	getInvoiceDetail(c, 0)
+}
+
+// GetSelfInvoice 用户查看自己的发票详情
+func GetSelfInvoice(c *gin.Context) {
+	getInvoiceDetail(c, c.GetInt("id"))
+}
+
+func downloadInvoice(c *gin.Context, userId int) {
+	invoice := getInvoice(c, userId)
+	if invoice == nil {
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", service.InvoiceFormatPDF))
+	var buf bytes.Buffer
+	err := service.RenderInvoice(&buf, invoice, format)
+	if errors.Is(err, service.ErrInvoicePDFFontRequired) {
+		// 未配置 UTF-8 字体时改为返回 HTML，避免下载到乱码的 PDF
+		format = service.InvoiceFormatHTML
+		buf.Reset()
+		err = service.RenderInvoice(&buf, invoice, format)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	contentType := "application/pdf"
+	disposition := "attachment"
+	if format == service.InvoiceFormatHTML {
+		contentType = "text/html; charset=utf-8"
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, service.InvoiceFileName(invoice, format)))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// DownloadInvoice 管理员下载发票
+func DownloadInvoice(c *gin.Context) {
+	downloadInvoice(c, 0)
+}
+
+// DownloadSelfInvoice 用户下载自己的发票
+func DownloadSelfInvoice(c *gin.Context) {
+	downloadInvoice(c, c.GetInt("id"))
+}
+
+type issueInvoiceRequest struct {
+	SourceType string `json:"source_type"`
+	TradeNo    string `json:"trade_no"`
+}
+
+// IssueInvoice 管理员为已支付订单补开发票
+func IssueInvoice(c *gin.Context) {
+	var req issueInvoiceRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.TradeNo == "" {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.SourceType == "" {
+		req.SourceType = model.InvoiceSourceTopUp
+	}
+	invoice, err := service.IssueInvoiceForPayment(req.SourceType, req.TradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, invoice)
+}
+
+type creditNoteRequest struct {
+	Amount      float64 `json:"amount"`
+	Reason      string  `json:"reason"`
+	DeductQuota bool    `json:"deduct_quota"`
+}
+
+// CreateCreditNote 为发票开具红字发票（退款）
+func CreateCreditNote(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	var req creditNoteRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	note, err := service.CreateCreditNote(id, req.Amount, req.Reason, req.DeductQuota)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, note)
+}
+
+// GetSelfBillingProfile 获取用户开票信息
+func GetSelfBillingProfile(c *gin.Context) {
+	profile, err := model.GetUserBillingProfile(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, profile)
+}
+
+// UpdateSelfBillingProfile 更新用户开票信息，仅影响之后开具的发票
+func UpdateSelfBillingProfile(c *gin.Context) {
+	var profile model.UserBillingProfile
+	if err := common.DecodeJson(c.Request.Body, &profile); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if len(profile.Name) > 128 || len(profile.Company) > 255 || len(profile.TaxId) > 64 ||
+		len(profile.Address) > 512 || len(profile.Country) > 64 || len(profile.Email) > 255 {
+		common.ApiErrorMsg(c, "开票信息过长")
+		return
+	}
+	profile.Id = 0
+	profile.UserId = c.GetInt("id")
+	if err := profile.Save(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, profile)
+}
@@ -1,11 +1,13 @@
 package controller
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -233,3 +235,33 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetLogPayload 按 request_id 获取抓取的请求/响应载荷（仅管理员）
+func GetLogPayload(c *gin.Context) {
+	requestId := c.Query("request_id")
+	if requestId == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "request_id is required",
+		})
+		return
+	}
+	capture, err := model.GetPayloadCaptureByRequestId(requestId, 0)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if capture == nil {
+		common.ApiErrorMsg(c, "该请求没有抓取载荷或载荷已过期")
+		return
+	}
+	payload, err := service.LoadPayloadCapture(capture)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"capture": capture,
+		"payload": json.RawMessage(payload),
+	})
+}
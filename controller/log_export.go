@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logExportDeadLetterRequest struct {
+	Sink     string   `json:"sink"`
+	Segments []string `json:"segments"`
+}
+
+// GetLogExportStatus 获取日志导出目标的运行状态
+func GetLogExportStatus(c *gin.Context) {
+	common.ApiSuccess(c, service.GetLogExportStatus())
+}
+
+// GetLogExportDeadLetters 列出死信分段，传入 segment 时返回该分段的事件
+func GetLogExportDeadLetters(c *gin.Context) {
+	sink := c.Query("sink")
+	if sink == "" {
+		common.ApiErrorMsg(c, "sink is required")
+		return
+	}
+	if segment := c.Query("segment"); segment != "" {
+		events, err := service.GetLogExportDeadLetterEvents(sink, segment)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		common.ApiSuccess(c, events)
+		return
+	}
+	letters, err := service.ListLogExportDeadLetters(sink)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, letters)
+}
+
+// RetryLogExportDeadLetters 将死信分段重新放入投递队列
+func RetryLogExportDeadLetters(c *gin.Context) {
+	var req logExportDeadLetterRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.Sink == "" {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	count, err := service.RetryLogExportDeadLetters(req.Sink, req.Segments)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
+
+// DeleteLogExportDeadLetters 删除死信分段
+func DeleteLogExportDeadLetters(c *gin.Context) {
+	var req logExportDeadLetterRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.Sink == "" {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	count, err := service.DeleteLogExportDeadLetters(req.Sink, req.Segments)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, count)
+}
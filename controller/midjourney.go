@@ -77,6 +77,11 @@ func UpdateMidjourneyTaskBulk() {
 				}
 				continue
 			}
+			midjourneyKey, err := midjourneyChannel.GetFirstResolvedKey()
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("Resolve midjourney channel key error: %v", err))
+				continue
+			}
 			requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
 
 			body, _ := json.Marshal(map[string]any{
@@ -93,7 +98,7 @@ func UpdateMidjourneyTaskBulk() {
 			// 使用带有超时的 context 创建新的请求
 			req = req.WithContext(ctx)
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+			req.Header.Set("mj-api-secret", midjourneyKey)
 			resp, err := service.GetHttpClient().Do(req)
 			if err != nil {
 				logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
@@ -296,6 +296,49 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "token_anomaly_setting.new_ip_prefix_action", "token_anomaly_setting.unusual_model_action", "token_anomaly_setting.off_hours_action":
+		err = operation_setting.ValidateTokenAnomalyAction(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "guardrail_setting.policies":
+		err = operation_setting.ValidateGuardrailPolicies(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "realtime_session_setting.default", "realtime_session_setting.group_policies", "realtime_session_setting.token_policies":
+		switch option.Key {
+		case "realtime_session_setting.default":
+			err = operation_setting.ValidateRealtimeSessionPolicy(option.Value.(string))
+		case "realtime_session_setting.group_policies":
+			err = operation_setting.ValidateRealtimeSessionGroupPolicies(option.Value.(string))
+		default:
+			err = operation_setting.ValidateRealtimeSessionTokenPolicies(option.Value.(string))
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "pricing_schedule_setting.schedules":
+		err = ratio_setting.ValidatePricingSchedules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value.(string))
 	if err != nil {
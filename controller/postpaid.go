@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type postpaidStatus struct {
+	Account *model.PostpaidAccount `json:"account"`
+	Quota   int                    `json:"quota"`
+	// Available 当前可用额度（余额 + 授信额度），账户不可用时为余额
+	Available int `json:"available"`
+}
+
+func getPostpaidStatus(c *gin.Context, userId int) {
+	account, err := model.GetPostpaidAccount(userId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		common.ApiError(c, err)
+		return
+	}
+	quota, err := model.GetUserQuota(userId, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	status := postpaidStatus{Account: account, Quota: quota, Available: quota}
+	if account.IsUsable() {
+		status.Available = quota + account.CreditLimit
+	}
+	common.ApiSuccess(c, status)
+}
+
+func getPostpaidSettlements(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	settlements, total, err := model.GetPostpaidSettlements(userId, c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(settlements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfPostpaid 用户查看自己的后付费账户
+func GetSelfPostpaid(c *gin.Context) {
+	getPostpaidStatus(c, c.GetInt("id"))
+}
+
+// GetSelfPostpaidSettlements 用户查看自己的后付费结算单
+func GetSelfPostpaidSettlements(c *gin.Context) {
+	getPostpaidSettlements(c, c.GetInt("id"))
+}
+
+// GetPostpaidAccounts 管理员查看后付费账户列表
+func GetPostpaidAccounts(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	accounts, total, err := model.GetPostpaidAccounts(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(accounts)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetPostpaidAccount 管理员查看用户的后付费账户
+func GetPostpaidAccount(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	getPostpaidStatus(c, userId)
+}
+
+type postpaidAccountRequest struct {
+	UserId      int    `json:"user_id"`
+	Enabled     bool   `json:"enabled"`
+	CreditLimit int    `json:"credit_limit"`
+	Remark      string `json:"remark"`
+}
+
+// UpdatePostpaidAccount 管理员开通或调整用户的后付费授信额度
+func UpdatePostpaidAccount(c *gin.Context) {
+	var req postpaidAccountRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.UserId <= 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	account, err := model.UpsertPostpaidAccount(req.UserId, req.Enabled, req.CreditLimit, req.Remark, common.GetTimestamp())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(req.UserId, model.LogTypeManage, "管理员更新后付费账户，授信额度 "+strconv.Itoa(req.CreditLimit))
+	common.ApiSuccess(c, account)
+}
+
+// SuspendPostpaidAccount 管理员手动暂停后付费账户
+func SuspendPostpaidAccount(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if _, err := model.SuspendPostpaidAccount(userId, model.PostpaidSuspendReasonManual); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// ResumePostpaidAccount 管理员手动恢复后付费账户
+func ResumePostpaidAccount(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if _, err := model.ResumePostpaidAccount(userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetAllPostpaidSettlements 管理员查看后付费结算单
+func GetAllPostpaidSettlements(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	getPostpaidSettlements(c, userId)
+}
+
+type payPostpaidSettlementRequest struct {
+	// Credit 线下收款时为用户增加应付额度
+	Credit bool `json:"credit"`
+}
+
+// PayPostpaidSettlement 管理员将结算单标记为已支付
+func PayPostpaidSettlement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	var req payPostpaidSettlementRequest
+	if c.Request.ContentLength > 0 {
+		if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+			common.ApiErrorMsg(c, "无效的参数")
+			return
+		}
+	}
+	settlement, err := service.SettlePostpaidSettlement(id, req.Credit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, settlement)
+}
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"slices"
+	"time"
+
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -8,6 +11,49 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// pricingScheduleHorizon 定价接口展示未来多长时间内的价格计划
+const pricingScheduleHorizon = 7 * 24 * time.Hour
+
+// pricingScheduleEffective 价格计划生效期间某模型在某分组下实际使用的倍率或价格
+type pricingScheduleEffective struct {
+	Schedule   string  `json:"schedule"`
+	Multiplier float64 `json:"multiplier"`
+	ModelRatio float64 `json:"model_ratio"`
+	ModelPrice float64 `json:"model_price"`
+	EndsAt     int64   `json:"ends_at"`
+}
+
+// buildEffectivePricing 按模型、分组列出当前生效的价格计划调整后的倍率或价格，未命中计划的模型不返回
+func buildEffectivePricing(pricing []model.Pricing, usableGroup map[string]string, now time.Time) map[string]map[string]pricingScheduleEffective {
+	result := make(map[string]map[string]pricingScheduleEffective)
+	setting := ratio_setting.GetPricingScheduleSetting()
+	if !setting.Enabled {
+		return result
+	}
+	for _, p := range pricing {
+		for group := range usableGroup {
+			if len(p.EnableGroup) > 0 && !slices.Contains(p.EnableGroup, group) {
+				continue
+			}
+			window, ok := setting.Resolve(p.ModelName, group, now)
+			if !ok {
+				continue
+			}
+			if result[p.ModelName] == nil {
+				result[p.ModelName] = make(map[string]pricingScheduleEffective)
+			}
+			result[p.ModelName][group] = pricingScheduleEffective{
+				Schedule:   window.Name,
+				Multiplier: window.Multiplier,
+				ModelRatio: p.ModelRatio * window.Multiplier,
+				ModelPrice: p.ModelPrice * window.Multiplier,
+				EndsAt:     window.EndsAt,
+			}
+		}
+	}
+	return result
+}
+
 func GetPricing(c *gin.Context) {
 	pricing := model.GetPricing()
 	userId, exists := c.Get("id")
@@ -38,6 +84,7 @@ func GetPricing(c *gin.Context) {
 		}
 	}
 
+	now := time.Now()
 	c.JSON(200, gin.H{
 		"success":            true,
 		"data":               pricing,
@@ -46,6 +93,8 @@ func GetPricing(c *gin.Context) {
 		"usable_group":       usableGroup,
 		"supported_endpoint": model.GetSupportedEndpointMap(),
 		"auto_groups":        service.GetUserAutoGroup(group),
+		"pricing_schedules":  ratio_setting.GetPricingScheduleSetting().Windows(usableGroup, now, pricingScheduleHorizon),
+		"effective_pricing":  buildEffectivePricing(pricing, usableGroup, now),
 		"_":                  "a42d372ccf0b5dd13ecf71203521f9d2",
 	})
 }
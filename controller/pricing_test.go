@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEffectivePricingActiveSchedule(t *testing.T) {
+	now := time.Date(2026, 6, 2, 3, 0, 0, 0, time.UTC)
+	setting := ratio_setting.GetPricingScheduleSetting()
+	saved := *setting
+	*setting = ratio_setting.PricingScheduleSetting{
+		Enabled: true,
+		Schedules: []ratio_setting.PricingSchedule{
+			{Name: "off-peak", Enabled: true, Models: []string{"model-*"}, Groups: []string{"default"}, WindowStart: "22:00", WindowEnd: "08:00", Multiplier: 0.5},
+		},
+	}
+	t.Cleanup(func() { *setting = saved })
+
+	pricing := []model.Pricing{
+		{ModelName: "model-a", ModelRatio: 2, EnableGroup: []string{"default", "vip"}},
+		{ModelName: "model-b", QuotaType: 1, ModelPrice: 0.04, EnableGroup: []string{"default"}},
+		{ModelName: "other", ModelRatio: 1, EnableGroup: []string{"default"}},
+	}
+	usableGroup := map[string]string{"default": "", "vip": ""}
+
+	effective := buildEffectivePricing(pricing, usableGroup, now)
+	require.Len(t, effective, 2)
+	require.Equal(t, map[string]pricingScheduleEffective{
+		"default": {Schedule: "off-peak", Multiplier: 0.5, ModelRatio: 1, EndsAt: time.Date(2026, 6, 2, 8, 0, 0, 0, time.UTC).Unix()},
+	}, effective["model-a"])
+	require.InDelta(t, 0.02, effective["model-b"]["default"].ModelPrice, 1e-9)
+
+	// 时段外不返回调整后的价格
+	require.Empty(t, buildEffectivePricing(pricing, usableGroup, now.Add(6*time.Hour)))
+}
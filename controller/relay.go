@@ -83,6 +83,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			return
 		}
 		defer ws.Close()
+		helper.InitWssWriteLock(c)
 	}
 
 	defer func() {
@@ -96,6 +97,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			switch relayFormat {
 			case types.RelayFormatOpenAIRealtime:
 				helper.WssError(c, ws, newAPIError.ToOpenAIError())
+				helper.WssClose(ws, realtimeCloseCode(newAPIError), string(newAPIError.GetErrorCode()))
 			case types.RelayFormatClaude:
 				c.JSON(newAPIError.StatusCode, gin.H{
 					"type":  "error",
@@ -126,11 +128,32 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
-	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
+	if relayFormat == types.RelayFormatOpenAIRealtime {
+		realtimeSession, sessionErr := service.StartRealtimeSession(c, relayInfo, func(stop *service.RealtimeSessionStop) {
+			helper.WssError(c, ws, stop.Error)
+			helper.WssClose(ws, stop.CloseCode, stop.Reason)
+		})
+		if sessionErr != nil {
+			newAPIError = sessionErr
+			return
+		}
+		defer realtimeSession.Finish(c)
+	}
+
+	// 启用内容安全流水线时由其替代敏感词检查
+	var guardrail *service.GuardrailSession
+	if relayFormat != types.RelayFormatOpenAIRealtime {
+		guardrail = service.NewGuardrailSession(relayInfo.TokenId, relayInfo.TokenKey, relayInfo.UsingGroup)
+	}
+	needInputGuardrail := guardrail.HasPhase(operation_setting.GuardrailPhaseInput)
+	needSensitiveCheck := guardrail == nil && setting.ShouldCheckPromptSensitive()
+	if guardrail == nil && relayFormat != types.RelayFormatOpenAIRealtime && setting.ShouldCheckCompletionSensitive() {
+		guardrail = service.NewSensitiveWordsOutputGuardrail()
+	}
 	needCountToken := constant.CountToken
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || needInputGuardrail {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -145,6 +168,28 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	if needInputGuardrail {
+		redacted, guardrailErr := applyInputGuardrail(c, relayInfo, guardrail, meta)
+		if guardrailErr != nil {
+			newAPIError = guardrailErr
+			return
+		}
+		if redacted {
+			// 请求体已脱敏，重新解析以使后续转换与计费使用脱敏后的内容
+			request, err = helper.GetAndValidateRequest(c, relayFormat)
+			if err != nil {
+				newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
+				return
+			}
+			relayInfo.Request = request
+			if needCountToken {
+				meta = request.GetTokenCountMeta()
+			} else {
+				meta = fastTokenCountMetaForPricing(request)
+			}
+		}
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -190,6 +235,32 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
 
+	// 流式响应经滑动窗口检测后下发；非流式响应先缓冲，输出检测通过后再写给客户端。两者均在下发前还原脱敏占位符
+	if guardrail.NeedsOutput() && relayInfo.IsStream {
+		var streamFilter *service.GuardrailStreamFilter
+		relayInfo.NewStreamOutputFilter = func() relaycommon.StreamOutputFilter {
+			streamFilter = service.NewGuardrailStreamFilter(c, guardrail, relayInfo)
+			if streamFilter == nil {
+				return nil
+			}
+			return streamFilter
+		}
+		defer func() {
+			if streamFilter != nil {
+				service.RecordGuardrailViolations(c, relayInfo, guardrail.PhaseViolations(operation_setting.GuardrailPhaseOutput), streamFilter.Blocked())
+			}
+		}()
+	} else if guardrail.NeedsOutput() {
+		guardrailWriter := service.StartGuardrailOutput(c)
+		defer func() {
+			blocked := guardrailWriter.Finish(c, guardrail, newAPIError == nil)
+			service.RecordGuardrailViolations(c, relayInfo, guardrail.PhaseViolations(operation_setting.GuardrailPhaseOutput), blocked)
+			if blocked != nil {
+				newAPIError = guardrailBlockedError(blocked)
+			}
+		}()
+	}
+
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
 		relayInfo.RetryIndex = retryParam.GetRetry()
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
@@ -256,6 +327,18 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// realtimeCloseCode 实时会话出错时发送给客户端的关闭码
+func realtimeCloseCode(err *types.NewAPIError) int {
+	switch {
+	case err.GetErrorCode() == types.ErrorCodeRealtimeSessionLimit:
+		return websocket.CloseTryAgainLater
+	case err.StatusCode >= http.StatusBadRequest && err.StatusCode < http.StatusInternalServerError:
+		return websocket.ClosePolicyViolation
+	default:
+		return websocket.CloseInternalServerErr
+	}
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func guardrailBlockedError(blocked *types.GuardrailViolation) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(
+		fmt.Errorf("%s blocked by guardrail policy %s (stage %s)", blocked.Phase, blocked.Policy, blocked.Stage),
+		types.ErrorCodeGuardrailBlocked, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// applyInputGuardrail 对请求内容执行输入检测。JSON 请求体中的用户内容可被脱敏或包裹改写，返回是否改写了请求体；
+// 其他请求体（如 multipart）只检测合并文本，脱敏按拦截处理，不执行提示词注入检测
+func applyInputGuardrail(c *gin.Context, relayInfo *relaycommon.RelayInfo, guardrail *service.GuardrailSession, meta *types.TokenCountMeta) (bool, *types.NewAPIError) {
+	var blocked *types.GuardrailViolation
+	changed := false
+	if strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		storage, err := common.GetBodyStorage(c)
+		if err != nil {
+			return false, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		body, err := storage.Bytes()
+		if err != nil {
+			return false, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		var newBody []byte
+		newBody, changed, blocked, err = guardrail.CheckJSON(c.Request.Context(), operation_setting.GuardrailPhaseInput, body)
+		if err != nil {
+			return false, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		if blocked == nil {
+			var injected bool
+			newBody, injected, blocked, err = guardrail.CheckInjection(relayInfo.RelayFormat, newBody)
+			if err != nil {
+				return false, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+			}
+			changed = changed || injected
+		}
+		if changed && blocked == nil {
+			if err := common.ReplaceBodyStorage(c, newBody); err != nil {
+				return false, types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
+			}
+		}
+	} else if meta != nil && meta.CombineText != "" {
+		_, _, blocked = guardrail.CheckTexts(c.Request.Context(), operation_setting.GuardrailPhaseInput, []string{meta.CombineText}, false)
+	}
+
+	violations := guardrail.PhaseViolations(operation_setting.GuardrailPhaseInput)
+	if blocked != nil {
+		service.RecordGuardrailViolations(c, relayInfo, violations, blocked)
+		return false, guardrailBlockedError(blocked)
+	}
+	relayInfo.GuardrailViolations = violations
+	return changed, nil
+}
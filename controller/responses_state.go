@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	responsesInputItemsDefaultLimit = 20
+	responsesInputItemsMaxLimit     = 100
+)
+
+func responsesStateError(c *gin.Context, statusCode int, message string, param string) {
+	errType := "invalid_request_error"
+	if statusCode >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    errType,
+			Param:   param,
+		},
+	})
+}
+
+// getTokenResponsesState 读取当前令牌保存的响应，未找到时已写入错误响应
+func getTokenResponsesState(c *gin.Context) (string, *service.ResponsesState, bool) {
+	responseId := c.Param("response_id")
+	state, found, err := service.GetResponsesState(c.GetInt("token_id"), responseId)
+	if err != nil {
+		responsesStateError(c, http.StatusInternalServerError, err.Error(), "")
+		return responseId, nil, false
+	}
+	if !found {
+		responsesStateError(c, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", responseId), "response_id")
+		return responseId, nil, false
+	}
+	return responseId, state, true
+}
+
+// RetrieveResponse 返回网关保存的响应对象
+func RetrieveResponse(c *gin.Context) {
+	_, state, ok := getTokenResponsesState(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", state.Response)
+}
+
+// DeleteResponse 删除网关保存的响应，之后无法再以其 ID 续接
+func DeleteResponse(c *gin.Context) {
+	responseId := c.Param("response_id")
+	deleted, err := service.DeleteResponsesState(c.GetInt("token_id"), responseId)
+	if err != nil {
+		responsesStateError(c, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !deleted {
+		responsesStateError(c, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", responseId), "response_id")
+		return
+	}
+	c.JSON(http.StatusOK, dto.ResponsesDeleted{
+		Id:      responseId,
+		Object:  "response.deleted",
+		Deleted: true,
+	})
+}
+
+// ListResponseInputItems 分页返回响应的输入项，参数与 OpenAI 一致：limit、order、after、before
+func ListResponseInputItems(c *gin.Context) {
+	responseId, state, ok := getTokenResponsesState(c)
+	if !ok {
+		return
+	}
+
+	limit := responsesInputItemsDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > responsesInputItemsMaxLimit {
+			responsesStateError(c, http.StatusBadRequest, fmt.Sprintf("Invalid 'limit': expected an integer between 1 and %d.", responsesInputItemsMaxLimit), "limit")
+			return
+		}
+		limit = parsed
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		responsesStateError(c, http.StatusBadRequest, "Invalid 'order': expected 'asc' or 'desc'.", "order")
+		return
+	}
+
+	items, err := service.ResponsesInputItems(responseId, state)
+	if err != nil {
+		responsesStateError(c, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if order == "desc" {
+		slices.Reverse(items)
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		var meta struct {
+			ID string `json:"id"`
+		}
+		_ = common.Unmarshal(item, &meta)
+		ids[i] = meta.ID
+	}
+
+	start, end := 0, len(items)
+	if after := c.Query("after"); after != "" {
+		index := slices.Index(ids, after)
+		if index < 0 {
+			responsesStateError(c, http.StatusBadRequest, fmt.Sprintf("Item with id '%s' not found.", after), "after")
+			return
+		}
+		start = index + 1
+	}
+	if before := c.Query("before"); before != "" {
+		index := slices.Index(ids, before)
+		if index < 0 {
+			responsesStateError(c, http.StatusBadRequest, fmt.Sprintf("Item with id '%s' not found.", before), "before")
+			return
+		}
+		end = index
+	}
+	if start > end {
+		start = end
+	}
+
+	list := dto.ResponsesInputItemList{
+		Object: "list",
+		Data:   []json.RawMessage{},
+	}
+	page := items[start:end]
+	if len(page) > limit {
+		page = page[:limit]
+		list.HasMore = true
+	}
+	if len(page) > 0 {
+		list.Data = page
+		list.FirstId = ids[start]
+		list.LastId = ids[start+len(page)-1]
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -160,6 +160,7 @@ func SubscriptionEpayNotify(c *gin.Context) {
 		_, _ = c.Writer.Write([]byte("fail"))
 		return
 	}
+	service.IssueInvoiceForPaymentAsync(model.InvoiceSourceSubscription, verifyInfo.ServiceTradeNo)
 
 	_, _ = c.Writer.Write([]byte("success"))
 }
@@ -209,6 +210,7 @@ func SubscriptionEpayReturn(c *gin.Context) {
 			c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/topup?pay=fail")
 			return
 		}
+		service.IssueInvoiceForPaymentAsync(model.InvoiceSourceSubscription, verifyInfo.ServiceTradeNo)
 		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/topup?pay=success")
 		return
 	}
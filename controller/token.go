@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
@@ -305,15 +307,9 @@ func UpdateToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if token.Status == common.TokenStatusEnabled {
-		if cleanToken.Status == common.TokenStatusExpired && cleanToken.ExpiredTime <= common.GetTimestamp() && cleanToken.ExpiredTime != -1 {
-			common.ApiErrorI18n(c, i18n.MsgTokenExpiredCannotEnable)
-			return
-		}
-		if cleanToken.Status == common.TokenStatusExhausted && cleanToken.RemainQuota <= 0 && !cleanToken.UnlimitedQuota {
-			common.ApiErrorI18n(c, i18n.MsgTokenExhaustedCannotEable)
-			return
-		}
+	if msgKey := checkTokenStatusChange(cleanToken, token.Status, statusOnly != ""); msgKey != "" {
+		common.ApiErrorI18n(c, msgKey)
+		return
 	}
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
@@ -344,6 +340,28 @@ func UpdateToken(c *gin.Context) {
 	})
 }
 
+// checkTokenStatusChange 校验用户发起的令牌状态变更，不允许时返回提示的消息键。
+// status 为 0 且非仅更新状态时表示不修改状态
+func checkTokenStatusChange(current *model.Token, status int, statusOnly bool) string {
+	if !statusOnly && status == 0 {
+		return ""
+	}
+	// 被隔离的令牌只能通过轮换密钥或管理员审核解除隔离，任何状态变更都不允许，
+	// 避免先禁用再启用绕过隔离
+	if current.Status == common.TokenStatusQuarantined && status != common.TokenStatusQuarantined {
+		return i18n.MsgTokenQuarantined
+	}
+	if status == common.TokenStatusEnabled {
+		if current.Status == common.TokenStatusExpired && current.ExpiredTime <= common.GetTimestamp() && current.ExpiredTime != -1 {
+			return i18n.MsgTokenExpiredCannotEnable
+		}
+		if current.Status == common.TokenStatusExhausted && current.RemainQuota <= 0 && !current.UnlimitedQuota {
+			return i18n.MsgTokenExhaustedCannotEable
+		}
+	}
+	return ""
+}
+
 type TokenBatch struct {
 	Ids []int `json:"ids"`
 }
@@ -594,3 +612,92 @@ func AdminDeleteUserToken(c *gin.Context) {
 	})
 	return
 }
+
+type rotateTokenRequest struct {
+	// GraceMinutes 旧密钥的过渡期（分钟），为空时使用默认值，为 0 时旧密钥立即失效
+	GraceMinutes *int `json:"grace_minutes"`
+}
+
+func getRotateGraceSeconds(c *gin.Context) (int64, error) {
+	var req rotateTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+			return 0, err
+		}
+	}
+	if req.GraceMinutes != nil && *req.GraceMinutes < 0 {
+		return 0, errors.New("过渡期不能为负数")
+	}
+	return operation_setting.GetRotationGraceSeconds(req.GraceMinutes), nil
+}
+
+func rotateTokenLog(token *model.Token, operator string) string {
+	content := fmt.Sprintf("%s轮换令牌「%s」(#%d) 的密钥", operator, token.Name, token.Id)
+	if token.PreviousKeyExpiresAt > 0 {
+		content += fmt.Sprintf("，旧密钥将于 %s 失效", time.Unix(token.PreviousKeyExpiresAt, 0).Format("2006-01-02 15:04:05"))
+	} else {
+		content += "，旧密钥已立即失效"
+	}
+	return content
+}
+
+// RotateToken 为令牌生成新密钥，保留额度、模型限制、IP 白名单等设置。旧密钥在过渡期内仍然有效
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	graceSeconds, err := getRotateGraceSeconds(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	token, err := model.RotateTokenKey(id, c.GetInt("id"), graceSeconds)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(token.UserId, model.LogTypeManage, rotateTokenLog(token, ""))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    token,
+	})
+}
+
+// AdminRotateUserToken 管理员轮换用户令牌的密钥
+func AdminRotateUserToken(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid user_id",
+		})
+		return
+	}
+	tokenId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid token id",
+		})
+		return
+	}
+	graceSeconds, err := getRotateGraceSeconds(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	token, err := model.RotateTokenKey(tokenId, userId, graceSeconds)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, rotateTokenLog(token, "管理员"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    token,
+	})
+}
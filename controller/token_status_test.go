@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTokenStatusChangeKeepsQuarantine(t *testing.T) {
+	quarantined := &model.Token{Status: common.TokenStatusQuarantined, ExpiredTime: -1, RemainQuota: 100}
+
+	// Disabling a quarantined token is rejected, so disable -> enable cannot release it.
+	require.Equal(t, i18n.MsgTokenQuarantined, checkTokenStatusChange(quarantined, common.TokenStatusDisabled, true))
+	require.Equal(t, i18n.MsgTokenQuarantined, checkTokenStatusChange(quarantined, common.TokenStatusDisabled, false))
+	require.Equal(t, i18n.MsgTokenQuarantined, checkTokenStatusChange(quarantined, common.TokenStatusEnabled, true))
+	require.Equal(t, i18n.MsgTokenQuarantined, checkTokenStatusChange(quarantined, 0, true))
+
+	// Editing other fields without touching the status is still allowed.
+	require.Empty(t, checkTokenStatusChange(quarantined, 0, false))
+	require.Empty(t, checkTokenStatusChange(quarantined, common.TokenStatusQuarantined, false))
+
+	// Even if the status was changed to disabled by some other path, enabling still works as before.
+	disabled := &model.Token{Status: common.TokenStatusDisabled, ExpiredTime: -1, RemainQuota: 100}
+	require.Empty(t, checkTokenStatusChange(disabled, common.TokenStatusEnabled, true))
+}
+
+func TestCheckTokenStatusChangeExpiredAndExhausted(t *testing.T) {
+	expired := &model.Token{Status: common.TokenStatusExpired, ExpiredTime: common.GetTimestamp() - 10}
+	require.Equal(t, i18n.MsgTokenExpiredCannotEnable, checkTokenStatusChange(expired, common.TokenStatusEnabled, true))
+
+	exhausted := &model.Token{Status: common.TokenStatusExhausted, ExpiredTime: -1}
+	require.Equal(t, i18n.MsgTokenExhaustedCannotEable, checkTokenStatusChange(exhausted, common.TokenStatusEnabled, false))
+	require.Empty(t, checkTokenStatusChange(exhausted, common.TokenStatusDisabled, true))
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
@@ -196,6 +197,7 @@ func sessionCompleted(event stripe.Event) {
 		"event_type":   string(event.Type),
 	}
 	if err := model.CompleteSubscriptionOrder(referenceId, common.GetJsonString(payload)); err == nil {
+		service.IssueInvoiceForPaymentAsync(model.InvoiceSourceSubscription, referenceId)
 		return
 	} else if err != nil && !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
 		log.Println("complete subscription order failed:", err.Error(), referenceId)
@@ -207,6 +209,7 @@ func sessionCompleted(event stripe.Event) {
 		log.Println(err.Error(), referenceId)
 		return
 	}
+	service.IssueInvoiceForPaymentAsync(model.InvoiceSourceTopUp, referenceId)
 
 	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
 	currency := strings.ToUpper(event.GetObjectValue("currency"))
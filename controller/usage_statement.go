@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type usageStatementRequest struct {
+	Format         string `json:"format"`
+	UserId         int    `json:"user_id"`
+	TokenId        int    `json:"token_id"`
+	ModelName      string `json:"model_name"`
+	StartTimestamp int64  `json:"start_timestamp"`
+	EndTimestamp   int64  `json:"end_timestamp"`
+}
+
+func (req *usageStatementRequest) toQuery() model.UsageStatementQuery {
+	return model.UsageStatementQuery{
+		UserId:         req.UserId,
+		TokenId:        req.TokenId,
+		ModelName:      req.ModelName,
+		StartTimestamp: req.StartTimestamp,
+		EndTimestamp:   req.EndTimestamp,
+	}
+}
+
+func setUsageStatementAttachment(c *gin.Context, filename string, format string) {
+	contentType := "text/csv; charset=utf-8"
+	if format == model.UsageStatementFormatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// exportUsageStatement 同步导出对账单，仅用于较小的时间范围
+func exportUsageStatement(c *gin.Context, req usageStatementRequest) {
+	if req.Format == "" {
+		req.Format = model.UsageStatementFormatCSV
+	}
+	query := req.toQuery()
+	if err := service.ValidateUsageStatementRequest(query, req.Format, service.UsageStatementSyncMaxRange); err != nil {
+		common.ApiErrorMsg(c, err.Error()+"，更大的时间范围请创建异步任务")
+		return
+	}
+	lines, err := service.BuildUsageStatement(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := service.WriteUsageStatement(&buf, req.Format, lines); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	setUsageStatementAttachment(c, service.UsageStatementFileName(query, req.Format), req.Format)
+	c.Data(http.StatusOK, c.Writer.Header().Get("Content-Type"), buf.Bytes())
+}
+
+func bindUsageStatementQuery(c *gin.Context) usageStatementRequest {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return usageStatementRequest{
+		Format:         c.Query("format"),
+		UserId:         userId,
+		TokenId:        tokenId,
+		ModelName:      c.Query("model_name"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+// ExportUsageStatement 管理员导出对账单
+func ExportUsageStatement(c *gin.Context) {
+	exportUsageStatement(c, bindUsageStatementQuery(c))
+}
+
+// ExportSelfUsageStatement 用户导出自己的对账单
+func ExportSelfUsageStatement(c *gin.Context) {
+	req := bindUsageStatementQuery(c)
+	req.UserId = c.GetInt("id")
+	exportUsageStatement(c, req)
+}
+
+func createUsageStatementJob(c *gin.Context, isAdmin bool) {
+	var req usageStatementRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	creatorId := c.GetInt("id")
+	if !isAdmin {
+		req.UserId = creatorId
+		count, err := model.CountActiveUsageStatementJobs(creatorId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if count > 0 {
+			common.ApiErrorMsg(c, "已有正在生成的对账单，请稍后再试")
+			return
+		}
+	}
+	if req.Format == "" {
+		req.Format = model.UsageStatementFormatCSV
+	}
+	query := req.toQuery()
+	if err := service.ValidateUsageStatementRequest(query, req.Format, service.UsageStatementJobMaxRange); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	job, err := service.CreateUsageStatementJob(creatorId, query, req.Format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, job)
+}
+
+// CreateUsageStatementJob 管理员创建异步对账单任务
+func CreateUsageStatementJob(c *gin.Context) {
+	createUsageStatementJob(c, true)
+}
+
+// CreateSelfUsageStatementJob 用户创建自己的异步对账单任务
+func CreateSelfUsageStatementJob(c *gin.Context) {
+	createUsageStatementJob(c, false)
+}
+
+// GetUsageStatementJobs 管理员查看所有对账单任务
+func GetUsageStatementJobs(c *gin.Context) {
+	getUsageStatementJobs(c, 0)
+}
+
+// GetSelfUsageStatementJobs 用户查看自己的对账单任务
+func GetSelfUsageStatementJobs(c *gin.Context) {
+	getUsageStatementJobs(c, c.GetInt("id"))
+}
+
+func getUsageStatementJobs(c *gin.Context, creatorId int) {
+	pageInfo := common.GetPageQuery(c)
+	jobs, total, err := model.GetUsageStatementJobs(creatorId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(jobs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// DownloadUsageStatementJob 管理员下载对账单
+func DownloadUsageStatementJob(c *gin.Context) {
+	downloadUsageStatementJob(c, 0)
+}
+
+// DownloadSelfUsageStatementJob 用户下载自己的对账单
+func DownloadSelfUsageStatementJob(c *gin.Context) {
+	downloadUsageStatementJob(c, c.GetInt("id"))
+}
+
+func downloadUsageStatementJob(c *gin.Context, creatorId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	job, err := model.GetUsageStatementJobById(id)
+	if err != nil || (creatorId != 0 && job.CreatorId != creatorId) {
+		common.ApiErrorMsg(c, "对账单不存在")
+		return
+	}
+	file, err := service.OpenUsageStatementFile(job)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	defer file.Close()
+	query := model.UsageStatementQuery{
+		UserId:         job.UserId,
+		TokenId:        job.TokenId,
+		StartTimestamp: job.StartTimestamp,
+		EndTimestamp:   job.EndTimestamp,
+	}
+	setUsageStatementAttachment(c, service.UsageStatementFileName(query, job.Format), job.Format)
+	c.DataFromReader(http.StatusOK, job.Size, c.Writer.Header().Get("Content-Type"), file, nil)
+}
@@ -381,6 +381,13 @@ func GetSelf(c *gin.Context) {
 
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
+	// webhook 密钥加密保存，返回解密后的设置
+	settingStr := user.Setting
+	if userSetting.WebhookSecret != "" {
+		if settingBytes, err := common.Marshal(userSetting); err == nil {
+			settingStr = string(settingBytes)
+		}
+	}
 
 	// 构建响应数据，包含用户信息和权限
 	responseData := map[string]interface{}{
@@ -405,7 +412,7 @@ func GetSelf(c *gin.Context) {
 		"aff_history_quota": user.AffHistoryQuota,
 		"inviter_id":        user.InviterId,
 		"linux_do_id":       user.LinuxDOId,
-		"setting":           user.Setting,
+		"setting":           settingStr,
 		"stripe_customer":   user.StripeCustomer,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
@@ -1166,6 +1173,8 @@ type UpdateUserSettingRequest struct {
 	UpstreamModelUpdateNotifyEnabled *bool   `json:"upstream_model_update_notify_enabled,omitempty"`
 	AcceptUnsetModelRatioModel       bool    `json:"accept_unset_model_ratio_model"`
 	RecordIpLog                      bool    `json:"record_ip_log"`
+
+	SpendAlert *dto.SpendAlertRules `json:"spend_alert,omitempty"`
 }
 
 func UpdateUserSetting(c *gin.Context) {
@@ -1249,6 +1258,14 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 验证消费告警规则
+	if req.SpendAlert != nil {
+		if req.SpendAlert.DailyQuota < 0 || req.SpendAlert.SingleRequestQuota < 0 || req.SpendAlert.HourlySpikeRatio < 0 {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+	}
+
 	userId := c.GetInt("id")
 	user, err := model.GetUserById(userId, true)
 	if err != nil {
@@ -1268,6 +1285,10 @@ func UpdateUserSetting(c *gin.Context) {
 		UpstreamModelUpdateNotifyEnabled: upstreamModelUpdateNotifyEnabled,
 		AcceptUnsetRatioModel:            req.AcceptUnsetModelRatioModel,
 		RecordIpLog:                      req.RecordIpLog,
+		SpendAlert:                       existingSettings.SpendAlert,
+	}
+	if req.SpendAlert != nil {
+		settings.SpendAlert = req.SpendAlert
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/secretref"
 	"github.com/QuantumNous/new-api/relay"
 )
 
@@ -166,7 +167,10 @@ func getVertexVideoURL(channel *model.Channel, task *model.Task) (string, error)
 		return "", fmt.Errorf("vertex task adaptor not found")
 	}
 
-	key := getVertexTaskKey(channel, task)
+	key, err := secretref.Resolve(getVertexTaskKey(channel, task))
+	if err != nil {
+		return "", err
+	}
 	if key == "" {
 		return "", fmt.Errorf("vertex key not available for task")
 	}
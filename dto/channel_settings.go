@@ -40,6 +40,10 @@ type ChannelOtherSettings struct {
 	UpstreamModelUpdateLastDetectedModels []string      `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
 	UpstreamModelUpdateLastRemovedModels  []string      `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
 	UpstreamModelUpdateIgnoredModels      []string      `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+	RealtimeBridgeTranscriptionModel      string        `json:"realtime_bridge_transcription_model,omitempty"`        // 实时桥接：语音转写模型
+	RealtimeBridgeChatModel               string        `json:"realtime_bridge_chat_model,omitempty"`                 // 实时桥接：对话模型
+	RealtimeBridgeSpeechModel             string        `json:"realtime_bridge_speech_model,omitempty"`               // 实时桥接：语音合成模型，为空时仅输出文本
+	RealtimeBridgeVoice                   string        `json:"realtime_bridge_voice,omitempty"`                      // 实时桥接：固定使用的音色，为空时使用会话指定的音色
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
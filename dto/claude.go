@@ -28,6 +28,8 @@ type ClaudeMediaMessage struct {
 	Signature    string               `json:"signature,omitempty"`
 	Delta        string               `json:"delta,omitempty"`
 	CacheControl json.RawMessage      `json:"cache_control,omitempty"`
+	// Title document 内容块的标题
+	Title string `json:"title,omitempty"`
 	// tool_calls
 	Id        string `json:"id,omitempty"`
 	Name      string `json:"name,omitempty"`
@@ -218,6 +220,35 @@ type ClaudeRequest struct {
 	ServiceTier string `json:"service_tier,omitempty"`
 }
 
+// ClaudeCountTokensRequest count_tokens 接口仅接受以下字段
+type ClaudeCountTokensRequest struct {
+	Model      string          `json:"model"`
+	System     any             `json:"system,omitempty"`
+	Messages   []ClaudeMessage `json:"messages"`
+	Tools      any             `json:"tools,omitempty"`
+	ToolChoice any             `json:"tool_choice,omitempty"`
+	Thinking   *Thinking       `json:"thinking,omitempty"`
+	McpServers json.RawMessage `json:"mcp_servers,omitempty"`
+}
+
+// ClaudeCountTokensResponse count_tokens 响应
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// NewClaudeCountTokensRequest 从 messages 请求中提取 count_tokens 所需字段
+func NewClaudeCountTokensRequest(request *ClaudeRequest, model string) *ClaudeCountTokensRequest {
+	return &ClaudeCountTokensRequest{
+		Model:      model,
+		System:     request.System,
+		Messages:   request.Messages,
+		Tools:      request.Tools,
+		ToolChoice: request.ToolChoice,
+		Thinking:   request.Thinking,
+		McpServers: request.McpServers,
+	}
+}
+
 // OutputConfigForEffort just for extract effort
 type OutputConfigForEffort struct {
 	Effort string `json:"effort,omitempty"`
@@ -235,6 +235,8 @@ func (g *GeminiInlineData) UnmarshalJSON(data []byte) error {
 }
 
 type FunctionCall struct {
+	// ID 客户端用于关联 functionResponse 的调用 ID，可选
+	ID           string `json:"id,omitempty"`
 	FunctionName string `json:"name"`
 	Arguments    any    `json:"args"`
 }
@@ -444,6 +446,7 @@ type GeminiChatCandidate struct {
 type GeminiChatSafetyRating struct {
 	Category    string `json:"category"`
 	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
 }
 
 type GeminiChatPromptFeedback struct {
@@ -455,6 +458,8 @@ type GeminiChatResponse struct {
 	Candidates     []GeminiChatCandidate     `json:"candidates"`
 	PromptFeedback *GeminiChatPromptFeedback `json:"promptFeedback,omitempty"`
 	UsageMetadata  GeminiUsageMetadata       `json:"usageMetadata"`
+	ModelVersion   string                    `json:"modelVersion,omitempty"`
+	ResponseId     string                    `json:"responseId,omitempty"`
 }
 
 type GeminiUsageMetadata struct {
@@ -534,6 +539,17 @@ func (r *GeminiEmbeddingRequest) SetModelName(modelName string) {
 	}
 }
 
+// GeminiCountTokensRequest countTokens 请求，contents 与 generateContentRequest 二选一
+type GeminiCountTokensRequest struct {
+	Contents               []GeminiChatContent `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiChatRequest  `json:"generateContentRequest,omitempty"`
+}
+
+// GeminiCountTokensResponse countTokens 响应
+type GeminiCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
 type GeminiBatchEmbeddingRequest struct {
 	Requests []*GeminiEmbeddingRequest `json:"requests"`
 }
@@ -13,6 +13,9 @@ const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypePostpaid      = "postpaid"
+	NotifyTypeSpendAlert    = "spend_alert"
+	NotifyTypeTokenAnomaly  = "token_anomaly"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
@@ -518,6 +518,12 @@ func (m *Message) ParseContent() []MediaContent {
 		return contentList
 	}
 
+	// 通过 SetMediaContent 设置后被复制到新消息时，内容仍是 []MediaContent
+	if mediaContents, ok := m.Content.([]MediaContent); ok {
+		m.parsedContent = mediaContents
+		return mediaContents
+	}
+
 	// 尝试解析为数组
 	//var arrayContent []map[string]interface{}
 
@@ -31,9 +31,16 @@ type TextResponse struct {
 }
 
 type OpenAITextResponseChoice struct {
-	Index        int `json:"index"`
-	Message      `json:"message"`
-	FinishReason string `json:"finish_reason"`
+	Index                int `json:"index"`
+	Message              `json:"message"`
+	FinishReason         string                         `json:"finish_reason"`
+	ContentFilterResults map[string]ContentFilterResult `json:"content_filter_results,omitempty"`
+}
+
+// ContentFilterResult Azure OpenAI 返回的单个类别内容过滤结果
+type ContentFilterResult struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity,omitempty"`
 }
 
 type OpenAITextResponse struct {
@@ -78,10 +85,11 @@ type FlexibleEmbeddingResponse struct {
 }
 
 type ChatCompletionsStreamResponseChoice struct {
-	Delta        ChatCompletionsStreamResponseChoiceDelta `json:"delta,omitempty"`
-	Logprobs     *any                                     `json:"logprobs"`
-	FinishReason *string                                  `json:"finish_reason"`
-	Index        int                                      `json:"index"`
+	Delta                ChatCompletionsStreamResponseChoiceDelta `json:"delta,omitempty"`
+	Logprobs             *any                                     `json:"logprobs"`
+	FinishReason         *string                                  `json:"finish_reason"`
+	Index                int                                      `json:"index"`
+	ContentFilterResults map[string]ContentFilterResult           `json:"content_filter_results,omitempty"`
 }
 
 type ChatCompletionsStreamResponseChoiceDelta struct {
@@ -230,6 +238,8 @@ type Usage struct {
 	InputTokens            int                `json:"input_tokens"`
 	OutputTokens           int                `json:"output_tokens"`
 	InputTokensDetails     *InputTokenDetails `json:"input_tokens_details"`
+	// OutputTokensDetails Responses API 的输出用量明细
+	OutputTokensDetails *OutputTokenDetails `json:"output_tokens_details,omitempty"`
 
 	// claude cache 1h
 	ClaudeCacheCreation5mTokens int `json:"claude_cache_creation_5_m_tokens"`
@@ -263,6 +273,22 @@ type OutputTokenDetails struct {
 	ReasoningTokens int `json:"reasoning_tokens"`
 }
 
+// ResponsesInputItemList GET /v1/responses/{id}/input_items 的响应
+type ResponsesInputItemList struct {
+	Object  string            `json:"object"`
+	Data    []json.RawMessage `json:"data"`
+	FirstId string            `json:"first_id,omitempty"`
+	LastId  string            `json:"last_id,omitempty"`
+	HasMore bool              `json:"has_more"`
+}
+
+// ResponsesDeleted DELETE /v1/responses/{id} 的响应
+type ResponsesDeleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
 type OpenAIResponsesResponse struct {
 	ID                 string             `json:"id"`
 	Object             string             `json:"object"`
@@ -331,19 +357,22 @@ func (o *OpenAIResponsesResponse) GetSize() string {
 
 type IncompleteDetails struct {
 	Reasoning string `json:"reasoning"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 type ResponsesOutput struct {
 	Type      string                   `json:"type"`
 	ID        string                   `json:"id"`
-	Status    string                   `json:"status"`
-	Role      string                   `json:"role"`
-	Content   []ResponsesOutputContent `json:"content"`
-	Quality   string                   `json:"quality"`
-	Size      string                   `json:"size"`
+	Status    string                   `json:"status,omitempty"`
+	Role      string                   `json:"role,omitempty"`
+	Content   []ResponsesOutputContent `json:"content,omitempty"`
+	Quality   string                   `json:"quality,omitempty"`
+	Size      string                   `json:"size,omitempty"`
 	CallId    string                   `json:"call_id,omitempty"`
 	Name      string                   `json:"name,omitempty"`
 	Arguments string                   `json:"arguments,omitempty"`
+	// Summary reasoning 输出项的推理摘要
+	Summary []ResponsesReasoningSummaryPart `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -384,6 +413,12 @@ type ResponsesStreamResponse struct {
 	SummaryIndex *int                           `json:"summary_index,omitempty"`
 	ItemID       string                         `json:"item_id,omitempty"`
 	Part         *ResponsesReasoningSummaryPart `json:"part,omitempty"`
+	// - response.output_text.done
+	// - response.reasoning_summary_text.done
+	Text      string `json:"text,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// SequenceNumber 网关合成事件时填写的事件序号
+	SequenceNumber int `json:"sequence_number"`
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -21,6 +21,33 @@ const (
 	RealtimeEventConversationItemCreated            = "conversation.item.created"
 )
 
+const (
+	RealtimeEventInputAudioBufferCommit   = "input_audio_buffer.commit"
+	RealtimeEventInputAudioBufferClear    = "input_audio_buffer.clear"
+	RealtimeEventConversationItemDelete   = "conversation.item.delete"
+	RealtimeEventConversationItemTruncate = "conversation.item.truncate"
+	RealtimeEventTypeResponseCancel       = "response.cancel"
+
+	RealtimeEventInputAudioBufferCommitted     = "input_audio_buffer.committed"
+	RealtimeEventInputAudioBufferCleared       = "input_audio_buffer.cleared"
+	RealtimeEventInputAudioBufferSpeechStarted = "input_audio_buffer.speech_started"
+	RealtimeEventInputAudioBufferSpeechStopped = "input_audio_buffer.speech_stopped"
+	RealtimeEventConversationItemDeleted       = "conversation.item.deleted"
+	RealtimeEventConversationItemTruncated     = "conversation.item.truncated"
+	RealtimeEventTranscriptionDelta            = "conversation.item.input_audio_transcription.delta"
+	RealtimeEventTranscriptionCompleted        = "conversation.item.input_audio_transcription.completed"
+	RealtimeEventTranscriptionFailed           = "conversation.item.input_audio_transcription.failed"
+	RealtimeEventTypeResponseCreated           = "response.created"
+	RealtimeEventResponseOutputItemAdded       = "response.output_item.added"
+	RealtimeEventResponseOutputItemDone        = "response.output_item.done"
+	RealtimeEventResponseContentPartAdded      = "response.content_part.added"
+	RealtimeEventResponseContentPartDone       = "response.content_part.done"
+	RealtimeEventResponseTextDelta             = "response.text.delta"
+	RealtimeEventResponseTextDone              = "response.text.done"
+	RealtimeEventResponseAudioDone             = "response.audio.done"
+	RealtimeEventResponseAudioTranscriptDone   = "response.audio_transcript.done"
+)
+
 type RealtimeEvent struct {
 	EventId string `json:"event_id"`
 	Type    string `json:"type"`
@@ -31,10 +58,32 @@ type RealtimeEvent struct {
 	Response *RealtimeResponse  `json:"response,omitempty"`
 	Delta    string             `json:"delta,omitempty"`
 	Audio    string             `json:"audio,omitempty"`
+
+	PreviousItemId string           `json:"previous_item_id,omitempty"`
+	ItemId         string           `json:"item_id,omitempty"`
+	ResponseId     string           `json:"response_id,omitempty"`
+	OutputIndex    *int             `json:"output_index,omitempty"`
+	ContentIndex   *int             `json:"content_index,omitempty"`
+	Part           *RealtimeContent `json:"part,omitempty"`
+	CallId         string           `json:"call_id,omitempty"`
+	Name           string           `json:"name,omitempty"`
+	Arguments      string           `json:"arguments,omitempty"`
+	Transcript     string           `json:"transcript,omitempty"`
+	Text           string           `json:"text,omitempty"`
+	AudioStartMs   *int             `json:"audio_start_ms,omitempty"`
+	AudioEndMs     *int             `json:"audio_end_ms,omitempty"`
 }
 
 type RealtimeResponse struct {
-	Usage *RealtimeUsage `json:"usage"`
+	Id            string         `json:"id,omitempty"`
+	Object        string         `json:"object,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	StatusDetails any            `json:"status_details,omitempty"`
+	Output        []RealtimeItem `json:"output,omitempty"`
+	// Modalities 与 Instructions 仅出现在客户端的 response.create 中，用于覆盖本次响应的会话配置
+	Modalities   []string       `json:"modalities,omitempty"`
+	Instructions string         `json:"instructions,omitempty"`
+	Usage        *RealtimeUsage `json:"usage"`
 }
 
 type RealtimeUsage struct {
@@ -46,6 +95,9 @@ type RealtimeUsage struct {
 }
 
 type RealtimeSession struct {
+	Id                      string                  `json:"id,omitempty"`
+	Object                  string                  `json:"object,omitempty"`
+	Model                   string                  `json:"model,omitempty"`
 	Modalities              []string                `json:"modalities"`
 	Instructions            string                  `json:"instructions"`
 	Voice                   string                  `json:"voice"`
@@ -79,6 +131,8 @@ type RealtimeItem struct {
 	Name      *string           `json:"name,omitempty"`
 	ToolCalls any               `json:"tool_calls,omitempty"`
 	CallId    string            `json:"call_id,omitempty"`
+	Arguments string            `json:"arguments,omitempty"`
+	Output    string            `json:"output,omitempty"`
 }
 type RealtimeContent struct {
 	Type       string `json:"type"`
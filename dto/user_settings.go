@@ -16,6 +16,17 @@ type UserSetting struct {
 	SidebarModules                   string  `json:"sidebar_modules,omitempty"`                      // SidebarModules 左侧边栏模块配置
 	BillingPreference                string  `json:"billing_preference,omitempty"`                   // BillingPreference 扣费策略（订阅/钱包）
 	Language                         string  `json:"language,omitempty"`                             // Language 用户语言偏好 (zh, en)
+
+	// SpendAlert 消费告警规则，为空表示不启用
+	SpendAlert *SpendAlertRules `json:"spend_alert,omitempty"`
+}
+
+// SpendAlertRules 消费告警规则，阈值为 0 时表示不启用对应规则
+type SpendAlertRules struct {
+	DailyQuota         int     `json:"daily_quota,omitempty"`          // DailyQuota 当日消费超过该额度时告警
+	HourlySpikeRatio   float64 `json:"hourly_spike_ratio,omitempty"`   // HourlySpikeRatio 当前小时消费超过过去 24 小时均值的倍数时告警
+	SingleRequestQuota int     `json:"single_request_quota,omitempty"` // SingleRequestQuota 单次请求消费超过该额度时告警
+	NewModel           bool    `json:"new_model,omitempty"`            // NewModel 首次使用某个模型时告警
 }
 
 var (
@@ -36,6 +36,7 @@ const (
 	MsgTokenGetInfoFailed        = "token.get_info_failed"
 	MsgTokenExpiredCannotEnable  = "token.expired_cannot_enable"
 	MsgTokenExhaustedCannotEable = "token.exhausted_cannot_enable"
+	MsgTokenQuarantined          = "token.quarantined_cannot_enable"
 	MsgTokenInvalid              = "token.invalid"
 	MsgTokenNotProvided          = "token.not_provided"
 	MsgTokenExpired              = "token.expired"
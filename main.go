@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -58,6 +62,7 @@ func main() {
 	}
 
 	defer func() {
+		service.FlushLogExport()
 		err := model.CloseDB()
 		if err != nil {
 			common.FatalLog("failed to close database: " + err.Error())
@@ -112,6 +117,18 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Payload capture retention cleanup
+	service.StartPayloadCaptureCleanupTask()
+
+	// Streaming log export to external sinks
+	service.StartLogExportTask()
+
+	// Postpaid period settlement and dunning
+	service.StartPostpaidSettlementTask()
+
+	// Token usage profiles for leaked-key detection
+	service.StartTokenAnomalyTask()
+
 	// Wire task polling adaptor factory (breaks service -> relay import cycle)
 	service.GetTaskAdaptorFunc = func(platform constant.TaskPlatform) service.TaskPollingAdaptor {
 		a := relay.GetTaskAdaptor(platform)
@@ -192,9 +209,21 @@ func main() {
 	// Log startup success message
 	common.LogStartupSuccess(startTime, port)
 
-	err = server.Run(":" + port)
-	if err != nil {
-		common.FatalLog("failed to start HTTP server: " + err.Error())
+	// 收到 SIGINT/SIGTERM 后优雅退出，确保上面 defer 中的日志导出与日志写入缓冲能够落盘
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	httpServer := &http.Server{Addr: ":" + port, Handler: server}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			common.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+	<-ctx.Done()
+	common.SysLog("shutting down HTTP server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		common.SysError("failed to shut down HTTP server gracefully: " + err.Error())
 	}
 }
 
@@ -268,6 +297,14 @@ func InitResources() error {
 		return err
 	}
 
+	// 加密存量敏感字段后退出
+	if *common.MigrateSecrets {
+		if err := model.MigrateSecrets(); err != nil {
+			common.FatalLog("failed to migrate secrets: " + err.Error())
+		}
+		os.Exit(0)
+	}
+
 	model.CheckSetup()
 
 	// Initialize options, should after model.InitDB()
@@ -285,6 +322,12 @@ func InitResources() error {
 		return err
 	}
 
+	// Initialize log sink
+	err = model.InitLogSink()
+	if err != nil {
+		return err
+	}
+
 	// Initialize Redis
 	err = common.InitRedisClient()
 	if err != nil {
@@ -238,6 +238,18 @@ func TokenAuthReadOnly() func(c *gin.Context) {
 			return
 		}
 
+		if token.IsPreviousKey(key) {
+			if token.PreviousKeyExpiresAt <= common.GetTimestamp() {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"message": "无效的令牌",
+				})
+				c.Abort()
+				return
+			}
+			model.RecordPreviousTokenKeyUse(token, c.ClientIP())
+		}
+
 		c.Set("id", token.UserId)
 		c.Set("token_id", token.Id)
 		c.Set("token_key", token.Key)
@@ -365,6 +377,10 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		if token.IsPreviousKey(key) {
+			model.RecordPreviousTokenKeyUse(token, c.ClientIP())
+		}
+		service.ObserveTokenRequest(token, c.ClientIP())
 		c.Next()
 	}
 }
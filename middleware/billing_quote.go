@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BillingQuotePrefix 报价接口前缀，其后拼接实际的 relay 路径，例如 /v1/billing/quote/v1/chat/completions
+const BillingQuotePrefix = "/v1/billing/quote"
+
+// BillingQuoteRequestConvert 将报价请求路径还原为 relay 路径，使鉴权、渠道选择与请求解析按原接口处理
+func BillingQuoteRequestConvert() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		path := strings.TrimPrefix(c.Request.URL.Path, BillingQuotePrefix)
+		if path == "" || path == "/" || !strings.HasPrefix(path, "/") {
+			abortWithOpenAiMessage(c, http.StatusNotFound, "relay path is required, e.g. "+BillingQuotePrefix+"/v1/chat/completions")
+			return
+		}
+		c.Request.URL.Path = path
+		c.Request.URL.RawPath = ""
+		c.Next()
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/service"
+	"github.com/gin-gonic/gin"
+)
+
+// PayloadCapture 按载荷抓取配置记录入站请求、上游请求与最终响应，用于排查问题
+// 需要放在 TokenAuth 之后，以便按用户/令牌判断是否抓取
+func PayloadCapture() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := service.StartPayloadCapture(c)
+		if session == nil {
+			c.Next()
+			return
+		}
+		c.Next()
+		service.FinishPayloadCapture(c, session)
+	}
+}
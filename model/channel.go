@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/secretref"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/samber/lo"
@@ -22,6 +23,7 @@ type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
 	Key                string  `json:"key" gorm:"not null"`
+	KeyDigest          string  `json:"-" gorm:"type:varchar(64);index"` // 密钥的 HMAC 摘要，密钥加密保存后用于按密钥搜索
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -102,7 +104,51 @@ func (channel *Channel) GetKeys() []string {
 	return keys
 }
 
+// GetNextEnabledKey 选取下一个可用的 key，并将外部密钥引用（env://、file://、vault://）解析为实际密钥
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	key, index, newAPIError := channel.selectEnabledKey()
+	if newAPIError != nil {
+		return key, index, newAPIError
+	}
+	resolved, err := secretref.Resolve(key)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to resolve key of channel %d: %s", channel.Id, err.Error()))
+		return "", index, types.NewError(err, types.ErrorCodeGetChannelFailed)
+	}
+	return resolved, index, nil
+}
+
+// GetResolvedKey 返回解析外部密钥引用后的完整密钥，多行密钥逐行解析。
+// 余额查询、模型列表等不经过 GetNextEnabledKey 的路径都需通过该方法取得实际密钥
+func (channel *Channel) GetResolvedKey() (string, error) {
+	if !strings.Contains(channel.Key, "://") {
+		return channel.Key, nil
+	}
+	lines := strings.Split(channel.Key, "\n")
+	for i, line := range lines {
+		if !secretref.IsReference(strings.TrimSpace(line)) {
+			continue
+		}
+		resolved, err := secretref.Resolve(line)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve key of channel %d: %w", channel.Id, err)
+		}
+		lines[i] = resolved
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// GetFirstResolvedKey 返回第一个密钥，外部密钥引用已解析
+func (channel *Channel) GetFirstResolvedKey() (string, error) {
+	key := strings.Split(channel.Key, "\n")[0]
+	resolved, err := secretref.Resolve(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve key of channel %d: %w", channel.Id, err)
+	}
+	return resolved, nil
+}
+
+func (channel *Channel) selectEnabledKey() (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -289,6 +335,15 @@ func GetChannelsByTag(tag string, idSort bool, selectAll bool) ([]*Channel, erro
 	return channels, err
 }
 
+// channelKeySearchCondition 返回按密钥精确搜索时使用的列与参数。密钥加密保存时密文每次不同，
+// 改为比较 HMAC 摘要
+func channelKeySearchCondition(keyword string) (string, string) {
+	if common.SecretEncryptionEnabled() {
+		return "key_digest", common.SecretLookupDigest(keyword)
+	}
+	return commonKeyCol, keyword
+}
+
 func SearchChannels(keyword string, group string, model string, idSort bool) ([]*Channel, error) {
 	var channels []*Channel
 	modelsCol := "`models`"
@@ -313,6 +368,7 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
+	keyCol, keyArg := channelKeySearchCondition(keyword)
 	var whereClause string
 	var args []interface{}
 	if group != "" && group != "null" {
@@ -323,11 +379,11 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + commonGroupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
+		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyArg, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
+		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyArg, "%"+keyword+"%", "%"+model+"%")
 	}
 
 	// 执行查询
@@ -581,6 +637,13 @@ func handlerMultiKeyUpdate(channel *Channel, usingKey string, status int, reason
 				keyIndex = i
 				break
 			}
+			// usingKey 为解析后的密钥，外部引用需解析后比较
+			if secretref.IsReference(key) {
+				if resolved, err := secretref.Resolve(key); err == nil && resolved == usingKey {
+					keyIndex = i
+					break
+				}
+			}
 		}
 		if channel.ChannelInfo.MultiKeyStatusList == nil {
 			channel.ChannelInfo.MultiKeyStatusList = make(map[int]int)
@@ -808,6 +871,7 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
+	keyCol, keyArg := channelKeySearchCondition(keyword)
 	var whereClause string
 	var args []interface{}
 	if group != "" && group != "null" {
@@ -818,11 +882,11 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + commonGroupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
+		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyArg, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
+		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
+		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyArg, "%"+keyword+"%", "%"+model+"%")
 	}
 
 	subQuery := baseQuery.Where(whereClause, args...).
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	InvoiceTypeInvoice    = "invoice"
+	InvoiceTypeCreditNote = "credit_note"
+
+	InvoiceSourceTopUp        = "topup"
+	InvoiceSourceSubscription = "subscription"
+)
+
+var ErrInvoiceCreditExceeded = errors.New("退款金额超过发票可冲红金额")
+
+// InvoiceParty 发票上的销售方或购买方信息
+type InvoiceParty struct {
+	Name    string `json:"name"`
+	Company string `json:"company,omitempty"`
+	TaxId   string `json:"tax_id,omitempty"`
+	Address string `json:"address,omitempty"`
+	Country string `json:"country,omitempty"`
+	Email   string `json:"email,omitempty"`
+}
+
+// Invoice 发票或红字发票（退款凭证），编号按类型与年份连续递增
+type Invoice struct {
+	Id     int    `json:"id"`
+	Number string `json:"number" gorm:"type:varchar(64);uniqueIndex"`
+	Type   string `json:"type" gorm:"type:varchar(16);index"`
+	UserId int    `json:"user_id" gorm:"index"`
+	// SourceKey 保证同一订单只开具一张发票
+	SourceKey        string  `json:"-" gorm:"type:varchar(300);uniqueIndex"`
+	SourceType       string  `json:"source_type" gorm:"type:varchar(32)"`
+	TradeNo          string  `json:"trade_no" gorm:"type:varchar(255);index"`
+	PaymentMethod    string  `json:"payment_method" gorm:"type:varchar(50)"`
+	RelatedInvoiceId int     `json:"related_invoice_id" gorm:"index"`
+	Currency         string  `json:"currency" gorm:"type:varchar(8)"`
+	Subtotal         float64 `json:"subtotal"`
+	TaxName          string  `json:"tax_name" gorm:"type:varchar(32)"`
+	TaxRate          float64 `json:"tax_rate"`
+	TaxAmount        float64 `json:"tax_amount"`
+	Total            float64 `json:"total"`
+	Description      string  `json:"description" gorm:"type:varchar(255)"`
+	Reason           string  `json:"reason" gorm:"type:text"`
+	Seller           string  `json:"seller" gorm:"type:text"`
+	Buyer            string  `json:"buyer" gorm:"type:text"`
+	IssuedAt         int64   `json:"issued_at" gorm:"bigint;index"`
+}
+
+// InvoiceSequence 发票编号计数器
+type InvoiceSequence struct {
+	Name  string `gorm:"primaryKey;type:varchar(64)"`
+	Value int64
+}
+
+// UserBillingProfile 用户开票信息
+type UserBillingProfile struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"uniqueIndex"`
+	Name      string `json:"name" gorm:"type:varchar(128)"`
+	Company   string `json:"company" gorm:"type:varchar(255)"`
+	TaxId     string `json:"tax_id" gorm:"type:varchar(64)"`
+	Address   string `json:"address" gorm:"type:varchar(512)"`
+	Country   string `json:"country" gorm:"type:varchar(64)"`
+	Email     string `json:"email" gorm:"type:varchar(255)"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// GetUserBillingProfile 获取用户开票信息，不存在时返回空信息
+func GetUserBillingProfile(userId int) (*UserBillingProfile, error) {
+	profile := &UserBillingProfile{UserId: userId}
+	err := DB.Where("user_id = ?", userId).First(profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return profile, nil
+	}
+	return profile, err
+}
+
+// Save 保存用户开票信息
+func (profile *UserBillingProfile) Save() error {
+	profile.UpdatedAt = common.GetTimestamp()
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "company", "tax_id", "address", "country", "email", "updated_at"}),
+	}).Create(profile).Error
+}
+
+// ToParty 转换为发票购买方信息
+func (profile *UserBillingProfile) ToParty() InvoiceParty {
+	return InvoiceParty{
+		Name:    profile.Name,
+		Company: profile.Company,
+		TaxId:   profile.TaxId,
+		Address: profile.Address,
+		Country: profile.Country,
+		Email:   profile.Email,
+	}
+}
+
+func (invoice *Invoice) GetSeller() InvoiceParty {
+	var party InvoiceParty
+	_ = common.UnmarshalJsonStr(invoice.Seller, &party)
+	return party
+}
+
+func (invoice *Invoice) GetBuyer() InvoiceParty {
+	var party InvoiceParty
+	_ = common.UnmarshalJsonStr(invoice.Buyer, &party)
+	return party
+}
+
+// nextInvoiceSequenceTx 在事务内递增计数器，UPDATE 持有行锁直到事务结束，保证编号连续且不重复
+func nextInvoiceSequenceTx(tx *gorm.DB, name string) (int64, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&InvoiceSequence{Name: name}).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Model(&InvoiceSequence{}).Where("name = ?", name).Update("value", gorm.Expr("value + 1")).Error; err != nil {
+		return 0, err
+	}
+	var seq InvoiceSequence
+	if err := tx.Where("name = ?", name).First(&seq).Error; err != nil {
+		return 0, err
+	}
+	return seq.Value, nil
+}
+
+// IssueInvoiceParams 开票参数，金额已按税率拆分
+type IssueInvoiceParams struct {
+	Type             string
+	Prefix           string
+	UserId           int
+	SourceType       string
+	TradeNo          string
+	PaymentMethod    string
+	RelatedInvoiceId int
+	Currency         string
+	Subtotal         float64
+	TaxName          string
+	TaxRate          float64
+	TaxAmount        float64
+	Total            float64
+	Description      string
+	Reason           string
+	Seller           InvoiceParty
+	Buyer            InvoiceParty
+}
+
+// IssueInvoice 开具发票。同一订单重复开票时返回已有发票；红字发票校验累计金额不超过原发票
+func IssueInvoice(params IssueInvoiceParams) (*Invoice, error) {
+	invoice := &Invoice{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		sourceKey := ""
+		if params.Type == InvoiceTypeInvoice {
+			sourceKey = fmt.Sprintf("%s:%s", params.SourceType, params.TradeNo)
+			err := tx.Where("source_key = ?", sourceKey).First(invoice).Error
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		now := time.Now()
+		seq, err := nextInvoiceSequenceTx(tx, fmt.Sprintf("%s-%d", params.Type, now.Year()))
+		if err != nil {
+			return err
+		}
+
+		if params.Type == InvoiceTypeCreditNote {
+			var original Invoice
+			if err := tx.Where("id = ? and type = ?", params.RelatedInvoiceId, InvoiceTypeInvoice).First(&original).Error; err != nil {
+				return errors.New("原发票不存在")
+			}
+			var credited float64
+			if err := tx.Model(&Invoice{}).Where("related_invoice_id = ? and type = ?", original.Id, InvoiceTypeCreditNote).
+				Select("coalesce(sum(total), 0)").Scan(&credited).Error; err != nil {
+				return err
+			}
+			remaining := decimal.NewFromFloat(original.Total).Sub(decimal.NewFromFloat(credited))
+			if decimal.NewFromFloat(params.Total).GreaterThan(remaining) {
+				return ErrInvoiceCreditExceeded
+			}
+		}
+
+		number := fmt.Sprintf("%s%d-%06d", params.Prefix, now.Year(), seq)
+		if sourceKey == "" {
+			sourceKey = fmt.Sprintf("%s:%s", params.Type, number)
+		}
+		*invoice = Invoice{
+			Number:           number,
+			Type:             params.Type,
+			UserId:           params.UserId,
+			SourceKey:        sourceKey,
+			SourceType:       params.SourceType,
+			TradeNo:          params.TradeNo,
+			PaymentMethod:    params.PaymentMethod,
+			RelatedInvoiceId: params.RelatedInvoiceId,
+			Currency:         params.Currency,
+			Subtotal:         params.Subtotal,
+			TaxName:          params.TaxName,
+			TaxRate:          params.TaxRate,
+			TaxAmount:        params.TaxAmount,
+			Total:            params.Total,
+			Description:      params.Description,
+			Reason:           params.Reason,
+			Seller:           common.GetJsonString(params.Seller),
+			Buyer:            common.GetJsonString(params.Buyer),
+			IssuedAt:         now.Unix(),
+		}
+		return tx.Create(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// GetInvoiceById userId 不为 0 时只返回该用户的发票
+func GetInvoiceById(id int, userId int) (*Invoice, error) {
+	var invoice Invoice
+	tx := DB.Where("id = ?", id)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err := tx.First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// GetInvoices userId 为 0 时查询所有用户
+func GetInvoices(userId int, invoiceType string, startIdx int, num int) (invoices []*Invoice, total int64, err error) {
+	tx := DB.Model(&Invoice{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if invoiceType != "" {
+		tx = tx.Where("type = ?", invoiceType)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&invoices).Error
+	return invoices, total, err
+}
+
+// GetCreditNotesByInvoiceId 获取发票关联的红字发票
+func GetCreditNotesByInvoiceId(invoiceId int) (notes []*Invoice, err error) {
+	err = DB.Where("related_invoice_id = ? and type = ?", invoiceId, InvoiceTypeCreditNote).Order("id asc").Find(&notes).Error
+	return notes, err
+}
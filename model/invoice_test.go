@@ -0,0 +1,75 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setupInvoiceTables(t *testing.T) {
+	t.Helper()
+	require.NoError(t, DB.AutoMigrate(&Invoice{}, &InvoiceSequence{}, &UserBillingProfile{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM invoices")
+		DB.Exec("DELETE FROM invoice_sequences")
+		DB.Exec("DELETE FROM user_billing_profiles")
+	})
+}
+
+func TestIssueInvoiceSequentialAndIdempotent(t *testing.T) {
+	setupInvoiceTables(t)
+
+	params := IssueInvoiceParams{Type: InvoiceTypeInvoice, Prefix: "INV-", UserId: 1, SourceType: InvoiceSourceTopUp, TradeNo: "T1", Total: 10}
+	first, err := IssueInvoice(params)
+	require.NoError(t, err)
+	again, err := IssueInvoice(params)
+	require.NoError(t, err)
+	require.Equal(t, first.Id, again.Id)
+
+	params.TradeNo = "T2"
+	second, err := IssueInvoice(params)
+	require.NoError(t, err)
+
+	year := time.Now().Year()
+	require.Equal(t, fmt.Sprintf("INV-%d-000001", year), first.Number)
+	require.Equal(t, fmt.Sprintf("INV-%d-000002", year), second.Number)
+}
+
+func TestIssueCreditNoteLimit(t *testing.T) {
+	setupInvoiceTables(t)
+
+	invoice, err := IssueInvoice(IssueInvoiceParams{Type: InvoiceTypeInvoice, Prefix: "INV-", UserId: 1, SourceType: InvoiceSourceTopUp, TradeNo: "T1", Total: 10})
+	require.NoError(t, err)
+
+	note := IssueInvoiceParams{Type: InvoiceTypeCreditNote, Prefix: "CN-", UserId: 1, RelatedInvoiceId: invoice.Id, Total: 6}
+	first, err := IssueInvoice(note)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("CN-%d-000001", time.Now().Year()), first.Number)
+
+	_, err = IssueInvoice(note)
+	require.ErrorIs(t, err, ErrInvoiceCreditExceeded)
+
+	note.Total = 4
+	_, err = IssueInvoice(note)
+	require.NoError(t, err)
+
+	notes, err := GetCreditNotesByInvoiceId(invoice.Id)
+	require.NoError(t, err)
+	require.Len(t, notes, 2)
+}
+
+func TestUserBillingProfileUpsert(t *testing.T) {
+	setupInvoiceTables(t)
+
+	profile := &UserBillingProfile{UserId: 3, Company: "Acme"}
+	require.NoError(t, profile.Save())
+	profile = &UserBillingProfile{UserId: 3, Company: "Acme Ltd", TaxId: "X1"}
+	require.NoError(t, profile.Save())
+
+	got, err := GetUserBillingProfile(3)
+	require.NoError(t, err)
+	require.Equal(t, "Acme Ltd", got.Company)
+	require.Equal(t, "X1", got.TaxId)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -60,6 +62,7 @@ func formatUserLogs(logs []*Log, startIdx int) {
 			// Remove admin-only debug fields.
 			delete(otherMap, "admin_info")
 			delete(otherMap, "reject_reason")
+			delete(otherMap, "guardrail")
 		}
 		logs[i].Other = common.MapToJsonStr(otherMap)
 		logs[i].Id = startIdx + i + 1
@@ -67,6 +70,11 @@ func formatUserLogs(logs []*Log, startIdx int) {
 }
 
 func GetLogByTokenId(tokenId int) (logs []*Log, err error) {
+	if reader := getLogReader(); reader != nil {
+		logs, _, err = reader.QueryLogs(context.Background(), LogQuery{TokenId: tokenId}, 0, common.MaxRecentItems)
+		formatUserLogs(logs, 0)
+		return logs, err
+	}
 	err = LOG_DB.Model(&Log{}).Where("token_id = ?", tokenId).Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	formatUserLogs(logs, 0)
 	return logs, err
@@ -84,7 +92,7 @@ func RecordLog(userId int, logType int, content string) {
 		Type:      logType,
 		Content:   content,
 	}
-	err := LOG_DB.Create(log).Error
+	err := recordLogEntry(log)
 	if err != nil {
 		common.SysLog("failed to record log: " + err.Error())
 	}
@@ -128,10 +136,32 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 		RequestId: requestId,
 		Other:     otherStr,
 	}
-	err := LOG_DB.Create(log).Error
+	err := recordLogEntry(log)
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
+	exportLog(LogExportSourceError, log)
+}
+
+// RecordGuardrailLog 记录内容安全流水线的拦截与输出检测结果，命中详情保存在 other 中
+func RecordGuardrailLog(c *gin.Context, userId int, modelName string, tokenName string, tokenId int, group string, content string, other map[string]interface{}) {
+	log := &Log{
+		UserId:    userId,
+		Username:  c.GetString("username"),
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeSystem,
+		Content:   content,
+		TokenName: tokenName,
+		ModelName: modelName,
+		TokenId:   tokenId,
+		Group:     group,
+		RequestId: c.GetString(common.RequestIdKey),
+		Other:     common.MapToJsonStr(other),
+	}
+	err := recordLogEntry(log)
+	if err != nil {
+		logger.LogError(c, "failed to record guardrail log: "+err.Error())
+	}
 }
 
 type RecordConsumeLogParams struct {
@@ -184,7 +214,10 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			if params.RequestId != "" {
 				return params.RequestId
 			}
-			return c.GetHeader("X-Request-ID")
+			if headerRequestId := c.GetHeader("X-Request-ID"); headerRequestId != "" {
+				return headerRequestId
+			}
+			return c.GetString(common.RequestIdKey)
 		}(c),
 		Ip: func() string {
 			if needRecordIp {
@@ -194,10 +227,11 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		}(),
 		Other:     otherStr,
 	}
-	err := LOG_DB.Create(log).Error
+	err := recordLogEntry(log)
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
+	exportLog(LogExportSourceConsume, log)
 	if common.DataExportEnabled {
 		gopool.Go(func() {
 			LogQuotaData(userId, username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens)
@@ -261,13 +295,39 @@ func RecordTaskBillingLog(params RecordTaskBillingLogParams) {
 		Group:     params.Group,
 		Other:     common.MapToJsonStr(params.Other),
 	}
-	err := LOG_DB.Create(log).Error
+	err := recordLogEntry(log)
 	if err != nil {
 		common.SysLog("failed to record task billing log: " + err.Error())
 	}
+	exportLog(LogExportSourceTaskBilling, log)
 }
 
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string, requestId string) (logs []*Log, total int64, err error) {
+	if reader := getLogReader(); reader != nil {
+		modelNamePattern := ""
+		if modelName != "" {
+			modelNamePattern, err = sanitizeLikePattern(modelName)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		logs, total, err = reader.QueryLogs(context.Background(), LogQuery{
+			LogType:          logType,
+			StartTimestamp:   startTimestamp,
+			EndTimestamp:     endTimestamp,
+			ModelName:        modelNamePattern,
+			ModelNameEscaped: true,
+			Username:         username,
+			TokenName:        tokenName,
+			ChannelId:        channel,
+			Group:            group,
+			RequestId:        requestId,
+		}, startIdx, num)
+		if err != nil {
+			return nil, 0, err
+		}
+		return logs, total, fillLogChannelNames(logs)
+	}
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB
@@ -308,6 +368,11 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 		return nil, 0, err
 	}
 
+	return logs, total, fillLogChannelNames(logs)
+}
+
+// fillLogChannelNames 为日志填充渠道名称
+func fillLogChannelNames(logs []*Log) error {
 	channelIds := types.NewSet[int]()
 	for _, log := range logs {
 		if log.ChannelId != 0 {
@@ -335,8 +400,8 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 			}
 		} else {
 			// Bulk query channels from DB
-			if err = DB.Table("channels").Select("id, name").Where("id IN ?", channelIds.Items()).Find(&channels).Error; err != nil {
-				return logs, total, err
+			if err := DB.Table("channels").Select("id, name").Where("id IN ?", channelIds.Items()).Find(&channels).Error; err != nil {
+				return err
 			}
 		}
 		channelMap := make(map[int]string, len(channels))
@@ -348,12 +413,47 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 		}
 	}
 
-	return logs, total, err
+	return nil
 }
 
 const logSearchCountLimit = 10000
 
+// escapeLikeExact 将字符串转义为以 ! 作为转义字符、精确匹配的 LIKE 模式
+func escapeLikeExact(input string) string {
+	input = strings.ReplaceAll(input, "!", "!!")
+	input = strings.ReplaceAll(input, "_", "!_")
+	return strings.ReplaceAll(input, "%", "!%")
+}
+
 func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, group string, requestId string) (logs []*Log, total int64, err error) {
+	modelNamePattern := ""
+	if modelName != "" {
+		modelNamePattern, err = sanitizeLikePattern(modelName)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if reader := getLogReader(); reader != nil {
+		logs, total, err = reader.QueryLogs(context.Background(), LogQuery{
+			UserId:           userId,
+			LogType:          logType,
+			StartTimestamp:   startTimestamp,
+			EndTimestamp:     endTimestamp,
+			ModelName:        modelNamePattern,
+			ModelNameEscaped: true,
+			TokenName:        tokenName,
+			Group:            group,
+			RequestId:        requestId,
+			CountLimit:       logSearchCountLimit,
+		}, startIdx, num)
+		if err != nil {
+			common.SysError("failed to search user logs: " + err.Error())
+			return nil, 0, errors.New("查询日志失败")
+		}
+		formatUserLogs(logs, startIdx)
+		return logs, total, nil
+	}
+
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB.Where("logs.user_id = ?", userId)
@@ -361,11 +461,7 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 		tx = LOG_DB.Where("logs.user_id = ? and logs.type = ?", userId, logType)
 	}
 
-	if modelName != "" {
-		modelNamePattern, err := sanitizeLikePattern(modelName)
-		if err != nil {
-			return nil, 0, err
-		}
+	if modelNamePattern != "" {
 		tx = tx.Where("logs.model_name LIKE ? ESCAPE '!'", modelNamePattern)
 	}
 	if tokenName != "" {
@@ -401,6 +497,31 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 // GetUserLogsWithTokenId gets logs for a specific user with optional token_id filter
 // Used by admin API for nicecode proxy
 func GetUserLogsWithTokenId(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, tokenId int, startIdx int, num int, group string) (logs []*Log, total int64, err error) {
+	if reader := getLogReader(); reader != nil {
+		modelNamePattern := ""
+		if modelName != "" {
+			modelNamePattern, err = sanitizeLikePattern(modelName)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		logs, total, err = reader.QueryLogs(context.Background(), LogQuery{
+			UserId:           userId,
+			LogType:          logType,
+			StartTimestamp:   startTimestamp,
+			EndTimestamp:     endTimestamp,
+			ModelName:        modelNamePattern,
+			ModelNameEscaped: true,
+			TokenName:        tokenName,
+			TokenId:          tokenId,
+			Group:            group,
+		}, startIdx, num)
+		if err != nil {
+			return nil, 0, err
+		}
+		formatUserLogs(logs, startIdx)
+		return logs, total, nil
+	}
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB.Where("logs.user_id = ?", userId)
@@ -444,6 +565,13 @@ func GetLogByRequestId(requestId string) (*Log, error) {
 	if requestId == "" {
 		return nil, nil
 	}
+	if reader := getLogReader(); reader != nil {
+		logs, _, err := reader.QueryLogs(context.Background(), LogQuery{RequestId: requestId}, 0, 1)
+		if err != nil || len(logs) == 0 {
+			return nil, err
+		}
+		return logs[0], nil
+	}
 	var log Log
 	err := LOG_DB.Where("request_id = ?", requestId).First(&log).Error
 	if err != nil {
@@ -456,11 +584,32 @@ func GetLogByRequestId(requestId string) (*Log, error) {
 }
 
 func SearchAllLogs(keyword string) (logs []*Log, err error) {
+	if reader := getLogReader(); reader != nil {
+		logs, _, err = reader.QueryLogs(context.Background(), LogQuery{
+			Keyword:    keyword,
+			CountLimit: common.MaxRecentItems,
+		}, 0, common.MaxRecentItems)
+		return logs, err
+	}
 	err = LOG_DB.Where("type = ? or content LIKE ?", keyword, keyword+"%").Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	return logs, err
 }
 
 func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
+	if reader := getLogReader(); reader != nil {
+		// 数据库实现按 type = keyword 过滤，非数字的关键词匹配不到任何日志
+		logType, convErr := strconv.Atoi(keyword)
+		if convErr != nil || logType == LogTypeUnknown {
+			return []*Log{}, nil
+		}
+		logs, _, err = reader.QueryLogs(context.Background(), LogQuery{
+			UserId:     userId,
+			LogType:    logType,
+			CountLimit: common.MaxRecentItems,
+		}, 0, common.MaxRecentItems)
+		formatUserLogs(logs, 0)
+		return logs, err
+	}
 	err = LOG_DB.Where("user_id = ? and type = ?", userId, keyword).Order("id desc").Limit(common.MaxRecentItems).Find(&logs).Error
 	formatUserLogs(logs, 0)
 	return logs, err
@@ -474,6 +623,30 @@ type Stat struct {
 }
 
 func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, group string) (stat Stat, err error) {
+	if reader := getLogReader(); reader != nil {
+		modelNamePattern := ""
+		if modelName != "" {
+			modelNamePattern, err = sanitizeLikePattern(modelName)
+			if err != nil {
+				return stat, err
+			}
+		}
+		stat, err = reader.SumLogStat(context.Background(), LogQuery{
+			StartTimestamp:   startTimestamp,
+			EndTimestamp:     endTimestamp,
+			ModelName:        modelNamePattern,
+			ModelNameEscaped: true,
+			Username:         username,
+			TokenName:        tokenName,
+			ChannelId:        channel,
+			Group:            group,
+		})
+		if err != nil {
+			common.SysError("failed to query log stat: " + err.Error())
+			return stat, errors.New("查询统计数据失败")
+		}
+		return stat, nil
+	}
 	tx := LOG_DB.Table("logs").Select("sum(quota) quota")
 
 	// 为rpm和tpm创建单独的查询
@@ -530,6 +703,20 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 }
 
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string) (token int) {
+	if reader := getLogReader(); reader != nil {
+		token, err := reader.SumLogTokens(context.Background(), LogQuery{
+			StartTimestamp:   startTimestamp,
+			EndTimestamp:     endTimestamp,
+			ModelName:        escapeLikeExact(modelName),
+			ModelNameEscaped: true,
+			Username:         username,
+			TokenName:        tokenName,
+		})
+		if err != nil {
+			common.SysError("failed to sum used token: " + err.Error())
+		}
+		return token
+	}
 	tx := LOG_DB.Table("logs").Select("ifnull(sum(prompt_tokens),0) + ifnull(sum(completion_tokens),0)")
 	if username != "" {
 		tx = tx.Where("username = ?", username)
@@ -551,6 +738,9 @@ func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelNa
 }
 
 func DeleteOldLog(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	if reader := getLogReader(); reader != nil {
+		return reader.DeleteLogsBefore(ctx, targetTimestamp, limit)
+	}
 	var total int64 = 0
 
 	for {
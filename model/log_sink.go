@@ -0,0 +1,425 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	LogSinkTypeDB         = "db"
+	LogSinkTypeClickHouse = "clickhouse"
+)
+
+// LogSink 日志写入后端
+type LogSink interface {
+	Name() string
+	WriteLogs(ctx context.Context, logs []*Log) error
+}
+
+// logIdAssigner 自行生成日志 id 的后端，在入队与导出前为日志分配 id
+type logIdAssigner interface {
+	assignLogId(log *Log)
+}
+
+// LogReader 可以查询日志的后端。启用后日志列表、统计与清理都从该后端读取，而不是 LOG_DB
+type LogReader interface {
+	QueryLogs(ctx context.Context, query LogQuery, startIdx int, num int) ([]*Log, int64, error)
+	SumLogStat(ctx context.Context, query LogQuery) (Stat, error)
+	// SumLogTokens 统计消费日志的输入与输出 token 总数
+	SumLogTokens(ctx context.Context, query LogQuery) (int, error)
+	// DistinctModelNames 返回符合条件的日志中出现过的模型名称
+	DistinctModelNames(ctx context.Context, query LogQuery) ([]string, error)
+	// DeleteLogsBefore 删除早于 targetTimestamp 的日志，每批最多删除约 limit 条
+	DeleteLogsBefore(ctx context.Context, targetTimestamp int64, limit int) (int64, error)
+}
+
+// LogQuery 日志查询条件，零值字段表示不过滤
+type LogQuery struct {
+	UserId         int
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	// ModelNameEscaped 表示 ModelName 已经过 sanitizeLikePattern 处理（以 ! 作为转义字符）
+	ModelNameEscaped bool
+	Username         string
+	TokenName        string
+	TokenId          int
+	ChannelId        int
+	Group            string
+	RequestId        string
+	// Keyword 匹配日志类型或内容前缀，用于旧版日志搜索接口
+	Keyword string
+	// CountLimit 限制总数统计的最大值，0 表示不限制
+	CountLimit int
+	// SkipCount 不统计总数，返回的总数为 0
+	SkipCount bool
+	// BeforeCreatedAt 与 BeforeId 为 keyset 游标，只返回 (created_at, id) 小于游标的日志，BeforeCreatedAt 为 0 表示不使用游标
+	BeforeCreatedAt int64
+	BeforeId        int64
+}
+
+// 日志导出事件来源
+const (
+	LogExportSourceConsume     = "consume"
+	LogExportSourceError       = "error"
+	LogExportSourceTaskBilling = "task_billing"
+)
+
+// LogExportHook 日志写入后的导出回调，不应阻塞调用方
+type LogExportHook func(source string, log *Log)
+
+var logExportHook atomic.Pointer[LogExportHook]
+
+// SetLogExportHook 注册日志导出回调，传入 nil 取消注册
+func SetLogExportHook(hook LogExportHook) {
+	if hook == nil {
+		logExportHook.Store(nil)
+		return
+	}
+	logExportHook.Store(&hook)
+}
+
+func exportLog(source string, log *Log) {
+	if hook := logExportHook.Load(); hook != nil {
+		(*hook)(source, log)
+	}
+}
+
+// dbLogSink 直接写入 LOG_DB
+type dbLogSink struct{}
+
+func (dbLogSink) Name() string {
+	return LogSinkTypeDB
+}
+
+func (dbLogSink) WriteLogs(ctx context.Context, logs []*Log) error {
+	if len(logs) == 1 {
+		return LOG_DB.WithContext(ctx).Create(logs[0]).Error
+	}
+	return LOG_DB.WithContext(ctx).CreateInBatches(logs, 100).Error
+}
+
+const (
+	logSinkWriteAttempts    = 3
+	logSinkSpillReplayDelay = 30 * time.Second
+)
+
+// logSinkWriter 异步批量写入日志，队列满时退化为同步写入以避免丢日志。
+// 写入失败时有限次重试，仍失败的批次落盘到 spillDir，由写入协程定期重放
+type logSinkWriter struct {
+	sink          LogSink
+	queue         chan *Log
+	batchSize     int
+	flushInterval time.Duration
+	flushCh       chan chan struct{}
+	retryBackoff  time.Duration
+	spillDir      string
+	spillSeq      atomic.Int64
+	// nextReplayAt 下一次允许重放的时间（UnixNano），队列满时的同步写入也会更新
+	nextReplayAt atomic.Int64
+}
+
+var (
+	logSinkMu     sync.RWMutex
+	logSink       LogSink = dbLogSink{}
+	logSinkAsync  *logSinkWriter
+	logSinkReader LogReader
+)
+
+// InitLogSink 根据环境变量初始化日志写入后端
+//
+//	LOG_SINK: db（默认）/ clickhouse
+//	LOG_SINK_ASYNC: 是否异步批量写入，非 db 后端始终异步
+//	LOG_SINK_READ: 后端支持查询时，是否从后端读取日志（默认 true）
+//	LOG_SINK_BATCH_SIZE / LOG_SINK_FLUSH_INTERVAL_MS / LOG_SINK_BUFFER_SIZE: 批量写入参数
+//	LOG_SINK_SPILL_DIR: 异步写入失败的批次落盘目录（默认位于磁盘缓存目录下）
+func InitLogSink() error {
+	sinkType := strings.ToLower(strings.TrimSpace(common.GetEnvOrDefaultString("LOG_SINK", LogSinkTypeDB)))
+	var sink LogSink
+	switch sinkType {
+	case LogSinkTypeDB:
+		sink = dbLogSink{}
+	case LogSinkTypeClickHouse:
+		chSink, err := newClickHouseLogSinkFromEnv()
+		if err != nil {
+			return err
+		}
+		sink = chSink
+	default:
+		return fmt.Errorf("unknown LOG_SINK %q", sinkType)
+	}
+
+	async := sinkType != LogSinkTypeDB || common.GetEnvOrDefaultBool("LOG_SINK_ASYNC", false)
+	var writer *logSinkWriter
+	if async {
+		writer = newLogSinkWriter(sink,
+			common.GetEnvOrDefault("LOG_SINK_BATCH_SIZE", 500),
+			time.Duration(common.GetEnvOrDefault("LOG_SINK_FLUSH_INTERVAL_MS", 1000))*time.Millisecond,
+			common.GetEnvOrDefault("LOG_SINK_BUFFER_SIZE", 10000),
+		)
+		writer.spillDir = common.GetEnvOrDefaultString("LOG_SINK_SPILL_DIR", filepath.Join(common.GetDiskCacheDir(), "log-sink"))
+	}
+	var reader LogReader
+	if r, ok := sink.(LogReader); ok && common.GetEnvOrDefaultBool("LOG_SINK_READ", true) {
+		reader = r
+	}
+
+	logSinkMu.Lock()
+	logSink = sink
+	logSinkAsync = writer
+	logSinkReader = reader
+	logSinkMu.Unlock()
+
+	if writer != nil {
+		writer.start()
+	}
+	common.SysLog(fmt.Sprintf("log sink initialized: sink=%s, async=%t, read_from_sink=%t", sink.Name(), async, reader != nil))
+	return nil
+}
+
+func getLogReader() LogReader {
+	logSinkMu.RLock()
+	defer logSinkMu.RUnlock()
+	return logSinkReader
+}
+
+// recordLogEntry 将日志交给当前日志后端
+func recordLogEntry(log *Log) error {
+	logSinkMu.RLock()
+	sink, writer := logSink, logSinkAsync
+	logSinkMu.RUnlock()
+	if assigner, ok := sink.(logIdAssigner); ok {
+		assigner.assignLogId(log)
+	}
+	if writer != nil {
+		writer.enqueue(log)
+		return nil
+	}
+	return sink.WriteLogs(context.Background(), []*Log{log})
+}
+
+// FlushLogSink 等待异步队列中的日志写入完成
+func FlushLogSink() {
+	logSinkMu.RLock()
+	writer := logSinkAsync
+	logSinkMu.RUnlock()
+	if writer != nil {
+		writer.flush()
+	}
+}
+
+func newLogSinkWriter(sink LogSink, batchSize int, flushInterval time.Duration, bufferSize int) *logSinkWriter {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	if bufferSize < batchSize {
+		bufferSize = batchSize
+	}
+	return &logSinkWriter{
+		sink:          sink,
+		queue:         make(chan *Log, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		flushCh:       make(chan chan struct{}),
+		retryBackoff:  time.Second,
+	}
+}
+
+func (w *logSinkWriter) enqueue(log *Log) {
+	select {
+	case w.queue <- log:
+	default:
+		// 队列已满，同步写入
+		w.write([]*Log{log})
+	}
+}
+
+func (w *logSinkWriter) start() {
+	gopool.Go(func() {
+		ticker := time.NewTicker(w.flushInterval)
+		defer ticker.Stop()
+		batch := make([]*Log, 0, w.batchSize)
+		drain := func() {
+			for {
+				select {
+				case log := <-w.queue:
+					batch = append(batch, log)
+					if len(batch) >= w.batchSize {
+						w.write(batch)
+						batch = make([]*Log, 0, w.batchSize)
+					}
+				default:
+					return
+				}
+			}
+		}
+		for {
+			select {
+			case log := <-w.queue:
+				batch = append(batch, log)
+				if len(batch) >= w.batchSize {
+					w.write(batch)
+					batch = make([]*Log, 0, w.batchSize)
+				}
+			case <-ticker.C:
+				if len(batch) > 0 {
+					w.write(batch)
+					batch = make([]*Log, 0, w.batchSize)
+				}
+				w.replaySpill()
+			case done := <-w.flushCh:
+				drain()
+				if len(batch) > 0 {
+					w.write(batch)
+					batch = make([]*Log, 0, w.batchSize)
+				}
+				close(done)
+			}
+		}
+	})
+}
+
+func (w *logSinkWriter) flush() {
+	done := make(chan struct{})
+	select {
+	case w.flushCh <- done:
+		<-done
+	case <-time.After(10 * time.Second):
+		common.SysError("log sink flush timed out")
+	}
+}
+
+func (w *logSinkWriter) writeOnce(logs []*Log) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return w.sink.WriteLogs(ctx, logs)
+}
+
+// write 写入失败时按 retryBackoff 递增退避重试，重试用尽后落盘等待重放
+func (w *logSinkWriter) write(logs []*Log) {
+	var err error
+	for attempt := 1; attempt <= logSinkWriteAttempts; attempt++ {
+		if err = w.writeOnce(logs); err == nil {
+			return
+		}
+		if attempt < logSinkWriteAttempts {
+			time.Sleep(w.retryBackoff * time.Duration(attempt))
+		}
+	}
+	common.SysError(fmt.Sprintf("failed to write %d logs to %s after %d attempts: %s", len(logs), w.sink.Name(), logSinkWriteAttempts, err.Error()))
+	if w.spillDir == "" {
+		return
+	}
+	if spillErr := w.spill(logs); spillErr != nil {
+		common.SysError(fmt.Sprintf("failed to spill %d logs, logs dropped: %s", len(logs), spillErr.Error()))
+		return
+	}
+	w.nextReplayAt.Store(time.Now().Add(logSinkSpillReplayDelay).UnixNano())
+}
+
+// spill 将写入失败的批次以 NDJSON 写入落盘目录，日志 id 已分配，重放时保持不变
+func (w *logSinkWriter) spill(logs []*Log) error {
+	if err := os.MkdirAll(w.spillDir, 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, log := range logs {
+		data, err := common.Marshal(log)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	name := fmt.Sprintf("%d-%06d.ndjson", time.Now().UnixNano(), w.spillSeq.Add(1)%1000000)
+	tmpPath := filepath.Join(w.spillDir, "."+name+".tmp")
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(w.spillDir, name))
+}
+
+// replaySpill 按顺序重放落盘的批次，遇到失败时停止并延迟下一次重放
+func (w *logSinkWriter) replaySpill() {
+	if w.spillDir == "" || time.Now().UnixNano() < w.nextReplayAt.Load() {
+		return
+	}
+	entries, err := os.ReadDir(w.spillDir)
+	if err != nil {
+		return
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".ndjson") && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(w.spillDir, name)
+		logs, err := readSpilledLogs(path)
+		if err == nil && len(logs) > 0 {
+			err = w.writeOnce(logs)
+		}
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to replay spilled logs %s: %s", name, err.Error()))
+			w.nextReplayAt.Store(time.Now().Add(logSinkSpillReplayDelay).UnixNano())
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			common.SysError(fmt.Sprintf("failed to remove replayed spill file %s: %s", name, err.Error()))
+		}
+	}
+}
+
+func readSpilledLogs(path string) ([]*Log, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var logs []*Log
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		log := &Log{}
+		if err := common.Unmarshal(line, log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	return logs, scanner.Err()
+}
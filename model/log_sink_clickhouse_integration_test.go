@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/pkg/clickhouse"
+	"github.com/stretchr/testify/require"
+)
+
+// 需要真实的 ClickHouse，设置 CLICKHOUSE_TEST_DSN（如 http://default:@localhost:8123/default）后运行
+func TestClickHouseLogSinkIntegration(t *testing.T) {
+	dsn := os.Getenv("CLICKHOUSE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("CLICKHOUSE_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+	client, err := clickhouse.NewClient(dsn)
+	require.NoError(t, err)
+	require.NoError(t, client.Ping(ctx))
+
+	table := fmt.Sprintf("logs_it_%d", time.Now().UnixNano())
+	sink, err := newClickHouseLogSink(client, table, 0)
+	require.NoError(t, err)
+	require.NoError(t, sink.migrate(ctx))
+	t.Cleanup(func() {
+		_ = client.Exec(context.Background(), "DROP TABLE IF EXISTS "+table, nil)
+	})
+
+	now := time.Now().Unix()
+	require.NoError(t, sink.WriteLogs(ctx, []*Log{
+		{UserId: 1, CreatedAt: now - 300, Type: LogTypeConsume, ModelName: "gpt_4o", Quota: 10, PromptTokens: 3, CompletionTokens: 4, Content: "old"},
+		{UserId: 1, CreatedAt: now - 200, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 20, PromptTokens: 5, CompletionTokens: 6, Content: "old"},
+		{UserId: 1, CreatedAt: now - 100, Type: LogTypeError, ModelName: "gpt-4o", Content: "upstream error"},
+		{UserId: 2, CreatedAt: now, Type: LogTypeConsume, ModelName: "claude", Quota: 30, PromptTokens: 7, CompletionTokens: 8, Content: "new"},
+	}))
+
+	logs, total, err := sink.QueryLogs(ctx, LogQuery{UserId: 1}, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, logs, 3)
+	require.Equal(t, LogTypeError, logs[0].Type)
+
+	// 下划线按字面匹配，不作为单字符通配符
+	pattern, err := sanitizeLikePattern("gpt_4o")
+	require.NoError(t, err)
+	logs, _, err = sink.QueryLogs(ctx, LogQuery{ModelName: pattern, ModelNameEscaped: true}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	logs, _, err = sink.QueryLogs(ctx, LogQuery{Keyword: "upstream"}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	stat, err := sink.SumLogStat(ctx, LogQuery{UserId: 1})
+	require.NoError(t, err)
+	require.Equal(t, 30, stat.Quota)
+
+	tokens, err := sink.SumLogTokens(ctx, LogQuery{})
+	require.NoError(t, err)
+	require.Equal(t, 33, tokens)
+
+	deleted, err := sink.DeleteLogsBefore(ctx, now-50, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, deleted)
+	_, total, err = sink.QueryLogs(ctx, LogQuery{}, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+}
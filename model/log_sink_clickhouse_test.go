@@ -0,0 +1,222 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/pkg/clickhouse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertLikePatternToClickHouse(t *testing.T) {
+	t.Parallel()
+
+	escaped, err := sanitizeLikePattern("gpt_4%")
+	require.NoError(t, err)
+	require.Equal(t, `gpt\_4%`, convertLikePatternToClickHouse(escaped, true))
+	require.Equal(t, `a!b`, convertLikePatternToClickHouse("a!!b", true))
+	require.Equal(t, `gpt_4%`, convertLikePatternToClickHouse("gpt_4%", false))
+	require.Equal(t, `a\\b`, convertLikePatternToClickHouse(`a\b`, false))
+}
+
+func TestBuildClickHouseLogWhere(t *testing.T) {
+	t.Parallel()
+
+	where, params := buildClickHouseLogWhere(LogQuery{})
+	require.Empty(t, where)
+	require.Empty(t, params)
+
+	where, params = buildClickHouseLogWhere(LogQuery{Keyword: "2"})
+	require.Equal(t, " WHERE (toString(type) = {keyword:String} OR startsWith(content, {keyword:String}))", where)
+	require.Equal(t, map[string]string{"keyword": "2"}, params)
+
+	where, params = buildClickHouseLogWhere(LogQuery{
+		UserId:  3,
+		LogType: LogTypeConsume,
+		Group:   "vip' OR 1=1",
+	})
+	require.Equal(t, " WHERE user_id = {user_id:Int64} AND type = {type:Int32} AND `group` = {group:String}", where)
+	require.Equal(t, map[string]string{"user_id": "3", "type": "2", "group": "vip' OR 1=1"}, params)
+
+	where, params = buildClickHouseLogWhere(LogQuery{UserId: 3, BeforeCreatedAt: 100, BeforeId: 42})
+	require.Equal(t, " WHERE user_id = {user_id:Int64} AND (created_at < {before_created_at:Int64} OR (created_at = {before_created_at:Int64} AND id < {before_id:Int64}))", where)
+	require.Equal(t, map[string]string{"user_id": "3", "before_created_at": "100", "before_id": "42"}, params)
+}
+
+func TestClickHouseLogSinkWriteAndQuery(t *testing.T) {
+	t.Parallel()
+
+	var inserted []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		require.Equal(t, "analytics", query.Get("database"))
+		if sql := query.Get("query"); strings.HasPrefix(sql, "INSERT INTO logs") {
+			body, _ := io.ReadAll(r.Body)
+			for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+				row := map[string]any{}
+				require.NoError(t, json.Unmarshal([]byte(line), &row))
+				inserted = append(inserted, row)
+			}
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		sql := string(body)
+		switch {
+		case strings.HasPrefix(sql, "SELECT count() AS total"):
+			require.Equal(t, "7", query.Get("param_user_id"))
+			_, _ = w.Write([]byte(`{"data":[{"total":1}]}`))
+		case strings.HasPrefix(sql, "SELECT id,"):
+			require.Contains(t, sql, "LIMIT 10 OFFSET 0 FORMAT JSON")
+			_, _ = w.Write([]byte(`{"data":[{"id":1,"user_id":7,"created_at":100,"type":2,"model_name":"gpt-4o","quota":30,"channel_id":5,"group":"default"}]}`))
+		default:
+			t.Errorf("unexpected query: %s", sql)
+		}
+	}))
+	defer server.Close()
+
+	client, err := clickhouse.NewClient(server.URL + "/analytics")
+	require.NoError(t, err)
+	sink, err := newClickHouseLogSink(client, "logs", 0)
+	require.NoError(t, err)
+
+	written := []*Log{
+		{UserId: 7, CreatedAt: 100, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 30, ChannelId: 5, Group: "default"},
+		{UserId: 7, CreatedAt: 101, Type: LogTypeError, ModelName: "gpt-4o"},
+	}
+	err = sink.WriteLogs(context.Background(), written)
+	require.NoError(t, err)
+	require.Len(t, inserted, 2)
+	// 生成的 id 回写到日志上，导出回调与调用方看到的 id 与表中一致
+	require.NotZero(t, written[0].Id)
+	require.EqualValues(t, written[0].Id, inserted[0]["id"])
+	require.EqualValues(t, 5, inserted[0]["channel_id"])
+	require.Equal(t, "default", inserted[0]["group"])
+	require.NotEqual(t, inserted[0]["id"], inserted[1]["id"])
+
+	logs, total, err := sink.QueryLogs(context.Background(), LogQuery{UserId: 7}, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Len(t, logs, 1)
+	require.Equal(t, 5, logs[0].ChannelId)
+	require.Equal(t, 30, logs[0].Quota)
+}
+
+func TestClickHouseLogSinkIdsUniqueAcrossNodes(t *testing.T) {
+	t.Parallel()
+
+	first, err := newClickHouseLogSink(&clickhouse.Client{}, "logs", 0)
+	require.NoError(t, err)
+	second, err := newClickHouseLogSink(&clickhouse.Client{}, "logs", 0)
+	require.NoError(t, err)
+	first.nodeId, second.nodeId = 1, 2
+
+	seen := make(map[int64]bool)
+	var last int64
+	// 超过单秒序号上限，验证借用下一秒后仍然唯一且递增
+	for i := 0; i < 20000; i++ {
+		id := first.nextId()
+		require.Greater(t, id, last)
+		last = id
+		require.False(t, seen[id])
+		seen[id] = true
+
+		other := second.nextId()
+		require.False(t, seen[other])
+		seen[other] = true
+	}
+	require.Less(t, last, int64(1)<<53)
+}
+
+func TestClickHouseLogSinkDeleteLogsBeforeHonorsLimit(t *testing.T) {
+	t.Parallel()
+
+	// 5 条待删除日志，created_at 分别为 1..5
+	remaining := []int64{1, 2, 3, 4, 5}
+	var deletes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sql := string(body)
+		query := r.URL.Query()
+		switch {
+		case strings.HasPrefix(sql, "SELECT max(created_at) AS cutoff"):
+			require.Contains(t, sql, "LIMIT 2)")
+			batch := remaining[:min(2, len(remaining))]
+			var cutoff int64
+			if len(batch) > 0 {
+				cutoff = batch[len(batch)-1]
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"data":[{"cutoff":%d,"total":%d}]}`, cutoff, len(batch))))
+		case strings.HasPrefix(sql, "SELECT count() AS total"):
+			cutoff, _ := strconv.ParseInt(query.Get("param_cutoff"), 10, 64)
+			count := 0
+			for _, createdAt := range remaining {
+				if createdAt <= cutoff {
+					count++
+				}
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"data":[{"total":%d}]}`, count)))
+		case strings.HasPrefix(sql, "ALTER TABLE logs DELETE"):
+			require.Contains(t, sql, "mutations_sync")
+			cutoff, _ := strconv.ParseInt(query.Get("param_cutoff"), 10, 64)
+			deletes = append(deletes, query.Get("param_cutoff"))
+			kept := remaining[:0]
+			for _, createdAt := range remaining {
+				if createdAt > cutoff {
+					kept = append(kept, createdAt)
+				}
+			}
+			remaining = kept
+		default:
+			t.Errorf("unexpected query: %s", sql)
+		}
+	}))
+	defer server.Close()
+
+	client, err := clickhouse.NewClient(server.URL)
+	require.NoError(t, err)
+	sink, err := newClickHouseLogSink(client, "logs", 0)
+	require.NoError(t, err)
+
+	deleted, err := sink.DeleteLogsBefore(context.Background(), 10, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, deleted)
+	require.Equal(t, []string{"2", "4", "5"}, deletes)
+	require.Empty(t, remaining)
+}
+
+func TestNewClickHouseLogSinkRejectsInvalidTable(t *testing.T) {
+	t.Parallel()
+
+	_, err := newClickHouseLogSink(&clickhouse.Client{}, "logs; DROP TABLE x", 0)
+	require.Error(t, err)
+}
+
+func TestClickHouseLogSinkDistinctModelNames(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		query := r.URL.Query()
+		require.True(t, strings.HasPrefix(string(body), "SELECT DISTINCT model_name FROM logs WHERE user_id = {user_id:Int64} AND type = {type:Int32} AND created_at <= {end:Int64}"))
+		require.Equal(t, "7", query.Get("param_user_id"))
+		require.Equal(t, "99", query.Get("param_end"))
+		_, _ = w.Write([]byte(`{"data":[{"model_name":"gpt-4o"},{"model_name":"claude"}]}`))
+	}))
+	defer server.Close()
+
+	client, err := clickhouse.NewClient(server.URL)
+	require.NoError(t, err)
+	sink, err := newClickHouseLogSink(client, "logs", 0)
+	require.NoError(t, err)
+
+	names, err := sink.DistinctModelNames(context.Background(), LogQuery{UserId: 7, LogType: LogTypeConsume, EndTimestamp: 99})
+	require.NoError(t, err)
+	require.Equal(t, []string{"gpt-4o", "claude"}, names)
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type flakyLogSink struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	written  []*Log
+}
+
+func (s *flakyLogSink) Name() string {
+	return "flaky"
+}
+
+func (s *flakyLogSink) WriteLogs(ctx context.Context, logs []*Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.written = append(s.written, logs...)
+	return nil
+}
+
+func TestLogSinkWriterRetriesThenSpillsAndReplays(t *testing.T) {
+	t.Parallel()
+
+	sink := &flakyLogSink{failures: 1}
+	writer := newLogSinkWriter(sink, 10, time.Second, 10)
+	writer.retryBackoff = time.Millisecond
+	writer.spillDir = t.TempDir()
+
+	// 一次失败后重试成功
+	writer.write([]*Log{{Id: 1, Content: "retried"}})
+	require.Equal(t, 2, sink.calls)
+	require.Len(t, sink.written, 1)
+
+	// 重试用尽后落盘
+	sink.failures = logSinkWriteAttempts
+	writer.write([]*Log{{Id: 2, Content: "spilled"}, {Id: 3, Content: "spilled"}})
+	entries, err := os.ReadDir(writer.spillDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// 重放延迟未到时不重放
+	writer.replaySpill()
+	require.Len(t, sink.written, 1)
+
+	writer.nextReplayAt.Store(0)
+	writer.replaySpill()
+	require.Len(t, sink.written, 3)
+	require.Equal(t, 2, sink.written[1].Id)
+	require.Equal(t, "spilled", sink.written[2].Content)
+	entries, err = os.ReadDir(writer.spillDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
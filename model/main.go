@@ -181,6 +181,9 @@ func InitDB() (err error) {
 			db = db.Debug()
 		}
 		DB = db
+		if err := RegisterSecretCallbacks(DB); err != nil {
+			return err
+		}
 		// MySQL charset/collation startup check: ensure Chinese-capable charset
 		if common.UsingMySQL {
 			if err := checkMySQLChineseSupport(DB); err != nil {
@@ -280,6 +283,15 @@ func migrateDB() error {
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&PayloadCapture{},
+		&UsageStatementJob{},
+		&Invoice{},
+		&InvoiceSequence{},
+		&PostpaidAccount{},
+		&PostpaidSettlement{},
+		&UserModelUsage{},
+		&TokenUsageProfile{},
+		&UserBillingProfile{},
 	)
 	if err != nil {
 		return err
@@ -328,6 +340,15 @@ func migrateDBFast() error {
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&PayloadCapture{}, "PayloadCapture"},
+		{&UsageStatementJob{}, "UsageStatementJob"},
+		{&Invoice{}, "Invoice"},
+		{&InvoiceSequence{}, "InvoiceSequence"},
+		{&PostpaidAccount{}, "PostpaidAccount"},
+		{&PostpaidSettlement{}, "PostpaidSettlement"},
+		{&UserModelUsage{}, "UserModelUsage"},
+		{&TokenUsageProfile{}, "TokenUsageProfile"},
+		{&UserBillingProfile{}, "UserBillingProfile"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -367,7 +388,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &PayloadCapture{}); err != nil {
 		return err
 	}
 	return nil
@@ -572,6 +593,7 @@ func closeDB(db *gorm.DB) error {
 }
 
 func CloseDB() error {
+	FlushLogSink()
 	if LOG_DB != DB {
 		err := closeDB(LOG_DB)
 		if err != nil {
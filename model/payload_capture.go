@@ -0,0 +1,75 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+)
+
+// PayloadCapture 请求/响应载荷抓取记录，载荷本体保存在存储后端中，这里只保存索引
+type PayloadCapture struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	RequestId   string `json:"request_id" gorm:"type:varchar(64);index:idx_payload_capture_request_id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"default:0"`
+	ModelName   string `json:"model_name" gorm:"default:''"`
+	ChannelId   int    `json:"channel_id" gorm:"default:0"`
+	RequestPath string `json:"request_path" gorm:"type:varchar(255);default:''"`
+	IsStream    bool   `json:"is_stream"`
+	StatusCode  int    `json:"status_code" gorm:"default:0"`
+	Reason      string `json:"reason" gorm:"type:varchar(16);default:''"` // user / token / sample
+	Storage     string `json:"storage" gorm:"type:varchar(32);default:''"`
+	StorageKey  string `json:"-" gorm:"type:varchar(255)"`
+	Size        int64  `json:"size" gorm:"default:0"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (PayloadCapture) TableName() string {
+	return "payload_captures"
+}
+
+func (p *PayloadCapture) Insert() error {
+	if p.CreatedAt == 0 {
+		p.CreatedAt = common.GetTimestamp()
+	}
+	return LOG_DB.Create(p).Error
+}
+
+// GetPayloadCaptureByRequestId 按 request_id 获取载荷抓取记录，userId 为 0 时不限制用户
+func GetPayloadCaptureByRequestId(requestId string, userId int) (*PayloadCapture, error) {
+	if requestId == "" {
+		return nil, errors.New("request_id is required")
+	}
+	tx := LOG_DB.Where("request_id = ?", requestId)
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	var capture PayloadCapture
+	err := tx.Order("id desc").First(&capture).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &capture, nil
+}
+
+// GetExpiredPayloadCaptures 获取已过期的载荷抓取记录
+func GetExpiredPayloadCaptures(now int64, limit int) ([]*PayloadCapture, error) {
+	var captures []*PayloadCapture
+	err := LOG_DB.Where("expires_at > 0 AND expires_at <= ?", now).
+		Order("id asc").
+		Limit(limit).
+		Find(&captures).Error
+	return captures, err
+}
+
+func DeletePayloadCapturesByIds(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return LOG_DB.Where("id IN ?", ids).Delete(&PayloadCapture{}).Error
+}
@@ -0,0 +1,333 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PostpaidStatusActive    = "active"
+	PostpaidStatusSuspended = "suspended"
+
+	PostpaidSuspendReasonCreditLimit = "credit_limit"
+	PostpaidSuspendReasonOverdue     = "overdue"
+	PostpaidSuspendReasonManual      = "manual"
+
+	PostpaidSettlementStatusPending = "pending"
+	PostpaidSettlementStatusPaid    = "paid"
+)
+
+// ErrPostpaidCreditLimitExceeded 预扣后余额将低于授信额度下限
+var ErrPostpaidCreditLimitExceeded = errors.New("超出授信额度")
+
+// PostpaidAccount 后付费账户：用户余额允许透支到 -CreditLimit，按账期出账结算
+type PostpaidAccount struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex"`
+	Enabled     bool   `json:"enabled"`
+	CreditLimit int    `json:"credit_limit"`
+	Status      string `json:"status" gorm:"type:varchar(16)"`
+	// SuspendReason 暂停原因：credit_limit / overdue / manual
+	SuspendReason string `json:"suspend_reason" gorm:"type:varchar(32)"`
+	SuspendedAt   int64  `json:"suspended_at" gorm:"bigint"`
+	// PeriodStart 当前账期开始时间，OpeningBalance 为账期开始时的余额
+	PeriodStart    int64 `json:"period_start" gorm:"bigint;index"`
+	OpeningBalance int   `json:"opening_balance"`
+	// WarnedPeriod 已发送授信额度预警的账期，避免同一账期重复提醒
+	WarnedPeriod int64  `json:"-" gorm:"bigint"`
+	Remark       string `json:"remark" gorm:"type:varchar(255)"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime  int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// PostpaidSettlement 后付费账期结算单，AmountDue 为本账期新增的透支额，上一账期未结清的透支仍由上一张结算单承担
+type PostpaidSettlement struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_postpaid_settlement_period"`
+	PeriodStart    int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_postpaid_settlement_period"`
+	PeriodEnd      int64  `json:"period_end" gorm:"bigint"`
+	OpeningBalance int    `json:"opening_balance"`
+	ClosingBalance int    `json:"closing_balance"`
+	Consumed       int    `json:"consumed"`
+	AmountDue      int    `json:"amount_due"`
+	Status         string `json:"status" gorm:"type:varchar(16);index"`
+	DunningCount   int    `json:"dunning_count"`
+	LastDunningAt  int64  `json:"last_dunning_at" gorm:"bigint"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	PaidTime       int64  `json:"paid_time" gorm:"bigint"`
+}
+
+// IsUsable 账户是否可用于透支
+func (account *PostpaidAccount) IsUsable() bool {
+	return account != nil && account.Enabled && account.Status == PostpaidStatusActive && account.CreditLimit > 0
+}
+
+// GetPostpaidAccount 获取用户后付费账户，不存在时返回 gorm.ErrRecordNotFound
+func GetPostpaidAccount(userId int) (*PostpaidAccount, error) {
+	account := &PostpaidAccount{}
+	err := DB.Where("user_id = ?", userId).First(account).Error
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetPostpaidAccounts 分页获取后付费账户
+func GetPostpaidAccounts(startIdx int, num int) (accounts []*PostpaidAccount, total int64, err error) {
+	tx := DB.Model(&PostpaidAccount{})
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&accounts).Error
+	return accounts, total, err
+}
+
+// UpsertPostpaidAccount 创建或更新后付费账户的授信配置，新账户从 periodStart 开始第一个账期
+func UpsertPostpaidAccount(userId int, enabled bool, creditLimit int, remark string, periodStart int64) (*PostpaidAccount, error) {
+	if creditLimit < 0 {
+		return nil, errors.New("授信额度不能为负数")
+	}
+	account := &PostpaidAccount{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", userId).First(account).Error
+		now := common.GetTimestamp()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var user User
+			if err := tx.Select("id", "quota").Where("id = ?", userId).First(&user).Error; err != nil {
+				return errors.New("用户不存在")
+			}
+			*account = PostpaidAccount{
+				UserId:         userId,
+				Enabled:        enabled,
+				CreditLimit:    creditLimit,
+				Status:         PostpaidStatusActive,
+				PeriodStart:    periodStart,
+				OpeningBalance: user.Quota,
+				Remark:         remark,
+				CreatedTime:    now,
+				UpdatedTime:    now,
+			}
+			return tx.Create(account).Error
+		}
+		if err != nil {
+			return err
+		}
+		account.Enabled = enabled
+		account.CreditLimit = creditLimit
+		account.Remark = remark
+		account.UpdatedTime = now
+		return tx.Model(&PostpaidAccount{}).Where("id = ?", account.Id).Updates(map[string]interface{}{
+			"enabled":      enabled,
+			"credit_limit": creditLimit,
+			"remark":       remark,
+			"updated_time": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// SuspendPostpaidAccount 暂停后付费账户，仅在账户处于活跃状态时生效，返回是否发生了状态变化
+func SuspendPostpaidAccount(userId int, reason string) (bool, error) {
+	result := DB.Model(&PostpaidAccount{}).
+		Where("user_id = ? and status = ?", userId, PostpaidStatusActive).
+		Updates(map[string]interface{}{
+			"status":         PostpaidStatusSuspended,
+			"suspend_reason": reason,
+			"suspended_at":   common.GetTimestamp(),
+			"updated_time":   common.GetTimestamp(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ResumePostpaidAccount 恢复后付费账户。reasons 非空时仅恢复因这些原因暂停的账户
+func ResumePostpaidAccount(userId int, reasons ...string) (bool, error) {
+	tx := DB.Model(&PostpaidAccount{}).Where("user_id = ? and status = ?", userId, PostpaidStatusSuspended)
+	if len(reasons) > 0 {
+		tx = tx.Where("suspend_reason in ?", reasons)
+	}
+	result := tx.Updates(map[string]interface{}{
+		"status":         PostpaidStatusActive,
+		"suspend_reason": "",
+		"suspended_at":   0,
+		"updated_time":   common.GetTimestamp(),
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkPostpaidAccountWarned 标记账期已发送授信预警，返回是否为本账期首次标记
+func MarkPostpaidAccountWarned(userId int, periodStart int64) (bool, error) {
+	result := DB.Model(&PostpaidAccount{}).
+		Where("user_id = ? and warned_period <> ?", userId, periodStart).
+		Update("warned_period", periodStart)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetPostpaidAccountsDueForSettlement 获取账期开始时间早于 cutoff 的待出账账户
+func GetPostpaidAccountsDueForSettlement(cutoff int64, limit int) ([]*PostpaidAccount, error) {
+	var accounts []*PostpaidAccount
+	err := DB.Where("enabled = ? and period_start < ?", true, cutoff).
+		Order("id asc").Limit(limit).Find(&accounts).Error
+	return accounts, err
+}
+
+// GetSuspendedPostpaidAccounts 按 id 游标获取因指定原因暂停的账户
+func GetSuspendedPostpaidAccounts(reason string, afterId int, limit int) ([]*PostpaidAccount, error) {
+	var accounts []*PostpaidAccount
+	err := DB.Where("status = ? and suspend_reason = ? and id > ?", PostpaidStatusSuspended, reason, afterId).
+		Order("id asc").Limit(limit).Find(&accounts).Error
+	return accounts, err
+}
+
+// ClosePostpaidPeriod 生成账期结算单并开启下一账期。同一账期重复执行时返回 nil
+func ClosePostpaidPeriod(account *PostpaidAccount, periodEnd int64, closingBalance int, consumed int) (*PostpaidSettlement, error) {
+	// 期初已透支的部分属于之前的结算单，本期只计新增透支，避免同一笔透支出现在多张待支付结算单中
+	amountDue := 0
+	if closingBalance < 0 {
+		amountDue = min(-closingBalance, account.OpeningBalance-closingBalance)
+		amountDue = max(amountDue, 0)
+	}
+	status := PostpaidSettlementStatusPending
+	now := common.GetTimestamp()
+	var paidTime int64
+	if amountDue == 0 {
+		status = PostpaidSettlementStatusPaid
+		paidTime = now
+	}
+	settlement := &PostpaidSettlement{
+		UserId:         account.UserId,
+		PeriodStart:    account.PeriodStart,
+		PeriodEnd:      periodEnd,
+		OpeningBalance: account.OpeningBalance,
+		ClosingBalance: closingBalance,
+		Consumed:       consumed,
+		AmountDue:      amountDue,
+		Status:         status,
+		CreatedTime:    now,
+		PaidTime:       paidTime,
+	}
+	created := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&PostpaidAccount{}).
+			Where("id = ? and period_start = ?", account.Id, account.PeriodStart).
+			Updates(map[string]interface{}{
+				"period_start":    periodEnd,
+				"opening_balance": closingBalance,
+				"updated_time":    now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 其他节点已结算该账期
+			return nil
+		}
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(settlement)
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected > 0
+		return nil
+	})
+	if err != nil || !created {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+// GetPendingPostpaidSettlements 按 id 游标获取待支付的结算单
+func GetPendingPostpaidSettlements(afterId int, limit int) ([]*PostpaidSettlement, error) {
+	var settlements []*PostpaidSettlement
+	err := DB.Where("status = ? and id > ?", PostpaidSettlementStatusPending, afterId).
+		Order("id asc").Limit(limit).Find(&settlements).Error
+	return settlements, err
+}
+
+// GetPostpaidSettlements 分页获取结算单，userId 为 0 时返回全部
+func GetPostpaidSettlements(userId int, status string, startIdx int, num int) (settlements []*PostpaidSettlement, total int64, err error) {
+	tx := DB.Model(&PostpaidSettlement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&settlements).Error
+	return settlements, total, err
+}
+
+// HasPendingPostpaidSettlement 用户是否存在待支付的结算单
+func HasPendingPostpaidSettlement(userId int) (bool, error) {
+	var count int64
+	err := DB.Model(&PostpaidSettlement{}).
+		Where("user_id = ? and status = ?", userId, PostpaidSettlementStatusPending).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// MarkPostpaidSettlementPaid 将结算单标记为已支付，返回是否发生了状态变化
+func MarkPostpaidSettlementPaid(id int) (*PostpaidSettlement, bool, error) {
+	settlement := &PostpaidSettlement{}
+	if err := DB.Where("id = ?", id).First(settlement).Error; err != nil {
+		return nil, false, err
+	}
+	now := common.GetTimestamp()
+	result := DB.Model(&PostpaidSettlement{}).
+		Where("id = ? and status = ?", id, PostpaidSettlementStatusPending).
+		Updates(map[string]interface{}{
+			"status":    PostpaidSettlementStatusPaid,
+			"paid_time": now,
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		settlement.Status = PostpaidSettlementStatusPaid
+		settlement.PaidTime = now
+	}
+	return settlement, result.RowsAffected > 0, nil
+}
+
+// RecordPostpaidDunning 记录一次催缴，dunningCount 为期望的当前次数，用于多节点下的幂等
+func RecordPostpaidDunning(id int, dunningCount int) (bool, error) {
+	result := DB.Model(&PostpaidSettlement{}).
+		Where("id = ? and status = ? and dunning_count = ?", id, PostpaidSettlementStatusPending, dunningCount).
+		Updates(map[string]interface{}{
+			"dunning_count":   dunningCount + 1,
+			"last_dunning_at": common.GetTimestamp(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DecreasePostpaidUserQuota 后付费预扣：扣减后余额不能低于 -creditLimit，条件更新保证并发请求不会共同突破授信额度。
+// 需要立即校验余额，因此不走批量更新
+func DecreasePostpaidUserQuota(userId int, quota int, creditLimit int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	result := DB.Model(&User{}).
+		Where("id = ? and quota - ? >= ?", userId, quota, -creditLimit).
+		Update("quota", gorm.Expr("quota - ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPostpaidCreditLimitExceeded
+	}
+	gopool.Go(func() {
+		if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+			common.SysLog("failed to decrease user quota: " + err.Error())
+		}
+	})
+	return nil
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setupPostpaidTables(t *testing.T) {
+	t.Helper()
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&PostpaidAccount{}, &PostpaidSettlement{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM postpaid_accounts")
+		DB.Exec("DELETE FROM postpaid_settlements")
+	})
+}
+
+func TestClosePostpaidPeriodIdempotent(t *testing.T) {
+	setupPostpaidTables(t)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "postpaid", Quota: 500}).Error)
+
+	account, err := UpsertPostpaidAccount(1, true, 1000, "", 100)
+	require.NoError(t, err)
+	require.True(t, account.IsUsable())
+	require.Equal(t, 500, account.OpeningBalance)
+
+	settlement, err := ClosePostpaidPeriod(account, 200, -300, 800)
+	require.NoError(t, err)
+	require.NotNil(t, settlement)
+	require.Equal(t, 300, settlement.AmountDue)
+	require.Equal(t, PostpaidSettlementStatusPending, settlement.Status)
+
+	// 使用旧的账期信息重复结算不会生成第二张结算单
+	again, err := ClosePostpaidPeriod(account, 200, -300, 800)
+	require.NoError(t, err)
+	require.Nil(t, again)
+
+	account, err = GetPostpaidAccount(1)
+	require.NoError(t, err)
+	require.EqualValues(t, 200, account.PeriodStart)
+	require.Equal(t, -300, account.OpeningBalance)
+
+	pending, err := HasPendingPostpaidSettlement(1)
+	require.NoError(t, err)
+	require.True(t, pending)
+
+	recorded, err := RecordPostpaidDunning(settlement.Id, 0)
+	require.NoError(t, err)
+	require.True(t, recorded)
+	recorded, err = RecordPostpaidDunning(settlement.Id, 0)
+	require.NoError(t, err)
+	require.False(t, recorded)
+
+	_, changed, err := MarkPostpaidSettlementPaid(settlement.Id)
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, changed, err = MarkPostpaidSettlementPaid(settlement.Id)
+	require.NoError(t, err)
+	require.False(t, changed)
+}
+
+// 上一账期结算单未结清时，下一账期只对新增透支出账
+func TestClosePostpaidPeriodBillsOnlyNewOverdraft(t *testing.T) {
+	setupPostpaidTables(t)
+	require.NoError(t, DB.Create(&User{Id: 3, Username: "postpaid3"}).Error)
+	account, err := UpsertPostpaidAccount(3, true, 1000, "", 100)
+	require.NoError(t, err)
+
+	first, err := ClosePostpaidPeriod(account, 200, -300, 300)
+	require.NoError(t, err)
+	require.Equal(t, 300, first.AmountDue)
+
+	account, err = GetPostpaidAccount(3)
+	require.NoError(t, err)
+	second, err := ClosePostpaidPeriod(account, 300, -450, 150)
+	require.NoError(t, err)
+	require.Equal(t, 150, second.AmountDue)
+
+	// 期间部分还款、没有新增透支时不再生成待支付金额
+	account, err = GetPostpaidAccount(3)
+	require.NoError(t, err)
+	third, err := ClosePostpaidPeriod(account, 400, -200, 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, third.AmountDue)
+	require.Equal(t, PostpaidSettlementStatusPaid, third.Status)
+}
+
+func TestPostpaidSuspendAndResume(t *testing.T) {
+	setupPostpaidTables(t)
+	require.NoError(t, DB.Create(&User{Id: 2, Username: "postpaid2"}).Error)
+	_, err := UpsertPostpaidAccount(2, true, 1000, "", 100)
+	require.NoError(t, err)
+
+	suspended, err := SuspendPostpaidAccount(2, PostpaidSuspendReasonOverdue)
+	require.NoError(t, err)
+	require.True(t, suspended)
+	suspended, err = SuspendPostpaidAccount(2, PostpaidSuspendReasonCreditLimit)
+	require.NoError(t, err)
+	require.False(t, suspended)
+
+	account, err := GetPostpaidAccount(2)
+	require.NoError(t, err)
+	require.False(t, account.IsUsable())
+
+	// 按原因恢复时不影响其他原因暂停的账户
+	resumed, err := ResumePostpaidAccount(2, PostpaidSuspendReasonCreditLimit)
+	require.NoError(t, err)
+	require.False(t, resumed)
+	resumed, err = ResumePostpaidAccount(2, PostpaidSuspendReasonOverdue)
+	require.NoError(t, err)
+	require.True(t, resumed)
+
+	account, err = GetPostpaidAccount(2)
+	require.NoError(t, err)
+	require.True(t, account.IsUsable())
+}
+
+func TestDecreasePostpaidUserQuotaRespectsCreditLimit(t *testing.T) {
+	setupPostpaidTables(t)
+	require.NoError(t, DB.Create(&User{Id: 3, Username: "postpaid3", Quota: 100}).Error)
+
+	require.NoError(t, DecreasePostpaidUserQuota(3, 600, 500))
+	require.ErrorIs(t, DecreasePostpaidUserQuota(3, 1, 500), ErrPostpaidCreditLimitExceeded)
+
+	quota, err := GetUserQuota(3, true)
+	require.NoError(t, err)
+	require.Equal(t, -500, quota)
+}
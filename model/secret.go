@@ -0,0 +1,291 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+// 以下配置项的值加密保存
+var encryptedOptionKeys = map[string]bool{
+	"EpayKey":             true,
+	"StripeApiSecret":     true,
+	"StripeWebhookSecret": true,
+	"CreemApiKey":         true,
+	"CreemWebhookSecret":  true,
+
+	"guardrail_setting.judge_api_key": true,
+}
+
+// encryptSecretColumn 写入前加密敏感字段。Update/Updates 传入 map 时值位于 Statement.Dest 中，
+// 否则就地加密结构体字段，由 AfterSave 还原为明文
+func encryptSecretColumn(tx *gorm.DB, column string, field *string) error {
+	if dest, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		value, ok := dest[column].(string)
+		if !ok {
+			return nil
+		}
+		encrypted, err := common.EncryptSecret(value)
+		if err != nil {
+			return err
+		}
+		dest[column] = encrypted
+		return nil
+	}
+	encrypted, err := common.EncryptSecret(*field)
+	if err != nil {
+		return err
+	}
+	*field = encrypted
+	return nil
+}
+
+// setSecretDigestColumn 写入敏感字段的查询摘要，与 encryptSecretColumn 一样区分 map 与结构体两种写入方式
+func setSecretDigestColumn(tx *gorm.DB, column string, digestColumn string, value string, digest *string) {
+	if dest, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		if value, ok := dest[column].(string); ok && !common.IsEncryptedSecret(value) {
+			dest[digestColumn] = common.SecretLookupDigest(value)
+		}
+		return
+	}
+	if !common.IsEncryptedSecret(value) {
+		*digest = common.SecretLookupDigest(value)
+	}
+}
+
+func decryptSecretField(field *string) error {
+	plaintext, err := common.DecryptSecret(*field)
+	if err != nil {
+		return err
+	}
+	*field = plaintext
+	return nil
+}
+
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	setSecretDigestColumn(tx, "key", "key_digest", channel.Key, &channel.KeyDigest)
+	return encryptSecretColumn(tx, "key", &channel.Key)
+}
+
+func (channel *Channel) AfterSave(tx *gorm.DB) error {
+	return decryptSecretField(&channel.Key)
+}
+
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	if err := decryptSecretField(&channel.Key); err != nil {
+		return fmt.Errorf("channel %d: %w", channel.Id, err)
+	}
+	return nil
+}
+
+func (channel *Channel) restoreSecretPlaintext() {
+	_ = decryptSecretField(&channel.Key)
+}
+
+func (p *CustomOAuthProvider) BeforeSave(tx *gorm.DB) error {
+	return encryptSecretColumn(tx, "client_secret", &p.ClientSecret)
+}
+
+func (p *CustomOAuthProvider) AfterSave(tx *gorm.DB) error {
+	return decryptSecretField(&p.ClientSecret)
+}
+
+func (p *CustomOAuthProvider) AfterFind(tx *gorm.DB) error {
+	return decryptSecretField(&p.ClientSecret)
+}
+
+func (p *CustomOAuthProvider) restoreSecretPlaintext() {
+	_ = decryptSecretField(&p.ClientSecret)
+}
+
+func (option *Option) BeforeSave(tx *gorm.DB) error {
+	if !encryptedOptionKeys[option.Key] {
+		return nil
+	}
+	return encryptSecretColumn(tx, "value", &option.Value)
+}
+
+func (option *Option) AfterSave(tx *gorm.DB) error {
+	return decryptSecretField(&option.Value)
+}
+
+func (option *Option) AfterFind(tx *gorm.DB) error {
+	return decryptSecretField(&option.Value)
+}
+
+func (option *Option) restoreSecretPlaintext() {
+	_ = decryptSecretField(&option.Value)
+}
+
+// secretPlaintextRestorer 由 BeforeSave 就地加密敏感字段的模型实现
+type secretPlaintextRestorer interface {
+	restoreSecretPlaintext()
+}
+
+// restoreSecretsOnError 写入失败时 AfterSave 不会执行，结构体中残留密文，这里将其还原为明文，
+// 避免调用方继续使用（如重试保存、写入缓存）密文
+func restoreSecretsOnError(db *gorm.DB) {
+	if db.Error == nil || !db.Statement.ReflectValue.IsValid() {
+		return
+	}
+	restore := func(value reflect.Value) {
+		if value.Kind() != reflect.Ptr && value.CanAddr() {
+			value = value.Addr()
+		}
+		if value.CanInterface() {
+			if restorer, ok := value.Interface().(secretPlaintextRestorer); ok {
+				restorer.restoreSecretPlaintext()
+			}
+		}
+	}
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			restore(db.Statement.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		restore(db.Statement.ReflectValue)
+	}
+}
+
+// RegisterSecretCallbacks 注册写入失败时还原敏感字段明文的回调，需在 DB 初始化后调用
+func RegisterSecretCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:after_create").Register("new_api:restore_secrets", restoreSecretsOnError); err != nil {
+		return err
+	}
+	return db.Callback().Update().After("gorm:after_update").Register("new_api:restore_secrets", restoreSecretsOnError)
+}
+
+// 用户设置以 JSON 保存，其中的 webhook 密钥单独加密
+func encryptUserSettingSecrets(setting *dto.UserSetting) error {
+	encrypted, err := common.EncryptSecret(setting.WebhookSecret)
+	if err != nil {
+		return err
+	}
+	setting.WebhookSecret = encrypted
+	return nil
+}
+
+func decryptUserSettingSecrets(setting *dto.UserSetting) {
+	if err := decryptSecretField(&setting.WebhookSecret); err != nil {
+		common.SysError("failed to decrypt user webhook secret: " + err.Error())
+		setting.WebhookSecret = ""
+	}
+}
+
+// MigrateSecrets 加密存量的明文敏感字段，并将旧主密钥加密的字段改由当前主密钥加密
+func MigrateSecrets() error {
+	if !common.SecretEncryptionEnabled() {
+		return fmt.Errorf("SECRET_MASTER_KEY is not configured")
+	}
+	total := 0
+
+	var channels []struct {
+		Id        int
+		Key       string
+		KeyDigest string
+	}
+	if err := DB.Model(&Channel{}).Select("id", "key", "key_digest").Find(&channels).Error; err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		value, changed, err := common.ReencryptSecret(channel.Key)
+		if err != nil {
+			return fmt.Errorf("channel %d: %w", channel.Id, err)
+		}
+		// 查询摘要随主密钥变化，轮换后需重新计算
+		plaintext, err := common.DecryptSecret(value)
+		if err != nil {
+			return fmt.Errorf("channel %d: %w", channel.Id, err)
+		}
+		digest := common.SecretLookupDigest(plaintext)
+		if changed || digest != channel.KeyDigest {
+			if err := DB.Model(&Channel{}).Where("id = ?", channel.Id).UpdateColumns(map[string]interface{}{
+				"key":        value,
+				"key_digest": digest,
+			}).Error; err != nil {
+				return err
+			}
+			total++
+		}
+	}
+
+	var providers []struct {
+		Id           int
+		ClientSecret string
+	}
+	if err := DB.Model(&CustomOAuthProvider{}).Select("id", "client_secret").Find(&providers).Error; err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		value, changed, err := common.ReencryptSecret(provider.ClientSecret)
+		if err != nil {
+			return fmt.Errorf("custom oauth provider %d: %w", provider.Id, err)
+		}
+		if changed {
+			if err := DB.Model(&CustomOAuthProvider{}).Where("id = ?", provider.Id).UpdateColumn("client_secret", value).Error; err != nil {
+				return err
+			}
+			total++
+		}
+	}
+
+	for optionKey := range encryptedOptionKeys {
+		var options []struct {
+			Value string
+		}
+		if err := DB.Model(&Option{}).Select("value").Where(commonKeyCol+" = ?", optionKey).Find(&options).Error; err != nil {
+			return err
+		}
+		for _, option := range options {
+			value, changed, err := common.ReencryptSecret(option.Value)
+			if err != nil {
+				return fmt.Errorf("option %s: %w", optionKey, err)
+			}
+			if changed {
+				if err := DB.Model(&Option{}).Where(commonKeyCol+" = ?", optionKey).UpdateColumn("value", value).Error; err != nil {
+					return err
+				}
+				total++
+			}
+		}
+	}
+
+	var users []struct {
+		Id      int
+		Setting string
+	}
+	if err := DB.Model(&User{}).Select("id", "setting").Where("setting LIKE ?", "%webhook_secret%").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		setting := dto.UserSetting{}
+		if err := common.UnmarshalJsonStr(user.Setting, &setting); err != nil {
+			common.SysError(fmt.Sprintf("user %d: failed to unmarshal setting: %s", user.Id, err.Error()))
+			continue
+		}
+		value, changed, err := common.ReencryptSecret(setting.WebhookSecret)
+		if err != nil {
+			return fmt.Errorf("user %d: %w", user.Id, err)
+		}
+		if !changed {
+			continue
+		}
+		setting.WebhookSecret = value
+		settingBytes, err := common.Marshal(setting)
+		if err != nil {
+			return err
+		}
+		if err := DB.Model(&User{}).Where("id = ?", user.Id).UpdateColumn("setting", string(settingBytes)).Error; err != nil {
+			return err
+		}
+		total++
+	}
+
+	common.SysLog(fmt.Sprintf("migrated %d secrets", total))
+	return nil
+}
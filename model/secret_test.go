@@ -0,0 +1,170 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/secretref"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelKeyEncryptedAtRest(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	common.SetSecretMasterKeys("test-master-key")
+	t.Cleanup(func() { common.SetSecretMasterKeys("") })
+
+	channel := &Channel{Name: "encrypted", Key: "sk-upstream-secret"}
+	require.NoError(t, DB.Create(channel).Error)
+	require.Equal(t, "sk-upstream-secret", channel.Key)
+
+	var raw string
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", channel.Id).Pluck("key", &raw).Error)
+	require.True(t, common.IsEncryptedSecret(raw))
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-upstream-secret", loaded.Key)
+
+	// Update 传入 map 时同样加密
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("key", "sk-rotated").Error)
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", channel.Id).Pluck("key", &raw).Error)
+	require.True(t, common.IsEncryptedSecret(raw))
+	loaded, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-rotated", loaded.Key)
+}
+
+func TestSearchChannelsMatchesEncryptedKey(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	common.SetSecretMasterKeys("test-master-key")
+	t.Cleanup(func() { common.SetSecretMasterKeys("") })
+
+	channel := &Channel{Name: "searchable", Key: "sk-find-me"}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, DB.Create(&Channel{Name: "other", Key: "sk-other"}).Error)
+
+	found, err := SearchChannels("sk-find-me", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, channel.Id, found[0].Id)
+
+	// 通过 map 更新密钥时摘要同步更新
+	require.NoError(t, DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("key", "sk-rotated").Error)
+	found, err = SearchChannels("sk-find-me", "", "", false)
+	require.NoError(t, err)
+	require.Empty(t, found)
+	found, err = SearchChannels("sk-rotated", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	// 主密钥轮换后由 MigrateSecrets 重新计算摘要
+	require.NoError(t, DB.AutoMigrate(&CustomOAuthProvider{}, &Option{}))
+	common.SetSecretMasterKeys("rotated-master-key", "test-master-key")
+	found, err = SearchChannels("sk-rotated", "", "", false)
+	require.NoError(t, err)
+	require.Empty(t, found)
+	require.NoError(t, MigrateSecrets())
+	found, err = SearchChannels("sk-rotated", "", "", false)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+}
+
+func TestChannelKeyRestoredWhenSaveFails(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	common.SetSecretMasterKeys("test-master-key")
+	t.Cleanup(func() { common.SetSecretMasterKeys("") })
+
+	channel := &Channel{Name: "first", Key: "sk-first"}
+	require.NoError(t, DB.Create(channel).Error)
+
+	// 主键冲突导致写入失败，内存中的结构体仍应是明文
+	duplicate := &Channel{Id: channel.Id, Name: "duplicate", Key: "sk-duplicate"}
+	require.Error(t, DB.Create(duplicate).Error)
+	require.Equal(t, "sk-duplicate", duplicate.Key)
+}
+
+func TestMigrateSecretsEncryptsLegacyRows(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	require.NoError(t, DB.AutoMigrate(&CustomOAuthProvider{}, &Option{}))
+	require.NoError(t, DB.Create(&Option{Key: "StripeApiSecret", Value: "sk_live_legacy"}).Error)
+	require.NoError(t, DB.Create(&Channel{Name: "legacy", Key: "sk-legacy"}).Error)
+	user := &User{Username: "webhook"}
+	user.SetSetting(dto.UserSetting{WebhookSecret: "whsec-legacy"})
+	require.NoError(t, DB.Create(user).Error)
+
+	common.SetSecretMasterKeys("test-master-key")
+	t.Cleanup(func() {
+		common.SetSecretMasterKeys("")
+		DB.Exec("DELETE FROM options")
+	})
+	require.NoError(t, MigrateSecrets())
+
+	var raw string
+	require.NoError(t, DB.Model(&Channel{}).Where("name = ?", "legacy").Pluck("key", &raw).Error)
+	require.True(t, common.IsEncryptedSecret(raw))
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Pluck("setting", &raw).Error)
+	require.NotContains(t, raw, "whsec-legacy")
+
+	require.NoError(t, DB.Model(&Option{}).Where("key = ?", "StripeApiSecret").Pluck("value", &raw).Error)
+	require.True(t, common.IsEncryptedSecret(raw))
+	options, err := AllOption()
+	require.NoError(t, err)
+	require.Equal(t, "sk_live_legacy", options[0].Value)
+
+	setting, err := GetUserSetting(user.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "whsec-legacy", setting.WebhookSecret)
+}
+
+func TestChannelKeyResolvesSecretReferences(t *testing.T) {
+	secretref.SetDefault(secretref.NewResolver(secretref.Config{EnvPrefix: "CHANNEL_SECRET_"}))
+	t.Cleanup(func() { secretref.SetDefault(nil) })
+	t.Setenv("CHANNEL_SECRET_A", "sk-a")
+	t.Setenv("CHANNEL_SECRET_B", "AK|SK|us-east-1")
+
+	channel := &Channel{Id: 1, Key: "env://CHANNEL_SECRET_B"}
+	key, _, apiErr := channel.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	require.Equal(t, "AK|SK|us-east-1", key)
+
+	channel.Key = "env://CHANNEL_SECRET_MISSING"
+	_, _, apiErr = channel.GetNextEnabledKey()
+	require.NotNil(t, apiErr)
+
+	// 多 key 模式下按解析后的密钥定位被禁用的 key
+	channel = &Channel{Id: 1, Key: "env://CHANNEL_SECRET_A\nenv://CHANNEL_SECRET_B"}
+	channel.ChannelInfo.IsMultiKey = true
+	channel.ChannelInfo.MultiKeySize = 2
+	handlerMultiKeyUpdate(channel, "AK|SK|us-east-1", common.ChannelStatusAutoDisabled, "invalid key")
+	require.Equal(t, common.ChannelStatusAutoDisabled, channel.ChannelInfo.MultiKeyStatusList[1])
+
+	key, index, apiErr := channel.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	require.Equal(t, 0, index)
+	require.Equal(t, "sk-a", key)
+
+	// 余额查询、模型拉取等直接取完整密钥的路径
+	resolved, err := channel.GetResolvedKey()
+	require.NoError(t, err)
+	require.Equal(t, "sk-a\nAK|SK|us-east-1", resolved)
+	first, err := channel.GetFirstResolvedKey()
+	require.NoError(t, err)
+	require.Equal(t, "sk-a", first)
+
+	channel = &Channel{Id: 1, Key: "sk-literal"}
+	resolved, err = channel.GetResolvedKey()
+	require.NoError(t, err)
+	require.Equal(t, "sk-literal", resolved)
+
+	channel.Key = "env://CHANNEL_SECRET_MISSING"
+	_, err = channel.GetResolvedKey()
+	require.Error(t, err)
+	_, err = channel.GetFirstResolvedKey()
+	require.Error(t, err)
+}
@@ -21,6 +21,9 @@ func TestMain(m *testing.M) {
 	}
 	DB = db
 	LOG_DB = db
+	if err := RegisterSecretCallbacks(db); err != nil {
+		panic("failed to register secret callbacks: " + err.Error())
+	}
 
 	common.UsingSQLite = true
 	common.RedisEnabled = false
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -29,12 +31,21 @@ type Token struct {
 	Group              string         `json:"group" gorm:"default:''"`
 	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
+
+	// 轮换密钥后的过渡期内旧密钥仍然有效，PreviousKey 仅保存旧密钥的 HMAC
+	PreviousKey          string `json:"-" gorm:"type:char(64);index"`
+	PreviousKeyExpiresAt int64  `json:"previous_key_expires_at" gorm:"bigint;default:0;index"`
 }
 
 func (token *Token) Clean() {
 	token.Key = ""
 }
 
+// IsPreviousKey 判断 key 是否为轮换前的旧密钥，不检查过渡期是否结束
+func (token *Token) IsPreviousKey(key string) bool {
+	return token.PreviousKey != "" && key != "" && token.PreviousKey == common.GenerateHMAC(key)
+}
+
 func (token *Token) GetIpLimits() []string {
 	// delete empty spaces
 	//split with \n
@@ -169,6 +180,10 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		return nil, errors.New("未提供令牌")
 	}
 	token, err = GetTokenByKey(key, false)
+	if err == nil && token.IsPreviousKey(key) && token.PreviousKeyExpiresAt <= common.GetTimestamp() {
+		// 旧密钥过渡期已结束，缓存中残留的旧密钥不再有效
+		err = gorm.ErrRecordNotFound
+	}
 	if err == nil {
 		if token.Status == common.TokenStatusExhausted {
 			keyPrefix := key[:3]
@@ -176,6 +191,8 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
 		} else if token.Status == common.TokenStatusExpired {
 			return token, errors.New("该令牌已过期")
+		} else if token.Status == common.TokenStatusQuarantined {
+			return token, errors.New("该令牌疑似泄露已被隔离，请轮换密钥或联系管理员")
 		}
 		if token.Status != common.TokenStatusEnabled {
 			return token, errors.New("该令牌状态不可用")
@@ -240,6 +257,39 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// 最晚的旧密钥过期时间，没有处于过渡期的轮换时无效密钥不再多查一次 previous_key
+var (
+	previousKeyGraceUntil   atomic.Int64
+	previousKeyGraceChecked atomic.Int64
+)
+
+// 定期从数据库刷新，以便感知其他实例上的轮换
+const previousKeyGraceRefreshSeconds = 5
+
+func previousKeyGraceActive() bool {
+	now := common.GetTimestamp()
+	checked := previousKeyGraceChecked.Load()
+	if now-checked >= previousKeyGraceRefreshSeconds && previousKeyGraceChecked.CompareAndSwap(checked, now) {
+		var until int64
+		if err := DB.Model(&Token{}).Select("COALESCE(MAX(previous_key_expires_at), 0)").Scan(&until).Error; err != nil {
+			// 查询失败时保守地允许回退查询
+			previousKeyGraceChecked.Store(checked)
+			return true
+		}
+		previousKeyGraceUntil.Store(until)
+	}
+	return previousKeyGraceUntil.Load() > now
+}
+
+func extendPreviousKeyGrace(until int64) {
+	for {
+		current := previousKeyGraceUntil.Load()
+		if current >= until || previousKeyGraceUntil.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
+
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
@@ -261,6 +311,15 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	}
 	fromDB = true
 	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && previousKeyGraceActive() {
+		// 轮换过渡期内的旧密钥，返回的令牌 Key 保持为请求使用的旧密钥
+		var previous Token
+		if DB.Where("previous_key = ? and previous_key_expires_at > ?", common.GenerateHMAC(key), common.GetTimestamp()).
+			First(&previous).Error == nil {
+			previous.Key = key
+			return &previous, nil
+		}
+	}
 	return token, err
 }
 
@@ -310,6 +369,7 @@ func (token *Token) Delete() (err error) {
 				if err != nil {
 					common.SysLog("failed to delete token cache: " + err.Error())
 				}
+				cacheDeletePreviousToken(*token)
 			})
 		}
 	}()
@@ -366,7 +426,7 @@ func IncreaseTokenQuota(tokenId int, key string, quota int) (err error) {
 	}
 	if common.RedisEnabled {
 		gopool.Go(func() {
-			err := cacheIncrTokenQuota(key, int64(quota))
+			err := cacheIncrTokenQuota(tokenId, key, int64(quota))
 			if err != nil {
 				common.SysLog("failed to increase token quota: " + err.Error())
 			}
@@ -396,7 +456,7 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 	}
 	if common.RedisEnabled {
 		gopool.Go(func() {
-			err := cacheDecrTokenQuota(key, int64(quota))
+			err := cacheDecrTokenQuota(id, key, int64(quota))
 			if err != nil {
 				common.SysLog("failed to decrease token quota: " + err.Error())
 			}
@@ -454,9 +514,107 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 		gopool.Go(func() {
 			for _, t := range tokens {
 				_ = cacheDeleteToken(t.Key)
+				cacheDeletePreviousToken(t)
 			}
 		})
 	}
 
 	return len(tokens), nil
 }
+
+// RecordPreviousTokenKeyUse 异步记录轮换过渡期内对旧密钥的使用
+func RecordPreviousTokenKeyUse(token *Token, clientIp string) {
+	userId, tokenId, name, expiresAt := token.UserId, token.Id, token.Name, token.PreviousKeyExpiresAt
+	gopool.Go(func() {
+		RecordLog(userId, LogTypeSystem, fmt.Sprintf("令牌「%s」(#%d) 使用了轮换前的旧密钥（来源 IP %s），旧密钥将于 %s 失效，请尽快更换为新密钥",
+			name, tokenId, clientIp, time.Unix(expiresAt, 0).Format("2006-01-02 15:04:05")))
+	})
+}
+
+// QuarantineToken 隔离令牌，仅对启用中的令牌生效，返回是否发生了状态变化
+func QuarantineToken(tokenId int) (bool, error) {
+	result := DB.Model(&Token{}).
+		Where("id = ? and status = ?", tokenId, common.TokenStatusEnabled).
+		Update("status", common.TokenStatusQuarantined)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	refreshTokenCache(tokenId)
+	return true, nil
+}
+
+// PinTokenAllowIps 为未设置 IP 白名单的令牌设置白名单，返回是否发生了变化
+func PinTokenAllowIps(tokenId int, ips []string) (bool, error) {
+	if len(ips) == 0 {
+		return false, nil
+	}
+	allowIps := strings.Join(ips, "\n")
+	result := DB.Model(&Token{}).
+		Where("id = ? and (allow_ips = '' or allow_ips is null)", tokenId).
+		Update("allow_ips", allowIps)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	refreshTokenCache(tokenId)
+	return true, nil
+}
+
+// RotateTokenKey 为令牌生成新密钥，保留令牌的其他设置。graceSeconds 大于 0 时旧密钥在过渡期内仍然有效，
+// 用量计入同一令牌；被隔离的令牌轮换后恢复启用，且旧密钥立即失效
+func RotateTokenKey(tokenId int, userId int, graceSeconds int64) (*Token, error) {
+	token, err := GetTokenByIds(tokenId, userId)
+	if err != nil {
+		return nil, err
+	}
+	oldKey := token.Key
+	newKey, err := common.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"key":                     newKey,
+		"previous_key":            "",
+		"previous_key_expires_at": int64(0),
+	}
+	if token.Status == common.TokenStatusQuarantined {
+		updates["status"] = common.TokenStatusEnabled
+	} else if graceSeconds > 0 {
+		updates["previous_key"] = common.GenerateHMAC(oldKey)
+		updates["previous_key_expires_at"] = common.GetTimestamp() + graceSeconds
+	}
+	result := DB.Model(&Token{}).Where("id = ? and "+commonKeyCol+" = ?", token.Id, oldKey).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("令牌已被修改，请重试")
+	}
+	extendPreviousKeyGrace(updates["previous_key_expires_at"].(int64))
+	// 再次轮换时更早的旧密钥立即失效
+	replaced := *token
+	token.Key = newKey
+	token.PreviousKey = updates["previous_key"].(string)
+	token.PreviousKeyExpiresAt = updates["previous_key_expires_at"].(int64)
+	if status, ok := updates["status"]; ok {
+		token.Status = status.(int)
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheDeleteToken(oldKey); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+			cacheDeletePreviousToken(replaced)
+		})
+	}
+	return token, nil
+}
+
+func refreshTokenCache(tokenId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	// GetTokenById 从数据库读取后会异步刷新缓存
+	if _, err := GetTokenById(tokenId); err != nil {
+		common.SysLog("failed to refresh token cache: " + err.Error())
+	}
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const tokenProfileMaxNetworks = 200
+
+// TokenUsageProfile 令牌的历史使用画像，用于泄露检测。
+// Networks 为见过的客户端网段（IPv4 /24、IPv6 /48）及其首次、最近出现时间，HourCounts 为按小时统计的请求数，ModelCounts 为按模型统计的请求数
+type TokenUsageProfile struct {
+	TokenId       int    `json:"token_id" gorm:"primaryKey;autoIncrement:false"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Networks      string `json:"networks" gorm:"type:text"`
+	HourCounts    string `json:"hour_counts" gorm:"type:text"`
+	ModelCounts   string `json:"model_counts" gorm:"type:text"`
+	TotalRequests int64  `json:"total_requests"`
+	FirstSeen     int64  `json:"first_seen" gorm:"bigint"`
+	LastSeen      int64  `json:"last_seen" gorm:"bigint"`
+}
+
+// TokenUsageDelta 单个节点在两次落库之间累积的令牌使用增量
+type TokenUsageDelta struct {
+	UserId     int
+	Networks   map[string]int64 // 网段 -> 最近出现时间
+	HourCounts [24]int64
+	Models     map[string]int64
+	Requests   int64
+	LastSeen   int64
+}
+
+// TokenProfileData 解析后的令牌使用画像
+type TokenProfileData struct {
+	Networks      map[string][2]int64 // 网段 -> [首次出现时间, 最近出现时间]
+	HourCounts    [24]int64
+	ModelCounts   map[string]int64
+	TotalRequests int64
+	FirstSeen     int64
+}
+
+// Parse 解析画像中的 JSON 字段
+func (profile *TokenUsageProfile) Parse() TokenProfileData {
+	data := TokenProfileData{
+		Networks:      map[string][2]int64{},
+		ModelCounts:   map[string]int64{},
+		TotalRequests: profile.TotalRequests,
+		FirstSeen:     profile.FirstSeen,
+	}
+	_ = common.UnmarshalJsonStr(profile.Networks, &data.Networks)
+	_ = common.UnmarshalJsonStr(profile.HourCounts, &data.HourCounts)
+	_ = common.UnmarshalJsonStr(profile.ModelCounts, &data.ModelCounts)
+	return data
+}
+
+// GetTokenUsageProfile 获取令牌使用画像，不存在时返回空画像
+func GetTokenUsageProfile(tokenId int) (TokenProfileData, error) {
+	var profile TokenUsageProfile
+	err := DB.Where("token_id = ?", tokenId).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return (&TokenUsageProfile{}).Parse(), nil
+	}
+	if err != nil {
+		return TokenProfileData{}, err
+	}
+	return profile.Parse(), nil
+}
+
+// MergeTokenUsageDelta 将增量合并到令牌使用画像。网段数量超过上限时淘汰最久未出现的网段
+func MergeTokenUsageDelta(tokenId int, delta *TokenUsageDelta) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var profile TokenUsageProfile
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("token_id = ?", tokenId).First(&profile).Error
+		isNew := errors.Is(err, gorm.ErrRecordNotFound)
+		if err != nil && !isNew {
+			return err
+		}
+		data := profile.Parse()
+		if isNew {
+			profile = TokenUsageProfile{TokenId: tokenId, UserId: delta.UserId, FirstSeen: common.GetTimestamp()}
+		}
+		for network, seen := range delta.Networks {
+			times, ok := data.Networks[network]
+			if !ok {
+				times[0] = seen
+			}
+			if seen > times[1] {
+				times[1] = seen
+			}
+			data.Networks[network] = times
+		}
+		if len(data.Networks) > tokenProfileMaxNetworks {
+			networks := make([]string, 0, len(data.Networks))
+			for network := range data.Networks {
+				networks = append(networks, network)
+			}
+			sort.Slice(networks, func(i, j int) bool {
+				return data.Networks[networks[i]][1] > data.Networks[networks[j]][1]
+			})
+			for _, network := range networks[tokenProfileMaxNetworks:] {
+				delete(data.Networks, network)
+			}
+		}
+		for hour, count := range delta.HourCounts {
+			data.HourCounts[hour] += count
+		}
+		for modelName, count := range delta.Models {
+			data.ModelCounts[modelName] += count
+		}
+
+		networks, _ := common.Marshal(data.Networks)
+		hours, _ := common.Marshal(data.HourCounts)
+		models, _ := common.Marshal(data.ModelCounts)
+		profile.Networks = string(networks)
+		profile.HourCounts = string(hours)
+		profile.ModelCounts = string(models)
+		profile.TotalRequests += delta.Requests
+		if delta.LastSeen > profile.LastSeen {
+			profile.LastSeen = delta.LastSeen
+		}
+		// 其他节点可能在读取后并发创建了画像，冲突时更新该行，请求数按增量累加
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "token_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"networks":       profile.Networks,
+				"hour_counts":    profile.HourCounts,
+				"model_counts":   profile.ModelCounts,
+				"total_requests": gorm.Expr("total_requests + ?", delta.Requests),
+				"last_seen":      profile.LastSeen,
+			}),
+		}).Create(&profile).Error
+	})
+}
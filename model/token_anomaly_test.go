@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeTokenUsageDeltaUpsert(t *testing.T) {
+	require.NoError(t, DB.AutoMigrate(&TokenUsageProfile{}))
+	t.Cleanup(func() { DB.Exec("DELETE FROM token_usage_profiles") })
+
+	first := &TokenUsageDelta{UserId: 1, Networks: map[string]int64{"203.0.113.0/24": 100}, Models: map[string]int64{"gpt-4o": 2}, Requests: 2, LastSeen: 100}
+	first.HourCounts[3] = 2
+	require.NoError(t, MergeTokenUsageDelta(7, first))
+
+	second := &TokenUsageDelta{UserId: 1, Networks: map[string]int64{"203.0.113.0/24": 200, "198.51.100.0/24": 150}, Models: map[string]int64{"gpt-4o": 1}, Requests: 1, LastSeen: 200}
+	second.HourCounts[3] = 1
+	require.NoError(t, MergeTokenUsageDelta(7, second))
+
+	var count int64
+	require.NoError(t, DB.Model(&TokenUsageProfile{}).Where("token_id = ?", 7).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+
+	profile, err := GetTokenUsageProfile(7)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, profile.TotalRequests)
+	require.EqualValues(t, 3, profile.HourCounts[3])
+	require.EqualValues(t, 3, profile.ModelCounts["gpt-4o"])
+	require.Equal(t, [2]int64{100, 200}, profile.Networks["203.0.113.0/24"])
+	require.Equal(t, [2]int64{150, 150}, profile.Networks["198.51.100.0/24"])
+}
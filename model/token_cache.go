@@ -1,23 +1,49 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/go-redis/redis/v8"
 )
 
 func cacheSetToken(token Token) error {
+	expiration := time.Duration(common.RedisKeyCacheSeconds()) * time.Second
+	if token.IsPreviousKey(token.Key) {
+		// 旧密钥的缓存不能超过轮换过渡期
+		remain := time.Duration(token.PreviousKeyExpiresAt-common.GetTimestamp()) * time.Second
+		if remain <= 0 {
+			return cacheDeleteToken(token.Key)
+		}
+		expiration = min(expiration, remain)
+	} else {
+		// 当前密钥的令牌信息发生变化时，旧密钥的缓存一并失效，下次使用时从数据库重新加载
+		cacheDeletePreviousToken(token)
+	}
 	key := common.GenerateHMAC(token.Key)
 	token.Clean()
-	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, expiration)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// cacheDeletePreviousToken 删除轮换前旧密钥的缓存，PreviousKey 即为缓存使用的 HMAC
+func cacheDeletePreviousToken(token Token) {
+	if token.PreviousKey == "" {
+		return
+	}
+	if err := common.RedisDelKey(fmt.Sprintf("token:%s", token.PreviousKey)); err != nil {
+		common.SysLog("failed to delete previous token cache: " + err.Error())
+	}
+}
+
 func cacheDeleteToken(key string) error {
 	key = common.GenerateHMAC(key)
 	err := common.RedisDelKey(fmt.Sprintf("token:%s", key))
@@ -27,17 +53,49 @@ func cacheDeleteToken(key string) error {
 	return nil
 }
 
-func cacheIncrTokenQuota(key string, increment int64) error {
-	key = common.GenerateHMAC(key)
-	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", key), constant.TokenFiledRemainQuota, increment)
+func cacheIncrTokenQuota(tokenId int, key string, increment int64) error {
+	hmacKey := common.GenerateHMAC(key)
+	err := common.RedisHIncrBy(fmt.Sprintf("token:%s", hmacKey), constant.TokenFiledRemainQuota, increment)
 	if err != nil {
 		return err
 	}
+	cacheDeleteSiblingToken(tokenId, hmacKey)
 	return nil
 }
 
-func cacheDecrTokenQuota(key string, decrement int64) error {
-	return cacheIncrTokenQuota(key, -decrement)
+func cacheDecrTokenQuota(tokenId int, key string, decrement int64) error {
+	return cacheIncrTokenQuota(tokenId, key, -decrement)
+}
+
+// cacheDeleteSiblingToken 轮换过渡期内新旧密钥各有一份令牌缓存，其中一份的余额变化后删除另一份，
+// 下次使用时从数据库重新加载。缓存中没有当前密钥时从数据库查出新旧密钥
+func cacheDeleteSiblingToken(tokenId int, hmacKey string) {
+	previousKey, err := common.RDB.HGet(context.Background(), fmt.Sprintf("token:%s", hmacKey), "PreviousKey").Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		common.SysLog("failed to get token cache: " + err.Error())
+		return
+	}
+	if err == nil && previousKey == "" {
+		return
+	}
+	if err == nil && previousKey != hmacKey {
+		if err := common.RedisDelKey(fmt.Sprintf("token:%s", previousKey)); err != nil {
+			common.SysLog("failed to delete previous token cache: " + err.Error())
+		}
+		return
+	}
+	var token Token
+	if err := DB.Where("id = ?", tokenId).First(&token).Error; err != nil {
+		return
+	}
+	if token.PreviousKey != "" && token.PreviousKey != hmacKey {
+		cacheDeletePreviousToken(token)
+	}
+	if common.GenerateHMAC(token.Key) != hmacKey {
+		if err := cacheDeleteToken(token.Key); err != nil {
+			common.SysLog("failed to delete token cache: " + err.Error())
+		}
+	}
 }
 
 func cacheSetTokenField(key string, field string, value string) error {
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantineAndRotateToken(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	token := &Token{UserId: 1, Key: "quarantine-old-key", Name: "leaked", Status: common.TokenStatusEnabled, UnlimitedQuota: true, ExpiredTime: -1}
+	require.NoError(t, DB.Create(token).Error)
+
+	quarantined, err := QuarantineToken(token.Id)
+	require.NoError(t, err)
+	require.True(t, quarantined)
+	quarantined, err = QuarantineToken(token.Id)
+	require.NoError(t, err)
+	require.False(t, quarantined)
+
+	_, err = ValidateUserToken("quarantine-old-key")
+	require.Error(t, err)
+
+	// 其他用户不能轮换该令牌
+	_, err = RotateTokenKey(token.Id, 2, 0)
+	require.Error(t, err)
+
+	rotated, err := RotateTokenKey(token.Id, 1, 3600)
+	require.NoError(t, err)
+	require.NotEqual(t, "quarantine-old-key", rotated.Key)
+	require.Equal(t, common.TokenStatusEnabled, rotated.Status)
+
+	_, err = GetTokenByKey("quarantine-old-key", true)
+	require.Error(t, err)
+	_, err = ValidateUserToken(rotated.Key)
+	require.NoError(t, err)
+}
+
+func TestRotateTokenKeyWithOverlap(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	token := &Token{UserId: 1, Key: "overlap-first-key", Name: "rotating", Status: common.TokenStatusEnabled, UnlimitedQuota: true, ExpiredTime: -1}
+	require.NoError(t, DB.Create(token).Error)
+
+	rotated, err := RotateTokenKey(token.Id, 1, 3600)
+	require.NoError(t, err)
+
+	// 过渡期内旧密钥仍然有效，且指向同一令牌
+	previous, err := ValidateUserToken("overlap-first-key")
+	require.NoError(t, err)
+	require.Equal(t, token.Id, previous.Id)
+	require.True(t, previous.IsPreviousKey("overlap-first-key"))
+	current, err := ValidateUserToken(rotated.Key)
+	require.NoError(t, err)
+	require.Equal(t, token.Id, current.Id)
+	require.False(t, current.IsPreviousKey(rotated.Key))
+
+	// 再次轮换后更早的旧密钥立即失效
+	again, err := RotateTokenKey(token.Id, 1, 3600)
+	require.NoError(t, err)
+	_, err = ValidateUserToken("overlap-first-key")
+	require.Error(t, err)
+	_, err = ValidateUserToken(rotated.Key)
+	require.NoError(t, err)
+
+	// 过渡期结束后旧密钥失效
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Update("previous_key_expires_at", common.GetTimestamp()-1).Error)
+	_, err = ValidateUserToken(rotated.Key)
+	require.Error(t, err)
+	_, err = ValidateUserToken(again.Key)
+	require.NoError(t, err)
+}
+
+func TestPreviousKeyLookupOnlyDuringGrace(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	previousKeyGraceUntil.Store(0)
+	previousKeyGraceChecked.Store(0)
+	token := &Token{UserId: 1, Key: "grace-first-key", Name: "grace", Status: common.TokenStatusEnabled, UnlimitedQuota: true, ExpiredTime: -1}
+	require.NoError(t, DB.Create(token).Error)
+
+	// 没有处于过渡期的轮换时，未知密钥不再查询 previous_key
+	require.False(t, previousKeyGraceActive())
+	_, err := GetTokenByKey("grace-unknown-key", true)
+	require.Error(t, err)
+
+	rotated, err := RotateTokenKey(token.Id, 1, 3600)
+	require.NoError(t, err)
+	require.True(t, previousKeyGraceActive())
+	previous, err := GetTokenByKey("grace-first-key", true)
+	require.NoError(t, err)
+	require.Equal(t, token.Id, previous.Id)
+
+	// 过渡期结束并刷新后恢复为单次查询
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Update("previous_key_expires_at", common.GetTimestamp()-1).Error)
+	previousKeyGraceChecked.Store(0)
+	require.False(t, previousKeyGraceActive())
+	_, err = GetTokenByKey(rotated.Key, true)
+	require.NoError(t, err)
+}
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	UsageStatementFormatCSV     = "csv"
+	UsageStatementFormatParquet = "parquet"
+
+	UsageStatementStatusPending   = "pending"
+	UsageStatementStatusRunning   = "running"
+	UsageStatementStatusSucceeded = "succeeded"
+	UsageStatementStatusFailed    = "failed"
+)
+
+// UsageStatementJob 用量对账单异步生成任务
+type UsageStatementJob struct {
+	Id int `json:"id"`
+	// CreatorId 发起任务的用户，普通用户只能查看和下载自己发起的任务
+	CreatorId      int    `json:"creator_id" gorm:"index"`
+	UserId         int    `json:"user_id"`
+	TokenId        int    `json:"token_id"`
+	ModelName      string `json:"model_name" gorm:"type:varchar(255);default:''"`
+	StartTimestamp int64  `json:"start_timestamp" gorm:"bigint"`
+	EndTimestamp   int64  `json:"end_timestamp" gorm:"bigint"`
+	Format         string `json:"format" gorm:"type:varchar(16)"`
+	Status         string `json:"status" gorm:"type:varchar(16);index"`
+	Rows           int    `json:"rows"`
+	Size           int64  `json:"size"`
+	FilePath       string `json:"-" gorm:"type:varchar(512);default:''"`
+	Error          string `json:"error" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	FinishedAt     int64  `json:"finished_at" gorm:"bigint"`
+	ExpiresAt      int64  `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (job *UsageStatementJob) Insert() error {
+	return DB.Create(job).Error
+}
+
+func (job *UsageStatementJob) Update() error {
+	return DB.Model(job).Select("status", "rows", "size", "file_path", "error", "finished_at", "expires_at").Updates(job).Error
+}
+
+func GetUsageStatementJobById(id int) (*UsageStatementJob, error) {
+	var job UsageStatementJob
+	err := DB.Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetUsageStatementJobs creatorId 为 0 时返回所有任务
+func GetUsageStatementJobs(creatorId int, startIdx int, num int) (jobs []*UsageStatementJob, total int64, err error) {
+	tx := DB.Model(&UsageStatementJob{})
+	if creatorId != 0 {
+		tx = tx.Where("creator_id = ?", creatorId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&jobs).Error
+	return jobs, total, err
+}
+
+func CountActiveUsageStatementJobs(creatorId int) (count int64, err error) {
+	err = DB.Model(&UsageStatementJob{}).
+		Where("creator_id = ? and status in ?", creatorId, []string{UsageStatementStatusPending, UsageStatementStatusRunning}).
+		Count(&count).Error
+	return count, err
+}
+
+func GetExpiredUsageStatementJobs(now int64, limit int) (jobs []*UsageStatementJob, err error) {
+	err = DB.Where("expires_at > 0 and expires_at < ?", now).Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+func DeleteUsageStatementJobsByIds(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Where("id in ?", ids).Delete(&UsageStatementJob{}).Error
+}
+
+// FailStaleUsageStatementJobs 将因进程重启等原因中断的任务标记为失败
+func FailStaleUsageStatementJobs(before int64) error {
+	return DB.Model(&UsageStatementJob{}).
+		Where("status in ? and created_at < ?", []string{UsageStatementStatusPending, UsageStatementStatusRunning}, before).
+		Updates(map[string]interface{}{
+			"status":      UsageStatementStatusFailed,
+			"error":       "job interrupted",
+			"finished_at": common.GetTimestamp(),
+		}).Error
+}
+
+// UsageStatementQuery 对账单查询条件，零值字段表示不过滤
+type UsageStatementQuery struct {
+	UserId         int
+	TokenId        int
+	ModelName      string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// UsageStatementRow 按天、用户、令牌、模型汇总的用量
+type UsageStatementRow struct {
+	Date             string
+	UserId           int
+	Username         string
+	TokenId          int
+	TokenName        string
+	ModelName        string
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	// Quota 消费额度减去退款额度
+	Quota int64
+}
+
+// AggregateUsageStatement 汇总消费与退款日志，日期按服务器时区划分
+func AggregateUsageStatement(query UsageStatementQuery) ([]*UsageStatementRow, error) {
+	rows := make(map[string]*UsageStatementRow)
+	add := func(log *Log) {
+		date := time.Unix(log.CreatedAt, 0).Format("2006-01-02")
+		key := fmt.Sprintf("%s|%d|%d|%s", date, log.UserId, log.TokenId, log.ModelName)
+		row, ok := rows[key]
+		if !ok {
+			row = &UsageStatementRow{
+				Date:      date,
+				UserId:    log.UserId,
+				TokenId:   log.TokenId,
+				ModelName: log.ModelName,
+			}
+			rows[key] = row
+		}
+		if log.Username != "" {
+			row.Username = log.Username
+		}
+		if log.TokenName != "" {
+			row.TokenName = log.TokenName
+		}
+		if log.Type == LogTypeRefund {
+			row.Quota -= int64(log.Quota)
+			return
+		}
+		row.Requests++
+		row.PromptTokens += int64(log.PromptTokens)
+		row.CompletionTokens += int64(log.CompletionTokens)
+		row.Quota += int64(log.Quota)
+	}
+
+	if err := iterateUsageStatementLogs(query, add); err != nil {
+		return nil, err
+	}
+
+	result := make([]*UsageStatementRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.UserId != b.UserId {
+			return a.UserId < b.UserId
+		}
+		if a.TokenId != b.TokenId {
+			return a.TokenId < b.TokenId
+		}
+		return a.ModelName < b.ModelName
+	})
+	return result, nil
+}
+
+const usageStatementBatchSize = 2000
+
+func iterateUsageStatementLogs(query UsageStatementQuery, fn func(log *Log)) error {
+	if reader := getLogReader(); reader != nil {
+		for _, logType := range []int{LogTypeConsume, LogTypeRefund} {
+			logQuery := LogQuery{
+				UserId:  query.UserId,
+				LogType: logType,
+				TokenId: query.TokenId,
+				// 精确匹配模型名，转义 LIKE 通配符
+				ModelName:        strings.NewReplacer("!", "!!", "_", "!_", "%", "!%").Replace(query.ModelName),
+				ModelNameEscaped: true,
+				StartTimestamp:   query.StartTimestamp,
+				EndTimestamp:     query.EndTimestamp,
+				SkipCount:        true,
+			}
+			// 按 (created_at, id) 倒序以 keyset 游标翻页，期间新写入的日志不会导致重复或遗漏
+			for {
+				logs, _, err := reader.QueryLogs(context.Background(), logQuery, 0, usageStatementBatchSize)
+				if err != nil {
+					return err
+				}
+				for _, log := range logs {
+					fn(log)
+				}
+				if len(logs) < usageStatementBatchSize {
+					break
+				}
+				last := logs[len(logs)-1]
+				logQuery.BeforeCreatedAt = last.CreatedAt
+				logQuery.BeforeId = int64(last.Id)
+			}
+		}
+		return nil
+	}
+
+	tx := LOG_DB.Model(&Log{}).
+		Select("id, user_id, username, token_id, token_name, model_name, type, created_at, quota, prompt_tokens, completion_tokens").
+		Where("type in ?", []int{LogTypeConsume, LogTypeRefund})
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.TokenId != 0 {
+		tx = tx.Where("token_id = ?", query.TokenId)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	var batch []*Log
+	return tx.FindInBatches(&batch, usageStatementBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, log := range batch {
+			fn(log)
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateUsageStatement(t *testing.T) {
+	truncateTables(t)
+
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local).Unix()
+	logs := []*Log{
+		{UserId: 1, Username: "alice", TokenId: 10, TokenName: "prod", ModelName: "gpt-4o", Type: LogTypeConsume, CreatedAt: day, Quota: 100, PromptTokens: 10, CompletionTokens: 5},
+		{UserId: 1, Username: "alice", TokenId: 10, TokenName: "prod", ModelName: "gpt-4o", Type: LogTypeConsume, CreatedAt: day + 60, Quota: 50, PromptTokens: 4, CompletionTokens: 1},
+		{UserId: 1, Username: "alice", TokenId: 10, TokenName: "prod", ModelName: "gpt-4o", Type: LogTypeRefund, CreatedAt: day + 120, Quota: 30},
+		{UserId: 1, Username: "alice", TokenId: 10, TokenName: "prod", ModelName: "gpt-4o", Type: LogTypeConsume, CreatedAt: day + 86400, Quota: 7},
+		{UserId: 1, Username: "alice", TokenId: 10, ModelName: "gpt-4o", Type: LogTypeError, CreatedAt: day},
+		{UserId: 2, Username: "bob", TokenId: 20, ModelName: "claude-3", Type: LogTypeConsume, CreatedAt: day, Quota: 9},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+
+	rows, err := AggregateUsageStatement(UsageStatementQuery{UserId: 1, StartTimestamp: day - 3600, EndTimestamp: day + 2*86400})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	first := rows[0]
+	require.Equal(t, "2026-03-01", first.Date)
+	require.Equal(t, "prod", first.TokenName)
+	require.EqualValues(t, 2, first.Requests)
+	require.EqualValues(t, 14, first.PromptTokens)
+	require.EqualValues(t, 6, first.CompletionTokens)
+	require.EqualValues(t, 120, first.Quota)
+
+	require.Equal(t, "2026-03-02", rows[1].Date)
+	require.EqualValues(t, 7, rows[1].Quota)
+}
+
+// stubKeysetLogReader 按 (created_at, id) 倒序返回日志，每次翻页前写入一条更新的日志
+type stubKeysetLogReader struct {
+	LogReader
+	logs    []*Log
+	queries []LogQuery
+}
+
+func (r *stubKeysetLogReader) QueryLogs(ctx context.Context, query LogQuery, startIdx int, num int) ([]*Log, int64, error) {
+	r.queries = append(r.queries, query)
+	var page []*Log
+	for i := len(r.logs) - 1; i >= 0 && len(page) < num; i-- {
+		log := r.logs[i]
+		if log.Type != query.LogType {
+			continue
+		}
+		if query.BeforeCreatedAt != 0 && (log.CreatedAt > query.BeforeCreatedAt || log.CreatedAt == query.BeforeCreatedAt && int64(log.Id) >= query.BeforeId) {
+			continue
+		}
+		page = append(page, log)
+	}
+	last := r.logs[len(r.logs)-1]
+	r.logs = append(r.logs, &Log{Id: last.Id + 1, UserId: 1, ModelName: "gpt-4o", Type: LogTypeConsume, CreatedAt: last.CreatedAt + 1, Quota: 1000})
+	return page[startIdx:], 0, nil
+}
+
+func TestAggregateUsageStatementLogReaderKeyset(t *testing.T) {
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local).Unix()
+	reader := &stubKeysetLogReader{}
+	total := usageStatementBatchSize + usageStatementBatchSize/2
+	for i := 0; i < total; i++ {
+		// 同一秒内有多条日志，游标需要同时比较 id
+		reader.logs = append(reader.logs, &Log{Id: i + 1, UserId: 1, ModelName: "gpt-4o", Type: LogTypeConsume, CreatedAt: day + int64(i/10), Quota: 1})
+	}
+	logSinkMu.Lock()
+	saved := logSinkReader
+	logSinkReader = reader
+	logSinkMu.Unlock()
+	t.Cleanup(func() {
+		logSinkMu.Lock()
+		logSinkReader = saved
+		logSinkMu.Unlock()
+	})
+
+	rows, err := AggregateUsageStatement(UsageStatementQuery{UserId: 1, StartTimestamp: day - 3600, EndTimestamp: day + 3600})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.EqualValues(t, total, rows[0].Requests)
+	require.EqualValues(t, total, rows[0].Quota)
+
+	for _, query := range reader.queries {
+		require.True(t, query.SkipCount)
+	}
+	require.Zero(t, reader.queries[0].BeforeCreatedAt)
+	cursor := reader.logs[total-usageStatementBatchSize]
+	require.Equal(t, cursor.CreatedAt, reader.queries[1].BeforeCreatedAt)
+	require.EqualValues(t, cursor.Id, reader.queries[1].BeforeId)
+}
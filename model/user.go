@@ -83,11 +83,16 @@ func (user *User) GetSetting() dto.UserSetting {
 		if err != nil {
 			common.SysLog("failed to unmarshal setting: " + err.Error())
 		}
+		decryptUserSettingSecrets(&setting)
 	}
 	return setting
 }
 
 func (user *User) SetSetting(setting dto.UserSetting) {
+	if err := encryptUserSettingSecrets(&setting); err != nil {
+		common.SysLog("failed to encrypt setting: " + err.Error())
+		return
+	}
 	settingBytes, err := json.Marshal(setting)
 	if err != nil {
 		common.SysLog("failed to marshal setting: " + err.Error())
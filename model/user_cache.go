@@ -40,6 +40,7 @@ func (user *UserBase) GetSetting() dto.UserSetting {
 		if err != nil {
 			common.SysLog("failed to unmarshal setting: " + err.Error())
 		}
+		decryptUserSettingSecrets(&setting)
 	}
 	return setting
 }
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"context"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// UserModelUsage 记录用户首次使用各模型的时间，用于首次使用模型告警
+type UserModelUsage struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_user_model_usage"`
+	ModelName   string `json:"model_name" gorm:"type:varchar(255);uniqueIndex:idx_user_model_usage"`
+	FirstUsedAt int64  `json:"first_used_at" gorm:"bigint"`
+}
+
+// MarkUserModelUsed 记录用户使用了某个模型，返回是否为首次使用。
+// 用户尚无记录时先从消费日志回填 before 之前用过的模型，避免历史模型被误判为首次使用
+func MarkUserModelUsed(userId int, modelName string, before int64) (bool, error) {
+	var count int64
+	if err := DB.Model(&UserModelUsage{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		if err := backfillUserModelUsage(userId, before); err != nil {
+			return false, err
+		}
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserModelUsage{
+		UserId:      userId,
+		ModelName:   modelName,
+		FirstUsedAt: common.GetTimestamp(),
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func backfillUserModelUsage(userId int, before int64) error {
+	var modelNames []string
+	var err error
+	if reader := getLogReader(); reader != nil {
+		modelNames, err = reader.DistinctModelNames(context.Background(), LogQuery{
+			UserId:       userId,
+			LogType:      LogTypeConsume,
+			EndTimestamp: before - 1,
+		})
+	} else {
+		err = LOG_DB.Model(&Log{}).
+			Where("user_id = ? and type = ? and created_at < ?", userId, LogTypeConsume, before).
+			Distinct("model_name").Pluck("model_name", &modelNames).Error
+	}
+	if err != nil {
+		return err
+	}
+	usages := make([]UserModelUsage, 0, len(modelNames))
+	now := common.GetTimestamp()
+	for _, name := range modelNames {
+		if name == "" {
+			continue
+		}
+		usages = append(usages, UserModelUsage{UserId: userId, ModelName: name, FirstUsedAt: now})
+	}
+	if len(usages) == 0 {
+		return nil
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(usages, 100).Error
+}
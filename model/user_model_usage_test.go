@@ -0,0 +1,44 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubModelNameReader struct {
+	LogReader
+	query LogQuery
+	names []string
+}
+
+func (r *stubModelNameReader) DistinctModelNames(ctx context.Context, query LogQuery) ([]string, error) {
+	r.query = query
+	return r.names, nil
+}
+
+func TestMarkUserModelUsedBackfillsFromLogReader(t *testing.T) {
+	require.NoError(t, DB.AutoMigrate(&UserModelUsage{}))
+	t.Cleanup(func() { DB.Exec("DELETE FROM user_model_usages") })
+
+	reader := &stubModelNameReader{names: []string{"gpt-4o", ""}}
+	logSinkMu.Lock()
+	saved := logSinkReader
+	logSinkReader = reader
+	logSinkMu.Unlock()
+	t.Cleanup(func() {
+		logSinkMu.Lock()
+		logSinkReader = saved
+		logSinkMu.Unlock()
+	})
+
+	first, err := MarkUserModelUsed(42, "gpt-4o", 1000)
+	require.NoError(t, err)
+	require.False(t, first)
+	require.Equal(t, LogQuery{UserId: 42, LogType: LogTypeConsume, EndTimestamp: 999}, reader.query)
+
+	first, err = MarkUserModelUsed(42, "claude", 1000)
+	require.NoError(t, err)
+	require.True(t, first)
+}
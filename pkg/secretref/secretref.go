@@ -0,0 +1,327 @@
+// Package secretref resolves credentials that are stored outside the database.
+// A reference replaces the literal secret and takes one of the forms
+//
+//	env://NAME                  environment variable (name must carry the configured prefix)
+//	file:///run/secrets/openai  file content, reloaded when the file changes
+//	vault://secret/data/openai#api_key
+//	                            HashiCorp Vault KV v1/v2 path and field
+//
+// Resolved values are cached; Vault values are refreshed after CacheTTL and the
+// last good value is served if Vault is temporarily unreachable. Concurrent
+// refreshes of the same reference share one request, and a failed refresh is
+// not retried for vaultRetryInterval.
+package secretref
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	schemeEnv   = "env://"
+	schemeFile  = "file://"
+	schemeVault = "vault://"
+
+	fileCheckInterval = 5 * time.Second
+	// vaultRetryInterval is how long the stale value is served after a failed refresh
+	vaultRetryInterval = 30 * time.Second
+)
+
+// Config controls which references may be resolved and how Vault is reached.
+type Config struct {
+	// EnvPrefix is required on environment variable names, so a reference
+	// cannot read unrelated process secrets such as SESSION_SECRET.
+	EnvPrefix string
+	// FileDirs lists the directories file references may read from.
+	FileDirs []string
+	// CacheTTL is how long a Vault value is used before it is fetched again.
+	CacheTTL time.Duration
+
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	HTTPClient     *http.Client
+}
+
+// ConfigFromEnv builds the configuration from SECRET_REF_* and the standard VAULT_* variables.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		EnvPrefix:      "CHANNEL_SECRET_",
+		FileDirs:       []string{"/run/secrets"},
+		CacheTTL:       5 * time.Minute,
+		VaultAddr:      strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		VaultToken:     os.Getenv("VAULT_TOKEN"),
+		VaultNamespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	if prefix, ok := os.LookupEnv("SECRET_REF_ENV_PREFIX"); ok {
+		cfg.EnvPrefix = prefix
+	}
+	if dirs := os.Getenv("SECRET_REF_FILE_DIRS"); dirs != "" {
+		cfg.FileDirs = nil
+		for _, dir := range strings.Split(dirs, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				cfg.FileDirs = append(cfg.FileDirs, dir)
+			}
+		}
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("SECRET_REF_CACHE_TTL")); err == nil && ttl > 0 {
+		cfg.CacheTTL = ttl
+	}
+	if cfg.VaultToken == "" {
+		if path := os.Getenv("VAULT_TOKEN_FILE"); path != "" {
+			if content, err := os.ReadFile(path); err == nil {
+				cfg.VaultToken = strings.TrimSpace(string(content))
+			}
+		}
+	}
+	return cfg
+}
+
+type cacheEntry struct {
+	value     string
+	fetchedAt time.Time
+	// vault references only: no refresh is attempted before retryAt
+	retryAt time.Time
+	// file references only
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+}
+
+// Resolver resolves references and caches the results.
+type Resolver struct {
+	cfg   Config
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+	now   func() time.Time
+	vault singleflight.Group
+}
+
+// NewResolver creates a resolver with the given configuration.
+func NewResolver(cfg Config) *Resolver {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 5 * time.Minute
+	}
+	return &Resolver{cfg: cfg, cache: map[string]*cacheEntry{}, now: time.Now}
+}
+
+var defaultResolver atomic.Pointer[Resolver]
+
+func getDefault() *Resolver {
+	if resolver := defaultResolver.Load(); resolver != nil {
+		return resolver
+	}
+	defaultResolver.CompareAndSwap(nil, NewResolver(ConfigFromEnv()))
+	return defaultResolver.Load()
+}
+
+// SetDefault replaces the process-wide resolver, mainly for tests.
+func SetDefault(resolver *Resolver) {
+	defaultResolver.Store(resolver)
+}
+
+// IsReference reports whether value is a secret reference rather than a literal secret.
+func IsReference(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, schemeEnv) || strings.HasPrefix(value, schemeFile) || strings.HasPrefix(value, schemeVault)
+}
+
+// Resolve resolves value with the process-wide resolver. Literal values are returned unchanged.
+func Resolve(value string) (string, error) {
+	return getDefault().Resolve(value)
+}
+
+// Resolve resolves value. Literal values are returned unchanged.
+func (r *Resolver) Resolve(value string) (string, error) {
+	ref := strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(ref, schemeEnv):
+		return r.resolveEnv(strings.TrimPrefix(ref, schemeEnv))
+	case strings.HasPrefix(ref, schemeFile):
+		return r.resolveFile(ref, strings.TrimPrefix(ref, schemeFile))
+	case strings.HasPrefix(ref, schemeVault):
+		return r.resolveVault(ref, strings.TrimPrefix(ref, schemeVault))
+	}
+	return value, nil
+}
+
+func (r *Resolver) resolveEnv(name string) (string, error) {
+	if name == "" || !strings.HasPrefix(name, r.cfg.EnvPrefix) {
+		return "", fmt.Errorf("secret reference env://%s: variable name must start with %q", name, r.cfg.EnvPrefix)
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("secret reference env://%s: variable is not set", name)
+	}
+	return value, nil
+}
+
+func (r *Resolver) allowedFile(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", errors.New("path must be absolute")
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range r.cfg.FileDirs {
+		base, err := filepath.EvalSymlinks(filepath.Clean(dir))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(base, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path is outside the allowed directories %v", r.cfg.FileDirs)
+}
+
+func (r *Resolver) resolveFile(ref string, path string) (string, error) {
+	now := r.now()
+	r.mu.Lock()
+	entry := r.cache[ref]
+	if entry != nil && now.Sub(entry.checkedAt) < fileCheckInterval {
+		r.mu.Unlock()
+		return entry.value, nil
+	}
+	r.mu.Unlock()
+
+	resolved, err := r.allowedFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret reference %s: %w", ref, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("secret reference %s: %w", ref, err)
+	}
+	if entry != nil && info.ModTime().Equal(entry.modTime) && info.Size() == entry.size {
+		r.mu.Lock()
+		entry.checkedAt = now
+		r.mu.Unlock()
+		return entry.value, nil
+	}
+	content, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("secret reference %s: %w", ref, err)
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("secret reference %s: file is empty", ref)
+	}
+	r.mu.Lock()
+	r.cache[ref] = &cacheEntry{value: value, fetchedAt: now, modTime: info.ModTime(), size: info.Size(), checkedAt: now}
+	r.mu.Unlock()
+	return value, nil
+}
+
+func (r *Resolver) resolveVault(ref string, target string) (string, error) {
+	now := r.now()
+	r.mu.Lock()
+	entry := r.cache[ref]
+	r.mu.Unlock()
+	if entry != nil && (now.Sub(entry.fetchedAt) < r.cfg.CacheTTL || now.Before(entry.retryAt)) {
+		return entry.value, nil
+	}
+
+	result, err, _ := r.vault.Do(ref, func() (any, error) {
+		return r.fetchVault(target)
+	})
+	if err != nil {
+		if entry != nil {
+			// keep serving the last good value while Vault is unavailable, without calling it on every request
+			r.mu.Lock()
+			r.cache[ref] = &cacheEntry{value: entry.value, fetchedAt: entry.fetchedAt, retryAt: now.Add(vaultRetryInterval)}
+			r.mu.Unlock()
+			return entry.value, nil
+		}
+		return "", fmt.Errorf("secret reference %s: %w", ref, err)
+	}
+	value := result.(string)
+	r.mu.Lock()
+	r.cache[ref] = &cacheEntry{value: value, fetchedAt: now}
+	r.mu.Unlock()
+	return value, nil
+}
+
+func (r *Resolver) fetchVault(target string) (string, error) {
+	if r.cfg.VaultAddr == "" {
+		return "", errors.New("VAULT_ADDR is not configured")
+	}
+	path, field, _ := strings.Cut(target, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", errors.New("vault path is empty")
+	}
+	req, err := http.NewRequest(http.MethodGet, r.cfg.VaultAddr+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if r.cfg.VaultToken != "" {
+		req.Header.Set("X-Vault-Token", r.cfg.VaultToken)
+	}
+	if r.cfg.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.cfg.VaultNamespace)
+	}
+	resp, err := r.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := payload.Data
+	// KV v2 nests the secret under data.data next to data.metadata
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = inner
+		}
+	}
+	if field == "" {
+		if len(data) != 1 {
+			return "", errors.New("vault secret has multiple fields, specify one with #field")
+		}
+		for name := range data {
+			field = name
+		}
+	}
+	raw, ok := data[field]
+	if !ok || raw == nil {
+		return "", fmt.Errorf("vault secret has no field %q", field)
+	}
+	if value, ok := raw.(string); ok {
+		return value, nil
+	}
+	// structured values (e.g. a Vertex service account) are returned as JSON
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,144 @@
+package secretref
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveLiteralAndEnv(t *testing.T) {
+	r := NewResolver(Config{EnvPrefix: "CHANNEL_SECRET_"})
+
+	value, err := r.Resolve("sk-literal")
+	require.NoError(t, err)
+	require.Equal(t, "sk-literal", value)
+
+	t.Setenv("CHANNEL_SECRET_OPENAI", "sk-from-env")
+	value, err = r.Resolve("env://CHANNEL_SECRET_OPENAI")
+	require.NoError(t, err)
+	require.Equal(t, "sk-from-env", value)
+
+	t.Setenv("SESSION_SECRET", "do-not-leak")
+	_, err = r.Resolve("env://SESSION_SECRET")
+	require.Error(t, err)
+}
+
+func TestResolveFileReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openai")
+	require.NoError(t, os.WriteFile(path, []byte("sk-first\n"), 0600))
+
+	r := NewResolver(Config{FileDirs: []string{dir}})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	value, err := r.Resolve("file://" + path)
+	require.NoError(t, err)
+	require.Equal(t, "sk-first", value)
+
+	require.NoError(t, os.WriteFile(path, []byte("sk-second-key\n"), 0600))
+	require.NoError(t, os.Chtimes(path, now.Add(time.Minute), now.Add(time.Minute)))
+	// within the check interval the cached value is used
+	value, err = r.Resolve("file://" + path)
+	require.NoError(t, err)
+	require.Equal(t, "sk-first", value)
+
+	now = now.Add(fileCheckInterval)
+	value, err = r.Resolve("file://" + path)
+	require.NoError(t, err)
+	require.Equal(t, "sk-second-key", value)
+
+	outside := filepath.Join(t.TempDir(), "other")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0600))
+	_, err = r.Resolve("file://" + outside)
+	require.Error(t, err)
+	_, err = r.Resolve("file://" + dir + "/../" + filepath.Base(filepath.Dir(outside)) + "/other")
+	require.Error(t, err)
+}
+
+func TestResolveVaultKV2(t *testing.T) {
+	available := true
+	failures := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !available {
+			failures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		require.Equal(t, "root-token", req.Header.Get("X-Vault-Token"))
+		switch req.URL.Path {
+		case "/v1/secret/data/openai":
+			_, _ = w.Write([]byte(`{"data":{"data":{"api_key":"sk-from-vault"},"metadata":{"version":1}}}`))
+		case "/v1/secret/data/vertex":
+			_, _ = w.Write([]byte(`{"data":{"data":{"key":{"type":"service_account"}},"metadata":{"version":3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	r := NewResolver(Config{VaultAddr: server.URL, VaultToken: "root-token", CacheTTL: time.Minute})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	value, err := r.Resolve("vault://secret/data/openai#api_key")
+	require.NoError(t, err)
+	require.Equal(t, "sk-from-vault", value)
+
+	value, err = r.Resolve("vault://secret/data/vertex")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"service_account"}`, value)
+
+	_, err = r.Resolve("vault://secret/data/missing#api_key")
+	require.Error(t, err)
+
+	// the last good value is served while Vault is unavailable
+	available = false
+	now = now.Add(2 * time.Minute)
+	value, err = r.Resolve("vault://secret/data/openai#api_key")
+	require.NoError(t, err)
+	require.Equal(t, "sk-from-vault", value)
+	require.Equal(t, 1, failures)
+
+	// a failed refresh is not retried on every request
+	value, err = r.Resolve("vault://secret/data/openai#api_key")
+	require.NoError(t, err)
+	require.Equal(t, "sk-from-vault", value)
+	require.Equal(t, 1, failures)
+
+	now = now.Add(vaultRetryInterval)
+	_, err = r.Resolve("vault://secret/data/openai#api_key")
+	require.NoError(t, err)
+	require.Equal(t, 2, failures)
+}
+
+func TestResolveVaultCollapsesConcurrentRefreshes(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"data":{"api_key":"sk-v1"}}`))
+	}))
+	defer server.Close()
+
+	r := NewResolver(Config{VaultAddr: server.URL})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := r.Resolve("vault://secret/openai#api_key")
+			require.NoError(t, err)
+			require.Equal(t, "sk-v1", value)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, hits.Load())
+}
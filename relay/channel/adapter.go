@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"errors"
 	"io"
 	"net/http"
 
@@ -81,3 +82,12 @@ type TaskAdaptor interface {
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
+
+// ErrTokenCountUnsupported 上游不支持对该请求计数，调用方应回退到本地估算
+var ErrTokenCountUnsupported = errors.New("token count is not supported by upstream")
+
+// TokenCounter 支持上游原生 token 计数接口（Anthropic count_tokens、Gemini countTokens）的适配器。
+// request 为客户端请求格式（*dto.ClaudeRequest 或 *dto.GeminiChatRequest），不支持的格式返回 ErrTokenCountUnsupported。
+type TokenCounter interface {
+	CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error)
+}
@@ -294,15 +294,19 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
 
-	// 调试模式：读取请求体用于打印
+	// 调试模式或载荷抓取：读取请求体用于打印/记录
 	var bodyBytes []byte
-	if common2.DebugEnabled && requestBody != nil {
+	capturePayload := service.IsPayloadCaptureActive(c)
+	if (common2.DebugEnabled || capturePayload) && requestBody != nil {
 		bodyBytes, err = io.ReadAll(requestBody)
 		if err != nil {
 			return nil, fmt.Errorf("read request body failed: %w", err)
 		}
 		// 重新创建 reader
 		requestBody = bytes.NewReader(bodyBytes)
+		if capturePayload {
+			service.CapturePayloadUpstreamRequest(c, bodyBytes)
+		}
 	}
 
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
@@ -336,6 +340,8 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 	if common2.DebugEnabled {
 		println("fullRequestURL:", fullRequestURL)
 	}
+	// 表单可能包含较大的文件，抓取载荷时边发送边记录，超出上限的部分截断
+	requestBody = service.CapturePayloadUpstreamReader(c, requestBody)
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
@@ -381,6 +387,8 @@ func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 		targetHeader.Set(key, value)
 	}
 	targetHeader.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	// 请求体以消息帧的形式在连接建立后转发，不在载荷抓取范围内
+	service.MarkPayloadUpstreamUncaptured(c, "websocket frames are not captured")
 	targetConn, _, err := websocket.DefaultDialer.Dial(fullRequestURL, targetHeader)
 	if err != nil {
 		return nil, fmt.Errorf("dial failed to %s: %w", fullRequestURL, err)
@@ -562,3 +570,27 @@ func DoTaskApiRequest(a TaskAdaptor, c *gin.Context, info *common.RelayInfo, req
 	}
 	return resp, nil
 }
+
+// DoTokenCountRequest 发送上游 token 计数请求，并将成功响应解析到 result
+func DoTokenCountRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, body any, result any) error {
+	jsonData, err := common2.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal token count request failed: %w", err)
+	}
+	resp, err := DoApiRequest(a, c, info, bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read token count response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(respBody) > 512 {
+			respBody = respBody[:512]
+		}
+		return fmt.Errorf("token count upstream status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return common2.Unmarshal(respBody, result)
+}
@@ -182,3 +182,12 @@ func (a *Adaptor) GetModelList() (models []string) {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+// CountTokens 仅支持 Claude 模型
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	claudeRequest, ok := request.(*dto.ClaudeRequest)
+	if !ok || isNovaModel(info.UpstreamModelName) {
+		return 0, channel.ErrTokenCountUnsupported
+	}
+	return awsCountTokens(c, info, claudeRequest)
+}
@@ -349,3 +349,40 @@ func handleNovaRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor)
 	c.JSON(http.StatusOK, response)
 	return nil, &response.Usage
 }
+
+// awsCountTokens 调用 Bedrock CountTokens，请求体与 InvokeModel 一致；该接口不支持跨区域推理配置，使用基础模型 ID
+func awsCountTokens(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (int, error) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return 0, err
+	}
+	maxTokens := uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(info.UpstreamModelName))
+	if request.MaxTokens != nil && *request.MaxTokens > 0 {
+		maxTokens = *request.MaxTokens
+	}
+	body, err := common.Marshal(&AwsClaudeRequest{
+		AnthropicVersion: "bedrock-2023-05-31",
+		System:           request.System,
+		Messages:         request.Messages,
+		MaxTokens:        maxTokens,
+		Tools:            request.Tools,
+		ToolChoice:       request.ToolChoice,
+		Thinking:         request.Thinking,
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "marshal aws count tokens request fail")
+	}
+
+	ctx, cancel := newAwsInvokeContext()
+	defer cancel()
+	output, err := awsCli.CountTokens(ctx, &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(getAwsModelID(info.UpstreamModelName)),
+		Input: &bedrockruntimeTypes.CountTokensInputMemberInvokeModel{
+			Value: bedrockruntimeTypes.InvokeModelTokensRequest{Body: body},
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "aws count tokens fail")
+	}
+	return int(aws.ToInt32(output.InputTokens)), nil
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -19,9 +21,18 @@ import (
 type Adaptor struct {
 }
 
-func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	openAIRequest, err := service.GeminiToOpenAIRequest(request, info)
+	if err != nil {
+		return nil, err
+	}
+	claudeRequest, err := RequestOpenAI2ClaudeMessage(c, *openAIRequest)
+	if err != nil {
+		return nil, err
+	}
+	applyGeminiThinking(claudeRequest, request.GenerationConfig.ThinkingConfig)
+	appendResponseFormatSystem(claudeRequest, openAIRequest.ResponseFormat)
+	return claudeRequest, nil
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
@@ -43,6 +54,9 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	baseURL := fmt.Sprintf("%s/v1/messages", info.ChannelBaseUrl)
+	if info.RelayMode == relayconstant.RelayModeCountTokens {
+		baseURL = baseURL + "/count_tokens"
+	}
 	// 如果客户端指定了 beta=true，或者配置启用了默认 beta
 	if info.IsClaudeBetaQuery || model_setting.GetClaudeSettings().DefaultBetaEnabled {
 		baseURL = baseURL + "?beta=true"
@@ -161,3 +175,17 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+// CountTokens 调用上游 /v1/messages/count_tokens
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	claudeRequest, ok := request.(*dto.ClaudeRequest)
+	if !ok {
+		return 0, channel.ErrTokenCountUnsupported
+	}
+	var result dto.ClaudeCountTokensResponse
+	err := channel.DoTokenCountRequest(a, c, info, dto.NewClaudeCountTokensRequest(claudeRequest, info.UpstreamModelName), &result)
+	if err != nil {
+		return 0, err
+	}
+	return result.InputTokens, nil
+}
@@ -0,0 +1,64 @@
+package claude
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptorCountTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service.InitHttpClient()
+
+	var gotPath, gotKey string
+	var gotBody map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-api-key")
+		body, _ := io.ReadAll(r.Body)
+		_ = common.Unmarshal(body, &gotBody)
+		_, _ = w.Write([]byte(`{"input_tokens":42}`))
+	}))
+	defer upstream.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", nil)
+
+	maxTokens := uint(1024)
+	request := &dto.ClaudeRequest{
+		Model:     "claude-sonnet-4-5",
+		MaxTokens: &maxTokens,
+		Messages:  []dto.ClaudeMessage{{Role: "user", Content: "hello"}},
+	}
+	info := &relaycommon.RelayInfo{
+		RelayMode: relayconstant.RelayModeCountTokens,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelBaseUrl:    upstream.URL,
+			ApiKey:            "sk-test",
+			UpstreamModelName: "claude-sonnet-4-5-20250929",
+		},
+	}
+
+	tokens, err := (&Adaptor{}).CountTokens(c, info, request)
+	require.NoError(t, err)
+	require.Equal(t, 42, tokens)
+	require.Equal(t, "/v1/messages/count_tokens", gotPath)
+	require.Equal(t, "sk-test", gotKey)
+	require.Equal(t, "claude-sonnet-4-5-20250929", gotBody["model"])
+	require.NotContains(t, gotBody, "max_tokens")
+
+	_, err = (&Adaptor{}).CountTokens(c, info, &dto.GeminiChatRequest{})
+	require.ErrorIs(t, err, channel.ErrTokenCountUnsupported)
+}
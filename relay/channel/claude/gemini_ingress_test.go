@@ -0,0 +1,77 @@
+package claude
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/ingresstest"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+var geminiIngress = ingresstest.Harness{Dir: "gemini_ingress", Path: "/v1beta/models/gemini-2.5-pro:generateContent"}
+
+func newGeminiIngressContext(t *testing.T, stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	t.Helper()
+	claudeSettings := model_setting.GetClaudeSettings()
+	oldDefaultBetaEnabled := claudeSettings.DefaultBetaEnabled
+	claudeSettings.DefaultBetaEnabled = false
+	t.Cleanup(func() {
+		claudeSettings.DefaultBetaEnabled = oldDefaultBetaEnabled
+	})
+	c, recorder := geminiIngress.NewContext(t)
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatGemini,
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		OriginModelName: "gemini-2.5-pro",
+		IsStream:        stream,
+		GeminiConvertInfo: &relaycommon.GeminiConvertInfo{
+			IncludeThoughts: true,
+		},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:       constant.ChannelTypeAnthropic,
+			ChannelBaseUrl:    "https://api.anthropic.com",
+			UpstreamModelName: "claude-sonnet-4-5",
+		},
+	}
+	return c, recorder, info
+}
+
+func TestGeminiIngressClaudeRequest(t *testing.T) {
+	c, _, info := newGeminiIngressContext(t, true)
+
+	var request dto.GeminiChatRequest
+	geminiIngress.ReadRequest(t, "request.json", &request)
+	converted, err := (&Adaptor{}).ConvertGeminiRequest(c, info, &request)
+	require.NoError(t, err)
+	body, err := common.Marshal(converted)
+	require.NoError(t, err)
+	geminiIngress.AssertGoldenJSON(t, "claude_request.golden.json", body)
+}
+
+func TestGeminiIngressClaudeStream(t *testing.T) {
+	c, recorder, info := newGeminiIngressContext(t, true)
+
+	usage, newAPIError := ClaudeStreamHandler(c, geminiIngress.FixtureResponse(t, "claude_stream.txt"), info)
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	require.NotContains(t, recorder.Body.String(), "c2ln")
+	geminiIngress.AssertGolden(t, "claude_stream.golden.txt", recorder.Body.Bytes())
+}
+
+func TestGeminiIngressClaudeResponse(t *testing.T) {
+	c, recorder, info := newGeminiIngressContext(t, false)
+
+	_, newAPIError := ClaudeHandler(c, geminiIngress.FixtureResponse(t, "claude_response.json"), info)
+	require.Nil(t, newAPIError)
+	geminiIngress.AssertGoldenJSON(t, "claude_response.golden.json", recorder.Body.Bytes())
+}
@@ -0,0 +1,93 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// applyGeminiThinking 按 thinkingConfig 的预算开启或关闭 extended thinking。
+// Claude 要求预算不少于 1024 且小于 max_tokens，开启时不能指定 temperature、top_p 与 top_k
+func applyGeminiThinking(claudeRequest *dto.ClaudeRequest, thinkingConfig *dto.GeminiThinkingConfig) {
+	if thinkingConfig != nil && thinkingConfig.ThinkingBudget != nil {
+		switch budget := *thinkingConfig.ThinkingBudget; {
+		case budget == 0:
+			claudeRequest.Thinking = nil
+		case budget > 0:
+			claudeRequest.Thinking = &dto.Thinking{
+				Type:         "enabled",
+				BudgetTokens: common.GetPointer(max(budget, 1024)),
+			}
+		}
+	}
+	if claudeRequest.Thinking == nil || claudeRequest.Thinking.Type != "enabled" {
+		return
+	}
+	budget := claudeRequest.Thinking.GetBudgetTokens()
+	if claudeRequest.MaxTokens == nil || int(*claudeRequest.MaxTokens) <= budget {
+		claudeRequest.MaxTokens = common.GetPointer(uint(budget + 1024))
+	}
+	claudeRequest.Temperature = nil
+	claudeRequest.TopP = nil
+	claudeRequest.TopK = nil
+}
+
+// appendResponseFormatSystem Claude 不支持 response_format，以系统提示要求按 JSON schema 输出
+func appendResponseFormatSystem(claudeRequest *dto.ClaudeRequest, responseFormat *dto.ResponseFormat) {
+	if responseFormat == nil {
+		return
+	}
+	var instruction string
+	switch responseFormat.Type {
+	case "json_object":
+		instruction = "Respond only with a valid JSON value, without any surrounding text or code fences."
+	case "json_schema":
+		var jsonSchema dto.FormatJsonSchema
+		if err := common.Unmarshal(responseFormat.JsonSchema, &jsonSchema); err != nil {
+			return
+		}
+		schema, err := common.Marshal(jsonSchema.Schema)
+		if err != nil {
+			return
+		}
+		instruction = fmt.Sprintf("Respond only with a JSON value that conforms to the following JSON schema, without any surrounding text or code fences:\n%s", schema)
+	default:
+		return
+	}
+	block := dto.ClaudeMediaMessage{
+		Type: "text",
+		Text: common.GetPointer(instruction),
+	}
+	systems, _ := claudeRequest.System.([]dto.ClaudeMediaMessage)
+	claudeRequest.System = append(systems, block)
+}
+
+// claudeDocumentFromFile 将 data URL 形式的文件转换为 document 内容块，仅支持内联数据
+func claudeDocumentFromFile(file *dto.MessageFile) *dto.ClaudeMediaMessage {
+	if file == nil || !strings.HasPrefix(file.FileData, "data:") {
+		return nil
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(file.FileData, "data:"), ",")
+	if !ok {
+		return nil
+	}
+	mediaType := strings.TrimSuffix(header, ";base64")
+	return &dto.ClaudeMediaMessage{
+		Type: "document",
+		Source: &dto.ClaudeMessageSource{
+			Type:      "base64",
+			MediaType: mediaType,
+			Data:      data,
+		},
+	}
+}
+
+// claudeUsageForGemini Claude 的 input_tokens 不含缓存读取与写入，Gemini 的 promptTokenCount 包含缓存部分
+func claudeUsageForGemini(usage *dto.Usage) *dto.Usage {
+	geminiUsage := *usage
+	geminiUsage.PromptTokens += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	geminiUsage.TotalTokens = geminiUsage.PromptTokens + geminiUsage.CompletionTokens
+	return &geminiUsage
+}
@@ -42,7 +42,8 @@ func maybeMarkClaudeRefusal(c *gin.Context, stopReason string) {
 	if c == nil {
 		return
 	}
-	if strings.EqualFold(stopReason, "refusal") {
+	// 已有原因（如输出检测拦截）时保留
+	if strings.EqualFold(stopReason, "refusal") && common.GetContextKeyString(c, constant.ContextKeyAdminRejectReason) == "" {
 		common.SetContextKey(c, constant.ContextKeyAdminRejectReason, "claude_stop_reason=refusal")
 	}
 }
@@ -424,6 +425,16 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 							continue
 						}
 						claudeMediaMessage.Text = common.GetPointer[string](textContent)
+					} else if mediaMessage.Type == dto.ContentTypeFile {
+						// PDF 等内联文件转为 document 内容块
+						document := claudeDocumentFromFile(mediaMessage.GetFile())
+						if document == nil {
+							continue
+						}
+						claudeMediaMessage = *document
+					} else if mediaMessage.Type != dto.ContentTypeImageURL {
+						// Claude 不支持音频与视频输入
+						continue
 					} else {
 						imageUrl := mediaMessage.GetImageMedia()
 						claudeMediaMessage.Type = "image"
@@ -468,7 +479,7 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 						hasValidContent = true
 						break
 					}
-					if msg.Type == "tool_use" || msg.Type == "tool_result" || msg.Type == "image" {
+					if msg.Type == "tool_use" || msg.Type == "tool_result" || msg.Type == "image" || msg.Type == "document" {
 						hasValidContent = true
 						break
 					}
@@ -869,6 +880,22 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		if err != nil {
 			logger.LogError(c, "send_stream_response_failed: "+err.Error())
 		}
+	} else if info.RelayFormat == types.RelayFormatGemini {
+		response := StreamResponseClaude2OpenAI(&claudeResponse)
+
+		if !FormatClaudeResponseInfo(&claudeResponse, response, claudeInfo) || response == nil {
+			return nil
+		}
+		// 思考签名只有 Claude 能识别，不转发
+		if claudeResponse.Delta != nil && claudeResponse.Delta.Type == "signature_delta" {
+			return nil
+		}
+		if geminiResponse := service.StreamResponseOpenAI2Gemini(response, info); geminiResponse != nil {
+			err = helper.ObjectData(c, geminiResponse)
+			if err != nil {
+				logger.LogError(c, "send_stream_response_failed: "+err.Error())
+			}
+		}
 	}
 	return nil
 }
@@ -895,6 +922,13 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 			}
 		}
 		helper.Done(c)
+	} else if info.RelayFormat == types.RelayFormatGemini {
+		if geminiResponse := service.FinishGeminiStream(info, claudeUsageForGemini(claudeInfo.Usage)); geminiResponse != nil {
+			err := helper.ObjectData(c, geminiResponse)
+			if err != nil {
+				common.SysLog("send final response failed: " + err.Error())
+			}
+		}
 	}
 }
 
@@ -955,6 +989,13 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 	case types.RelayFormatClaude:
 		responseData = data
+	case types.RelayFormatGemini:
+		openaiResponse := ResponseClaude2OpenAI(&claudeResponse)
+		openaiResponse.Usage = *claudeUsageForGemini(claudeInfo.Usage)
+		responseData, err = json.Marshal(service.ResponseOpenAI2Gemini(openaiResponse, info))
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
 	}
 
 	if claudeResponse.Usage != nil && claudeResponse.Usage.ServerToolUse != nil && claudeResponse.Usage.ServerToolUse.WebSearchRequests > 0 {
@@ -1,6 +1,7 @@
 package gemini
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -127,8 +128,8 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 
 }
 
-func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
-
+// trimThinkingSuffix 去除思考适配使用的模型名后缀，得到上游实际模型名
+func trimThinkingSuffix(info *relaycommon.RelayInfo) {
 	if model_setting.GetGeminiSettings().ThinkingAdapterEnabled &&
 		!model_setting.ShouldPreserveThinkingSuffix(info.OriginModelName) {
 		// 新增逻辑：处理 -thinking-<budget> 格式
@@ -143,9 +144,17 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 			info.UpstreamModelName = baseModel
 		}
 	}
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	trimThinkingSuffix(info)
 
 	version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
 
+	if info.RelayMode == constant.RelayModeCountTokens {
+		return fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName), nil
+	}
+
 	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return fmt.Sprintf("%s/%s/models/%s:predict", info.ChannelBaseUrl, version, info.UpstreamModelName), nil
 	}
@@ -285,3 +294,38 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+type countTokensContent struct {
+	Model              string                  `json:"model"`
+	Contents           []dto.GeminiChatContent `json:"contents"`
+	Tools              json.RawMessage         `json:"tools,omitempty"`
+	ToolConfig         *dto.ToolConfig         `json:"toolConfig,omitempty"`
+	SystemInstructions *dto.GeminiChatContent  `json:"systemInstruction,omitempty"`
+}
+
+type countTokensRequest struct {
+	GenerateContentRequest countTokensContent `json:"generateContentRequest"`
+}
+
+// CountTokens 调用上游 models/{model}:countTokens，携带系统提示与工具一并计数
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	geminiRequest, ok := request.(*dto.GeminiChatRequest)
+	if !ok {
+		return 0, channel.ErrTokenCountUnsupported
+	}
+	trimThinkingSuffix(info)
+	body := countTokensRequest{
+		GenerateContentRequest: countTokensContent{
+			Model:              "models/" + info.UpstreamModelName,
+			Contents:           geminiRequest.Contents,
+			Tools:              geminiRequest.Tools,
+			ToolConfig:         geminiRequest.ToolConfig,
+			SystemInstructions: geminiRequest.SystemInstructions,
+		},
+	}
+	var result dto.GeminiCountTokensResponse
+	if err := channel.DoTokenCountRequest(a, c, info, body, &result); err != nil {
+		return 0, err
+	}
+	return result.TotalTokens, nil
+}
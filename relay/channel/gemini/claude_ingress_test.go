@@ -0,0 +1,77 @@
+package gemini
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/ingresstest"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// Gemini function calls get random call ids, normalize them before comparing.
+var geminiCallIDPattern = regexp.MustCompile(`"call_[^"]+"`)
+
+var claudeIngress = ingresstest.Harness{
+	Dir:  "claude_ingress",
+	Path: "/v1/messages",
+	Normalize: func(actual []byte) []byte {
+		return geminiCallIDPattern.ReplaceAll(actual, []byte(`"call_0"`))
+	},
+}
+
+func newClaudeIngressContext(t *testing.T, stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	t.Helper()
+	c, recorder := claudeIngress.NewContext(t)
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatClaude,
+		OriginModelName: "gemini-2.5-pro",
+		IsStream:        stream,
+		ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{
+			LastMessagesType: relaycommon.LastMessageTypeNone,
+		},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:       constant.ChannelTypeGemini,
+			UpstreamModelName: "gemini-2.5-pro",
+		},
+	}
+	return c, recorder, info
+}
+
+func TestClaudeIngressGeminiRequest(t *testing.T) {
+	c, _, info := newClaudeIngressContext(t, true)
+
+	var request dto.ClaudeRequest
+	claudeIngress.ReadRequest(t, "request.json", &request)
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertClaudeRequest(c, info, &request)
+	require.NoError(t, err)
+	body, err := common.Marshal(converted)
+	require.NoError(t, err)
+	claudeIngress.AssertGoldenJSON(t, "gemini_request.golden.json", body)
+}
+
+func TestClaudeIngressGeminiStream(t *testing.T) {
+	c, recorder, info := newClaudeIngressContext(t, true)
+
+	usage, newAPIError := GeminiChatStreamHandler(c, info, claudeIngress.FixtureResponse(t, "gemini_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	claudeIngress.AssertGolden(t, "gemini_stream.golden.txt", recorder.Body.Bytes())
+}
+
+func TestClaudeIngressGeminiResponse(t *testing.T) {
+	c, recorder, info := newClaudeIngressContext(t, false)
+
+	_, newAPIError := GeminiChatHandler(c, info, claudeIngress.FixtureResponse(t, "gemini_response.json"))
+	require.Nil(t, newAPIError)
+	claudeIngress.AssertGoldenJSON(t, "gemini_response.golden.json", recorder.Body.Bytes())
+}
@@ -0,0 +1,101 @@
+// Package ingresstest 各渠道入口格式转换测试共用的上下文构造与 golden 文件断言，仅供测试使用
+package ingresstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// Run `go test ./relay/channel/<adaptor> -run Ingress -update` to regenerate the golden files.
+var update = flag.Bool("update", false, "update golden files")
+
+// Harness 一种入口格式的测试夹具，fixture 与 golden 文件位于 testdata/<Dir>
+type Harness struct {
+	Dir string
+	// Path 入口请求路径
+	Path string
+	// Normalize 比较 golden 文件前对输出做归一化，例如替换随机生成的 id
+	Normalize func([]byte) []byte
+}
+
+// NewContext 构造入口请求的 gin 上下文，测试结束后恢复流式超时设置
+func (h Harness) NewContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	oldStreamingTimeout := constant.StreamingTimeout
+	constant.StreamingTimeout = 300
+	t.Cleanup(func() {
+		constant.StreamingTimeout = oldStreamingTimeout
+	})
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, h.Path, nil)
+	c.Set(common.RequestIdKey, "test")
+	return c, recorder
+}
+
+func (h Harness) ReadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", h.Dir, name))
+	require.NoError(t, err)
+	return data
+}
+
+// ReadRequest 将 fixture 解析到 request
+func (h Harness) ReadRequest(t *testing.T, name string, request any) {
+	t.Helper()
+	require.NoError(t, common.Unmarshal(h.ReadFixture(t, name), request))
+}
+
+// FixtureResponse 以 fixture 作为上游响应体
+func (h Harness) FixtureResponse(t *testing.T, name string) *http.Response {
+	t.Helper()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(h.ReadFixture(t, name))),
+	}
+}
+
+// AssertGolden 比较输出与 golden 文件，带 -update 运行时先重写 golden 文件
+func (h Harness) AssertGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	if h.Normalize != nil {
+		actual = h.Normalize(actual)
+	}
+	path := filepath.Join("testdata", h.Dir, name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, actual, 0o644))
+	}
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(actual))
+}
+
+// AssertGoldenJSON 格式化 JSON 后比较
+func (h Harness) AssertGoldenJSON(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	h.AssertGolden(t, name, IndentJSON(t, actual))
+}
+
+func IndentJSON(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, json.Indent(&out, data, "", "  "))
+	out.WriteByte('\n')
+	return out.Bytes()
+}
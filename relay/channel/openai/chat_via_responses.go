@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -71,6 +72,14 @@ func OaiResponsesToChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 		chatResp.Usage = *usage
 	}
 
+	// Claude 与 Gemini 消息可同时包含文本与工具调用
+	if info.RelayFormat == types.RelayFormatClaude || info.RelayFormat == types.RelayFormatGemini {
+		if toolCalls := service.ExtractFunctionCallsFromResponses(&responsesResp); len(toolCalls) > 0 && len(chatResp.Choices) > 0 {
+			chatResp.Choices[0].Message.SetToolCalls(toolCalls)
+			chatResp.Choices[0].FinishReason = "tool_calls"
+		}
+	}
+
 	var responseBody []byte
 	switch info.RelayFormat {
 	case types.RelayFormatClaude:
@@ -234,8 +243,9 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 		if callID == "" {
 			return true
 		}
-		if outputText.Len() > 0 {
+		if outputText.Len() > 0 && info.RelayFormat == types.RelayFormatOpenAI {
 			// Prefer streaming assistant text over tool calls to match non-stream behavior.
+			// Claude and Gemini messages carry text and tool calls together, so keep both there.
 			return true
 		}
 		if !sendStartIfNeeded() {
@@ -433,7 +443,7 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 
 		case "response.function_call_arguments.done":
 
-		case "response.completed":
+		case "response.completed", "response.incomplete":
 			if streamResp.Response != nil {
 				if streamResp.Response.Model != "" {
 					model = streamResp.Response.Model
@@ -477,6 +487,13 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 				if sawToolCall && outputText.Len() == 0 {
 					finishReason = "tool_calls"
 				}
+				// 未完成的响应：超出长度或被内容过滤截断
+				if streamResp.Type == "response.incomplete" {
+					finishReason = constant.FinishReasonLength
+					if streamResp.Response != nil && streamResp.Response.IncompleteDetails != nil && streamResp.Response.IncompleteDetails.Reason == "content_filter" {
+						finishReason = constant.FinishReasonContentFilter
+					}
+				}
 				stop := helper.GenerateStopResponse(responseId, createAt, model, finishReason)
 				if !sendChatChunk(stop) {
 					return false
@@ -526,6 +543,17 @@ func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo
 			return nil, streamErr
 		}
 	}
+	if info.RelayFormat == types.RelayFormatClaude && info.ClaudeConvertInfo != nil {
+		info.ClaudeConvertInfo.Usage = usage
+		for _, claudeResp := range service.FinishClaudeStream(info) {
+			_ = helper.ClaudeData(c, *claudeResp)
+		}
+	}
+	if info.RelayFormat == types.RelayFormatGemini {
+		if geminiResp := service.FinishGeminiStream(info, usage); geminiResp != nil {
+			_ = sendGeminiStreamData(c, geminiResp)
+		}
+	}
 	if info.RelayFormat == types.RelayFormatOpenAI && info.ShouldIncludeUsage && usage != nil {
 		if err := helper.ObjectData(c, helper.GenerateFinalUsageResponse(responseId, createAt, model, *usage)); err != nil {
 			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponse, http.StatusInternalServerError)
@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/ingresstest"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+var claudeIngress = ingresstest.Harness{Dir: "claude_ingress", Path: "/v1/messages"}
+
+func newClaudeIngressContext(t *testing.T, stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	t.Helper()
+	c, recorder := claudeIngress.NewContext(t)
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatClaude,
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		OriginModelName: "claude-sonnet-4-5",
+		IsStream:        stream,
+		ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{
+			LastMessagesType: relaycommon.LastMessageTypeNone,
+		},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:          constant.ChannelTypeOpenAI,
+			ChannelBaseUrl:       "https://llm.example.com",
+			UpstreamModelName:    "gpt-4.1",
+			SupportStreamOptions: true,
+		},
+	}
+	return c, recorder, info
+}
+
+func readClaudeIngressRequest(t *testing.T) *dto.ClaudeRequest {
+	t.Helper()
+	var request dto.ClaudeRequest
+	claudeIngress.ReadRequest(t, "request.json", &request)
+	return &request
+}
+
+func TestClaudeIngressOpenAIRequest(t *testing.T) {
+	c, _, info := newClaudeIngressContext(t, true)
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertClaudeRequest(c, info, readClaudeIngressRequest(t))
+	require.NoError(t, err)
+	body, err := common.Marshal(converted)
+	require.NoError(t, err)
+	claudeIngress.AssertGoldenJSON(t, "openai_request.golden.json", body)
+}
+
+func TestClaudeIngressResponsesRequest(t *testing.T) {
+	_, _, info := newClaudeIngressContext(t, true)
+
+	chatRequest, err := service.ClaudeToOpenAIRequest(*readClaudeIngressRequest(t), info)
+	require.NoError(t, err)
+	responsesRequest, err := service.ChatCompletionsRequestToResponsesRequest(chatRequest)
+	require.NoError(t, err)
+	body, err := common.Marshal(responsesRequest)
+	require.NoError(t, err)
+	claudeIngress.AssertGoldenJSON(t, "responses_request.golden.json", body)
+}
+
+func TestClaudeIngressOfficialOpenAIDropsReasoningHistory(t *testing.T) {
+	_, _, info := newClaudeIngressContext(t, true)
+	info.ChannelBaseUrl = ""
+
+	chatRequest, err := service.ClaudeToOpenAIRequest(*readClaudeIngressRequest(t), info)
+	require.NoError(t, err)
+	for _, message := range chatRequest.Messages {
+		require.Empty(t, message.ReasoningContent)
+	}
+}
+
+func TestClaudeIngressOpenAIStream(t *testing.T) {
+	c, recorder, info := newClaudeIngressContext(t, true)
+
+	usage, newAPIError := OaiStreamHandler(c, info, claudeIngress.FixtureResponse(t, "openai_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1200, usage.PromptTokens)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	claudeIngress.AssertGolden(t, "openai_stream.golden.txt", recorder.Body.Bytes())
+}
+
+func TestClaudeIngressOpenAIResponse(t *testing.T) {
+	c, recorder, info := newClaudeIngressContext(t, false)
+
+	_, newAPIError := OpenaiHandler(c, info, claudeIngress.FixtureResponse(t, "openai_response.json"))
+	require.Nil(t, newAPIError)
+	claudeIngress.AssertGoldenJSON(t, "openai_response.golden.json", recorder.Body.Bytes())
+}
+
+func TestClaudeIngressResponsesStream(t *testing.T) {
+	c, recorder, info := newClaudeIngressContext(t, true)
+
+	usage, newAPIError := OaiResponsesToChatStreamHandler(c, info, claudeIngress.FixtureResponse(t, "responses_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	claudeIngress.AssertGolden(t, "responses_stream.golden.txt", recorder.Body.Bytes())
+}
+
+func TestClaudeIngressResponsesResponse(t *testing.T) {
+	c, recorder, info := newClaudeIngressContext(t, false)
+
+	_, newAPIError := OaiResponsesToChatHandler(c, info, claudeIngress.FixtureResponse(t, "responses_response.json"))
+	require.Nil(t, newAPIError)
+	claudeIngress.AssertGoldenJSON(t, "responses_response.golden.json", recorder.Body.Bytes())
+}
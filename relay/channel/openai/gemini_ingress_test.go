@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/ingresstest"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+var geminiIngress = ingresstest.Harness{Dir: "gemini_ingress", Path: "/v1beta/models/gemini-2.5-pro:generateContent"}
+
+func newGeminiIngressContext(t *testing.T, stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	t.Helper()
+	c, recorder := geminiIngress.NewContext(t)
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatGemini,
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		OriginModelName: "gemini-2.5-pro",
+		IsStream:        stream,
+		GeminiConvertInfo: &relaycommon.GeminiConvertInfo{
+			IncludeThoughts: true,
+		},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:          constant.ChannelTypeOpenAI,
+			ChannelBaseUrl:       "https://llm.example.com",
+			UpstreamModelName:    "gpt-4.1",
+			SupportStreamOptions: true,
+		},
+	}
+	return c, recorder, info
+}
+
+func readGeminiIngressRequest(t *testing.T) *dto.GeminiChatRequest {
+	t.Helper()
+	var request dto.GeminiChatRequest
+	geminiIngress.ReadRequest(t, "request.json", &request)
+	return &request
+}
+
+func TestGeminiIngressOpenAIRequest(t *testing.T) {
+	c, _, info := newGeminiIngressContext(t, true)
+
+	adaptor := &Adaptor{}
+	converted, err := adaptor.ConvertGeminiRequest(c, info, readGeminiIngressRequest(t))
+	require.NoError(t, err)
+	body, err := common.Marshal(converted)
+	require.NoError(t, err)
+	geminiIngress.AssertGoldenJSON(t, "openai_request.golden.json", body)
+}
+
+func TestGeminiIngressPairsFunctionResponsesByID(t *testing.T) {
+	_, _, info := newGeminiIngressContext(t, false)
+
+	request := &dto.GeminiChatRequest{
+		Contents: []dto.GeminiChatContent{
+			{Role: "model", Parts: []dto.GeminiPart{
+				{FunctionCall: &dto.FunctionCall{ID: "fc_a", FunctionName: "read_file", Arguments: map[string]any{"path": "a"}}},
+				{FunctionCall: &dto.FunctionCall{ID: "fc_b", FunctionName: "read_file", Arguments: map[string]any{"path": "b"}}},
+			}},
+			{Role: "user", Parts: []dto.GeminiPart{
+				{FunctionResponse: &dto.GeminiFunctionResponse{ID: []byte(`"fc_b"`), Name: "read_file", Response: map[string]any{"content": "B"}}},
+				{FunctionResponse: &dto.GeminiFunctionResponse{Name: "read_file", Response: map[string]any{"content": "A"}}},
+			}},
+		},
+	}
+	openaiRequest, err := service.GeminiToOpenAIRequest(request, info)
+	require.NoError(t, err)
+	require.Len(t, openaiRequest.Messages, 3)
+	require.Equal(t, "fc_b", openaiRequest.Messages[1].ToolCallId)
+	require.Equal(t, "fc_a", openaiRequest.Messages[2].ToolCallId)
+}
+
+func TestGeminiIngressOpenAIStream(t *testing.T) {
+	c, recorder, info := newGeminiIngressContext(t, true)
+
+	usage, newAPIError := OaiStreamHandler(c, info, geminiIngress.FixtureResponse(t, "openai_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	geminiIngress.AssertGolden(t, "openai_stream.golden.txt", recorder.Body.Bytes())
+}
+
+func TestGeminiIngressOpenAIStreamHidesThoughts(t *testing.T) {
+	c, recorder, info := newGeminiIngressContext(t, true)
+	info.GeminiConvertInfo.IncludeThoughts = false
+
+	_, newAPIError := OaiStreamHandler(c, info, geminiIngress.FixtureResponse(t, "openai_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.NotContains(t, recorder.Body.String(), `"thought":true`)
+	require.Contains(t, recorder.Body.String(), `"functionCall"`)
+}
+
+func TestGeminiIngressOpenAIResponse(t *testing.T) {
+	c, recorder, info := newGeminiIngressContext(t, false)
+
+	_, newAPIError := OpenaiHandler(c, info, geminiIngress.FixtureResponse(t, "openai_response.json"))
+	require.Nil(t, newAPIError)
+	geminiIngress.AssertGoldenJSON(t, "openai_response.golden.json", recorder.Body.Bytes())
+}
+
+func TestGeminiIngressResponsesStream(t *testing.T) {
+	c, recorder, info := newGeminiIngressContext(t, true)
+
+	usage, newAPIError := OaiResponsesToChatStreamHandler(c, info, claudeIngress.FixtureResponse(t, "responses_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	geminiIngress.AssertGolden(t, "responses_stream.golden.txt", recorder.Body.Bytes())
+}
@@ -29,6 +29,8 @@ func HandleStreamFormat(c *gin.Context, info *relaycommon.RelayInfo, data string
 		return handleClaudeFormat(c, data, info)
 	case types.RelayFormatGemini:
 		return handleGeminiFormat(c, data, info)
+	case types.RelayFormatOpenAIResponses:
+		return handleResponsesFormat(c, data, info)
 	}
 	return nil
 }
@@ -62,7 +64,21 @@ func handleGeminiFormat(c *gin.Context, data string, info *relaycommon.RelayInfo
 	if geminiResponse == nil {
 		return nil
 	}
+	return sendGeminiStreamData(c, geminiResponse)
+}
 
+func handleResponsesFormat(c *gin.Context, data string, info *relaycommon.RelayInfo) error {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.Unmarshal(common.StringToByteSlice(data), &streamResponse); err != nil {
+		return err
+	}
+	for _, event := range service.StreamResponseOpenAI2Responses(&streamResponse, info) {
+		_ = helper.ResponsesData(c, *event)
+	}
+	return nil
+}
+
+func sendGeminiStreamData(c *gin.Context, geminiResponse *dto.GeminiChatResponse) error {
 	geminiResponseStr, err := common.Marshal(geminiResponse)
 	if err != nil {
 		logger.LogError(c, "failed to marshal gemini response: "+err.Error())
@@ -208,48 +224,47 @@ func HandleFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStream
 		helper.Done(c)
 
 	case types.RelayFormatClaude:
+		info.ClaudeConvertInfo.Usage = usage
+
+		var claudeResponses []*dto.ClaudeResponse
 		var streamResponse dto.ChatCompletionsStreamResponse
 		if err := common.Unmarshal(common.StringToByteSlice(lastStreamData), &streamResponse); err != nil {
 			common.SysLog("error unmarshalling stream response: " + err.Error())
-			return
+		} else {
+			claudeResponses = service.StreamResponseOpenAI2Claude(&streamResponse, info)
 		}
-
-		info.ClaudeConvertInfo.Usage = usage
-
-		claudeResponses := service.StreamResponseOpenAI2Claude(&streamResponse, info)
+		// 上游流已结束，补发尚未发送的 message_delta 与 message_stop
+		claudeResponses = append(claudeResponses, service.FinishClaudeStream(info)...)
 		for _, resp := range claudeResponses {
 			_ = helper.ClaudeData(c, *resp)
 		}
-		info.ClaudeConvertInfo.Done = true
 
 	case types.RelayFormatGemini:
 		var streamResponse dto.ChatCompletionsStreamResponse
 		if err := common.Unmarshal(common.StringToByteSlice(lastStreamData), &streamResponse); err != nil {
 			common.SysLog("error unmarshalling stream response: " + err.Error())
-			return
+		} else if geminiResponse := service.StreamResponseOpenAI2Gemini(&streamResponse, info); geminiResponse != nil {
+			_ = sendGeminiStreamData(c, geminiResponse)
 		}
 
-		// 这里处理的是 openai 最后一个流响应，其 delta 为空，有 finish_reason 字段
-		// 因此相比较于 google 官方的流响应，由 openai 转换而来会多一个 parts 为空，finishReason 为 STOP 的响应
-		// 而包含最后一段文本输出的响应（倒数第二个）的 finishReason 为 null
-		// 暂不知是否有程序会不兼容。
-
-		geminiResponse := service.StreamResponseOpenAI2Gemini(&streamResponse, info)
-
-		// openai 流响应开头的空数据
-		if geminiResponse == nil {
-			return
+		// 工具调用、结束原因与最终 usage 在最后一个响应中一并发送，与 Gemini 官方流响应一致
+		if geminiResponse := service.FinishGeminiStream(info, usage); geminiResponse != nil {
+			_ = sendGeminiStreamData(c, geminiResponse)
 		}
 
-		geminiResponseStr, err := common.Marshal(geminiResponse)
-		if err != nil {
-			common.SysLog("error marshalling gemini response: " + err.Error())
-			return
+	case types.RelayFormatOpenAIResponses:
+		var responsesEvents []*dto.ResponsesStreamResponse
+		var streamResponse dto.ChatCompletionsStreamResponse
+		if err := common.Unmarshal(common.StringToByteSlice(lastStreamData), &streamResponse); err != nil {
+			common.SysLog("error unmarshalling stream response: " + err.Error())
+		} else {
+			responsesEvents = service.StreamResponseOpenAI2Responses(&streamResponse, info)
+		}
+		// 输出项的 done 事件与带最终用量的 response.completed 在上游流结束后补发
+		responsesEvents = append(responsesEvents, service.FinishResponsesStream(info, usage)...)
+		for _, event := range responsesEvents {
+			_ = helper.ResponsesData(c, *event)
 		}
-
-		// 发送最终的 Gemini 响应
-		c.Render(-1, common.CustomEvent{Data: "data: " + string(geminiResponseStr)})
-		_ = helper.FlushWriter(c)
 	}
 }
 
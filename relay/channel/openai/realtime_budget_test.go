@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// With server VAD the upstream starts responses on its own, so the budget is checked on response.created.
+func TestRealtimeHandlerStopsServerVADResponseOverBudget(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}))
+	savedDB, savedRedis := model.DB, common.RedisEnabled
+	model.DB, common.RedisEnabled = db, false
+	t.Cleanup(func() { model.DB, common.RedisEnabled = savedDB, savedRedis })
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "realtime", Quota: 50, Status: common.UserStatusEnabled}).Error)
+	require.NoError(t, db.Create(&model.Token{Id: 1, UserId: 1, Key: "realtimevad", RemainQuota: 50, Status: common.TokenStatusEnabled}).Error)
+
+	setting := operation_setting.GetRealtimeSessionSetting()
+	saved := *setting
+	*setting = operation_setting.RealtimeSessionSetting{
+		Enabled: true,
+		Default: operation_setting.RealtimeSessionPolicy{MinRemainQuota: 100},
+	}
+	t.Cleanup(func() { *setting = saved })
+
+	upgrader := websocket.Upgrader{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"response.created","response":{"id":"resp_vad","status":"in_progress"}}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	handlerDone := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		clientConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer clientConn.Close()
+		targetConn, _, err := websocket.DefaultDialer.Dial(wsURL(upstream), nil)
+		if err != nil {
+			return
+		}
+		defer targetConn.Close()
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = r
+		helper.InitWssWriteLock(c)
+		info := &relaycommon.RelayInfo{UserId: 1, TokenId: 1, ClientWs: clientConn, TargetWs: targetConn}
+		session, apiErr := service.StartRealtimeSession(c, info, func(stop *service.RealtimeSessionStop) {
+			helper.WssError(c, clientConn, stop.Error)
+			helper.WssClose(clientConn, stop.CloseCode, stop.Reason)
+		})
+		if apiErr != nil {
+			return
+		}
+		defer session.Finish(c)
+		OpenaiRealtimeHandler(c, info)
+	}))
+	defer gateway.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial(wsURL(gateway), nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, message, err := client.ReadMessage()
+	require.NoError(t, err)
+	var event dto.RealtimeEvent
+	require.NoError(t, common.Unmarshal(message, &event))
+	require.Equal(t, dto.RealtimeEventTypeError, event.Type)
+	require.Equal(t, "insufficient_quota", event.Error.Code)
+
+	_, _, err = client.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+
+	select {
+	case <-handlerDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("realtime handler did not return after the session was stopped")
+	}
+}
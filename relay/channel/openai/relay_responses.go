@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -42,6 +43,7 @@ func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 
 	// 写入新的 response body
 	service.IOCopyBytesGracefully(c, resp, responseBody)
+	service.RecordResponsesStateResponse(info, responseBody)
 
 	// compute usage
 	usage := dto.Usage{}
@@ -86,8 +88,9 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 		if err := common.UnmarshalJsonStr(data, &streamResponse); err == nil {
 			sendResponsesStreamData(c, streamResponse, data)
 			switch streamResponse.Type {
-			case "response.completed":
+			case "response.completed", "response.incomplete":
 				if streamResponse.Response != nil {
+					recordResponsesStreamState(info, data)
 					if streamResponse.Response.Usage != nil {
 						if streamResponse.Response.Usage.InputTokens != 0 {
 							usage.PromptTokens = streamResponse.Response.Usage.InputTokens
@@ -148,3 +151,16 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 
 	return usage, nil
 }
+
+// recordResponsesStreamState 从 response.completed 事件中取出完整响应对象，供网关保存会话状态
+func recordResponsesStreamState(info *relaycommon.RelayInfo, data string) {
+	if info == nil || info.ResponsesStateInfo == nil {
+		return
+	}
+	var event struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := common.UnmarshalJsonStr(data, &event); err == nil {
+		service.RecordResponsesStateResponse(info, event.Response)
+	}
+}
@@ -0,0 +1,94 @@
+package openai
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/ingresstest"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+var responsesIngress = ingresstest.Harness{Dir: "responses_ingress", Path: "/v1/responses"}
+
+func newResponsesIngressContext(t *testing.T, stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	t.Helper()
+	c, recorder := responsesIngress.NewContext(t)
+
+	request := readResponsesIngressRequest(t)
+	convertInfo := service.NewResponsesConvertInfo(request, "deepseek-chat")
+	convertInfo.ResponseId = "resp_test"
+	convertInfo.CreatedAt = 1
+	convertInfo.Response.ID = "resp_test"
+	convertInfo.Response.CreatedAt = 1
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:          types.RelayFormatOpenAIResponses,
+		RelayMode:            relayconstant.RelayModeChatCompletions,
+		OriginModelName:      "deepseek-chat",
+		IsStream:             stream,
+		ResponsesConvertInfo: convertInfo,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:          constant.ChannelTypeDeepSeek,
+			ChannelBaseUrl:       "https://api.deepseek.com",
+			UpstreamModelName:    "deepseek-chat",
+			SupportStreamOptions: true,
+		},
+	}
+	return c, recorder, info
+}
+
+func readResponsesIngressRequest(t *testing.T) *dto.OpenAIResponsesRequest {
+	t.Helper()
+	var request dto.OpenAIResponsesRequest
+	responsesIngress.ReadRequest(t, "request.json", &request)
+	return &request
+}
+
+func TestResponsesIngressChatRequest(t *testing.T) {
+	_, _, info := newResponsesIngressContext(t, true)
+
+	chatRequest, err := service.ResponsesRequestToChatCompletionsRequest(readResponsesIngressRequest(t), info)
+	require.NoError(t, err)
+	body, err := common.Marshal(chatRequest)
+	require.NoError(t, err)
+	responsesIngress.AssertGoldenJSON(t, "chat_request.golden.json", body)
+}
+
+func TestResponsesIngressRejectsItemReference(t *testing.T) {
+	_, _, info := newResponsesIngressContext(t, false)
+
+	request := &dto.OpenAIResponsesRequest{
+		Model: "deepseek-chat",
+		Input: []byte(`[{"type":"item_reference","id":"msg_1"}]`),
+	}
+	_, err := service.ResponsesRequestToChatCompletionsRequest(request, info)
+	require.Error(t, err)
+}
+
+func TestResponsesIngressChatStream(t *testing.T) {
+	c, recorder, info := newResponsesIngressContext(t, true)
+
+	usage, newAPIError := OaiStreamHandler(c, info, claudeIngress.FixtureResponse(t, "openai_stream.txt"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, 1024, usage.PromptTokensDetails.CachedTokens)
+	require.True(t, info.ResponsesConvertInfo.Done)
+	require.Len(t, info.ResponsesConvertInfo.Output, 4)
+	responsesIngress.AssertGolden(t, "chat_stream.golden.txt", recorder.Body.Bytes())
+}
+
+func TestResponsesIngressChatResponse(t *testing.T) {
+	c, recorder, info := newResponsesIngressContext(t, false)
+
+	_, newAPIError := OpenaiHandler(c, info, claudeIngress.FixtureResponse(t, "openai_response.json"))
+	require.Nil(t, newAPIError)
+	responsesIngress.AssertGoldenJSON(t, "chat_response.golden.json", recorder.Body.Bytes())
+}
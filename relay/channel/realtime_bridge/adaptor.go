@@ -0,0 +1,97 @@
+package realtime_bridge
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adaptor 在网关侧终结 OpenAI Realtime 协议，由转写、对话、语音合成三个渠道组成语音流水线
+type Adaptor struct {
+}
+
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: endpoint not supported")
+}
+
+func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: /v1/messages endpoint not supported")
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
+	return nil, errors.New("realtime bridge channel: endpoint not supported")
+}
+
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: endpoint not supported")
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return "", errors.New("realtime bridge channel: only /v1/realtime is supported")
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
+	return nil
+}
+
+func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: /v1/chat/completions endpoint not supported")
+}
+
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: /v1/rerank endpoint not supported")
+}
+
+func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: /v1/embeddings endpoint not supported")
+}
+
+func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
+	return nil, errors.New("realtime bridge channel: /v1/responses endpoint not supported")
+}
+
+// DoRequest 不建立上游 WebSocket，各环节在会话中按需请求
+func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if info.RelayMode != relayconstant.RelayModeRealtime {
+		return nil, errors.New("realtime bridge channel: only /v1/realtime is supported")
+	}
+	return nil, nil
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if info.ClientWs == nil {
+		return nil, types.NewError(errors.New("realtime bridge channel: websocket connection required"), types.ErrorCodeBadResponse)
+	}
+	config, configErr := newBridgeConfig(info)
+	if configErr != nil {
+		return nil, types.NewError(configErr, types.ErrorCodeGetChannelFailed)
+	}
+	for _, modelName := range config.models() {
+		if priceErr := service.CheckRealtimeBridgeLegPrice(info, modelName); priceErr != nil {
+			return nil, types.NewError(priceErr, types.ErrorCodeModelPriceError, types.ErrOptionWithSkipRetry())
+		}
+	}
+	session := newSession(c, info, config, newChannelLegResolver(info), func(leg *service.RealtimeBridgeLeg) error {
+		return service.ConsumeRealtimeBridgeLegQuota(c, info, leg)
+	})
+	return session.run(), nil
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
@@ -0,0 +1,147 @@
+package realtime_bridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// pcm16SampleRate Realtime 协议 pcm16 格式固定为 24kHz 单声道 16 位小端
+	pcm16SampleRate     = 24000
+	pcm16BytesPerSecond = pcm16SampleRate * 2
+	vadFrameMs          = 20
+	vadFrameBytes       = pcm16BytesPerSecond * vadFrameMs / 1000
+	// vadEnergyScale 将 turn_detection.threshold（0~1）换算为帧能量阈值，默认 0.5 约对应 -32 dBFS
+	vadEnergyScale = 0.05
+)
+
+func pcm16DurationMs(size int) int {
+	return size * 1000 / pcm16BytesPerSecond
+}
+
+func pcm16BytesForMs(ms int) int {
+	return ms * pcm16BytesPerSecond / 1000 / 2 * 2
+}
+
+// pcm16ToWav 为转写环节封装 WAV 头，上游普遍不接受裸 PCM
+func pcm16ToWav(pcm []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcm))
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // 单声道
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(pcm16SampleRate))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(pcm16BytesPerSecond))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// skipWavHeader 部分语音合成上游忽略 response_format=pcm 而返回 WAV，跳过文件头直到 data 块
+func skipWavHeader(r io.Reader) (io.Reader, error) {
+	head := make([]byte, 12)
+	n, err := io.ReadFull(r, head)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return bytes.NewReader(head[:n]), nil
+		}
+		return nil, err
+	}
+	if string(head[0:4]) != "RIFF" || string(head[8:12]) != "WAVE" {
+		return io.MultiReader(bytes.NewReader(head), r), nil
+	}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, errors.New("invalid wav audio: data chunk not found")
+		}
+		size := binary.LittleEndian.Uint32(chunk[4:8])
+		if string(chunk[0:4]) == "data" {
+			return r, nil
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+			return nil, errors.New("invalid wav audio: data chunk not found")
+		}
+	}
+}
+
+// pcm16Energy 帧的均方根能量，归一化到 0~1
+func pcm16Energy(frame []byte) float64 {
+	samples := len(frame) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(frame[i*2:]))) / 32768
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(samples))
+}
+
+type vadEventKind int
+
+const (
+	vadSpeechStarted vadEventKind = iota
+	vadSpeechStopped
+)
+
+type vadEvent struct {
+	kind vadEventKind
+	ms   int
+}
+
+// vadState 基于帧能量的简易语音活动检测，用于模拟 server_vad：
+// 能量超过阈值视为开始说话，随后持续静音 silence_duration_ms 视为说完
+type vadState struct {
+	speaking  bool
+	silenceMs int
+	// totalMs 会话开始以来收到的音频时长，对应事件中的 audio_start_ms / audio_end_ms
+	totalMs int
+	pending []byte
+}
+
+func (v *vadState) reset() {
+	v.speaking = false
+	v.silenceMs = 0
+	v.pending = nil
+}
+
+func (v *vadState) feed(audio []byte, td *turnDetection) []vadEvent {
+	var events []vadEvent
+	data := append(v.pending, audio...)
+	threshold := td.threshold() * vadEnergyScale
+	for len(data) >= vadFrameBytes {
+		frame := data[:vadFrameBytes]
+		data = data[vadFrameBytes:]
+		v.totalMs += vadFrameMs
+		if pcm16Energy(frame) >= threshold {
+			v.silenceMs = 0
+			if !v.speaking {
+				v.speaking = true
+				events = append(events, vadEvent{kind: vadSpeechStarted, ms: max(v.totalMs-vadFrameMs-td.prefixPaddingMs(), 0)})
+			}
+			continue
+		}
+		if !v.speaking {
+			continue
+		}
+		v.silenceMs += vadFrameMs
+		if v.silenceMs >= td.silenceDurationMs() {
+			v.speaking = false
+			v.silenceMs = 0
+			events = append(events, vadEvent{kind: vadSpeechStopped, ms: v.totalMs})
+		}
+	}
+	v.pending = append([]byte(nil), data...)
+	return events
+}
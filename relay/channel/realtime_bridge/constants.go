@@ -0,0 +1,9 @@
+package realtime_bridge
+
+var ModelList = []string{
+	"gpt-realtime",
+	"gpt-4o-realtime-preview",
+	"gpt-4o-mini-realtime-preview",
+}
+
+var ChannelName = "realtime_bridge"
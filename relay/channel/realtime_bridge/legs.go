@@ -0,0 +1,311 @@
+package realtime_bridge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/samber/lo"
+)
+
+const (
+	legTranscription = "transcription"
+	legChat          = "chat"
+	legSpeech        = "speech"
+
+	legErrorBodyLimit = 4 << 10
+)
+
+type bridgeConfig struct {
+	TranscriptionModel string
+	ChatModel          string
+	SpeechModel        string
+	Voice              string
+}
+
+func newBridgeConfig(info *relaycommon.RelayInfo) (*bridgeConfig, error) {
+	settings := info.ChannelOtherSettings
+	config := &bridgeConfig{
+		TranscriptionModel: strings.TrimSpace(settings.RealtimeBridgeTranscriptionModel),
+		ChatModel:          strings.TrimSpace(settings.RealtimeBridgeChatModel),
+		SpeechModel:        strings.TrimSpace(settings.RealtimeBridgeSpeechModel),
+		Voice:              strings.TrimSpace(settings.RealtimeBridgeVoice),
+	}
+	if config.ChatModel == "" {
+		return nil, errors.New("realtime bridge channel: chat model is not configured")
+	}
+	return config, nil
+}
+
+func (c *bridgeConfig) models() []string {
+	return lo.Compact([]string{c.TranscriptionModel, c.ChatModel, c.SpeechModel})
+}
+
+// legEndpoint 某个环节选中的上游渠道，需兼容 OpenAI 的音频与对话接口
+type legEndpoint struct {
+	ChannelId     int
+	ChannelType   int
+	BaseURL       string
+	Key           string
+	UpstreamModel string
+	Proxy         string
+}
+
+type legResolver func(modelName string) (*legEndpoint, error)
+
+// newChannelLegResolver 在会话所用分组内为环节模型选择渠道
+func newChannelLegResolver(info *relaycommon.RelayInfo) legResolver {
+	return func(modelName string) (*legEndpoint, error) {
+		channel, err := model.GetRandomSatisfiedChannel(info.UsingGroup, modelName, 0)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, fmt.Errorf("no available channel for model %s in group %s", modelName, info.UsingGroup)
+		}
+		if apiType, _ := common.ChannelType2APIType(channel.Type); apiType != constant.APITypeOpenAI || channel.Type == constant.ChannelTypeAzure {
+			return nil, fmt.Errorf("channel #%d of model %s is not OpenAI compatible", channel.Id, modelName)
+		}
+		key, _, keyErr := channel.GetNextEnabledKey()
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		upstreamModel := modelName
+		if mapping := channel.GetModelMapping(); mapping != "" && mapping != "{}" {
+			modelMap := make(map[string]string)
+			if err := common.Unmarshal([]byte(mapping), &modelMap); err != nil {
+				return nil, fmt.Errorf("unmarshal_model_mapping_failed: %w", err)
+			}
+			if mapped := modelMap[modelName]; mapped != "" {
+				upstreamModel = mapped
+			}
+		}
+		return &legEndpoint{
+			ChannelId:     channel.Id,
+			ChannelType:   channel.Type,
+			BaseURL:       channel.GetBaseURL(),
+			Key:           key,
+			UpstreamModel: upstreamModel,
+			Proxy:         channel.GetSetting().Proxy,
+		}, nil
+	}
+}
+
+func (e *legEndpoint) do(ctx context.Context, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, relaycommon.GetFullRequestURL(e.BaseURL, path, e.ChannelType), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+e.Key)
+	client, err := service.GetHttpClientWithProxy(e.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, legErrorBodyLimit))
+		return nil, fmt.Errorf("upstream channel #%d returned status %d: %s", e.ChannelId, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// scanSSE 逐条回调 SSE 的 data 内容，遇到 [DONE] 结束
+func scanSSE(body io.Reader, handle func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			return nil
+		}
+		if err := handle(data); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+type transcriptionUsage struct {
+	Type              string `json:"type"`
+	InputTokens       int    `json:"input_tokens"`
+	OutputTokens      int    `json:"output_tokens"`
+	TotalTokens       int    `json:"total_tokens"`
+	InputTokenDetails struct {
+		TextTokens  int `json:"text_tokens"`
+		AudioTokens int `json:"audio_tokens"`
+	} `json:"input_token_details"`
+}
+
+type transcriptionEvent struct {
+	Type  string              `json:"type"`
+	Delta string              `json:"delta"`
+	Text  string              `json:"text"`
+	Usage *transcriptionUsage `json:"usage"`
+}
+
+// transcribe 请求转写环节。上游支持流式转写时逐段回调 onDelta，否则一次性返回完整文本
+func (e *legEndpoint) transcribe(ctx context.Context, pcm []byte, onDelta func(delta string)) (string, *transcriptionUsage, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", e.UpstreamModel)
+	_ = writer.WriteField("response_format", "json")
+	_ = writer.WriteField("stream", "true")
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := part.Write(pcm16ToWav(pcm)); err != nil {
+		return "", nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return "", nil, err
+	}
+
+	resp, err := e.do(ctx, "/v1/audio/transcriptions", writer.FormDataContentType(), &body)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var result transcriptionEvent
+		if err := common.DecodeJson(resp.Body, &result); err != nil {
+			return "", nil, fmt.Errorf("invalid transcription response: %w", err)
+		}
+		if result.Text != "" {
+			onDelta(result.Text)
+		}
+		return result.Text, result.Usage, nil
+	}
+
+	var text strings.Builder
+	var usage *transcriptionUsage
+	done := false
+	err = scanSSE(resp.Body, func(data string) error {
+		var event transcriptionEvent
+		if err := common.UnmarshalJsonStr(data, &event); err != nil {
+			return fmt.Errorf("invalid transcription stream event: %w", err)
+		}
+		switch event.Type {
+		case "transcript.text.delta":
+			text.WriteString(event.Delta)
+			onDelta(event.Delta)
+		case "transcript.text.done":
+			done = true
+			usage = event.Usage
+			if event.Text != "" {
+				text.Reset()
+				text.WriteString(event.Text)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if !done && text.Len() == 0 {
+		return "", nil, errors.New("transcription stream ended without transcript")
+	}
+	return text.String(), usage, nil
+}
+
+// chat 以流式请求对话环节，每个数据块回调 onChunk，返回上游报告的用量（可能为空）
+func (e *legEndpoint) chat(ctx context.Context, request *dto.GeneralOpenAIRequest, onChunk func(chunk *dto.ChatCompletionsStreamResponse)) (*dto.Usage, error) {
+	request.Model = e.UpstreamModel
+	request.Stream = common.GetPointer(true)
+	request.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	data, err := common.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.do(ctx, "/v1/chat/completions", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var usage *dto.Usage
+	err = scanSSE(resp.Body, func(data string) error {
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+			return fmt.Errorf("invalid chat stream chunk: %w", err)
+		}
+		if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+			usage = chunk.Usage
+		}
+		onChunk(&chunk)
+		return nil
+	})
+	return usage, err
+}
+
+// speak 请求语音合成环节，要求上游输出 24kHz pcm，音频按块回调 onAudio
+func (e *legEndpoint) speak(ctx context.Context, text string, voice string, onAudio func(pcm []byte)) error {
+	data, err := common.Marshal(dto.AudioRequest{
+		Model:          e.UpstreamModel,
+		Input:          text,
+		Voice:          voice,
+		ResponseFormat: "pcm",
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(ctx, "/v1/audio/speech", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	reader, err := skipWavHeader(resp.Body)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, pcm16BytesPerSecond/5)
+	var carry []byte
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			chunk := append(carry, buf[:n]...)
+			// 保证每块为完整的 16 位采样
+			even := len(chunk) / 2 * 2
+			if even > 0 {
+				onAudio(append([]byte(nil), chunk[:even]...))
+			}
+			carry = append([]byte(nil), chunk[even:]...)
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
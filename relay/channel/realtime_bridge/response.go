@@ -0,0 +1,453 @@
+package realtime_bridge
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+)
+
+const (
+	// speechSentenceEnds 对话输出按句切分后逐句送入语音合成，以降低首个音频的延迟
+	speechSentenceEnds = ".!?。！？；;\n"
+	// minSpeechSegmentRunes 过短的句子与后文合并合成
+	minSpeechSegmentRunes = 12
+)
+
+// responseTurn 一次 response.create 的输出状态
+type responseTurn struct {
+	s        *session
+	ctx      context.Context
+	response *dto.RealtimeResponse
+	audio    bool
+	voice    string
+
+	message *dto.RealtimeItem
+	// messageIndex 消息在本次响应输出中的序号
+	messageIndex int
+	text         strings.Builder
+
+	calls       map[int]*dto.RealtimeItem
+	callIndexes map[int]int
+	callOrder   []int
+
+	chatLeg        *service.RealtimeBridgeLeg
+	speechLeg      *service.RealtimeBridgeLeg
+	speechEndpoint *legEndpoint
+	speechFailed   bool
+	pendingText    strings.Builder
+}
+
+// respond 依次调用对话与语音合成环节生成一次响应
+func (s *session) respond(ctx context.Context, override *dto.RealtimeResponse) {
+	// 额度不足一次响应时会话已被关闭
+	if s.control.CheckBudget(s.c) != nil {
+		return
+	}
+	defer s.control.EndResponse()
+	responseCtx, cancel := context.WithCancel(ctx)
+	s.setResponseCancel(cancel)
+	defer func() {
+		s.setResponseCancel(nil)
+		cancel()
+	}()
+
+	settings := s.snapshotSettings()
+	modalities := settings.Modalities
+	instructions := settings.Instructions
+	if override != nil {
+		if len(override.Modalities) > 0 {
+			modalities = override.Modalities
+		}
+		if override.Instructions != "" {
+			instructions = override.Instructions
+		}
+	}
+	turn := &responseTurn{
+		s:   s,
+		ctx: responseCtx,
+		response: &dto.RealtimeResponse{
+			Id:     newRealtimeId("resp_"),
+			Object: "realtime.response",
+			Status: "in_progress",
+			Output: []dto.RealtimeItem{},
+		},
+		audio:       slices.Contains(modalities, "audio") && s.config.SpeechModel != "",
+		voice:       settings.Voice,
+		calls:       make(map[int]*dto.RealtimeItem),
+		callIndexes: make(map[int]int),
+	}
+	s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseCreated, Response: turn.snapshot()})
+
+	err := turn.chat(settings, instructions)
+	if err == nil && responseCtx.Err() == nil {
+		turn.flushSpeech(true)
+	}
+	turn.finish(err)
+}
+
+func (t *responseTurn) snapshot() *dto.RealtimeResponse {
+	response := *t.response
+	response.Output = slices.Clone(t.response.Output)
+	return &response
+}
+
+func (t *responseTurn) chat(settings *dto.RealtimeSession, instructions string) error {
+	modelName := t.s.config.ChatModel
+	endpoint, err := t.s.resolve(modelName)
+	if err != nil {
+		return err
+	}
+	t.chatLeg = newLeg(legChat, endpoint, modelName)
+	request := t.s.chatRequest(settings, instructions)
+	usage, err := endpoint.chat(t.ctx, request, t.onChunk)
+	if usage != nil {
+		t.chatLeg.Usage.InputTokenDetails.TextTokens = usage.PromptTokens
+		t.chatLeg.Usage.InputTokenDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+		t.chatLeg.Usage.OutputTokenDetails.TextTokens = usage.CompletionTokens
+	} else {
+		// 上游未返回用量（或被取消）时按文本估算
+		promptTokens := 0
+		for _, message := range request.Messages {
+			promptTokens += service.CountTextToken(message.StringContent(), modelName)
+		}
+		output := t.text.String()
+		for _, index := range t.callOrder {
+			output += t.calls[index].Arguments
+		}
+		t.chatLeg.Usage.InputTokenDetails.TextTokens = promptTokens
+		t.chatLeg.Usage.OutputTokenDetails.TextTokens = service.CountTextToken(output, modelName)
+	}
+	if t.ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (t *responseTurn) onChunk(chunk *dto.ChatCompletionsStreamResponse) {
+	if t.ctx.Err() != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			t.appendText(content)
+		}
+		for i, toolCall := range choice.Delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			t.appendToolCall(index, toolCall)
+		}
+	}
+}
+
+func (t *responseTurn) addOutput(item *dto.RealtimeItem) int {
+	index := len(t.response.Output)
+	t.response.Output = append(t.response.Output, *item)
+	previousItemId := t.s.lastItemId()
+	t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemAdded, ResponseId: t.response.Id, OutputIndex: common.GetPointer(index), Item: item})
+	t.s.insertItem(previousItemId, item)
+	return index
+}
+
+func (t *responseTurn) partType() string {
+	if t.audio {
+		return "audio"
+	}
+	return "text"
+}
+
+func (t *responseTurn) appendText(delta string) {
+	if t.message == nil {
+		t.message = &dto.RealtimeItem{
+			Id:      newRealtimeId("item_"),
+			Type:    "message",
+			Status:  "in_progress",
+			Role:    "assistant",
+			Content: []dto.RealtimeContent{},
+		}
+		t.messageIndex = t.addOutput(t.message)
+		t.s.emit(&dto.RealtimeEvent{
+			Type:         dto.RealtimeEventResponseContentPartAdded,
+			ResponseId:   t.response.Id,
+			ItemId:       t.message.Id,
+			OutputIndex:  common.GetPointer(t.messageIndex),
+			ContentIndex: common.GetPointer(0),
+			Part:         &dto.RealtimeContent{Type: t.partType()},
+		})
+	}
+	t.text.WriteString(delta)
+	eventType := dto.RealtimeEventResponseTextDelta
+	if t.audio {
+		eventType = dto.RealtimeEventResponseAudioTranscriptionDelta
+	}
+	t.s.emit(&dto.RealtimeEvent{
+		Type:         eventType,
+		ResponseId:   t.response.Id,
+		ItemId:       t.message.Id,
+		OutputIndex:  common.GetPointer(t.messageIndex),
+		ContentIndex: common.GetPointer(0),
+		Delta:        delta,
+	})
+	if t.audio {
+		t.pendingText.WriteString(delta)
+		t.flushSpeech(false)
+	}
+}
+
+func (t *responseTurn) appendToolCall(index int, toolCall dto.ToolCallResponse) {
+	item, ok := t.calls[index]
+	if !ok {
+		callId := toolCall.ID
+		if callId == "" {
+			callId = newRealtimeId("call_")
+		}
+		name := toolCall.Function.Name
+		item = &dto.RealtimeItem{
+			Id:     newRealtimeId("item_"),
+			Type:   "function_call",
+			Status: "in_progress",
+			Name:   &name,
+			CallId: callId,
+		}
+		t.calls[index] = item
+		t.callOrder = append(t.callOrder, index)
+		t.callIndexes[index] = t.addOutput(item)
+	} else if toolCall.Function.Name != "" && *item.Name == "" {
+		*item.Name = toolCall.Function.Name
+	}
+	if toolCall.Function.Arguments == "" {
+		return
+	}
+	item.Arguments += toolCall.Function.Arguments
+	t.s.emit(&dto.RealtimeEvent{
+		Type:        dto.RealtimeEventResponseFunctionCallArgumentsDelta,
+		ResponseId:  t.response.Id,
+		ItemId:      item.Id,
+		OutputIndex: common.GetPointer(t.callIndexes[index]),
+		CallId:      item.CallId,
+		Delta:       toolCall.Function.Arguments,
+	})
+}
+
+// flushSpeech 将已完成的句子送入语音合成环节，final 为 true 时合成剩余全部文本
+func (t *responseTurn) flushSpeech(final bool) {
+	if !t.audio || t.speechFailed {
+		return
+	}
+	pending := t.pendingText.String()
+	cut := len(pending)
+	if !final {
+		cut = strings.LastIndexAny(pending, speechSentenceEnds)
+		if cut < 0 {
+			return
+		}
+		_, size := utf8.DecodeRuneInString(pending[cut:])
+		cut += size
+		if utf8.RuneCountInString(pending[:cut]) < minSpeechSegmentRunes {
+			return
+		}
+	}
+	segment := strings.TrimSpace(pending[:cut])
+	t.pendingText.Reset()
+	t.pendingText.WriteString(pending[cut:])
+	if segment == "" || t.ctx.Err() != nil {
+		return
+	}
+
+	modelName := t.s.config.SpeechModel
+	if t.speechLeg == nil {
+		endpoint, err := t.s.resolve(modelName)
+		if err != nil {
+			t.failSpeech(err)
+			return
+		}
+		t.speechLeg = newLeg(legSpeech, endpoint, modelName)
+		t.speechEndpoint = endpoint
+	}
+	t.speechLeg.Usage.InputTokenDetails.TextTokens += service.CountTextToken(segment, modelName)
+	err := t.speechEndpoint.speak(t.ctx, segment, t.voice, func(pcm []byte) {
+		delta := base64.StdEncoding.EncodeToString(pcm)
+		audioTokens, _ := service.CountAudioTokenOutput(delta, "pcm16")
+		t.speechLeg.Usage.OutputTokenDetails.AudioTokens += audioTokens
+		t.s.emit(&dto.RealtimeEvent{
+			Type:         dto.RealtimeEventResponseAudioDelta,
+			ResponseId:   t.response.Id,
+			ItemId:       t.message.Id,
+			OutputIndex:  common.GetPointer(t.messageIndex),
+			ContentIndex: common.GetPointer(0),
+			Delta:        delta,
+		})
+	})
+	if err != nil && t.ctx.Err() == nil {
+		t.failSpeech(err)
+	}
+}
+
+// failSpeech 语音合成失败时本次响应继续输出文本转写，不再尝试合成
+func (t *responseTurn) failSpeech(err error) {
+	t.speechFailed = true
+	t.s.emitError("server_error", "speech_failed", "Speech synthesis failed: "+err.Error())
+}
+
+func (t *responseTurn) finish(chatErr error) {
+	status := "completed"
+	var statusDetails any
+	switch {
+	case chatErr != nil:
+		status = "failed"
+		apiErr := types.OpenAIError{Type: "server_error", Message: chatErr.Error()}
+		statusDetails = map[string]any{"type": "failed", "error": apiErr}
+		t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeError, Error: &apiErr})
+	case t.ctx.Err() != nil:
+		status = "cancelled"
+		reason := t.s.responseCancelReason()
+		if reason == "" {
+			reason = "client_cancelled"
+		}
+		statusDetails = map[string]any{"type": "cancelled", "reason": reason}
+	}
+	itemStatus := "completed"
+	if status != "completed" {
+		itemStatus = "incomplete"
+	}
+
+	if t.message != nil {
+		t.finishMessage(itemStatus)
+	}
+	for _, index := range t.callOrder {
+		item := t.calls[index]
+		item.Status = itemStatus
+		if itemStatus == "completed" {
+			t.s.emit(&dto.RealtimeEvent{
+				Type:        dto.RealtimeEventResponseFunctionCallArgumentsDone,
+				ResponseId:  t.response.Id,
+				ItemId:      item.Id,
+				OutputIndex: common.GetPointer(t.callIndexes[index]),
+				CallId:      item.CallId,
+				Name:        *item.Name,
+				Arguments:   item.Arguments,
+			})
+		}
+		t.response.Output[t.callIndexes[index]] = *item
+		t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemDone, ResponseId: t.response.Id, OutputIndex: common.GetPointer(t.callIndexes[index]), Item: item})
+	}
+
+	usage := &dto.RealtimeUsage{}
+	for _, leg := range []*service.RealtimeBridgeLeg{t.chatLeg, t.speechLeg} {
+		if leg == nil {
+			continue
+		}
+		t.s.bill(leg)
+		addRealtimeUsage(usage, leg.Usage)
+	}
+	t.response.Status = status
+	t.response.StatusDetails = statusDetails
+	t.response.Usage = usage
+	t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseDone, Response: t.snapshot()})
+}
+
+func (t *responseTurn) finishMessage(itemStatus string) {
+	text := t.text.String()
+	part := dto.RealtimeContent{Type: "text", Text: text}
+	if t.audio {
+		part = dto.RealtimeContent{Type: "audio", Transcript: text}
+	}
+	t.message.Status = itemStatus
+	t.message.Content = []dto.RealtimeContent{part}
+	if t.audio {
+		t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioDone, ResponseId: t.response.Id, ItemId: t.message.Id, OutputIndex: common.GetPointer(t.messageIndex), ContentIndex: common.GetPointer(0)})
+		t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioTranscriptDone, ResponseId: t.response.Id, ItemId: t.message.Id, OutputIndex: common.GetPointer(t.messageIndex), ContentIndex: common.GetPointer(0), Transcript: text})
+	} else {
+		t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseTextDone, ResponseId: t.response.Id, ItemId: t.message.Id, OutputIndex: common.GetPointer(t.messageIndex), ContentIndex: common.GetPointer(0), Text: text})
+	}
+	t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseContentPartDone, ResponseId: t.response.Id, ItemId: t.message.Id, OutputIndex: common.GetPointer(t.messageIndex), ContentIndex: common.GetPointer(0), Part: &part})
+	t.response.Output[t.messageIndex] = *t.message
+	t.s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemDone, ResponseId: t.response.Id, OutputIndex: common.GetPointer(t.messageIndex), Item: t.message})
+}
+
+// chatRequest 将会话条目转换为对话环节的 Chat Completions 请求
+func (s *session) chatRequest(settings *dto.RealtimeSession, instructions string) *dto.GeneralOpenAIRequest {
+	request := &dto.GeneralOpenAIRequest{}
+	if instructions != "" {
+		request.Messages = append(request.Messages, dto.Message{Role: "system", Content: instructions})
+	}
+	var pendingCalls []dto.ToolCallRequest
+	flushCalls := func() {
+		if len(pendingCalls) == 0 {
+			return
+		}
+		message := dto.Message{Role: "assistant"}
+		message.SetNullContent()
+		message.SetToolCalls(pendingCalls)
+		request.Messages = append(request.Messages, message)
+		pendingCalls = nil
+	}
+	for _, item := range s.items {
+		if item.Type == "function_call" {
+			name := ""
+			if item.Name != nil {
+				name = *item.Name
+			}
+			pendingCalls = append(pendingCalls, dto.ToolCallRequest{
+				ID:       item.CallId,
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: name, Arguments: item.Arguments},
+			})
+			continue
+		}
+		flushCalls()
+		switch item.Type {
+		case "message":
+			var texts []string
+			for _, content := range item.Content {
+				switch content.Type {
+				case "input_text", "text":
+					texts = append(texts, content.Text)
+				case "input_audio", "audio":
+					texts = append(texts, content.Transcript)
+				}
+			}
+			text := strings.TrimSpace(strings.Join(texts, "\n"))
+			if text == "" {
+				continue
+			}
+			request.Messages = append(request.Messages, dto.Message{Role: item.Role, Content: text})
+		case "function_call_output":
+			request.Messages = append(request.Messages, dto.Message{Role: "tool", ToolCallId: item.CallId, Content: item.Output})
+		}
+	}
+	flushCalls()
+
+	for _, tool := range settings.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		request.Tools = append(request.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(request.Tools) > 0 && settings.ToolChoice != "" {
+		request.ToolChoice = settings.ToolChoice
+	}
+	if settings.Temperature > 0 {
+		temperature := settings.Temperature
+		request.Temperature = &temperature
+	}
+	return request
+}
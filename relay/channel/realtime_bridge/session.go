@@ -0,0 +1,647 @@
+package realtime_bridge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	sessionJobQueueSize = 64
+	// minCommitAudioMs 手动提交的音频短于该时长时按 OpenAI 的行为报错
+	minCommitAudioMs = 100
+
+	defaultVoice       = "alloy"
+	defaultTemperature = 0.8
+)
+
+// turnDetection 会话的 turn_detection 配置，server_vad 与 semantic_vad 均按能量检测模拟
+type turnDetection struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold,omitempty"`
+	PrefixPaddingMs   int     `json:"prefix_padding_ms,omitempty"`
+	SilenceDurationMs int     `json:"silence_duration_ms,omitempty"`
+	CreateResponse    *bool   `json:"create_response,omitempty"`
+	InterruptResponse *bool   `json:"interrupt_response,omitempty"`
+}
+
+func defaultTurnDetection() *turnDetection {
+	return &turnDetection{
+		Type:              "server_vad",
+		Threshold:         0.5,
+		PrefixPaddingMs:   300,
+		SilenceDurationMs: 500,
+		CreateResponse:    common.GetPointer(true),
+		InterruptResponse: common.GetPointer(true),
+	}
+}
+
+func (t *turnDetection) threshold() float64 {
+	if t.Threshold <= 0 {
+		return 0.5
+	}
+	return t.Threshold
+}
+
+func (t *turnDetection) prefixPaddingMs() int {
+	if t.PrefixPaddingMs <= 0 {
+		return 300
+	}
+	return t.PrefixPaddingMs
+}
+
+func (t *turnDetection) silenceDurationMs() int {
+	if t.SilenceDurationMs <= 0 {
+		return 500
+	}
+	return t.SilenceDurationMs
+}
+
+func (t *turnDetection) createResponse() bool {
+	return t.CreateResponse == nil || *t.CreateResponse
+}
+
+func (t *turnDetection) interruptResponse() bool {
+	return t.InterruptResponse == nil || *t.InterruptResponse
+}
+
+type session struct {
+	c       *gin.Context
+	info    *relaycommon.RelayInfo
+	ws      *websocket.Conn
+	config  *bridgeConfig
+	resolve legResolver
+	consume func(leg *service.RealtimeBridgeLeg) error
+	// control 会话时长、空闲与额度限制，未经控制器创建时为 nil
+	control *service.RealtimeSession
+
+	writeMu sync.Mutex
+
+	mu             sync.Mutex
+	settings       dto.RealtimeSession
+	turnDetection  *turnDetection
+	responseCancel context.CancelFunc
+	cancelReason   string
+	usage          dto.RealtimeUsage
+
+	// audio、vad、speechItemId 只由读取协程访问
+	audio        []byte
+	vad          vadState
+	speechItemId string
+
+	// items 只由工作协程访问
+	items []*dto.RealtimeItem
+	jobs  chan func(ctx context.Context)
+}
+
+func newSession(c *gin.Context, info *relaycommon.RelayInfo, config *bridgeConfig, resolve legResolver, consume func(leg *service.RealtimeBridgeLeg) error) *session {
+	modalities := []string{"text", "audio"}
+	if config.SpeechModel == "" {
+		modalities = []string{"text"}
+	}
+	td := defaultTurnDetection()
+	return &session{
+		c:       c,
+		info:    info,
+		ws:      info.ClientWs,
+		config:  config,
+		resolve: resolve,
+		consume: consume,
+		control: service.GetRealtimeSession(c),
+		settings: dto.RealtimeSession{
+			Id:                      newRealtimeId("sess_"),
+			Object:                  "realtime.session",
+			Model:                   info.OriginModelName,
+			Modalities:              modalities,
+			Voice:                   common.GetStringIfEmpty(config.Voice, defaultVoice),
+			InputAudioFormat:        "pcm16",
+			OutputAudioFormat:       "pcm16",
+			InputAudioTranscription: dto.InputAudioTranscription{Model: config.TranscriptionModel},
+			TurnDetection:           td,
+			Tools:                   []dto.RealTimeTool{},
+			ToolChoice:              "auto",
+			Temperature:             defaultTemperature,
+		},
+		turnDetection: td,
+		jobs:          make(chan func(ctx context.Context), sessionJobQueueSize),
+	}
+}
+
+func newRealtimeId(prefix string) string {
+	return prefix + common.GetRandomString(20)
+}
+
+// run 处理客户端事件直到连接关闭，返回各环节用量之和
+func (s *session) run() *dto.RealtimeUsage {
+	s.info.IsStream = true
+	ctx, cancel := context.WithCancel(s.c.Request.Context())
+	defer cancel()
+
+	s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionCreated, Session: s.snapshotSettings()})
+
+	workerDone := make(chan struct{})
+	gopool.Go(func() {
+		defer close(workerDone)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job := <-s.jobs:
+				job(ctx)
+			}
+		}
+	})
+
+	s.read(ctx)
+	cancel()
+	<-workerDone
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage
+	return &usage
+}
+
+func (s *session) read(ctx context.Context) {
+	for {
+		_, message, err := s.ws.ReadMessage()
+		if err != nil {
+			select {
+			case <-s.control.Done():
+				// 会话因限制被关闭，连接已断开
+				return
+			default:
+			}
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				logger.LogError(s.c, "realtime bridge read error: "+err.Error())
+			}
+			return
+		}
+		s.control.Touch()
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := common.Unmarshal(message, &header); err != nil {
+			s.emitError("invalid_request_error", "invalid_json", "Invalid JSON event: "+err.Error())
+			continue
+		}
+		s.handle(ctx, header.Type, message)
+	}
+}
+
+func (s *session) handle(ctx context.Context, eventType string, message []byte) {
+	switch eventType {
+	case dto.RealtimeEventTypeSessionUpdate:
+		s.updateSession(message)
+	case dto.RealtimeEventInputAudioBufferAppend:
+		var event dto.RealtimeEvent
+		if err := common.Unmarshal(message, &event); err != nil {
+			s.emitError("invalid_request_error", "invalid_event", err.Error())
+			return
+		}
+		s.appendAudio(ctx, event.Audio)
+	case dto.RealtimeEventInputAudioBufferCommit:
+		if pcm16DurationMs(len(s.audio)) < minCommitAudioMs {
+			s.emitError("invalid_request_error", "input_audio_buffer_commit_empty",
+				fmt.Sprintf("Error committing input audio buffer: buffer too small. Expected at least %dms of audio.", minCommitAudioMs))
+			return
+		}
+		s.commitAudio(ctx, newRealtimeId("item_"), false)
+	case dto.RealtimeEventInputAudioBufferClear:
+		s.audio = nil
+		s.vad.reset()
+		s.speechItemId = ""
+		s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCleared})
+	case dto.RealtimeEventTypeConversationCreate:
+		var event dto.RealtimeEvent
+		if err := common.Unmarshal(message, &event); err != nil || event.Item == nil {
+			s.emitError("invalid_request_error", "invalid_event", "conversation.item.create requires an item")
+			return
+		}
+		s.enqueue(ctx, func(ctx context.Context) {
+			s.createItem(ctx, event.PreviousItemId, event.Item)
+		})
+	case dto.RealtimeEventConversationItemDelete:
+		var event dto.RealtimeEvent
+		_ = common.Unmarshal(message, &event)
+		s.enqueue(ctx, func(ctx context.Context) {
+			s.deleteItem(event.ItemId)
+		})
+	case dto.RealtimeEventTypeResponseCreate:
+		var event dto.RealtimeEvent
+		if err := common.Unmarshal(message, &event); err != nil {
+			s.emitError("invalid_request_error", "invalid_event", err.Error())
+			return
+		}
+		s.enqueue(ctx, func(ctx context.Context) {
+			s.respond(ctx, event.Response)
+		})
+	case dto.RealtimeEventTypeResponseCancel:
+		if !s.cancelResponse("client_cancelled") {
+			s.emitError("invalid_request_error", "response_cancel_not_active", "Cancellation failed: no active response found.")
+		}
+	default:
+		s.emitError("invalid_request_error", "unsupported_event",
+			fmt.Sprintf("Event type '%s' is not supported by the realtime bridge.", eventType))
+	}
+}
+
+func (s *session) enqueue(ctx context.Context, job func(ctx context.Context)) {
+	select {
+	case s.jobs <- job:
+	case <-ctx.Done():
+	}
+}
+
+func (s *session) emit(event *dto.RealtimeEvent) {
+	event.EventId = newRealtimeId("event_")
+	s.control.Touch()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = helper.WssObject(s.c, s.ws, event)
+}
+
+func (s *session) emitError(errType string, code string, message string) {
+	s.emit(&dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeError,
+		Error: &types.OpenAIError{
+			Type:    errType,
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+func (s *session) snapshotSettings() *dto.RealtimeSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.settings
+	settings.Modalities = slices.Clone(s.settings.Modalities)
+	settings.Tools = slices.Clone(s.settings.Tools)
+	return &settings
+}
+
+func (s *session) currentTurnDetection() *turnDetection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.turnDetection
+}
+
+// updateSession 按字段合并 session.update，未出现的字段保持不变
+func (s *session) updateSession(message []byte) {
+	var raw struct {
+		Session map[string]json.RawMessage `json:"session"`
+	}
+	if err := common.Unmarshal(message, &raw); err != nil || raw.Session == nil {
+		s.emitError("invalid_request_error", "invalid_event", "session.update requires a session object")
+		return
+	}
+	var update dto.RealtimeSession
+	var td *turnDetection
+	var invalid string
+	for key, value := range raw.Session {
+		var err error
+		switch key {
+		case "modalities":
+			err = common.Unmarshal(value, &update.Modalities)
+			for _, modality := range update.Modalities {
+				if modality != "text" && modality != "audio" {
+					invalid = fmt.Sprintf("Invalid modality '%s'.", modality)
+				}
+			}
+		case "instructions":
+			err = common.Unmarshal(value, &update.Instructions)
+		case "voice":
+			err = common.Unmarshal(value, &update.Voice)
+		case "input_audio_format", "output_audio_format":
+			var format string
+			err = common.Unmarshal(value, &format)
+			if err == nil && format != "pcm16" {
+				invalid = fmt.Sprintf("Invalid '%s': the realtime bridge only supports pcm16.", key)
+			}
+		case "input_audio_transcription":
+			if common.GetJsonType(value) == "object" {
+				err = common.Unmarshal(value, &update.InputAudioTranscription)
+			}
+		case "turn_detection":
+			if common.GetJsonType(value) == "object" {
+				td = &turnDetection{}
+				err = common.Unmarshal(value, td)
+				if err == nil && td.Type != "" && td.Type != "server_vad" && td.Type != "semantic_vad" {
+					invalid = fmt.Sprintf("Invalid turn_detection type '%s'.", td.Type)
+				}
+			}
+		case "tools":
+			err = common.Unmarshal(value, &update.Tools)
+		case "tool_choice":
+			err = common.Unmarshal(value, &update.ToolChoice)
+			if err != nil {
+				invalid = "Invalid 'tool_choice': the realtime bridge only supports 'auto', 'none' and 'required'."
+				err = nil
+			}
+		case "temperature":
+			err = common.Unmarshal(value, &update.Temperature)
+		}
+		if err != nil {
+			invalid = fmt.Sprintf("Invalid '%s': %s", key, err.Error())
+		}
+	}
+	if invalid != "" {
+		s.emitError("invalid_request_error", "invalid_value", invalid)
+		return
+	}
+
+	s.mu.Lock()
+	for key := range raw.Session {
+		switch key {
+		case "modalities":
+			if s.config.SpeechModel == "" {
+				// 未配置语音合成环节时只能输出文本
+				update.Modalities = []string{"text"}
+			}
+			s.settings.Modalities = update.Modalities
+		case "instructions":
+			s.settings.Instructions = update.Instructions
+		case "voice":
+			if s.config.Voice == "" {
+				s.settings.Voice = update.Voice
+			}
+		case "input_audio_transcription":
+			s.settings.InputAudioTranscription = update.InputAudioTranscription
+		case "turn_detection":
+			s.turnDetection = td
+			if td == nil {
+				s.settings.TurnDetection = nil
+			} else {
+				s.settings.TurnDetection = td
+			}
+		case "tools":
+			s.settings.Tools = update.Tools
+			s.info.RealtimeTools = update.Tools
+		case "tool_choice":
+			s.settings.ToolChoice = update.ToolChoice
+		case "temperature":
+			s.settings.Temperature = update.Temperature
+		}
+	}
+	s.mu.Unlock()
+	if td == nil {
+		s.vad.reset()
+	}
+	s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: s.snapshotSettings()})
+}
+
+// appendAudio 追加输入音频；开启 turn_detection 时检测说话起止，说完后自动提交
+func (s *session) appendAudio(ctx context.Context, audio string) {
+	data, err := base64.StdEncoding.DecodeString(audio)
+	if err != nil {
+		s.emitError("invalid_request_error", "invalid_value", "Invalid 'audio': expected base64-encoded pcm16 audio.")
+		return
+	}
+	s.audio = append(s.audio, data...)
+
+	td := s.currentTurnDetection()
+	if td == nil {
+		return
+	}
+	for _, event := range s.vad.feed(data, td) {
+		switch event.kind {
+		case vadSpeechStarted:
+			s.speechItemId = newRealtimeId("item_")
+			ms := event.ms
+			s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferSpeechStarted, AudioStartMs: &ms, ItemId: s.speechItemId})
+			if td.interruptResponse() {
+				s.cancelResponse("turn_detected")
+			}
+		case vadSpeechStopped:
+			ms := event.ms
+			s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferSpeechStopped, AudioEndMs: &ms, ItemId: s.speechItemId})
+			s.commitAudio(ctx, s.speechItemId, td.createResponse())
+			s.speechItemId = ""
+		}
+	}
+	if !s.vad.speaking {
+		// 未说话时只保留前置填充部分，避免把长时间静音送去转写
+		if keep := pcm16BytesForMs(td.prefixPaddingMs()); len(s.audio) > keep {
+			s.audio = append([]byte(nil), s.audio[len(s.audio)-keep:]...)
+		}
+	}
+}
+
+func (s *session) commitAudio(ctx context.Context, itemId string, createResponse bool) {
+	pcm := s.audio
+	s.audio = nil
+	s.enqueue(ctx, func(ctx context.Context) {
+		previousItemId := s.lastItemId()
+		s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCommitted, PreviousItemId: previousItemId, ItemId: itemId})
+		item := &dto.RealtimeItem{
+			Id:      itemId,
+			Type:    "message",
+			Status:  "completed",
+			Role:    "user",
+			Content: []dto.RealtimeContent{{Type: "input_audio"}},
+		}
+		s.insertItem(previousItemId, item)
+		transcript, ok := s.transcribe(ctx, itemId, pcm)
+		item.Content[0].Transcript = transcript
+		if ok && createResponse {
+			s.respond(ctx, nil)
+		}
+	})
+}
+
+// transcribe 调用转写环节并推送转写事件，返回转写文本
+func (s *session) transcribe(ctx context.Context, itemId string, pcm []byte) (string, bool) {
+	contentIndex := 0
+	fail := func(err error) (string, bool) {
+		s.emit(&dto.RealtimeEvent{
+			Type:         dto.RealtimeEventTranscriptionFailed,
+			ItemId:       itemId,
+			ContentIndex: &contentIndex,
+			Error: &types.OpenAIError{
+				Type:    "transcription_error",
+				Message: err.Error(),
+			},
+		})
+		return "", false
+	}
+	modelName := s.config.TranscriptionModel
+	if modelName == "" {
+		return fail(fmt.Errorf("realtime bridge channel: transcription model is not configured"))
+	}
+	endpoint, err := s.resolve(modelName)
+	if err != nil {
+		return fail(err)
+	}
+	leg := newLeg(legTranscription, endpoint, modelName)
+	text, upstreamUsage, err := endpoint.transcribe(ctx, pcm, func(delta string) {
+		s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTranscriptionDelta, ItemId: itemId, ContentIndex: &contentIndex, Delta: delta})
+	})
+	if err != nil {
+		return fail(err)
+	}
+	s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventTranscriptionCompleted, ItemId: itemId, ContentIndex: &contentIndex, Transcript: text})
+
+	if upstreamUsage != nil && upstreamUsage.Type == "tokens" && upstreamUsage.TotalTokens > 0 {
+		leg.Usage.InputTokenDetails.AudioTokens = upstreamUsage.InputTokenDetails.AudioTokens
+		leg.Usage.InputTokenDetails.TextTokens = upstreamUsage.InputTokenDetails.TextTokens
+		leg.Usage.OutputTokenDetails.TextTokens = upstreamUsage.OutputTokens
+	} else {
+		audioTokens, _ := service.CountAudioTokenInput(base64.StdEncoding.EncodeToString(pcm), "pcm16")
+		leg.Usage.InputTokenDetails.AudioTokens = audioTokens
+		leg.Usage.OutputTokenDetails.TextTokens = service.CountTextToken(text, modelName)
+	}
+	s.bill(leg)
+	return text, true
+}
+
+func newLeg(name string, endpoint *legEndpoint, modelName string) *service.RealtimeBridgeLeg {
+	return &service.RealtimeBridgeLeg{
+		Name:      name,
+		ChannelId: endpoint.ChannelId,
+		ModelName: modelName,
+		Usage:     &dto.RealtimeUsage{},
+		StartTime: time.Now(),
+	}
+}
+
+// bill 汇总环节用量并按环节计费
+func (s *session) bill(leg *service.RealtimeBridgeLeg) {
+	usage := leg.Usage
+	usage.InputTokens = usage.InputTokenDetails.TextTokens + usage.InputTokenDetails.AudioTokens
+	usage.OutputTokens = usage.OutputTokenDetails.TextTokens + usage.OutputTokenDetails.AudioTokens
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+
+	s.mu.Lock()
+	addRealtimeUsage(&s.usage, usage)
+	s.mu.Unlock()
+
+	if err := s.consume(leg); err != nil {
+		logger.LogError(s.c, fmt.Sprintf("realtime bridge %s leg billing failed: %s", leg.Name, err.Error()))
+		s.emitError("server_error", "billing_failed", "Failed to record usage: "+err.Error())
+	}
+}
+
+func addRealtimeUsage(total *dto.RealtimeUsage, usage *dto.RealtimeUsage) {
+	total.TotalTokens += usage.TotalTokens
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.InputTokenDetails.CachedTokens += usage.InputTokenDetails.CachedTokens
+	total.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	total.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	total.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	total.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+}
+
+func (s *session) setResponseCancel(cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responseCancel = cancel
+	s.cancelReason = ""
+}
+
+// cancelResponse 取消进行中的响应，没有响应时返回 false
+func (s *session) cancelResponse(reason string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.responseCancel == nil {
+		return false
+	}
+	if s.cancelReason == "" {
+		s.cancelReason = reason
+	}
+	s.responseCancel()
+	return true
+}
+
+func (s *session) responseCancelReason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancelReason
+}
+
+func (s *session) lastItemId() string {
+	if len(s.items) == 0 {
+		return ""
+	}
+	return s.items[len(s.items)-1].Id
+}
+
+// insertItem 将条目插入 previousItemId 之后，为空时追加到末尾，"root" 表示插入到开头
+func (s *session) insertItem(previousItemId string, item *dto.RealtimeItem) {
+	index := len(s.items)
+	switch previousItemId {
+	case "":
+	case "root":
+		index = 0
+	default:
+		if i := slices.IndexFunc(s.items, func(existing *dto.RealtimeItem) bool { return existing.Id == previousItemId }); i >= 0 {
+			index = i + 1
+		}
+	}
+	s.items = slices.Insert(s.items, index, item)
+	s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, PreviousItemId: previousItemId, Item: item})
+}
+
+func (s *session) createItem(ctx context.Context, previousItemId string, item *dto.RealtimeItem) {
+	switch item.Type {
+	case "message", "function_call", "function_call_output":
+	default:
+		s.emitError("invalid_request_error", "invalid_value", fmt.Sprintf("Invalid item type '%s'.", item.Type))
+		return
+	}
+	if previousItemId != "" && previousItemId != "root" &&
+		!slices.ContainsFunc(s.items, func(existing *dto.RealtimeItem) bool { return existing.Id == previousItemId }) {
+		s.emitError("invalid_request_error", "item_not_found", fmt.Sprintf("Item with id '%s' not found.", previousItemId))
+		return
+	}
+	if item.Id == "" {
+		item.Id = newRealtimeId("item_")
+	}
+	item.Status = "completed"
+	if previousItemId == "" {
+		previousItemId = s.lastItemId()
+	}
+	s.insertItem(previousItemId, item)
+
+	// 客户端直接提交的音频内容同样经转写环节转为文本
+	for i := range item.Content {
+		content := &item.Content[i]
+		if content.Type != "input_audio" || content.Audio == "" || content.Transcript != "" {
+			continue
+		}
+		pcm, err := base64.StdEncoding.DecodeString(content.Audio)
+		if err != nil {
+			s.emitError("invalid_request_error", "invalid_value", "Invalid 'audio': expected base64-encoded pcm16 audio.")
+			continue
+		}
+		content.Audio = ""
+		content.Transcript, _ = s.transcribe(ctx, item.Id, pcm)
+	}
+}
+
+func (s *session) deleteItem(itemId string) {
+	index := slices.IndexFunc(s.items, func(item *dto.RealtimeItem) bool { return item.Id == itemId })
+	if index < 0 {
+		s.emitError("invalid_request_error", "item_not_found", fmt.Sprintf("Item with id '%s' not found.", itemId))
+		return
+	}
+	s.items = slices.Delete(s.items, index, index+1)
+	s.emit(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemDeleted, ItemId: itemId})
+}
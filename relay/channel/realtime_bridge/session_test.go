@@ -0,0 +1,337 @@
+package realtime_bridge
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// mockVoiceUpstream serves OpenAI-compatible transcription, chat and speech endpoints.
+type mockVoiceUpstream struct {
+	mu           sync.Mutex
+	chatRequests []dto.GeneralOpenAIRequest
+	speechInputs []string
+	audioBytes   int
+}
+
+func (m *mockVoiceUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/audio/transcriptions":
+		file, _, err := r.FormFile("file")
+		if err != nil || r.FormValue("model") != "whisper-large" {
+			http.Error(w, "bad transcription request", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		m.mu.Lock()
+		m.audioBytes = len(data)
+		m.mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"transcript.text.delta\",\"delta\":\"What's the \"}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"transcript.text.delta\",\"delta\":\"weather in Paris?\"}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"transcript.text.done\",\"text\":\"What's the weather in Paris?\",\"usage\":{\"type\":\"tokens\",\"input_tokens\":30,\"output_tokens\":7,\"total_tokens\":37,\"input_token_details\":{\"audio_tokens\":30}}}\n\n")
+	case "/v1/chat/completions":
+		var request dto.GeneralOpenAIRequest
+		if err := common.DecodeJson(r.Body, &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		m.chatRequests = append(m.chatRequests, request)
+		m.mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		if request.Messages[len(request.Messages)-1].Role != "tool" {
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_weather\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"\"}}]}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"city\\\":\\\"Paris\\\"}\"}}]}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}],\"usage\":{\"prompt_tokens\":50,\"completion_tokens\":10,\"total_tokens\":60}}\n\n")
+		} else {
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"It is sunny in Paris today. \"}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Enjoy it\"}}]}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":70,\"completion_tokens\":9,\"total_tokens\":79}}\n\n")
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	case "/v1/audio/speech":
+		var request dto.AudioRequest
+		if err := common.DecodeJson(r.Body, &request); err != nil || request.ResponseFormat != "pcm" || request.Voice != "nova" {
+			http.Error(w, "bad speech request", http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		m.speechInputs = append(m.speechInputs, request.Input)
+		m.mu.Unlock()
+		w.Header().Set("Content-Type", "audio/pcm")
+		_, _ = w.Write(make([]byte, pcm16BytesPerSecond/10))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type bridgeHarness struct {
+	upstream *mockVoiceUpstream
+	conn     *websocket.Conn
+
+	mu    sync.Mutex
+	legs  []service.RealtimeBridgeLeg
+	usage *dto.RealtimeUsage
+	done  chan struct{}
+}
+
+func newBridgeHarness(t *testing.T, config *bridgeConfig) *bridgeHarness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	harness := &bridgeHarness{upstream: &mockVoiceUpstream{}, done: make(chan struct{})}
+	upstreamServer := httptest.NewServer(harness.upstream)
+	t.Cleanup(upstreamServer.Close)
+
+	channelIds := map[string]int{"whisper-large": 11, "deepseek-chat": 12, "kokoro-tts": 13}
+	resolve := func(modelName string) (*legEndpoint, error) {
+		return &legEndpoint{ChannelId: channelIds[modelName], BaseURL: upstreamServer.URL, Key: "sk-test", UpstreamModel: modelName}, nil
+	}
+
+	upgrader := websocket.Upgrader{}
+	engine := gin.New()
+	engine.GET("/v1/realtime", func(c *gin.Context) {
+		ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		info := &relaycommon.RelayInfo{OriginModelName: "gpt-realtime", ClientWs: ws}
+		session := newSession(c, info, config, resolve, func(leg *service.RealtimeBridgeLeg) error {
+			harness.mu.Lock()
+			defer harness.mu.Unlock()
+			harness.legs = append(harness.legs, *leg)
+			return nil
+		})
+		usage := session.run()
+		harness.mu.Lock()
+		harness.usage = usage
+		harness.mu.Unlock()
+		close(harness.done)
+	})
+	bridgeServer := httptest.NewServer(engine)
+	t.Cleanup(bridgeServer.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(bridgeServer.URL, "http")+"/v1/realtime", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	harness.conn = conn
+	return harness
+}
+
+func (h *bridgeHarness) send(t *testing.T, event string) {
+	t.Helper()
+	require.NoError(t, h.conn.WriteMessage(websocket.TextMessage, []byte(event)))
+}
+
+// readUntil collects server events up to and including the first event of the given type.
+func (h *bridgeHarness) readUntil(t *testing.T, eventType string) []dto.RealtimeEvent {
+	t.Helper()
+	var events []dto.RealtimeEvent
+	require.NoError(t, h.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		_, message, err := h.conn.ReadMessage()
+		require.NoError(t, err)
+		var event dto.RealtimeEvent
+		require.NoError(t, common.Unmarshal(message, &event))
+		events = append(events, event)
+		if event.Type == eventType {
+			return events
+		}
+	}
+}
+
+func (h *bridgeHarness) close(t *testing.T) {
+	t.Helper()
+	_ = h.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	select {
+	case <-h.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge session did not finish")
+	}
+}
+
+func eventTypes(events []dto.RealtimeEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func eventDeltas(events []dto.RealtimeEvent, eventType string) string {
+	var b strings.Builder
+	for _, event := range events {
+		if event.Type == eventType {
+			b.WriteString(event.Delta)
+		}
+	}
+	return b.String()
+}
+
+// toneAudio returns base64 pcm16 audio: a 440Hz tone followed by silence.
+func toneAudio(toneMs int, silenceMs int) string {
+	samples := pcm16SampleRate * (toneMs + silenceMs) / 1000
+	toneSamples := pcm16SampleRate * toneMs / 1000
+	pcm := make([]byte, samples*2)
+	for i := 0; i < toneSamples; i++ {
+		sample := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/pcm16SampleRate))
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(sample))
+	}
+	return base64.StdEncoding.EncodeToString(pcm)
+}
+
+func TestBridgeVoiceTurnWithToolCall(t *testing.T) {
+	config := &bridgeConfig{TranscriptionModel: "whisper-large", ChatModel: "deepseek-chat", SpeechModel: "kokoro-tts", Voice: "nova"}
+	h := newBridgeHarness(t, config)
+
+	created := h.readUntil(t, dto.RealtimeEventTypeSessionCreated)
+	require.Equal(t, "nova", created[0].Session.Voice)
+	require.Equal(t, []string{"text", "audio"}, created[0].Session.Modalities)
+
+	h.send(t, `{"type":"session.update","session":{"turn_detection":null,"instructions":"Be brief.","tools":[{"type":"function","name":"get_weather","description":"Get weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}]}}`)
+	updated := h.readUntil(t, dto.RealtimeEventTypeSessionUpdated)
+	require.Nil(t, updated[0].Session.TurnDetection)
+	require.Len(t, updated[0].Session.Tools, 1)
+
+	// Manual turn: the committed audio is transcribed through the transcription leg.
+	h.send(t, fmt.Sprintf(`{"type":"input_audio_buffer.append","audio":%q}`, toneAudio(300, 0)))
+	h.send(t, `{"type":"input_audio_buffer.commit"}`)
+	events := h.readUntil(t, dto.RealtimeEventTranscriptionCompleted)
+	require.Equal(t, []string{
+		dto.RealtimeEventInputAudioBufferCommitted,
+		dto.RealtimeEventConversationItemCreated,
+		dto.RealtimeEventTranscriptionDelta,
+		dto.RealtimeEventTranscriptionDelta,
+		dto.RealtimeEventTranscriptionCompleted,
+	}, eventTypes(events))
+	userItemId := events[0].ItemId
+	require.Equal(t, userItemId, events[1].Item.Id)
+	require.Equal(t, "What's the weather in Paris?", events[4].Transcript)
+	require.Equal(t, 44+pcm16BytesForMs(300), h.upstream.audioBytes)
+
+	// The chat leg asks for a tool call, emitted as a function_call item.
+	h.send(t, `{"type":"response.create"}`)
+	events = h.readUntil(t, dto.RealtimeEventTypeResponseDone)
+	require.Equal(t, []string{
+		dto.RealtimeEventTypeResponseCreated,
+		dto.RealtimeEventResponseOutputItemAdded,
+		dto.RealtimeEventConversationItemCreated,
+		dto.RealtimeEventResponseFunctionCallArgumentsDelta,
+		dto.RealtimeEventResponseFunctionCallArgumentsDone,
+		dto.RealtimeEventResponseOutputItemDone,
+		dto.RealtimeEventTypeResponseDone,
+	}, eventTypes(events))
+	done := events[len(events)-1].Response
+	require.Equal(t, "completed", done.Status)
+	require.Len(t, done.Output, 1)
+	require.Equal(t, "function_call", done.Output[0].Type)
+	require.Equal(t, "call_weather", done.Output[0].CallId)
+	require.Equal(t, `{"city":"Paris"}`, done.Output[0].Arguments)
+	require.Equal(t, 60, done.Usage.TotalTokens)
+
+	// The tool result continues the conversation; the answer is spoken through the speech leg.
+	h.send(t, `{"type":"conversation.item.create","item":{"type":"function_call_output","call_id":"call_weather","output":"{\"weather\":\"sunny\"}"}}`)
+	h.readUntil(t, dto.RealtimeEventConversationItemCreated)
+	h.send(t, `{"type":"response.create"}`)
+	events = h.readUntil(t, dto.RealtimeEventTypeResponseDone)
+	require.Equal(t, "It is sunny in Paris today. Enjoy it", eventDeltas(events, dto.RealtimeEventResponseAudioTranscriptionDelta))
+	audio, err := base64.StdEncoding.DecodeString(eventDeltas(events, dto.RealtimeEventResponseAudioDelta))
+	require.NoError(t, err)
+	require.Len(t, audio, 2*pcm16BytesPerSecond/10)
+	require.Contains(t, eventTypes(events), dto.RealtimeEventResponseAudioDone)
+	done = events[len(events)-1].Response
+	require.Equal(t, "completed", done.Status)
+	require.Equal(t, "audio", done.Output[0].Content[0].Type)
+	require.Equal(t, "It is sunny in Paris today. Enjoy it", done.Output[0].Content[0].Transcript)
+	require.GreaterOrEqual(t, done.Usage.InputTokenDetails.TextTokens, 70)
+	require.Positive(t, done.Usage.OutputTokenDetails.AudioTokens)
+	require.Equal(t, []string{"It is sunny in Paris today.", "Enjoy it"}, h.upstream.speechInputs)
+
+	chat := h.upstream.chatRequests[1]
+	require.Equal(t, "system", chat.Messages[0].Role)
+	require.Equal(t, "Be brief.", chat.Messages[0].StringContent())
+	require.Equal(t, "What's the weather in Paris?", chat.Messages[1].StringContent())
+	require.Equal(t, "assistant", chat.Messages[2].Role)
+	require.Contains(t, string(chat.Messages[2].ToolCalls), "call_weather")
+	require.Equal(t, "tool", chat.Messages[3].Role)
+	require.Equal(t, "call_weather", chat.Messages[3].ToolCallId)
+	require.Len(t, chat.Tools, 1)
+
+	h.close(t)
+	require.Len(t, h.legs, 4)
+	require.Equal(t, legTranscription, h.legs[0].Name)
+	require.Equal(t, 11, h.legs[0].ChannelId)
+	require.Equal(t, 30, h.legs[0].Usage.InputTokenDetails.AudioTokens)
+	require.Equal(t, legChat, h.legs[1].Name)
+	require.Equal(t, "deepseek-chat", h.legs[1].ModelName)
+	require.Equal(t, legChat, h.legs[2].Name)
+	require.Equal(t, legSpeech, h.legs[3].Name)
+	require.Equal(t, 13, h.legs[3].ChannelId)
+	total := 0
+	for _, leg := range h.legs {
+		total += leg.Usage.TotalTokens
+	}
+	require.Equal(t, total, h.usage.TotalTokens)
+}
+
+func TestBridgeServerVADCommitsAndResponds(t *testing.T) {
+	config := &bridgeConfig{TranscriptionModel: "whisper-large", ChatModel: "deepseek-chat"}
+	h := newBridgeHarness(t, config)
+	created := h.readUntil(t, dto.RealtimeEventTypeSessionCreated)
+	require.Equal(t, []string{"text"}, created[0].Session.Modalities)
+
+	// Without a speech leg the default server VAD turn ends in a text response.
+	h.send(t, fmt.Sprintf(`{"type":"input_audio_buffer.append","audio":%q}`, toneAudio(400, 700)))
+	events := h.readUntil(t, dto.RealtimeEventTypeResponseDone)
+	types := eventTypes(events)
+	require.Equal(t, dto.RealtimeEventInputAudioBufferSpeechStarted, types[0])
+	require.Equal(t, dto.RealtimeEventInputAudioBufferSpeechStopped, types[1])
+	require.Equal(t, events[0].ItemId, events[1].ItemId)
+	require.Equal(t, 0, *events[0].AudioStartMs)
+	require.Equal(t, 900, *events[1].AudioEndMs)
+	require.Contains(t, types, dto.RealtimeEventTranscriptionCompleted)
+	require.Contains(t, types, dto.RealtimeEventTypeResponseCreated)
+	// The first chat reply is a tool call because no tool output exists yet.
+	require.Equal(t, "completed", events[len(events)-1].Response.Status)
+
+	h.send(t, `{"type":"response.cancel"}`)
+	cancelled := h.readUntil(t, dto.RealtimeEventTypeError)
+	require.Equal(t, "response_cancel_not_active", cancelled[0].Error.Code)
+
+	h.send(t, `{"type":"session.update","session":{"output_audio_format":"g711_ulaw"}}`)
+	invalid := h.readUntil(t, dto.RealtimeEventTypeError)
+	require.Equal(t, "invalid_value", invalid[0].Error.Code)
+	h.close(t)
+}
+
+func TestVADDetectsSpeechBoundaries(t *testing.T) {
+	pcm, err := base64.StdEncoding.DecodeString(toneAudio(200, 600))
+	require.NoError(t, err)
+	var vad vadState
+	td := defaultTurnDetection()
+	events := vad.feed(pcm[:len(pcm)/2], td)
+	events = append(events, vad.feed(pcm[len(pcm)/2:], td)...)
+	require.Equal(t, []vadEvent{{kind: vadSpeechStarted, ms: 0}, {kind: vadSpeechStopped, ms: 700}}, events)
+	require.False(t, vad.speaking)
+
+	silent := make([]byte, pcm16BytesForMs(1000))
+	require.Empty(t, vad.feed(silent, td))
+}
@@ -231,8 +231,14 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 			suffix = "predict"
 		}
+		if info.RelayMode == constant.RelayModeCountTokens {
+			suffix = "countTokens"
+		}
 		return a.getRequestUrl(info, info.UpstreamModelName, suffix)
 	} else if a.RequestMode == RequestModeClaude {
+		if info.RelayMode == constant.RelayModeCountTokens {
+			return a.getRequestUrl(info, "count-tokens", "rawPredict")
+		}
 		if info.IsStream {
 			suffix = "streamRawPredict?alt=sse"
 		} else {
@@ -420,3 +426,43 @@ func (a *Adaptor) GetModelList() []string {
 func (a *Adaptor) GetChannelName() string {
 	return ChannelName
 }
+
+type geminiCountTokensRequest struct {
+	Contents           []dto.GeminiChatContent `json:"contents"`
+	Tools              json.RawMessage         `json:"tools,omitempty"`
+	SystemInstructions *dto.GeminiChatContent  `json:"systemInstruction,omitempty"`
+}
+
+// CountTokens Claude 模型调用 count-tokens:rawPredict，Gemini 模型调用 :countTokens
+func (a *Adaptor) CountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	switch r := request.(type) {
+	case *dto.ClaudeRequest:
+		if a.RequestMode != RequestModeClaude || info.ChannelOtherSettings.VertexKeyType == dto.VertexKeyTypeAPIKey {
+			return 0, channel.ErrTokenCountUnsupported
+		}
+		model := info.UpstreamModelName
+		if v, ok := claudeModelMap[info.UpstreamModelName]; ok {
+			model = v
+		}
+		var result dto.ClaudeCountTokensResponse
+		if err := channel.DoTokenCountRequest(a, c, info, dto.NewClaudeCountTokensRequest(r, model), &result); err != nil {
+			return 0, err
+		}
+		return result.InputTokens, nil
+	case *dto.GeminiChatRequest:
+		if a.RequestMode != RequestModeGemini {
+			return 0, channel.ErrTokenCountUnsupported
+		}
+		body := geminiCountTokensRequest{
+			Contents:           r.Contents,
+			Tools:              r.Tools,
+			SystemInstructions: r.SystemInstructions,
+		}
+		var result dto.GeminiCountTokensResponse
+		if err := channel.DoTokenCountRequest(a, c, info, body, &result); err != nil {
+			return 0, err
+		}
+		return result.TotalTokens, nil
+	}
+	return 0, channel.ErrTokenCountUnsupported
+}
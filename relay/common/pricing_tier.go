@@ -0,0 +1,86 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// requestServiceTier 读取请求中的 service_tier
+func requestServiceTier(request dto.Request) string {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		if len(r.ServiceTier) == 0 {
+			return ""
+		}
+		var tier string
+		if err := common.Unmarshal(r.ServiceTier, &tier); err != nil {
+			return ""
+		}
+		return tier
+	case *dto.OpenAIResponsesRequest:
+		return r.ServiceTier
+	case *dto.ClaudeRequest:
+		return r.ServiceTier
+	}
+	return ""
+}
+
+// effectiveServiceTier 返回实际发往上游的 service_tier。
+// 选定渠道后，若渠道未允许透传 service_tier，该字段会被移除，按默认层级计费。
+func (info *RelayInfo) effectiveServiceTier() string {
+	tier := strings.ToLower(strings.TrimSpace(requestServiceTier(info.Request)))
+	if tier == "" || info.ChannelMeta == nil {
+		return tier
+	}
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+		return tier
+	}
+	if !info.ChannelOtherSettings.AllowServiceTier {
+		return ""
+	}
+	return tier
+}
+
+// ApplyPricingTier 按提示 tokens 与 service_tier 选择分段计价规则并更新 PriceData 中的倍率。
+// 预扣费时使用预估 tokens，结算时使用上游返回的实际 tokens 重新选择。
+func (info *RelayInfo) ApplyPricingTier(promptTokens int) {
+	if info.PriceData.UsePrice {
+		return
+	}
+	info.PriceData.ServiceTier = info.effectiveServiceTier()
+	rule, ok := ratio_setting.GetTieredRatioSetting().Match(info.OriginModelName, promptTokens, info.PriceData.ServiceTier)
+	if !ok {
+		info.PriceData.ApplyPricingTier(nil, types.PricingTierRatios{})
+		return
+	}
+	info.PriceData.ApplyPricingTier(&types.PricingTierInfo{
+		Name:              rule.Name,
+		ServiceTier:       info.PriceData.ServiceTier,
+		PromptTokensAbove: rule.PromptTokensAbove,
+		PromptTokens:      promptTokens,
+	}, types.PricingTierRatios{
+		ModelRatio:         rule.ModelRatio,
+		CompletionRatio:    rule.CompletionRatio,
+		CacheRatio:         rule.CacheRatio,
+		CacheCreationRatio: rule.CacheCreationRatio,
+		Multiplier:         rule.Multiplier,
+	})
+}
+
+// SettlePricingTier 结算前按上游返回的用量重新选择分段规则。
+// promptExcludesCache 为 true 表示 prompt_tokens 不含缓存读写 tokens（Claude 语义），需要加回后再判断区间。
+func (info *RelayInfo) SettlePricingTier(usage *dto.Usage, promptExcludesCache bool) {
+	if usage == nil {
+		return
+	}
+	promptTokens := usage.PromptTokens
+	if promptExcludesCache {
+		promptTokens += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	}
+	info.ApplyPricingTier(promptTokens)
+}
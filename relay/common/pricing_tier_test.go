@@ -0,0 +1,109 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func withTieredRatioSetting(t *testing.T, rules map[string][]ratio_setting.TieredRatioRule) {
+	t.Helper()
+	setting := ratio_setting.GetTieredRatioSetting()
+	original := *setting
+	setting.Enabled = true
+	setting.Rules = rules
+	t.Cleanup(func() {
+		*setting = original
+	})
+}
+
+func TestApplyPricingTierSelectsBracketAndServiceTier(t *testing.T) {
+	withTieredRatioSetting(t, map[string][]ratio_setting.TieredRatioRule{
+		"claude-sonnet-*": {
+			{Name: "long-context", PromptTokensAbove: 200000, ModelRatio: 3, CompletionRatio: 7.5 / 3},
+			{Name: "priority", ServiceTier: "priority", Multiplier: 2},
+		},
+	})
+
+	info := &RelayInfo{
+		OriginModelName: "claude-sonnet-4",
+		Request:         &dto.ClaudeRequest{ServiceTier: "priority"},
+		PriceData:       types.PriceData{ModelRatio: 1.5, CompletionRatio: 5},
+	}
+
+	info.ApplyPricingTier(1000)
+	require.NotNil(t, info.PriceData.PricingTier)
+	require.Equal(t, "priority", info.PriceData.PricingTier.Name)
+	require.Equal(t, 3.0, info.PriceData.ModelRatio)
+	require.Equal(t, 5.0, info.PriceData.CompletionRatio)
+
+	info.Request = &dto.ClaudeRequest{}
+	info.ApplyPricingTier(250000)
+	require.Equal(t, "long-context", info.PriceData.PricingTier.Name)
+	require.Equal(t, 3.0, info.PriceData.ModelRatio)
+	require.Equal(t, 2.5, info.PriceData.CompletionRatio)
+
+	// 结算时实际用量回落到阈值以下，恢复基础倍率
+	info.SettlePricingTier(&dto.Usage{PromptTokens: 150000}, false)
+	require.Nil(t, info.PriceData.PricingTier)
+	require.Equal(t, 1.5, info.PriceData.ModelRatio)
+	require.Equal(t, 5.0, info.PriceData.CompletionRatio)
+
+	// Claude 语义下缓存 tokens 计入区间判断
+	usage := &dto.Usage{PromptTokens: 1000}
+	usage.PromptTokensDetails.CachedTokens = 210000
+	info.SettlePricingTier(usage, true)
+	require.Equal(t, "long-context", info.PriceData.PricingTier.Name)
+	require.Equal(t, 211000, info.PriceData.PricingTier.PromptTokens)
+}
+
+func TestApplyPricingTierIgnoresFilteredServiceTier(t *testing.T) {
+	withTieredRatioSetting(t, map[string][]ratio_setting.TieredRatioRule{
+		"gpt-5": {{Name: "flex", ServiceTier: "flex", Multiplier: 0.5}},
+	})
+
+	info := &RelayInfo{
+		OriginModelName: "gpt-5",
+		Request:         &dto.GeneralOpenAIRequest{ServiceTier: json.RawMessage(`"flex"`)},
+		PriceData:       types.PriceData{ModelRatio: 0.625, CompletionRatio: 8},
+	}
+	info.ApplyPricingTier(100)
+	require.Equal(t, 0.3125, info.PriceData.ModelRatio)
+
+	// 渠道未允许透传 service_tier，上游按默认层级计费
+	info.ChannelMeta = &ChannelMeta{}
+	info.ApplyPricingTier(100)
+	require.Nil(t, info.PriceData.PricingTier)
+	require.Equal(t, "", info.PriceData.ServiceTier)
+	require.Equal(t, 0.625, info.PriceData.ModelRatio)
+
+	info.ChannelOtherSettings.AllowServiceTier = true
+	info.ApplyPricingTier(100)
+	require.Equal(t, "flex", info.PriceData.ServiceTier)
+	require.Equal(t, 0.3125, info.PriceData.ModelRatio)
+}
+
+func TestApplyPricingTierKeepsPricingSchedule(t *testing.T) {
+	withTieredRatioSetting(t, map[string][]ratio_setting.TieredRatioRule{
+		"gemini-2.5-pro": {{Name: "long-context", PromptTokensAbove: 200000, ModelRatio: 1.25}},
+	})
+
+	info := &RelayInfo{
+		OriginModelName: "gemini-2.5-pro",
+		PriceData: types.PriceData{
+			ModelRatio:      0.625,
+			CompletionRatio: 8,
+			PricingSchedule: &types.PricingScheduleInfo{Name: "off-peak", Multiplier: 0.5},
+		},
+	}
+	info.ApplyPricingTier(1000)
+	require.Equal(t, 0.3125, info.PriceData.ModelRatio)
+
+	info.ApplyPricingTier(300000)
+	require.Equal(t, 0.625, info.PriceData.ModelRatio)
+	require.Equal(t, 1.25, info.PriceData.PricingTier.ModelRatio)
+}
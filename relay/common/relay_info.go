@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/secretref"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -37,9 +38,67 @@ type ClaudeConvertInfo struct {
 	Usage            *dto.Usage
 	FinishReason     string
 	Done             bool
-
-	ToolCallBaseIndex      int
-	ToolCallMaxIndexOffset int
+	// Started 是否已发送 message_start
+	Started bool
+	// NextIndex 下一个内容块的序号
+	NextIndex int
+	// ToolBlocks OpenAI 工具调用序号 -> tool_use 内容块序号
+	ToolBlocks map[int]int
+}
+
+// GeminiToolCallState 流式转换为 Gemini 格式时累积中的工具调用
+type GeminiToolCallState struct {
+	Candidate int
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// GeminiConvertInfo 非 Gemini 上游转换为 Gemini 流式响应时的状态
+type GeminiConvertInfo struct {
+	// ToolCalls 参数分片到齐后在最后一个响应中以 functionCall 输出
+	ToolCalls []*GeminiToolCallState
+	// FinishReasons candidate 序号 -> OpenAI 结束原因
+	FinishReasons map[int]string
+	ResponseId    string
+	// IncludeThoughts 客户端是否在 thinkingConfig 中要求返回思考内容
+	IncludeThoughts bool
+	Done            bool
+}
+
+// ResponsesConvertInfo Chat Completions 上游转换为 Responses 响应时的状态
+type ResponsesConvertInfo struct {
+	// ResponseId 网关生成的响应 ID，同时作为会话状态的存储键
+	ResponseId string
+	CreatedAt  int64
+	// Response 按请求参数预先填充的响应对象，事件与最终响应在此基础上补充输出与用量
+	Response *dto.OpenAIResponsesResponse
+	Store    bool
+	// SequenceNumber 下一个流事件的序号
+	SequenceNumber int
+	Started        bool
+	Output         []dto.ResponsesOutput
+	// ItemDone 对应输出项是否已发送 response.output_item.done
+	ItemDone []bool
+	// ToolItems Chat 工具调用序号 -> function_call 输出项序号
+	ToolItems    map[int]int
+	FinishReason string
+	Done         bool
+}
+
+// ResponsesStateInfo 网关保存 Responses 会话状态所需的信息
+type ResponsesStateInfo struct {
+	PreviousResponseId string
+	// Input 本轮请求的输入项，不含续接时由网关展开的历史
+	Input []json.RawMessage
+	Store bool
+	// UpstreamStore 上游是否保存了该响应，决定续接时能否直接透传 previous_response_id
+	UpstreamStore bool
+	// Bridged 请求转换为 Chat Completions 发送，上游不持有会话状态
+	Bridged bool
+	// Response 最终响应对象，由响应处理器写入
+	Response json.RawMessage
 }
 
 type RerankerInfo struct {
@@ -82,6 +141,16 @@ type TokenCountMeta struct {
 	estimatePromptTokens int
 }
 
+// StreamOutputFilter 流式输出检测器，按上游格式处理数据
+type StreamOutputFilter interface {
+	// Push 接收一条上游数据，返回可以下发的数据；stop 为 true 时应终止流并下发 Finish 的结果
+	Push(data string) ([]string, bool)
+	// Flush 上游正常结束时返回仍在缓冲中的数据，stop 含义同 Push
+	Flush() ([]string, bool)
+	// Finish 返回终止流时补发的结束事件
+	Finish() []string
+}
+
 type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
@@ -150,6 +219,11 @@ type RelayInfo struct {
 	RuntimeHeadersOverride                map[string]interface{}
 	UseRuntimeHeadersOverride             bool
 
+	// GuardrailViolations 输入检测中放行的命中（脱敏、标记），随消费日志记录
+	GuardrailViolations []types.GuardrailViolation
+	// NewStreamOutputFilter 非空时 StreamScannerHandler 为每次流式响应创建输出检测器
+	NewStreamOutputFilter func() StreamOutputFilter
+
 	PriceData types.PriceData
 
 	Request dto.Request
@@ -164,6 +238,11 @@ type RelayInfo struct {
 	ThinkingContentInfo
 	TokenCountMeta
 	*ClaudeConvertInfo
+	GeminiConvertInfo *GeminiConvertInfo
+	// ResponsesConvertInfo 仅在 Responses 请求转发到 Chat Completions 上游时设置
+	ResponsesConvertInfo *ResponsesConvertInfo
+	// ResponsesStateInfo 需要由网关保存会话状态的 Responses 请求设置
+	ResponsesStateInfo *ResponsesStateInfo
 	*RerankerInfo
 	*ResponsesUsageInfo
 	*ChannelMeta
@@ -193,6 +272,15 @@ func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 		SupportStreamOptions: false,
 	}
 
+	if secretref.IsReference(channelMeta.ApiKey) {
+		// GetNextEnabledKey 已解析外部密钥引用，此处兜底处理直接写入上下文的引用
+		if key, err := secretref.Resolve(channelMeta.ApiKey); err == nil {
+			channelMeta.ApiKey = key
+		} else {
+			common.SysError(fmt.Sprintf("failed to resolve key of channel %d: %s", channelMeta.ChannelId, err.Error()))
+		}
+	}
+
 	if channelType == constant.ChannelTypeAzure {
 		channelMeta.ApiVersion = GetAPIVersion(c)
 	}
@@ -401,6 +489,10 @@ func GenRelayInfoGemini(c *gin.Context, request dto.Request) *RelayInfo {
 	info := genBaseRelayInfo(c, request)
 	info.RelayFormat = types.RelayFormatGemini
 	info.ShouldIncludeUsage = false
+	info.GeminiConvertInfo = &GeminiConvertInfo{}
+	if geminiRequest, ok := request.(*dto.GeminiChatRequest); ok && geminiRequest.GenerationConfig.ThinkingConfig != nil {
+		info.GeminiConvertInfo.IncludeThoughts = geminiRequest.GenerationConfig.ThinkingConfig.IncludeThoughts
+	}
 
 	return info
 }
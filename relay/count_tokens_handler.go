@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountTokensHelper 统计请求的输入 tokens：渠道支持时请求上游计数，不支持或上游失败时使用本地估算。
+// 返回的 bool 表示结果是否来自上游。
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) (int, bool, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+
+	if operation_setting.GetCountTokensSetting().UpstreamEnabled {
+		tokens, err := countTokensUpstream(c, info)
+		if err == nil {
+			return tokens, true, nil
+		}
+		if !errors.Is(err, channel.ErrTokenCountUnsupported) {
+			logger.LogWarn(c, fmt.Sprintf("upstream count tokens failed, fallback to local estimate: %s", err.Error()))
+		}
+	}
+
+	tokens, err := service.CountRequestToken(c, info.Request.GetTokenCountMeta(), info)
+	if err != nil {
+		return 0, false, types.NewError(err, types.ErrorCodeCountTokenFailed, types.ErrOptionWithSkipRetry())
+	}
+	return tokens, false, nil
+}
+
+func countTokensUpstream(c *gin.Context, info *relaycommon.RelayInfo) (int, error) {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return 0, channel.ErrTokenCountUnsupported
+	}
+	counter, ok := adaptor.(channel.TokenCounter)
+	if !ok {
+		return 0, channel.ErrTokenCountUnsupported
+	}
+	if err := helper.ModelMappedHelper(c, info, info.Request); err != nil {
+		return 0, err
+	}
+	adaptor.Init(info)
+	return counter.CountTokens(c, info, info.Request)
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
@@ -78,6 +80,19 @@ func ResponseChunkData(c *gin.Context, resp dto.ResponsesStreamResponse, data st
 	_ = FlushWriter(c)
 }
 
+// ResponsesData 发送网关合成的 Responses 流事件
+func ResponsesData(c *gin.Context, resp dto.ResponsesStreamResponse) error {
+	jsonData, err := common.Marshal(resp)
+	if err != nil {
+		common.SysError("error marshalling stream response: " + err.Error())
+	} else {
+		c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
+		c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonData)})
+	}
+	_ = FlushWriter(c)
+	return nil
+}
+
 func StringData(c *gin.Context, str string) error {
 	if c == nil || c.Writer == nil {
 		return errors.New("context or writer is nil")
@@ -121,11 +136,34 @@ func Done(c *gin.Context) {
 	_ = StringData(c, "[DONE]")
 }
 
+// wssWriteLockKey 实时会话的写操作锁。会话控制会在转发协程之外下发错误事件，
+// 同一请求内的 websocket 写操作需串行执行
+const wssWriteLockKey = "wss_write_lock"
+
+// InitWssWriteLock 为当前请求的 websocket 写操作加锁，需在开始转发前调用
+func InitWssWriteLock(c *gin.Context) {
+	c.Set(wssWriteLockKey, &sync.Mutex{})
+}
+
+func lockWssWrite(c *gin.Context) func() {
+	if c == nil {
+		return func() {}
+	}
+	value, ok := c.Get(wssWriteLockKey)
+	if !ok {
+		return func() {}
+	}
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
 func WssString(c *gin.Context, ws *websocket.Conn, str string) error {
 	if ws == nil {
 		logger.LogError(c, "websocket connection is nil")
 		return errors.New("websocket connection is nil")
 	}
+	defer lockWssWrite(c)()
 	//common.LogInfo(c, fmt.Sprintf("sending message: %s", str))
 	return ws.WriteMessage(1, []byte(str))
 }
@@ -139,6 +177,7 @@ func WssObject(c *gin.Context, ws *websocket.Conn, object interface{}) error {
 		logger.LogError(c, "websocket connection is nil")
 		return errors.New("websocket connection is nil")
 	}
+	defer lockWssWrite(c)()
 	//common.LogInfo(c, fmt.Sprintf("sending message: %s", jsonData))
 	return ws.WriteMessage(1, jsonData)
 }
@@ -155,6 +194,15 @@ func WssError(c *gin.Context, ws *websocket.Conn, openaiError types.OpenAIError)
 	_ = WssObject(c, ws, errorObj)
 }
 
+// WssClose 发送关闭帧后关闭连接
+func WssClose(ws *websocket.Conn, closeCode int, reason string) {
+	if ws == nil {
+		return
+	}
+	_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(time.Second))
+	_ = ws.Close()
+}
+
 func GetResponseID(c *gin.Context) string {
 	logID := c.GetString(common.RequestIdKey)
 	return fmt.Sprintf("chatcmpl-%s", logID)
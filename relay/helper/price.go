@@ -2,6 +2,7 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -45,12 +46,27 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 	return groupRatioInfo
 }
 
+// resolvePricingSchedule 查询当前对模型与使用分组生效的定时/促销价格计划
+func resolvePricingSchedule(info *relaycommon.RelayInfo) *types.PricingScheduleInfo {
+	window, ok := ratio_setting.GetPricingScheduleSetting().Resolve(info.OriginModelName, info.UsingGroup, time.Now())
+	if !ok {
+		return nil
+	}
+	return &types.PricingScheduleInfo{
+		Name:       window.Name,
+		Multiplier: window.Multiplier,
+		EndsAt:     window.EndsAt,
+	}
+}
+
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
 
 	groupRatioInfo := HandleGroupRatio(c, info)
+	schedule := resolvePricingSchedule(info)
 
 	var preConsumedQuota int
+	var preConsumedTokens int
 	var modelRatio float64
 	var completionRatio float64
 	var cacheRatio float64
@@ -62,7 +78,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var audioCompletionRatio float64
 	var freeModel bool
 	if !usePrice {
-		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
+		preConsumedTokens = common.Max(promptTokens, common.PreConsumedQuota)
 		if meta.MaxTokens != 0 {
 			preConsumedTokens += meta.MaxTokens
 		}
@@ -87,15 +103,39 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
-		ratio := modelRatio * groupRatioInfo.GroupRatio
-		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
 		if meta.ImagePriceRatio != 0 {
 			modelPrice = modelPrice * meta.ImagePriceRatio
 		}
+		if schedule != nil {
+			modelPrice = modelPrice * schedule.Multiplier
+		}
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	}
 
+	info.PriceData = types.PriceData{
+		ModelPrice:           modelPrice,
+		ModelRatio:           modelRatio,
+		CompletionRatio:      completionRatio,
+		GroupRatioInfo:       groupRatioInfo,
+		UsePrice:             usePrice,
+		CacheRatio:           cacheRatio,
+		ImageRatio:           imageRatio,
+		AudioRatio:           audioRatio,
+		AudioCompletionRatio: audioCompletionRatio,
+		CacheCreationRatio:   cacheCreationRatio,
+		CacheCreation5mRatio: cacheCreationRatio5m,
+		CacheCreation1hRatio: cacheCreationRatio1h,
+		PricingSchedule:      schedule,
+	}
+	if !usePrice {
+		// 分段计价：按预估提示 tokens 与 service_tier 选择倍率，结算时会按实际用量重新选择
+		info.ApplyPricingTier(promptTokens)
+		modelRatio = info.PriceData.ModelRatio
+		ratio := modelRatio * groupRatioInfo.GroupRatio
+		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
+	}
+
 	// check if free model pre-consume is disabled
 	if !operation_setting.GetQuotaSetting().EnableFreeModelPreConsume {
 		// if model price or ratio is 0, do not pre-consume quota
@@ -115,28 +155,13 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		}
 	}
 
-	priceData := types.PriceData{
-		FreeModel:            freeModel,
-		ModelPrice:           modelPrice,
-		ModelRatio:           modelRatio,
-		CompletionRatio:      completionRatio,
-		GroupRatioInfo:       groupRatioInfo,
-		UsePrice:             usePrice,
-		CacheRatio:           cacheRatio,
-		ImageRatio:           imageRatio,
-		AudioRatio:           audioRatio,
-		AudioCompletionRatio: audioCompletionRatio,
-		CacheCreationRatio:   cacheCreationRatio,
-		CacheCreation5mRatio: cacheCreationRatio5m,
-		CacheCreation1hRatio: cacheCreationRatio1h,
-		QuotaToPreConsume:    preConsumedQuota,
-	}
+	info.PriceData.FreeModel = freeModel
+	info.PriceData.QuotaToPreConsume = preConsumedQuota
 
 	if common.DebugEnabled {
-		println(fmt.Sprintf("model_price_helper result: %s", priceData.ToSetting()))
+		println(fmt.Sprintf("model_price_helper result: %s", info.PriceData.ToSetting()))
 	}
-	info.PriceData = priceData
-	return priceData, nil
+	return info.PriceData, nil
 }
 
 // ModelPriceHelperPerCall 按次计费的 PriceHelper (MJ、Task)
@@ -166,6 +191,10 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) (types
 		}
 
 	}
+	schedule := resolvePricingSchedule(info)
+	if schedule != nil {
+		modelPrice = modelPrice * schedule.Multiplier
+	}
 	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 
 	// 免费模型检测（与 ModelPriceHelper 对齐）
@@ -178,10 +207,11 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) (types
 	}
 
 	priceData := types.PriceData{
-		FreeModel:      freeModel,
-		ModelPrice:     modelPrice,
-		Quota:          quota,
-		GroupRatioInfo: groupRatioInfo,
+		FreeModel:       freeModel,
+		ModelPrice:      modelPrice,
+		Quota:           quota,
+		GroupRatioInfo:  groupRatioInfo,
+		PricingSchedule: schedule,
 	}
 	return priceData, nil
 }
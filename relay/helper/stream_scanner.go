@@ -178,6 +178,30 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 
 	dataChan := make(chan string, 10)
 
+	// 输出检测：数据先经过检测器的滑动窗口，拦截时补发结束事件并终止读取上游
+	var outputFilter relaycommon.StreamOutputFilter
+	if info.NewStreamOutputFilter != nil {
+		outputFilter = info.NewStreamOutputFilter()
+	}
+	handleFiltered := func(items []string, stop bool) bool {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		for _, item := range items {
+			if !dataHandler(item) {
+				return false
+			}
+		}
+		if stop {
+			for _, item := range outputFilter.Finish() {
+				if !dataHandler(item) {
+					break
+				}
+			}
+			return false
+		}
+		return true
+	}
+
 	wg.Add(1)
 	gopool.Go(func() {
 		defer func() {
@@ -188,6 +212,12 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			common.SafeSendBool(stopChan, true)
 		}()
 		for data := range dataChan {
+			if outputFilter != nil {
+				if !handleFiltered(outputFilter.Push(data)) {
+					return
+				}
+				continue
+			}
 			writeMutex.Lock()
 			success := dataHandler(data)
 			writeMutex.Unlock()
@@ -195,6 +225,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 				return
 			}
 		}
+		if outputFilter != nil {
+			handleFiltered(outputFilter.Flush())
+		}
 	})
 
 	// Scanner goroutine with improved error handling
@@ -193,6 +193,65 @@ func TestStreamScannerHandler_HandlerFailureStops(t *testing.T) {
 	assert.Equal(t, int64(failAt), count.Load())
 }
 
+// holdFilter holds back the last two chunks and stops on stopAt.
+type holdFilter struct {
+	held   []string
+	stopAt string
+}
+
+func (f *holdFilter) Push(data string) ([]string, bool) {
+	if strings.Contains(data, f.stopAt) {
+		return nil, true
+	}
+	f.held = append(f.held, data)
+	if len(f.held) <= 2 {
+		return nil, false
+	}
+	out := f.held[:1]
+	f.held = f.held[1:]
+	return out, false
+}
+
+func (f *holdFilter) Flush() ([]string, bool) {
+	out := f.held
+	f.held = nil
+	return out, false
+}
+
+func (f *holdFilter) Finish() []string {
+	return []string{"finish"}
+}
+
+func TestStreamScannerHandler_OutputFilter(t *testing.T) {
+	t.Parallel()
+
+	c, resp, info := setupStreamTest(t, strings.NewReader(buildSSEBody(20)))
+	info.NewStreamOutputFilter = func() relaycommon.StreamOutputFilter {
+		return &holdFilter{stopAt: "token_none"}
+	}
+	var received []string
+	StreamScannerHandler(c, resp, info, func(data string) bool {
+		received = append(received, data)
+		return true
+	})
+	require.Len(t, received, 20, "held data must be flushed at the end")
+	assert.Contains(t, received[19], "token_19")
+
+	c, resp, info = setupStreamTest(t, strings.NewReader(buildSSEBody(20)))
+	info.NewStreamOutputFilter = func() relaycommon.StreamOutputFilter {
+		return &holdFilter{stopAt: "token_10"}
+	}
+	received = nil
+	StreamScannerHandler(c, resp, info, func(data string) bool {
+		received = append(received, data)
+		return true
+	})
+	// 0..7 are released, 8 and 9 are still held and dropped, then Finish is sent.
+	require.Len(t, received, 9)
+	assert.Contains(t, received[7], "token_7")
+	assert.Equal(t, "finish", received[8])
+}
+
 func TestStreamScannerHandler_SkipsNonDataLines(t *testing.T) {
 	t.Parallel()
 
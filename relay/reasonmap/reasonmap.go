@@ -39,3 +39,14 @@ func OpenAIFinishReasonToClaudeStopReason(finishReason string) string {
 		return finishReason
 	}
 }
+
+func OpenAIFinishReasonToGeminiFinishReason(finishReason string) string {
+	switch strings.ToLower(finishReason) {
+	case "length", "max_tokens":
+		return "MAX_TOKENS"
+	case constant.FinishReasonContentFilter:
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
@@ -0,0 +1,160 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	appconstant "github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// chatCompletionsOnlyAPITypes 未实现 Responses 接口、且响应经由 OpenAI 兼容处理器输出的渠道，
+// /v1/responses 请求始终转换为 Chat Completions 发送
+var chatCompletionsOnlyAPITypes = map[int]bool{
+	appconstant.APITypeDeepSeek:    true,
+	appconstant.APITypeMoonshot:    true,
+	appconstant.APITypeSiliconFlow: true,
+	appconstant.APITypeMistral:     true,
+	appconstant.APITypeMiniMax:     true,
+	appconstant.APITypeZhipuV4:     true,
+	appconstant.APITypeBaiduV2:     true,
+	appconstant.APITypeSubmodel:    true,
+}
+
+func shouldResponsesUseChatCompletions(info *relaycommon.RelayInfo) bool {
+	if info.RelayMode != relayconstant.RelayModeResponses {
+		return false
+	}
+	if chatCompletionsOnlyAPITypes[info.ApiType] {
+		return true
+	}
+	return service.ShouldResponsesUseChatCompletionsGlobal(info.ChannelId, info.ChannelType, info.OriginModelName)
+}
+
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest) (*dto.Usage, *types.NewAPIError) {
+	input, err := service.ParseResponsesInput(request.Input)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	var history []json.RawMessage
+	if request.PreviousResponseID != "" {
+		history, err = service.GetResponsesHistory(info.TokenId, request.PreviousResponseID)
+		if errors.Is(err, service.ErrResponsesStateNotFound) {
+			return nil, types.NewErrorWithStatusCode(
+				fmt.Errorf("previous response with id '%s' not found", request.PreviousResponseID),
+				types.ErrorCodeInvalidRequest,
+				http.StatusBadRequest,
+				types.ErrOptionWithSkipRetry(),
+			)
+		}
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+	}
+
+	// 历史上下文与本轮输入合并后整体转换，上游无需支持会话状态
+	fullRequest := *request
+	fullRequest.Input, err = common.Marshal(append(append([]json.RawMessage{}, history...), input...))
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	chatRequest, err := service.ResponsesRequestToChatCompletionsRequest(&fullRequest, info)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if lo.FromPtrOr(chatRequest.Stream, false) && info.SupportStreamOptions {
+		chatRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	applySystemPromptIfNeeded(c, info, chatRequest)
+
+	info.ResponsesConvertInfo = service.NewResponsesConvertInfo(request, info.OriginModelName)
+	info.ResponsesStateInfo = &relaycommon.ResponsesStateInfo{
+		PreviousResponseId: request.PreviousResponseID,
+		Input:              input,
+		Store:              service.ResponsesRequestStore(request),
+		Bridged:            true,
+	}
+	info.AppendRequestConversion(types.RelayFormatOpenAI)
+
+	savedRelayMode := info.RelayMode
+	savedRequestURLPath := info.RequestURLPath
+	defer func() {
+		info.RelayMode = savedRelayMode
+		info.RequestURLPath = savedRequestURLPath
+	}()
+
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RequestURLPath = "/v1/chat/completions"
+
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, chatRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+		if err != nil {
+			return nil, newAPIErrorFromParamOverride(err)
+		}
+	}
+
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+
+	var httpResp *http.Response
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, types.NewOpenAIError(nil, types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+
+	httpResp = resp.(*http.Response)
+	info.IsStream = info.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+	if httpResp.StatusCode != http.StatusOK {
+		newApiErr := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
+		return nil, newApiErr
+	}
+
+	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	if newApiErr != nil {
+		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
+		return nil, newApiErr
+	}
+
+	if err := service.SaveResponsesState(info); err != nil {
+		logger.LogError(c, "failed to save responses state: "+err.Error())
+	}
+	return usage.(*dto.Usage), nil
+}
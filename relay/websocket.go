@@ -3,6 +3,7 @@ package relay
 import (
 	"fmt"
 
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service"
@@ -41,6 +42,14 @@ func WssHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
 		return newAPIError
 	}
-	service.PostWssConsumeQuota(c, info, info.UpstreamModelName, usage.(*dto.RealtimeUsage), "")
+	if info.ApiType == constant.APITypeRealtimeBridge {
+		// 桥接会话已按转写、对话、语音合成各环节分别计费，退还会话模型的预扣费
+		if info.Billing != nil {
+			info.Billing.Refund(c)
+		}
+		service.RecordRealtimeBridgeSessionLog(c, info)
+		return nil
+	}
+	service.PostWssConsumeQuota(c, info, info.UpstreamModelName, usage.(*dto.RealtimeUsage), service.GetRealtimeSession(c).Summary())
 	return nil
 }
@@ -252,6 +252,7 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
@@ -264,6 +265,7 @@ func SetApiRouter(router *gin.Engine) {
 			adminTokenRoute.POST("/", controller.AdminAddUserToken)
 			adminTokenRoute.PUT("/", controller.AdminUpdateUserToken)
 			adminTokenRoute.DELETE("/:id", controller.AdminDeleteUserToken)
+			adminTokenRoute.POST("/:id/rotate", controller.AdminRotateUserToken)
 		}
 
 		// Token info route - get token info by token key (for nicecode proxy)
@@ -283,6 +285,29 @@ func SetApiRouter(router *gin.Engine) {
 			}
 		}
 
+		invoiceRoute := apiRouter.Group("/invoice")
+		invoiceRoute.GET("/self", middleware.UserAuth(), controller.GetSelfInvoices)
+		invoiceRoute.GET("/self/:id", middleware.UserAuth(), controller.GetSelfInvoice)
+		invoiceRoute.GET("/self/:id/download", middleware.UserAuth(), controller.DownloadSelfInvoice)
+		invoiceRoute.GET("/billing_profile", middleware.UserAuth(), controller.GetSelfBillingProfile)
+		invoiceRoute.PUT("/billing_profile", middleware.UserAuth(), controller.UpdateSelfBillingProfile)
+		invoiceRoute.GET("/", middleware.AdminAuth(), controller.GetAllInvoices)
+		invoiceRoute.GET("/:id", middleware.AdminAuth(), controller.GetInvoice)
+		invoiceRoute.GET("/:id/download", middleware.AdminAuth(), controller.DownloadInvoice)
+		invoiceRoute.POST("/issue", middleware.AdminAuth(), controller.IssueInvoice)
+		invoiceRoute.POST("/:id/credit_note", middleware.RootAuth(), controller.CreateCreditNote)
+
+		postpaidRoute := apiRouter.Group("/postpaid")
+		postpaidRoute.GET("/self", middleware.UserAuth(), controller.GetSelfPostpaid)
+		postpaidRoute.GET("/self/settlements", middleware.UserAuth(), controller.GetSelfPostpaidSettlements)
+		postpaidRoute.GET("/", middleware.AdminAuth(), controller.GetPostpaidAccounts)
+		postpaidRoute.PUT("/", middleware.RootAuth(), controller.UpdatePostpaidAccount)
+		postpaidRoute.GET("/settlements", middleware.AdminAuth(), controller.GetAllPostpaidSettlements)
+		postpaidRoute.POST("/settlements/:id/pay", middleware.AdminAuth(), controller.PayPostpaidSettlement)
+		postpaidRoute.GET("/:user_id", middleware.AdminAuth(), controller.GetPostpaidAccount)
+		postpaidRoute.POST("/:user_id/suspend", middleware.AdminAuth(), controller.SuspendPostpaidAccount)
+		postpaidRoute.POST("/:user_id/resume", middleware.AdminAuth(), controller.ResumePostpaidAccount)
+
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
@@ -303,6 +328,11 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), middleware.SearchRateLimit(), controller.SearchUserLogs)
+		logRoute.GET("/payload", middleware.AdminAuth(), controller.GetLogPayload)
+		logRoute.GET("/export/status", middleware.RootAuth(), controller.GetLogExportStatus)
+		logRoute.GET("/export/dead_letters", middleware.RootAuth(), controller.GetLogExportDeadLetters)
+		logRoute.POST("/export/dead_letters/retry", middleware.RootAuth(), controller.RetryLogExportDeadLetters)
+		logRoute.DELETE("/export/dead_letters", middleware.RootAuth(), controller.DeleteLogExportDeadLetters)
 
 		// Admin route to get logs for a specific user (for nicecode proxy)
 		adminLogRoute := apiRouter.Group("/admin/user/:user_id/log")
@@ -317,6 +347,14 @@ func SetApiRouter(router *gin.Engine) {
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/statement", middleware.AdminAuth(), controller.ExportUsageStatement)
+		dataRoute.GET("/statement/jobs", middleware.AdminAuth(), controller.GetUsageStatementJobs)
+		dataRoute.POST("/statement/jobs", middleware.AdminAuth(), controller.CreateUsageStatementJob)
+		dataRoute.GET("/statement/jobs/:id/download", middleware.AdminAuth(), controller.DownloadUsageStatementJob)
+		dataRoute.GET("/self/statement", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.ExportSelfUsageStatement)
+		dataRoute.GET("/self/statement/jobs", middleware.UserAuth(), controller.GetSelfUsageStatementJobs)
+		dataRoute.POST("/self/statement/jobs", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.CreateSelfUsageStatementJob)
+		dataRoute.GET("/self/statement/jobs/:id/download", middleware.UserAuth(), controller.DownloadSelfUsageStatementJob)
 
 		logRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
 		{
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"strings"
+
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
@@ -61,6 +63,16 @@ func SetRelayRouter(router *gin.Engine) {
 		})
 	}
 
+	// 网关保存的 Responses 响应，无需选择渠道
+	responsesRouter := router.Group("/v1/responses")
+	responsesRouter.Use(middleware.RouteTag("relay"))
+	responsesRouter.Use(middleware.TokenAuth())
+	{
+		responsesRouter.GET("/:response_id", controller.RetrieveResponse)
+		responsesRouter.DELETE("/:response_id", controller.DeleteResponse)
+		responsesRouter.GET("/:response_id/input_items", controller.ListResponseInputItems)
+	}
+
 	playgroundRouter := router.Group("/pg")
 	playgroundRouter.Use(middleware.RouteTag("relay"))
 	playgroundRouter.Use(middleware.SystemPerformanceCheck())
@@ -77,6 +89,8 @@ func SetRelayRouter(router *gin.Engine) {
 		// WebSocket 路由（统一到 Relay）
 		wsRouter := relayV1Router.Group("")
 		wsRouter.Use(middleware.Distribute())
+		// 实时会话的消息帧不抓取，仅生成标记为未抓取的记录
+		wsRouter.Use(middleware.PayloadCapture())
 		wsRouter.GET("/realtime", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
@@ -85,11 +99,15 @@ func SetRelayRouter(router *gin.Engine) {
 		//http router
 		httpRouter := relayV1Router.Group("")
 		httpRouter.Use(middleware.Distribute())
+		httpRouter.Use(middleware.PayloadCapture())
 
 		// claude related routes
 		httpRouter.POST("/messages", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatClaude)
 		})
+		httpRouter.POST("/messages/count_tokens", func(c *gin.Context) {
+			controller.RelayCountTokens(c, types.RelayFormatClaude)
+		})
 
 		// chat related routes
 		httpRouter.POST("/completions", func(c *gin.Context) {
@@ -143,9 +161,7 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/engines/:model/embeddings", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatGemini)
 		})
-		httpRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		httpRouter.POST("/models/*path", relayGemini)
 
 		// other relay routes
 		httpRouter.POST("/moderations", func(c *gin.Context) {
@@ -167,6 +183,17 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.DELETE("/models/:model", controller.RelayNotImplemented)
 	}
 
+	// 报价接口：按 relay 请求体预估费用，不转发上游，例如 POST /v1/billing/quote/v1/chat/completions
+	quoteRouter := router.Group(middleware.BillingQuotePrefix)
+	quoteRouter.Use(middleware.RouteTag("relay"))
+	quoteRouter.Use(middleware.SystemPerformanceCheck())
+	quoteRouter.Use(middleware.BillingQuoteRequestConvert())
+	quoteRouter.Use(middleware.TokenAuth())
+	quoteRouter.Use(middleware.Distribute())
+	{
+		quoteRouter.POST("/*path", controller.RelayQuote)
+	}
+
 	relayMjRouter := router.Group("/mj")
 	relayMjRouter.Use(middleware.RouteTag("relay"))
 	relayMjRouter.Use(middleware.SystemPerformanceCheck())
@@ -194,12 +221,20 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter.Use(middleware.TokenAuth())
 	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
 	relayGeminiRouter.Use(middleware.Distribute())
+	relayGeminiRouter.Use(middleware.PayloadCapture())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
-		relayGeminiRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		relayGeminiRouter.POST("/models/*path", relayGemini)
+	}
+}
+
+// relayGemini Gemini 原生接口，:countTokens 单独处理，不转发为生成请求
+func relayGemini(c *gin.Context) {
+	if strings.HasSuffix(c.Param("path"), ":countTokens") {
+		controller.RelayCountTokens(c, types.RelayFormatGemini)
+		return
 	}
+	controller.Relay(c, types.RelayFormatGemini)
 }
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
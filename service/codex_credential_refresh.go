@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/secretref"
 )
 
 type CodexCredentialRefreshOptions struct {
@@ -51,6 +52,10 @@ func RefreshCodexChannelCredential(ctx context.Context, channelID int, opts Code
 		return nil, nil, fmt.Errorf("channel type is not Codex")
 	}
 
+	// 外部密钥引用由密钥服务负责轮换，刷新后写回会覆盖引用
+	if secretref.IsReference(strings.TrimSpace(ch.Key)) {
+		return nil, nil, fmt.Errorf("codex channel: credential stored as secret reference cannot be refreshed")
+	}
 	oauthKey, err := parseCodexOAuthKey(strings.TrimSpace(ch.Key))
 	if err != nil {
 		return nil, nil, err
@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/secretref"
 
 	"github.com/bytedance/gopkg/util/gopool"
 )
@@ -89,7 +90,7 @@ func runCodexCredentialAutoRefreshOnce() {
 			}
 
 			rawKey := strings.TrimSpace(ch.Key)
-			if rawKey == "" {
+			if rawKey == "" || secretref.IsReference(rawKey) {
 				continue
 			}
 
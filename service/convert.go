@@ -1,8 +1,10 @@
 package service
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
@@ -87,6 +89,9 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		openAITools = append(openAITools, openAITool)
 	}
 	openAIRequest.Tools = openAITools
+	if len(openAITools) > 0 && claudeRequest.ToolChoice != nil {
+		convertClaudeToolChoice(claudeRequest.ToolChoice, &openAIRequest)
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -118,18 +123,19 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 					}
 					openAIMessage.SetMediaContent(systemMediaMessages)
 				} else {
-					systemStr := ""
+					systemTexts := make([]string, 0, len(systems))
 					for _, system := range systems {
 						if system.Text != nil {
-							systemStr += *system.Text
+							systemTexts = append(systemTexts, *system.Text)
 						}
 					}
-					openAIMessage.SetStringContent(systemStr)
+					openAIMessage.SetStringContent(strings.Join(systemTexts, "\n"))
 				}
 				openAIMessages = append(openAIMessages, openAIMessage)
 			}
 		}
 	}
+	carryReasoning := shouldCarryReasoningContent(info)
 	for _, claudeMessage := range claudeRequest.Messages {
 		openAIMessage := dto.Message{
 			Role: claudeMessage.Role,
@@ -139,13 +145,15 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		if claudeMessage.IsStringContent() {
 			openAIMessage.SetStringContent(claudeMessage.GetStringContent())
 		} else {
-			content, err := claudeMessage.ParseContent()
+			contents, err := claudeMessage.ParseContent()
 			if err != nil {
 				return nil, err
 			}
-			contents := content
 			var toolCalls []dto.ToolCallRequest
+			var reasoning strings.Builder
 			mediaMessages := make([]dto.MediaContent, 0, len(contents))
+			// tool 消息只能携带文本，工具结果中的图片与文档放入随后的用户消息
+			var toolResultMedia []dto.MediaContent
 
 			for _, mediaMsg := range contents {
 				switch mediaMsg.Type {
@@ -156,15 +164,17 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 						CacheControl: mediaMsg.CacheControl,
 					}
 					mediaMessages = append(mediaMessages, message)
-				case "image":
-					// Handle image conversion (base64 to URL or keep as is)
-					imageData := fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
-					//textContent += fmt.Sprintf("[Image: %s]", imageData)
-					mediaMessage := dto.MediaContent{
-						Type:     "image_url",
-						ImageUrl: &dto.MessageImageUrl{Url: imageData},
+				case "image", "document":
+					mediaMessages = append(mediaMessages, claudeSourceToOpenAI(mediaMsg)...)
+				case "thinking":
+					if mediaMsg.Thinking != nil && *mediaMsg.Thinking != "" {
+						if reasoning.Len() > 0 {
+							reasoning.WriteString("\n\n")
+						}
+						reasoning.WriteString(*mediaMsg.Thinking)
 					}
-					mediaMessages = append(mediaMessages, mediaMessage)
+				case "redacted_thinking":
+					// 加密的思考内容与签名只有 Claude 能识别，不转发给其他上游
 				case "tool_use":
 					toolCall := dto.ToolCallRequest{
 						ID:   mediaMsg.Id,
@@ -177,34 +187,26 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 					toolCalls = append(toolCalls, toolCall)
 				case "tool_result":
 					// Add tool result as a separate message
-					toolName := mediaMsg.Name
-					if toolName == "" {
-						toolName = claudeRequest.SearchToolNameByToolCallId(mediaMsg.ToolUseId)
-					}
-					oaiToolMessage := dto.Message{
-						Role:       "tool",
-						Name:       &toolName,
-						ToolCallId: mediaMsg.ToolUseId,
-					}
-					//oaiToolMessage.SetStringContent(*mediaMsg.GetMediaContent().Text)
-					if mediaMsg.IsStringContent() {
-						oaiToolMessage.SetStringContent(mediaMsg.GetStringContent())
-					} else {
-						mediaContents := mediaMsg.ParseMediaContent()
-						encodeJson, _ := common.Marshal(mediaContents)
-						oaiToolMessage.SetStringContent(string(encodeJson))
-					}
+					oaiToolMessage, media := claudeToolResultToOpenAI(claudeRequest, mediaMsg)
 					openAIMessages = append(openAIMessages, oaiToolMessage)
+					toolResultMedia = append(toolResultMedia, media...)
 				}
 			}
+			if len(toolResultMedia) > 0 {
+				mediaMessages = append(toolResultMedia, mediaMessages...)
+			}
 
 			if len(toolCalls) > 0 {
 				openAIMessage.SetToolCalls(toolCalls)
 			}
 
-			if len(mediaMessages) > 0 && len(toolCalls) == 0 {
+			if len(mediaMessages) > 0 {
 				openAIMessage.SetMediaContent(mediaMessages)
 			}
+
+			if carryReasoning && claudeMessage.Role == "assistant" && reasoning.Len() > 0 {
+				openAIMessage.ReasoningContent = reasoning.String()
+			}
 		}
 		if len(openAIMessage.ParseContent()) > 0 || len(openAIMessage.ToolCalls) > 0 {
 			openAIMessages = append(openAIMessages, openAIMessage)
@@ -216,6 +218,129 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 	return &openAIRequest, nil
 }
 
+// convertClaudeToolChoice 转换 tool_choice，disable_parallel_tool_use 对应 parallel_tool_calls=false
+func convertClaudeToolChoice(toolChoice any, openAIRequest *dto.GeneralOpenAIRequest) {
+	choice, err := common.Any2Type[dto.ClaudeToolChoice](toolChoice)
+	if err != nil {
+		return
+	}
+	switch choice.Type {
+	case "auto", "none":
+		openAIRequest.ToolChoice = choice.Type
+	case "any":
+		openAIRequest.ToolChoice = "required"
+	case "tool":
+		openAIRequest.ToolChoice = map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": choice.Name,
+			},
+		}
+	}
+	if choice.DisableParallelToolUse {
+		openAIRequest.ParallelTooCalls = lo.ToPtr(false)
+	}
+}
+
+// shouldCarryReasoningContent 历史消息中的思考内容是否以 reasoning_content 转发。
+// OpenAI 官方接口会拒绝未知的消息字段，其他兼容上游（如 DeepSeek、Kimi 的工具调用轮次）需要回传思考内容
+func shouldCarryReasoningContent(info *relaycommon.RelayInfo) bool {
+	if info.ChannelMeta == nil || info.ChannelType != constant.ChannelTypeOpenAI {
+		return true
+	}
+	baseURL := strings.TrimRight(info.ChannelBaseUrl, "/")
+	return baseURL != "" && baseURL != constant.ChannelBaseURLs[constant.ChannelTypeOpenAI]
+}
+
+// claudeSourceToOpenAI 转换 image 与 document 内容块。PDF 转为 file 内容，纯文本文档转为文本，
+// 无法内联的远程文档降级为引用说明
+func claudeSourceToOpenAI(block dto.ClaudeMediaMessage) []dto.MediaContent {
+	source := block.Source
+	if source == nil {
+		return nil
+	}
+	data, _ := source.Data.(string)
+	if block.Type == "image" {
+		url := source.Url
+		if source.Type == "base64" {
+			url = fmt.Sprintf("data:%s;base64,%s", source.MediaType, data)
+		}
+		if url == "" {
+			return nil
+		}
+		return []dto.MediaContent{{
+			Type:     dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{Url: url},
+		}}
+	}
+
+	switch source.Type {
+	case "base64":
+		fileName := block.Title
+		if fileName == "" {
+			fileName = "document.pdf"
+		}
+		return []dto.MediaContent{{
+			Type: dto.ContentTypeFile,
+			File: &dto.MessageFile{
+				FileName: fileName,
+				FileData: fmt.Sprintf("data:%s;base64,%s", source.MediaType, data),
+			},
+		}}
+	case "text":
+		text := data
+		if block.Title != "" {
+			text = block.Title + "\n\n" + data
+		}
+		return []dto.MediaContent{{
+			Type:         dto.ContentTypeText,
+			Text:         text,
+			CacheControl: block.CacheControl,
+		}}
+	case "url":
+		text := "Document: " + source.Url
+		if block.Title != "" {
+			text = fmt.Sprintf("Document %q: %s", block.Title, source.Url)
+		}
+		return []dto.MediaContent{{
+			Type: dto.ContentTypeText,
+			Text: text,
+		}}
+	}
+	return nil
+}
+
+// claudeToolResultToOpenAI 转换 tool_result 内容块。文本合并为 tool 消息，图片与文档单独返回
+func claudeToolResultToOpenAI(claudeRequest dto.ClaudeRequest, block dto.ClaudeMediaMessage) (dto.Message, []dto.MediaContent) {
+	toolName := block.Name
+	if toolName == "" {
+		toolName = claudeRequest.SearchToolNameByToolCallId(block.ToolUseId)
+	}
+	toolMessage := dto.Message{
+		Role:       "tool",
+		Name:       &toolName,
+		ToolCallId: block.ToolUseId,
+	}
+	if block.IsStringContent() {
+		toolMessage.SetStringContent(block.GetStringContent())
+		return toolMessage, nil
+	}
+	var texts []string
+	var media []dto.MediaContent
+	for _, item := range block.ParseMediaContent() {
+		switch item.Type {
+		case "text":
+			texts = append(texts, item.GetText())
+		case "image", "document":
+			media = append(media, claudeSourceToOpenAI(item)...)
+		default:
+			texts = append(texts, item.GetJsonRowString())
+		}
+	}
+	toolMessage.SetStringContent(strings.Join(texts, "\n"))
+	return toolMessage, media
+}
+
 func generateStopBlock(index int) *dto.ClaudeResponse {
 	return &dto.ClaudeResponse{
 		Type:  "content_block_stop",
@@ -223,361 +348,199 @@ func generateStopBlock(index int) *dto.ClaudeResponse {
 	}
 }
 
-func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
-	if info.ClaudeConvertInfo.Done {
+func generateDeltaBlock(index int, delta *dto.ClaudeMediaMessage) *dto.ClaudeResponse {
+	return &dto.ClaudeResponse{
+		Type:  "content_block_delta",
+		Index: common.GetPointer[int](index),
+		Delta: delta,
+	}
+}
+
+// closeClaudeBlock 结束当前打开的内容块
+func closeClaudeBlock(info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	if convertInfo.LastMessagesType == relaycommon.LastMessageTypeNone || convertInfo.LastMessagesType == "" {
 		return nil
 	}
+	convertInfo.LastMessagesType = relaycommon.LastMessageTypeNone
+	return []*dto.ClaudeResponse{generateStopBlock(convertInfo.Index)}
+}
 
-	var claudeResponses []*dto.ClaudeResponse
-	// stopOpenBlocks emits the required content_block_stop event(s) for the currently open block(s)
-	// according to Anthropic's SSE streaming state machine:
-	// content_block_start -> content_block_delta* -> content_block_stop (per index).
-	//
-	// For text/thinking, there is at most one open block at info.ClaudeConvertInfo.Index.
-	// For tools, OpenAI tool_calls can stream multiple parallel tool_use blocks (indexed from 0),
-	// so we may have multiple open blocks and must stop each one explicitly.
-	stopOpenBlocks := func() {
-		switch info.ClaudeConvertInfo.LastMessagesType {
-		case relaycommon.LastMessageTypeText, relaycommon.LastMessageTypeThinking:
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-		case relaycommon.LastMessageTypeTools:
-			base := info.ClaudeConvertInfo.ToolCallBaseIndex
-			for offset := 0; offset <= info.ClaudeConvertInfo.ToolCallMaxIndexOffset; offset++ {
-				claudeResponses = append(claudeResponses, generateStopBlock(base+offset))
-			}
-		}
+// openClaudeBlock 结束当前内容块，并以下一个可用序号开始新的内容块。
+// Claude 的流式协议要求每个序号依次经历 content_block_start -> content_block_delta* -> content_block_stop
+func openClaudeBlock(info *relaycommon.RelayInfo, messageType string, block *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	responses := closeClaudeBlock(info)
+	convertInfo.Index = convertInfo.NextIndex
+	convertInfo.NextIndex++
+	convertInfo.LastMessagesType = messageType
+	return append(responses, &dto.ClaudeResponse{
+		Type:         "content_block_start",
+		Index:        common.GetPointer[int](convertInfo.Index),
+		ContentBlock: block,
+	})
+}
+
+func claudeMessageStart(id string, model string, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
+	info.ClaudeConvertInfo.Started = true
+	msg := &dto.ClaudeMediaMessage{
+		Id:    id,
+		Model: model,
+		Type:  "message",
+		Role:  "assistant",
+		Usage: &dto.ClaudeUsage{
+			InputTokens:  info.GetEstimatePromptTokens(),
+			OutputTokens: 0,
+		},
 	}
-	// stopOpenBlocksAndAdvance closes the currently open block(s) and advances the content block index
-	// to the next available slot for subsequent content_block_start events.
-	//
-	// This prevents invalid streams where a content_block_delta (e.g. thinking_delta) is emitted for an
-	// index whose active content_block type is different (the typical cause of "Mismatched content block type").
-	stopOpenBlocksAndAdvance := func() {
-		if info.ClaudeConvertInfo.LastMessagesType == relaycommon.LastMessageTypeNone {
-			return
-		}
-		stopOpenBlocks()
-		switch info.ClaudeConvertInfo.LastMessagesType {
-		case relaycommon.LastMessageTypeTools:
-			info.ClaudeConvertInfo.Index = info.ClaudeConvertInfo.ToolCallBaseIndex + info.ClaudeConvertInfo.ToolCallMaxIndexOffset + 1
-			info.ClaudeConvertInfo.ToolCallBaseIndex = 0
-			info.ClaudeConvertInfo.ToolCallMaxIndexOffset = 0
-		default:
-			info.ClaudeConvertInfo.Index++
-		}
-		info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeNone
-	}
-	if info.SendResponseCount == 1 {
-		msg := &dto.ClaudeMediaMessage{
-			Id:    openAIResponse.Id,
-			Model: openAIResponse.Model,
-			Type:  "message",
-			Role:  "assistant",
-			Usage: &dto.ClaudeUsage{
-				InputTokens:  info.GetEstimatePromptTokens(),
-				OutputTokens: 0,
-			},
+	msg.SetContent(make([]any, 0))
+	return &dto.ClaudeResponse{
+		Type:    "message_start",
+		Message: msg,
+	}
+}
+
+// claudeToolCallEvents 转换一个工具调用增量。工具调用按 OpenAI 的序号对应到各自的 tool_use 内容块，
+// 首次出现时开始内容块，参数以 input_json_delta 下发
+func claudeToolCallEvents(info *relaycommon.RelayInfo, position int, toolCall dto.ToolCallResponse) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	toolIndex := position
+	if toolCall.Index != nil {
+		toolIndex = *toolCall.Index
+	}
+	var responses []*dto.ClaudeResponse
+	blockIndex, ok := convertInfo.ToolBlocks[toolIndex]
+	if !ok && (toolCall.ID != "" || toolCall.Function.Name != "") {
+		if convertInfo.ToolBlocks == nil {
+			convertInfo.ToolBlocks = make(map[int]int)
+		}
+		id := toolCall.ID
+		if id == "" {
+			id = "toolu_" + common.GetRandomString(24)
 		}
-		msg.SetContent(make([]any, 0))
-		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-			Type:    "message_start",
-			Message: msg,
+		responses = openClaudeBlock(info, relaycommon.LastMessageTypeTools, &dto.ClaudeMediaMessage{
+			Id:    id,
+			Type:  "tool_use",
+			Name:  toolCall.Function.Name,
+			Input: map[string]interface{}{},
 		})
-		//claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-		//	Type: "ping",
-		//})
-		if openAIResponse.IsToolCall() {
-			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-			info.ClaudeConvertInfo.ToolCallBaseIndex = 0
-			info.ClaudeConvertInfo.ToolCallMaxIndexOffset = 0
-			var toolCall dto.ToolCallResponse
-			if len(openAIResponse.Choices) > 0 && len(openAIResponse.Choices[0].Delta.ToolCalls) > 0 {
-				toolCall = openAIResponse.Choices[0].Delta.ToolCalls[0]
-			} else {
-				first := openAIResponse.GetFirstToolCall()
-				if first != nil {
-					toolCall = *first
-				} else {
-					toolCall = dto.ToolCallResponse{}
-				}
-			}
-			resp := &dto.ClaudeResponse{
-				Type: "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Id:    toolCall.ID,
-					Type:  "tool_use",
-					Name:  toolCall.Function.Name,
-					Input: map[string]interface{}{},
-				},
-			}
-			resp.SetIndex(0)
-			claudeResponses = append(claudeResponses, resp)
-			// 首块包含工具 delta，则追加 input_json_delta
-			if toolCall.Function.Arguments != "" {
-				idx := 0
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &idx,
-					Type:  "content_block_delta",
-					Delta: &dto.ClaudeMediaMessage{
-						Type:        "input_json_delta",
-						PartialJson: &toolCall.Function.Arguments,
-					},
-				})
-			}
-		} else {
+		blockIndex = convertInfo.Index
+		convertInfo.ToolBlocks[toolIndex] = blockIndex
+		ok = true
+	}
+	if !ok && convertInfo.LastMessagesType == relaycommon.LastMessageTypeTools {
+		// 缺少序号与 ID 的参数增量属于当前的工具调用
+		blockIndex, ok = convertInfo.Index, true
+	}
+	if ok && toolCall.Function.Arguments != "" {
+		arguments := toolCall.Function.Arguments
+		responses = append(responses, generateDeltaBlock(blockIndex, &dto.ClaudeMediaMessage{
+			Type:        "input_json_delta",
+			PartialJson: &arguments,
+		}))
+	}
+	return responses
+}
 
-		}
-		// 判断首个响应是否存在内容（非标准的 OpenAI 响应）
-		if len(openAIResponse.Choices) > 0 {
-			reasoning := openAIResponse.Choices[0].Delta.GetReasoningContent()
-			content := openAIResponse.Choices[0].Delta.GetContentString()
+func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	if convertInfo.Done {
+		return nil
+	}
 
-			if reasoning != "" {
-				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-					stopOpenBlocksAndAdvance()
-				}
-				idx := info.ClaudeConvertInfo.Index
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &idx,
-					Type:  "content_block_start",
-					ContentBlock: &dto.ClaudeMediaMessage{
-						Type:     "thinking",
-						Thinking: common.GetPointer[string](""),
-					},
-				})
-				idx2 := idx
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &idx2,
-					Type:  "content_block_delta",
-					Delta: &dto.ClaudeMediaMessage{
-						Type:     "thinking_delta",
-						Thinking: &reasoning,
-					},
-				})
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-			} else if content != "" {
-				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-					stopOpenBlocksAndAdvance()
-				}
-				idx := info.ClaudeConvertInfo.Index
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &idx,
-					Type:  "content_block_start",
-					ContentBlock: &dto.ClaudeMediaMessage{
-						Type: "text",
-						Text: common.GetPointer[string](""),
-					},
-				})
-				idx2 := idx
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Index: &idx2,
-					Type:  "content_block_delta",
-					Delta: &dto.ClaudeMediaMessage{
-						Type: "text_delta",
-						Text: common.GetPointer[string](content),
-					},
-				})
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-			}
-		}
+	var claudeResponses []*dto.ClaudeResponse
+	if !convertInfo.Started {
+		claudeResponses = append(claudeResponses, claudeMessageStart(openAIResponse.Id, openAIResponse.Model, info))
+	}
 
-		// 如果首块就带 finish_reason，需要立即发送停止块
-		if len(openAIResponse.Choices) > 0 && openAIResponse.Choices[0].FinishReason != nil && *openAIResponse.Choices[0].FinishReason != "" {
-			info.FinishReason = *openAIResponse.Choices[0].FinishReason
-			stopOpenBlocks()
-			oaiUsage := openAIResponse.Usage
-			if oaiUsage == nil {
-				oaiUsage = info.ClaudeConvertInfo.Usage
-			}
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-			info.ClaudeConvertInfo.Done = true
-		}
-		return claudeResponses
-	}
-
-	if len(openAIResponse.Choices) == 0 {
-		// no choices
-		// 可能为非标准的 OpenAI 响应，判断是否已经完成
-		if info.ClaudeConvertInfo.Done {
-			stopOpenBlocks()
-			oaiUsage := info.ClaudeConvertInfo.Usage
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
+	// 同一个数据块中可能同时包含思考、文本与工具调用，按该顺序依次转换
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			if convertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
+				claudeResponses = append(claudeResponses, openClaudeBlock(info, relaycommon.LastMessageTypeThinking, &dto.ClaudeMediaMessage{
+					Type:     "thinking",
+					Thinking: common.GetPointer[string](""),
+				})...)
 			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
+			claudeResponses = append(claudeResponses, generateDeltaBlock(convertInfo.Index, &dto.ClaudeMediaMessage{
+				Type:     "thinking_delta",
+				Thinking: &reasoning,
+			}))
 		}
-		return claudeResponses
-	} else {
-		chosenChoice := openAIResponse.Choices[0]
-		doneChunk := chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != ""
-		if doneChunk {
-			info.FinishReason = *chosenChoice.FinishReason
-		}
-
-		var claudeResponse dto.ClaudeResponse
-		var isEmpty bool
-		claudeResponse.Type = "content_block_delta"
-		if len(chosenChoice.Delta.ToolCalls) > 0 {
-			toolCalls := chosenChoice.Delta.ToolCalls
-			if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
-				stopOpenBlocksAndAdvance()
-				info.ClaudeConvertInfo.ToolCallBaseIndex = info.ClaudeConvertInfo.Index
-				info.ClaudeConvertInfo.ToolCallMaxIndexOffset = 0
-			}
-			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-			base := info.ClaudeConvertInfo.ToolCallBaseIndex
-			maxOffset := info.ClaudeConvertInfo.ToolCallMaxIndexOffset
-
-			for i, toolCall := range toolCalls {
-				offset := 0
-				if toolCall.Index != nil {
-					offset = *toolCall.Index
-				} else {
-					offset = i
-				}
-				if offset > maxOffset {
-					maxOffset = offset
-				}
-				blockIndex := base + offset
-
-				idx := blockIndex
-				if toolCall.Function.Name != "" {
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &idx,
-						Type:  "content_block_start",
-						ContentBlock: &dto.ClaudeMediaMessage{
-							Id:    toolCall.ID,
-							Type:  "tool_use",
-							Name:  toolCall.Function.Name,
-							Input: map[string]interface{}{},
-						},
-					})
-				}
-
-				if len(toolCall.Function.Arguments) > 0 {
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &idx,
-						Type:  "content_block_delta",
-						Delta: &dto.ClaudeMediaMessage{
-							Type:        "input_json_delta",
-							PartialJson: &toolCall.Function.Arguments,
-						},
-					})
-				}
-			}
-			info.ClaudeConvertInfo.ToolCallMaxIndexOffset = maxOffset
-			info.ClaudeConvertInfo.Index = base + maxOffset
-		} else {
-			reasoning := chosenChoice.Delta.GetReasoningContent()
-			textContent := chosenChoice.Delta.GetContentString()
-			if reasoning != "" || textContent != "" {
-				if reasoning != "" {
-					if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-						stopOpenBlocksAndAdvance()
-						idx := info.ClaudeConvertInfo.Index
-						claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-							Index: &idx,
-							Type:  "content_block_start",
-							ContentBlock: &dto.ClaudeMediaMessage{
-								Type:     "thinking",
-								Thinking: common.GetPointer[string](""),
-							},
-						})
-					}
-					info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-					claudeResponse.Delta = &dto.ClaudeMediaMessage{
-						Type:     "thinking_delta",
-						Thinking: &reasoning,
-					}
-				} else {
-					if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-						stopOpenBlocksAndAdvance()
-						idx := info.ClaudeConvertInfo.Index
-						claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-							Index: &idx,
-							Type:  "content_block_start",
-							ContentBlock: &dto.ClaudeMediaMessage{
-								Type: "text",
-								Text: common.GetPointer[string](""),
-							},
-						})
-					}
-					info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-					claudeResponse.Delta = &dto.ClaudeMediaMessage{
-						Type: "text_delta",
-						Text: common.GetPointer[string](textContent),
-					}
-				}
-			} else {
-				isEmpty = true
+		if text := choice.Delta.GetContentString(); text != "" {
+			if convertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
+				claudeResponses = append(claudeResponses, openClaudeBlock(info, relaycommon.LastMessageTypeText, &dto.ClaudeMediaMessage{
+					Type: "text",
+					Text: common.GetPointer[string](""),
+				})...)
 			}
+			claudeResponses = append(claudeResponses, generateDeltaBlock(convertInfo.Index, &dto.ClaudeMediaMessage{
+				Type: "text_delta",
+				Text: common.GetPointer[string](text),
+			}))
 		}
-
-		claudeResponse.Index = common.GetPointer[int](info.ClaudeConvertInfo.Index)
-		if !isEmpty && claudeResponse.Delta != nil {
-			claudeResponses = append(claudeResponses, &claudeResponse)
+		for i, toolCall := range choice.Delta.ToolCalls {
+			claudeResponses = append(claudeResponses, claudeToolCallEvents(info, i, toolCall)...)
 		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			convertInfo.FinishReason = *choice.FinishReason
+			info.FinishReason = *choice.FinishReason
+		}
+	}
 
-		if doneChunk || info.ClaudeConvertInfo.Done {
-			stopOpenBlocks()
-			oaiUsage := openAIResponse.Usage
-			if oaiUsage == nil {
-				oaiUsage = info.ClaudeConvertInfo.Usage
-			}
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
-			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-			info.ClaudeConvertInfo.Done = true
-			return claudeResponses
+	// 结束原因与用量可能分属两个数据块（stream_options.include_usage），收到用量后才结束消息，
+	// 否则由 FinishClaudeStream 在上游流结束时补发
+	if convertInfo.FinishReason != "" && openAIResponse.Usage != nil {
+		if convertInfo.Usage == nil {
+			convertInfo.Usage = openAIResponse.Usage
 		}
+		claudeResponses = append(claudeResponses, FinishClaudeStream(info)...)
 	}
+	return claudeResponses
+}
 
+// FinishClaudeStream 结束转换得到的 Claude 流：关闭打开的内容块，发送带有停止原因与用量的 message_delta 以及 message_stop
+func FinishClaudeStream(info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	if convertInfo == nil || convertInfo.Done {
+		return nil
+	}
+	var claudeResponses []*dto.ClaudeResponse
+	if !convertInfo.Started {
+		claudeResponses = append(claudeResponses, claudeMessageStart("", info.UpstreamModelName, info))
+	}
+	claudeResponses = append(claudeResponses, closeClaudeBlock(info)...)
+
+	usage := &dto.ClaudeUsage{InputTokens: info.GetEstimatePromptTokens()}
+	if convertInfo.Usage != nil {
+		usage = claudeUsageFromOpenAI(convertInfo.Usage)
+	}
+	claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+		Type:  "message_delta",
+		Usage: usage,
+		Delta: &dto.ClaudeMediaMessage{
+			StopReason: common.GetPointer[string](claudeStopReason(convertInfo.FinishReason, len(convertInfo.ToolBlocks) > 0)),
+		},
+	}, &dto.ClaudeResponse{
+		Type: "message_stop",
+	})
+	convertInfo.Done = true
 	return claudeResponses
 }
 
+// claudeUsageFromOpenAI OpenAI 的 prompt_tokens 包含缓存命中与缓存写入，Claude 的 input_tokens 不包含
+func claudeUsageFromOpenAI(usage *dto.Usage) *dto.ClaudeUsage {
+	cacheRead := usage.PromptTokensDetails.CachedTokens
+	cacheCreation := usage.PromptTokensDetails.CachedCreationTokens
+	return &dto.ClaudeUsage{
+		InputTokens:              max(usage.PromptTokens-cacheRead-cacheCreation, 0),
+		OutputTokens:             usage.CompletionTokens,
+		CacheReadInputTokens:     cacheRead,
+		CacheCreationInputTokens: cacheCreation,
+	}
+}
+
 func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
 	var stopReason string
 	contents := make([]dto.ClaudeMediaMessage, 0)
@@ -588,34 +551,49 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 		Model: openAIResponse.Model,
 	}
 	for _, choice := range openAIResponse.Choices {
-		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		if choice.FinishReason == "tool_calls" {
-			for _, toolUse := range choice.Message.ParseToolCalls() {
-				claudeContent := dto.ClaudeMediaMessage{}
-				claudeContent.Type = "tool_use"
-				claudeContent.Id = toolUse.ID
-				claudeContent.Name = toolUse.Function.Name
-				var mapParams map[string]interface{}
-				if err := common.Unmarshal([]byte(toolUse.Function.Arguments), &mapParams); err == nil {
-					claudeContent.Input = mapParams
-				} else {
-					claudeContent.Input = toolUse.Function.Arguments
-				}
-				contents = append(contents, claudeContent)
-			}
-		} else {
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:     "thinking",
+				Thinking: common.GetPointer[string](reasoning),
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
 			claudeContent := dto.ClaudeMediaMessage{}
 			claudeContent.Type = "text"
-			claudeContent.SetText(choice.Message.StringContent())
+			claudeContent.SetText(text)
 			contents = append(contents, claudeContent)
 		}
+		toolUses := choice.Message.ParseToolCalls()
+		for _, toolUse := range toolUses {
+			claudeContent := dto.ClaudeMediaMessage{}
+			claudeContent.Type = "tool_use"
+			claudeContent.Id = toolUse.ID
+			claudeContent.Name = toolUse.Function.Name
+			var mapParams map[string]interface{}
+			if toolUse.Function.Arguments == "" {
+				claudeContent.Input = map[string]interface{}{}
+			} else if err := common.Unmarshal([]byte(toolUse.Function.Arguments), &mapParams); err == nil {
+				claudeContent.Input = mapParams
+			} else {
+				claudeContent.Input = toolUse.Function.Arguments
+			}
+			contents = append(contents, claudeContent)
+		}
+		stopReason = claudeStopReason(choice.FinishReason, len(toolUses) > 0)
+	}
+	if len(contents) == 0 {
+		claudeContent := dto.ClaudeMediaMessage{}
+		claudeContent.Type = "text"
+		claudeContent.SetText("")
+		contents = append(contents, claudeContent)
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
-	claudeResponse.Usage = &dto.ClaudeUsage{
-		InputTokens:  openAIResponse.PromptTokens,
-		OutputTokens: openAIResponse.CompletionTokens,
-	}
+	claudeResponse.Usage = claudeUsageFromOpenAI(&openAIResponse.Usage)
 
 	return claudeResponse
 }
@@ -624,6 +602,21 @@ func stopReasonOpenAI2Claude(reason string) string {
 	return reasonmap.OpenAIFinishReasonToClaudeStopReason(reason)
 }
 
+// claudeStopReason 输出了 tool_use 内容块且正常结束时停止原因为 tool_use，
+// 部分上游（如 Gemini）在工具调用后仍返回 stop
+func claudeStopReason(finishReason string, hasToolUse bool) string {
+	switch finishReason {
+	case "", "stop", "tool_calls", "function_call":
+		if hasToolUse {
+			return "tool_use"
+		}
+		if finishReason == "" {
+			return "end_turn"
+		}
+	}
+	return stopReasonOpenAI2Claude(finishReason)
+}
+
 func toJSONString(v interface{}) string {
 	b, err := json.Marshal(v)
 	if err != nil {
@@ -639,6 +632,8 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 	}
 
 	// 转换 messages
+	carryReasoning := shouldCarryReasoningContent(info)
+	callIDs := &geminiCallIDs{pending: make(map[string][]string)}
 	var messages []dto.Message
 	for _, content := range geminiRequest.Contents {
 		message := dto.Message{
@@ -648,37 +643,39 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		// 处理 parts
 		var mediaContents []dto.MediaContent
 		var toolCalls []dto.ToolCallRequest
+		var reasoning strings.Builder
 		for _, part := range content.Parts {
-			if part.Text != "" {
-				mediaContent := dto.MediaContent{
-					Type: "text",
-					Text: part.Text,
-				}
-				mediaContents = append(mediaContents, mediaContent)
-			} else if part.InlineData != nil {
-				mediaContent := dto.MediaContent{
-					Type: "image_url",
-					ImageUrl: &dto.MessageImageUrl{
-						Url:      fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
-						Detail:   "auto",
-						MimeType: part.InlineData.MimeType,
-					},
-				}
-				mediaContents = append(mediaContents, mediaContent)
-			} else if part.FileData != nil {
-				mediaContent := dto.MediaContent{
-					Type: "image_url",
-					ImageUrl: &dto.MessageImageUrl{
-						Url:      part.FileData.FileUri,
-						Detail:   "auto",
-						MimeType: part.FileData.MimeType,
-					},
+			switch {
+			case part.Thought:
+				if part.Text != "" {
+					if reasoning.Len() > 0 {
+						reasoning.WriteString("\n\n")
+					}
+					reasoning.WriteString(part.Text)
 				}
-				mediaContents = append(mediaContents, mediaContent)
-			} else if part.FunctionCall != nil {
+			case part.Text != "":
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: part.Text,
+				})
+			case part.InlineData != nil:
+				mediaContents = append(mediaContents, geminiInlineDataToOpenAI(part.InlineData))
+			case part.FileData != nil:
+				mediaContents = append(mediaContents, geminiFileDataToOpenAI(part.FileData))
+			case part.ExecutableCode != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: fmt.Sprintf("```%s\n%s\n```", strings.ToLower(part.ExecutableCode.Language), part.ExecutableCode.Code),
+				})
+			case part.CodeExecutionResult != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: part.CodeExecutionResult.Output,
+				})
+			case part.FunctionCall != nil:
 				// 处理 Gemini 的工具调用
 				toolCall := dto.ToolCallRequest{
-					ID:   fmt.Sprintf("call_%d", len(toolCalls)+1), // 生成唯一ID
+					ID:   callIDs.call(part.FunctionCall),
 					Type: "function",
 					Function: dto.FunctionRequest{
 						Name:      part.FunctionCall.FunctionName,
@@ -686,11 +683,11 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 					},
 				}
 				toolCalls = append(toolCalls, toolCall)
-			} else if part.FunctionResponse != nil {
+			case part.FunctionResponse != nil:
 				// 处理 Gemini 的工具响应，创建单独的 tool 消息
 				toolMessage := dto.Message{
 					Role:       "tool",
-					ToolCallId: fmt.Sprintf("call_%d", len(toolCalls)), // 使用对应的调用ID
+					ToolCallId: callIDs.response(part.FunctionResponse),
 				}
 				toolMessage.SetStringContent(toJSONString(part.FunctionResponse.Response))
 				messages = append(messages, toolMessage)
@@ -699,15 +696,18 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 
 		// 设置消息内容
 		if len(toolCalls) > 0 {
-			// 如果有工具调用，设置工具调用
 			message.SetToolCalls(toolCalls)
-		} else if len(mediaContents) == 1 && mediaContents[0].Type == "text" {
+		}
+		if len(mediaContents) == 1 && mediaContents[0].Type == dto.ContentTypeText {
 			// 如果只有一个文本内容，直接设置字符串
 			message.Content = mediaContents[0].Text
 		} else if len(mediaContents) > 0 {
 			// 如果有多个内容或包含媒体，设置为数组
 			message.SetMediaContent(mediaContents)
 		}
+		if carryReasoning && message.Role == "assistant" && reasoning.Len() > 0 {
+			message.ReasoningContent = reasoning.String()
+		}
 
 		// 只有当消息有内容或工具调用时才添加
 		if len(message.ParseContent()) > 0 || len(message.ToolCalls) > 0 {
@@ -717,43 +717,65 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 
 	openaiRequest.Messages = messages
 
-	if geminiRequest.GenerationConfig.Temperature != nil {
-		openaiRequest.Temperature = geminiRequest.GenerationConfig.Temperature
+	generationConfig := geminiRequest.GenerationConfig
+	if generationConfig.Temperature != nil {
+		openaiRequest.Temperature = generationConfig.Temperature
 	}
-	if geminiRequest.GenerationConfig.TopP != nil && *geminiRequest.GenerationConfig.TopP > 0 {
-		openaiRequest.TopP = lo.ToPtr(*geminiRequest.GenerationConfig.TopP)
+	if generationConfig.TopP != nil && *generationConfig.TopP > 0 {
+		openaiRequest.TopP = lo.ToPtr(*generationConfig.TopP)
 	}
-	if geminiRequest.GenerationConfig.TopK != nil && *geminiRequest.GenerationConfig.TopK > 0 {
-		openaiRequest.TopK = lo.ToPtr(int(*geminiRequest.GenerationConfig.TopK))
+	if generationConfig.TopK != nil && *generationConfig.TopK > 0 {
+		openaiRequest.TopK = lo.ToPtr(int(*generationConfig.TopK))
 	}
-	if geminiRequest.GenerationConfig.MaxOutputTokens != nil && *geminiRequest.GenerationConfig.MaxOutputTokens > 0 {
-		openaiRequest.MaxTokens = lo.ToPtr(*geminiRequest.GenerationConfig.MaxOutputTokens)
+	if generationConfig.MaxOutputTokens != nil && *generationConfig.MaxOutputTokens > 0 {
+		openaiRequest.MaxTokens = lo.ToPtr(*generationConfig.MaxOutputTokens)
 	}
 	// gemini stop sequences 最多 5 个，openai stop 最多 4 个
-	if len(geminiRequest.GenerationConfig.StopSequences) > 0 {
-		openaiRequest.Stop = geminiRequest.GenerationConfig.StopSequences[:4]
+	if len(generationConfig.StopSequences) > 0 {
+		openaiRequest.Stop = generationConfig.StopSequences[:min(len(generationConfig.StopSequences), 4)]
+	}
+	if generationConfig.CandidateCount != nil && *generationConfig.CandidateCount > 0 {
+		openaiRequest.N = lo.ToPtr(*generationConfig.CandidateCount)
+	}
+	if generationConfig.PresencePenalty != nil {
+		openaiRequest.PresencePenalty = lo.ToPtr(float64(*generationConfig.PresencePenalty))
 	}
-	if geminiRequest.GenerationConfig.CandidateCount != nil && *geminiRequest.GenerationConfig.CandidateCount > 0 {
-		openaiRequest.N = lo.ToPtr(*geminiRequest.GenerationConfig.CandidateCount)
+	if generationConfig.FrequencyPenalty != nil {
+		openaiRequest.FrequencyPenalty = lo.ToPtr(float64(*generationConfig.FrequencyPenalty))
 	}
+	if generationConfig.Seed != nil {
+		openaiRequest.Seed = lo.ToPtr(float64(*generationConfig.Seed))
+	}
+	if generationConfig.ResponseLogprobs != nil && *generationConfig.ResponseLogprobs {
+		openaiRequest.LogProbs = lo.ToPtr(true)
+		if generationConfig.Logprobs != nil {
+			openaiRequest.TopLogProbs = lo.ToPtr(int(*generationConfig.Logprobs))
+		}
+	}
+	openaiRequest.ResponseFormat = geminiResponseFormatToOpenAI(generationConfig)
+	openaiRequest.ReasoningEffort = geminiThinkingToReasoningEffort(generationConfig.ThinkingConfig)
 
 	// 转换工具调用
 	if len(geminiRequest.GetTools()) > 0 {
 		var tools []dto.ToolCallRequest
 		for _, tool := range geminiRequest.GetTools() {
 			if tool.FunctionDeclarations != nil {
-				functionDeclarations, err := common.Any2Type[[]dto.FunctionRequest](tool.FunctionDeclarations)
+				functionDeclarations, err := common.Any2Type[[]geminiFunctionDeclaration](tool.FunctionDeclarations)
 				if err != nil {
 					common.SysError(fmt.Sprintf("failed to parse gemini function declarations: %v (type=%T)", err, tool.FunctionDeclarations))
 					continue
 				}
 				for _, function := range functionDeclarations {
+					parameters := function.ParametersJsonSchema
+					if parameters == nil {
+						parameters = geminiSchemaToJSONSchema(function.Parameters)
+					}
 					openAITool := dto.ToolCallRequest{
 						Type: "function",
 						Function: dto.FunctionRequest{
 							Name:        function.Name,
 							Description: function.Description,
-							Parameters:  function.Parameters,
+							Parameters:  parameters,
 						},
 					}
 					tools = append(tools, openAITool)
@@ -762,6 +784,9 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		}
 		if len(tools) > 0 {
 			openaiRequest.Tools = tools
+			if geminiRequest.ToolConfig != nil && geminiRequest.ToolConfig.FunctionCallingConfig != nil {
+				openaiRequest.ToolChoice = geminiFunctionCallingToToolChoice(geminiRequest.ToolConfig.FunctionCallingConfig)
+			}
 		}
 	}
 
@@ -778,6 +803,229 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 	return openaiRequest, nil
 }
 
+// geminiFunctionDeclaration 函数声明，参数可为 OpenAPI 风格的 parameters 或标准 JSON Schema
+type geminiFunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Parameters           any    `json:"parameters,omitempty"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
+}
+
+// geminiCallIDs 为工具调用分配 ID，并按调用 ID 或同名调用的先后顺序与 functionResponse 配对
+type geminiCallIDs struct {
+	seq     int
+	last    string
+	pending map[string][]string
+}
+
+func (g *geminiCallIDs) call(call *dto.FunctionCall) string {
+	id := call.ID
+	if id == "" {
+		g.seq++
+		id = fmt.Sprintf("call_%d", g.seq)
+	}
+	g.pending[call.FunctionName] = append(g.pending[call.FunctionName], id)
+	g.last = id
+	return id
+}
+
+func (g *geminiCallIDs) response(response *dto.GeminiFunctionResponse) string {
+	var id string
+	if len(response.ID) > 0 {
+		_ = common.Unmarshal(response.ID, &id)
+	}
+	pending := g.pending[response.Name]
+	if id != "" {
+		g.pending[response.Name] = lo.Without(pending, id)
+		return id
+	}
+	if len(pending) > 0 {
+		g.pending[response.Name] = pending[1:]
+		return pending[0]
+	}
+	return g.last
+}
+
+// geminiInlineDataToOpenAI 图片转为 image_url，音频转为 input_audio，视频转为 video_url，
+// 文本类数据解码为文本，其余（如 PDF）转为 file 内容
+func geminiInlineDataToOpenAI(inlineData *dto.GeminiInlineData) dto.MediaContent {
+	mimeType := inlineData.MimeType
+	dataURL := fmt.Sprintf("data:%s;base64,%s", mimeType, inlineData.Data)
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return dto.MediaContent{
+			Type: dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{
+				Url:      dataURL,
+				Detail:   "auto",
+				MimeType: mimeType,
+			},
+		}
+	case strings.HasPrefix(mimeType, "audio/"):
+		format := strings.TrimPrefix(mimeType, "audio/")
+		if format == "mpeg" {
+			format = "mp3"
+		}
+		return dto.MediaContent{
+			Type: dto.ContentTypeInputAudio,
+			InputAudio: &dto.MessageInputAudio{
+				Data:   inlineData.Data,
+				Format: format,
+			},
+		}
+	case strings.HasPrefix(mimeType, "video/"):
+		return dto.MediaContent{
+			Type:     dto.ContentTypeVideoUrl,
+			VideoUrl: &dto.MessageVideoUrl{Url: dataURL},
+		}
+	case strings.HasPrefix(mimeType, "text/") || mimeType == "application/json":
+		if decoded, err := base64.StdEncoding.DecodeString(inlineData.Data); err == nil {
+			return dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: string(decoded),
+			}
+		}
+	}
+	fileName := "document"
+	if mimeType == "application/pdf" {
+		fileName = "document.pdf"
+	}
+	return dto.MediaContent{
+		Type: dto.ContentTypeFile,
+		File: &dto.MessageFile{
+			FileName: fileName,
+			FileData: dataURL,
+		},
+	}
+}
+
+// geminiFileDataToOpenAI 远程图片与视频按 URL 传递，其他文件无法内联，降级为引用说明
+func geminiFileDataToOpenAI(fileData *dto.GeminiFileData) dto.MediaContent {
+	switch {
+	case strings.HasPrefix(fileData.MimeType, "video/"):
+		return dto.MediaContent{
+			Type:     dto.ContentTypeVideoUrl,
+			VideoUrl: &dto.MessageVideoUrl{Url: fileData.FileUri},
+		}
+	case fileData.MimeType == "" || strings.HasPrefix(fileData.MimeType, "image/"):
+		return dto.MediaContent{
+			Type: dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{
+				Url:      fileData.FileUri,
+				Detail:   "auto",
+				MimeType: fileData.MimeType,
+			},
+		}
+	}
+	return dto.MediaContent{
+		Type: dto.ContentTypeText,
+		Text: fmt.Sprintf("File (%s): %s", fileData.MimeType, fileData.FileUri),
+	}
+}
+
+// geminiSchemaToJSONSchema 将 Gemini 的 OpenAPI 风格 schema（大写 type、nullable）转换为 JSON Schema
+func geminiSchemaToJSONSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			switch key {
+			case "type":
+				if typeName, ok := value.(string); ok {
+					out[key] = strings.ToLower(typeName)
+					continue
+				}
+			case "nullable", "propertyOrdering":
+				if _, ok := value.(map[string]any); !ok {
+					continue
+				}
+			}
+			out[key] = geminiSchemaToJSONSchema(value)
+		}
+		if nullable, _ := v["nullable"].(bool); nullable {
+			if typeName, ok := out["type"].(string); ok {
+				out["type"] = []any{typeName, "null"}
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = geminiSchemaToJSONSchema(item)
+		}
+		return out
+	}
+	return schema
+}
+
+// geminiResponseFormatToOpenAI responseMimeType 为 application/json 时转换为 response_format，
+// 优先使用 responseJsonSchema，其次转换 responseSchema
+func geminiResponseFormatToOpenAI(generationConfig dto.GeminiChatGenerationConfig) *dto.ResponseFormat {
+	if generationConfig.ResponseMimeType != "application/json" {
+		return nil
+	}
+	var schema any
+	if len(generationConfig.ResponseJsonSchema) > 0 {
+		schema = generationConfig.ResponseJsonSchema
+	} else if generationConfig.ResponseSchema != nil {
+		schema = geminiSchemaToJSONSchema(generationConfig.ResponseSchema)
+	}
+	if schema == nil {
+		return &dto.ResponseFormat{Type: "json_object"}
+	}
+	jsonSchema, err := common.Marshal(dto.FormatJsonSchema{
+		Name:   "response",
+		Schema: schema,
+	})
+	if err != nil {
+		return &dto.ResponseFormat{Type: "json_object"}
+	}
+	return &dto.ResponseFormat{Type: "json_schema", JsonSchema: jsonSchema}
+}
+
+// geminiThinkingToReasoningEffort 显式指定思考等级或正数思考预算时转换为 reasoning_effort，
+// 动态预算（-1）与关闭思考（0）不传递
+func geminiThinkingToReasoningEffort(thinkingConfig *dto.GeminiThinkingConfig) string {
+	if thinkingConfig == nil {
+		return ""
+	}
+	if thinkingConfig.ThinkingLevel != "" {
+		return strings.ToLower(thinkingConfig.ThinkingLevel)
+	}
+	if thinkingConfig.ThinkingBudget == nil || *thinkingConfig.ThinkingBudget <= 0 {
+		return ""
+	}
+	switch budget := *thinkingConfig.ThinkingBudget; {
+	case budget <= 1024:
+		return "low"
+	case budget <= 8192:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// geminiFunctionCallingToToolChoice 转换 functionCallingConfig，ANY 且只允许一个函数时指定该函数
+func geminiFunctionCallingToToolChoice(config *dto.FunctionCallingConfig) any {
+	switch strings.ToUpper(string(config.Mode)) {
+	case "NONE":
+		return "none"
+	case "ANY":
+		if len(config.AllowedFunctionNames) == 1 {
+			return map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": config.AllowedFunctionNames[0],
+				},
+			}
+		}
+		return "required"
+	case "AUTO", "VALIDATED":
+		return "auto"
+	}
+	return nil
+}
+
 func convertGeminiRoleToOpenAI(geminiRole string) string {
 	switch geminiRole {
 	case "user":
@@ -801,77 +1049,133 @@ func extractTextFromGeminiParts(parts []dto.GeminiPart) string {
 	return strings.Join(texts, "\n")
 }
 
+// geminiIncludeThoughts 客户端在 thinkingConfig 中开启 includeThoughts 时才输出思考内容
+func geminiIncludeThoughts(info *relaycommon.RelayInfo) bool {
+	return info.GeminiConvertInfo != nil && info.GeminiConvertInfo.IncludeThoughts
+}
+
+// geminiFunctionArgs 解析工具调用参数，非 JSON 对象时放入 arguments 字段
+func geminiFunctionArgs(arguments string) map[string]interface{} {
+	args := make(map[string]interface{})
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			args = map[string]interface{}{"arguments": arguments}
+		}
+	}
+	return args
+}
+
+// geminiUsageMetadataFromOpenAI candidatesTokenCount 不含思考 token，思考 token 单独计入 thoughtsTokenCount
+func geminiUsageMetadataFromOpenAI(usage *dto.Usage) dto.GeminiUsageMetadata {
+	reasoningTokens := usage.CompletionTokenDetails.ReasoningTokens
+	metadata := dto.GeminiUsageMetadata{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens - reasoningTokens,
+		ThoughtsTokenCount:      reasoningTokens,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+		TotalTokenCount:         usage.TotalTokens,
+	}
+	if metadata.TotalTokenCount == 0 {
+		metadata.TotalTokenCount = usage.PromptTokens + usage.CompletionTokens
+	}
+	return metadata
+}
+
+// azureSafetyCategories Azure OpenAI 内容过滤类别与 Gemini 安全类别的对应关系，按输出顺序排列
+var azureSafetyCategories = []struct {
+	azure  string
+	gemini string
+}{
+	{"hate", "HARM_CATEGORY_HATE_SPEECH"},
+	{"sexual", "HARM_CATEGORY_SEXUALLY_EXPLICIT"},
+	{"violence", "HARM_CATEGORY_DANGEROUS_CONTENT"},
+	{"self_harm", "HARM_CATEGORY_DANGEROUS_CONTENT"},
+}
+
+var azureSeverityProbability = map[string]string{
+	"safe":   "NEGLIGIBLE",
+	"low":    "LOW",
+	"medium": "MEDIUM",
+	"high":   "HIGH",
+}
+
+// geminiSafetyRatings 将 content_filter_results 转换为 safetyRatings，同一 Gemini 类别取最高概率
+func geminiSafetyRatings(results map[string]dto.ContentFilterResult) []dto.GeminiChatSafetyRating {
+	ratings := make([]dto.GeminiChatSafetyRating, 0)
+	positions := make(map[string]int)
+	probabilityRank := []string{"NEGLIGIBLE", "LOW", "MEDIUM", "HIGH"}
+	for _, category := range azureSafetyCategories {
+		result, ok := results[category.azure]
+		if !ok {
+			continue
+		}
+		probability, ok := azureSeverityProbability[strings.ToLower(result.Severity)]
+		if !ok {
+			continue
+		}
+		rating := dto.GeminiChatSafetyRating{
+			Category:    category.gemini,
+			Probability: probability,
+			Blocked:     result.Filtered,
+		}
+		position, exists := positions[category.gemini]
+		if !exists {
+			positions[category.gemini] = len(ratings)
+			ratings = append(ratings, rating)
+			continue
+		}
+		if lo.IndexOf(probabilityRank, probability) > lo.IndexOf(probabilityRank, ratings[position].Probability) {
+			ratings[position].Probability = probability
+		}
+		ratings[position].Blocked = ratings[position].Blocked || rating.Blocked
+	}
+	return ratings
+}
+
 // ResponseOpenAI2Gemini 将 OpenAI 响应转换为 Gemini 格式
 func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.GeminiChatResponse {
 	geminiResponse := &dto.GeminiChatResponse{
-		Candidates: make([]dto.GeminiChatCandidate, 0, len(openAIResponse.Choices)),
-		UsageMetadata: dto.GeminiUsageMetadata{
-			PromptTokenCount:     openAIResponse.PromptTokens,
-			CandidatesTokenCount: openAIResponse.CompletionTokens,
-			TotalTokenCount:      openAIResponse.PromptTokens + openAIResponse.CompletionTokens,
-		},
+		Candidates:    make([]dto.GeminiChatCandidate, 0, len(openAIResponse.Choices)),
+		UsageMetadata: geminiUsageMetadataFromOpenAI(&openAIResponse.Usage),
+		ModelVersion:  openAIResponse.Model,
+		ResponseId:    openAIResponse.Id,
 	}
+	includeThoughts := geminiIncludeThoughts(info)
 
 	for _, choice := range openAIResponse.Choices {
+		finishReason := reasonmap.OpenAIFinishReasonToGeminiFinishReason(choice.FinishReason)
 		candidate := dto.GeminiChatCandidate{
 			Index:         int64(choice.Index),
-			SafetyRatings: []dto.GeminiChatSafetyRating{},
-		}
-
-		// 设置结束原因
-		var finishReason string
-		switch choice.FinishReason {
-		case "stop":
-			finishReason = "STOP"
-		case "length":
-			finishReason = "MAX_TOKENS"
-		case "content_filter":
-			finishReason = "SAFETY"
-		case "tool_calls":
-			finishReason = "STOP"
-		default:
-			finishReason = "STOP"
+			FinishReason:  &finishReason,
+			SafetyRatings: geminiSafetyRatings(choice.ContentFilterResults),
 		}
-		candidate.FinishReason = &finishReason
 
-		// 转换消息内容
+		// 转换消息内容，顺序为思考、文本、工具调用
 		content := dto.GeminiChatContent{
 			Role:  "model",
 			Parts: make([]dto.GeminiPart, 0),
 		}
-
-		// 处理工具调用
-		toolCalls := choice.Message.ParseToolCalls()
-		if len(toolCalls) > 0 {
-			for _, toolCall := range toolCalls {
-				// 解析参数
-				var args map[string]interface{}
-				if toolCall.Function.Arguments != "" {
-					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-						args = map[string]interface{}{"arguments": toolCall.Function.Arguments}
-					}
-				} else {
-					args = make(map[string]interface{})
-				}
-
-				part := dto.GeminiPart{
-					FunctionCall: &dto.FunctionCall{
-						FunctionName: toolCall.Function.Name,
-						Arguments:    args,
-					},
-				}
-				content.Parts = append(content.Parts, part)
+		if includeThoughts {
+			reasoningContent := choice.Message.ReasoningContent
+			if reasoningContent == "" {
+				reasoningContent = choice.Message.Reasoning
 			}
-		} else {
-			// 处理文本内容
-			textContent := choice.Message.StringContent()
-			if textContent != "" {
-				part := dto.GeminiPart{
-					Text: textContent,
-				}
-				content.Parts = append(content.Parts, part)
+			if reasoningContent != "" {
+				content.Parts = append(content.Parts, dto.GeminiPart{Text: reasoningContent, Thought: true})
 			}
 		}
+		if textContent := choice.Message.StringContent(); textContent != "" {
+			content.Parts = append(content.Parts, dto.GeminiPart{Text: textContent})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			content.Parts = append(content.Parts, dto.GeminiPart{
+				FunctionCall: &dto.FunctionCall{
+					ID:           toolCall.ID,
+					FunctionName: toolCall.Function.Name,
+					Arguments:    geminiFunctionArgs(toolCall.Function.Arguments),
+				},
+			})
+		}
 
 		candidate.Content = content
 		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
@@ -880,105 +1184,139 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 	return geminiResponse
 }
 
-// StreamResponseOpenAI2Gemini 将 OpenAI 流式响应转换为 Gemini 格式
+// StreamResponseOpenAI2Gemini 将 OpenAI 流式响应转换为 Gemini 格式。
+// 文本与思考内容即时输出；工具调用参数分片累积，与结束原因、usage 一起由 FinishGeminiStream 输出
 func StreamResponseOpenAI2Gemini(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) *dto.GeminiChatResponse {
-	// 检查是否有实际内容或结束标志
-	hasContent := false
-	hasFinishReason := false
+	if info.GeminiConvertInfo == nil {
+		info.GeminiConvertInfo = &relaycommon.GeminiConvertInfo{}
+	}
+	convertInfo := info.GeminiConvertInfo
+	if convertInfo.FinishReasons == nil {
+		convertInfo.FinishReasons = make(map[int]string)
+	}
+	if openAIResponse.Id != "" {
+		convertInfo.ResponseId = openAIResponse.Id
+	}
+	includeThoughts := geminiIncludeThoughts(info)
+
+	candidates := make([]dto.GeminiChatCandidate, 0, len(openAIResponse.Choices))
 	for _, choice := range openAIResponse.Choices {
-		if len(choice.Delta.GetContentString()) > 0 || (choice.Delta.ToolCalls != nil && len(choice.Delta.ToolCalls) > 0) {
-			hasContent = true
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			convertInfo.FinishReasons[choice.Index] = *choice.FinishReason
 		}
-		if choice.FinishReason != nil {
-			hasFinishReason = true
+		for i, toolCall := range choice.Delta.ToolCalls {
+			accumulateGeminiToolCall(convertInfo, choice.Index, i, toolCall)
 		}
-	}
 
-	// 如果没有实际内容且没有结束标志，跳过。主要针对 openai 流响应开头的空数据
-	if !hasContent && !hasFinishReason {
+		parts := make([]dto.GeminiPart, 0)
+		if reasoningContent := choice.Delta.GetReasoningContent(); includeThoughts && reasoningContent != "" {
+			parts = append(parts, dto.GeminiPart{Text: reasoningContent, Thought: true})
+		}
+		if textContent := choice.Delta.GetContentString(); textContent != "" {
+			parts = append(parts, dto.GeminiPart{Text: textContent})
+		}
+		// 没有实际内容时跳过，主要针对 openai 流响应开头的空数据
+		if len(parts) == 0 {
+			continue
+		}
+		candidates = append(candidates, dto.GeminiChatCandidate{
+			Index:         int64(choice.Index),
+			SafetyRatings: geminiSafetyRatings(choice.ContentFilterResults),
+			Content: dto.GeminiChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+		})
+	}
+	if len(candidates) == 0 {
 		return nil
 	}
 
-	geminiResponse := &dto.GeminiChatResponse{
-		Candidates: make([]dto.GeminiChatCandidate, 0, len(openAIResponse.Choices)),
+	return &dto.GeminiChatResponse{
+		Candidates: candidates,
 		UsageMetadata: dto.GeminiUsageMetadata{
-			PromptTokenCount:     info.GetEstimatePromptTokens(),
-			CandidatesTokenCount: 0, // 流式响应中可能没有完整的 usage 信息
-			TotalTokenCount:      info.GetEstimatePromptTokens(),
+			PromptTokenCount: info.GetEstimatePromptTokens(),
+			TotalTokenCount:  info.GetEstimatePromptTokens(),
 		},
+		ModelVersion: info.UpstreamModelName,
+		ResponseId:   convertInfo.ResponseId,
 	}
+}
 
-	if openAIResponse.Usage != nil {
-		geminiResponse.UsageMetadata.PromptTokenCount = openAIResponse.Usage.PromptTokens
-		geminiResponse.UsageMetadata.CandidatesTokenCount = openAIResponse.Usage.CompletionTokens
-		geminiResponse.UsageMetadata.TotalTokenCount = openAIResponse.Usage.TotalTokens
+func accumulateGeminiToolCall(convertInfo *relaycommon.GeminiConvertInfo, candidate int, position int, toolCall dto.ToolCallResponse) {
+	index := position
+	if toolCall.Index != nil {
+		index = *toolCall.Index
 	}
+	state, ok := lo.Find(convertInfo.ToolCalls, func(state *relaycommon.GeminiToolCallState) bool {
+		return state.Candidate == candidate && state.Index == index
+	})
+	if !ok {
+		state = &relaycommon.GeminiToolCallState{Candidate: candidate, Index: index}
+		convertInfo.ToolCalls = append(convertInfo.ToolCalls, state)
+	}
+	if toolCall.ID != "" {
+		state.ID = toolCall.ID
+	}
+	if toolCall.Function.Name != "" {
+		state.Name = toolCall.Function.Name
+	}
+	state.Arguments += toolCall.Function.Arguments
+}
 
-	for _, choice := range openAIResponse.Choices {
-		candidate := dto.GeminiChatCandidate{
-			Index:         int64(choice.Index),
-			SafetyRatings: []dto.GeminiChatSafetyRating{},
-		}
-
-		// 设置结束原因
-		if choice.FinishReason != nil {
-			var finishReason string
-			switch *choice.FinishReason {
-			case "stop":
-				finishReason = "STOP"
-			case "length":
-				finishReason = "MAX_TOKENS"
-			case "content_filter":
-				finishReason = "SAFETY"
-			case "tool_calls":
-				finishReason = "STOP"
-			default:
-				finishReason = "STOP"
-			}
-			candidate.FinishReason = &finishReason
-		}
-
-		// 转换消息内容
-		content := dto.GeminiChatContent{
-			Role:  "model",
-			Parts: make([]dto.GeminiPart, 0),
-		}
+// FinishGeminiStream 上游流结束后输出最后一个响应：累积的工具调用、结束原因与最终 usage
+func FinishGeminiStream(info *relaycommon.RelayInfo, usage *dto.Usage) *dto.GeminiChatResponse {
+	if info.GeminiConvertInfo == nil {
+		info.GeminiConvertInfo = &relaycommon.GeminiConvertInfo{}
+	}
+	convertInfo := info.GeminiConvertInfo
+	if convertInfo.Done {
+		return nil
+	}
+	convertInfo.Done = true
 
-		// 处理工具调用
-		if choice.Delta.ToolCalls != nil {
-			for _, toolCall := range choice.Delta.ToolCalls {
-				// 解析参数
-				var args map[string]interface{}
-				if toolCall.Function.Arguments != "" {
-					if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-						args = map[string]interface{}{"arguments": toolCall.Function.Arguments}
-					}
-				} else {
-					args = make(map[string]interface{})
-				}
+	indexes := lo.Keys(convertInfo.FinishReasons)
+	for _, state := range convertInfo.ToolCalls {
+		indexes = append(indexes, state.Candidate)
+	}
+	indexes = lo.Uniq(indexes)
+	if len(indexes) == 0 {
+		indexes = []int{0}
+	}
+	sort.Ints(indexes)
 
-				part := dto.GeminiPart{
-					FunctionCall: &dto.FunctionCall{
-						FunctionName: toolCall.Function.Name,
-						Arguments:    args,
-					},
-				}
-				content.Parts = append(content.Parts, part)
-			}
-		} else {
-			// 处理文本内容
-			textContent := choice.Delta.GetContentString()
-			if textContent != "" {
-				part := dto.GeminiPart{
-					Text: textContent,
-				}
-				content.Parts = append(content.Parts, part)
+	geminiResponse := &dto.GeminiChatResponse{
+		Candidates:   make([]dto.GeminiChatCandidate, 0, len(indexes)),
+		ModelVersion: info.UpstreamModelName,
+		ResponseId:   convertInfo.ResponseId,
+	}
+	if usage != nil {
+		geminiResponse.UsageMetadata = geminiUsageMetadataFromOpenAI(usage)
+	}
+	for _, index := range indexes {
+		parts := make([]dto.GeminiPart, 0)
+		for _, state := range convertInfo.ToolCalls {
+			if state.Candidate != index {
+				continue
 			}
+			parts = append(parts, dto.GeminiPart{
+				FunctionCall: &dto.FunctionCall{
+					ID:           state.ID,
+					FunctionName: state.Name,
+					Arguments:    geminiFunctionArgs(state.Arguments),
+				},
+			})
 		}
-
-		candidate.Content = content
-		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
+		finishReason := reasonmap.OpenAIFinishReasonToGeminiFinishReason(convertInfo.FinishReasons[index])
+		geminiResponse.Candidates = append(geminiResponse.Candidates, dto.GeminiChatCandidate{
+			Index:         int64(index),
+			FinishReason:  &finishReason,
+			SafetyRatings: []dto.GeminiChatSafetyRating{},
+			Content: dto.GeminiChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+		})
 	}
-
 	return geminiResponse
 }
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalcCountTokensQuota 计算 token 计数接口单次调用的额度，price 为美元单价
+func CalcCountTokensQuota(price, groupRatio float64) int {
+	if price <= 0 || groupRatio <= 0 {
+		return 0
+	}
+	return int(decimal.NewFromFloat(price).
+		Mul(decimal.NewFromFloat(common.QuotaPerUnit)).
+		Mul(decimal.NewFromFloat(groupRatio)).
+		Round(0).
+		IntPart())
+}
+
+// PostCountTokensConsumeQuota 结算 token 计数接口的按次费用并记录消费日志
+func PostCountTokensConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, quota int, inputTokens int, upstream bool) {
+	if err := SettleBilling(ctx, relayInfo, quota); err != nil {
+		logger.LogError(ctx, "error settling count tokens billing: "+err.Error())
+	}
+	model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+
+	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+	other := map[string]any{
+		"count_tokens":          true,
+		"count_tokens_upstream": upstream,
+		"model_price":           relayInfo.PriceData.ModelPrice,
+		"group_ratio":           groupRatio,
+	}
+	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
+	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId:      relayInfo.ChannelId,
+		PromptTokens:   inputTokens,
+		ModelName:      relayInfo.OriginModelName,
+		TokenName:      ctx.GetString("token_name"),
+		Quota:          quota,
+		Content:        fmt.Sprintf("token 计数，模型价格 %.4f，分组倍率 %.2f", relayInfo.PriceData.ModelPrice, groupRatio),
+		TokenId:        relayInfo.TokenId,
+		UseTimeSeconds: int(useTimeSeconds),
+		Group:          relayInfo.UsingGroup,
+		Other:          other,
+	})
+}
@@ -7,12 +7,12 @@ import (
 )
 
 // ---------------------------------------------------------------------------
-// FundingSource — 资金来源接口（钱包 or 订阅）
+// FundingSource — 资金来源接口（钱包 / 订阅 / 后付费）
 // ---------------------------------------------------------------------------
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "postpaid"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -63,6 +63,30 @@ func (w *WalletFunding) Refund() error {
 	return model.IncreaseUserQuota(w.userId, w.consumed, false)
 }
 
+// ---------------------------------------------------------------------------
+// PostpaidFunding — 后付费资金来源实现
+// ---------------------------------------------------------------------------
+
+// PostpaidFunding 与钱包共用用户余额，但允许余额透支到 -creditLimit。
+// 预扣时原子检查授信额度，结算补扣可能超出，超限处理见 checkPostpaidCreditLimit。
+type PostpaidFunding struct {
+	WalletFunding
+	creditLimit int
+}
+
+func (p *PostpaidFunding) Source() string { return BillingSourcePostpaid }
+
+func (p *PostpaidFunding) PreConsume(amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	if err := model.DecreasePostpaidUserQuota(p.userId, amount, p.creditLimit); err != nil {
+		return err
+	}
+	p.consumed = amount
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // SubscriptionFunding — 订阅资金来源实现
 // ---------------------------------------------------------------------------
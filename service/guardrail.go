@@ -0,0 +1,599 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultGuardrailReplacement = "[REDACTED]"
+
+const defaultGuardrailJudgePrompt = "You are a content safety classifier. Decide whether the user content violates content safety policy. " +
+	"Reply with SAFE, or UNSAFE followed by a short category name. Do not reply with anything else."
+
+// guardrailSkipKeys 这些字段是协议结构而非用户内容，不参与检测与脱敏
+var guardrailSkipKeys = map[string]bool{
+	"model": true, "role": true, "type": true, "id": true, "name": true, "object": true,
+	"tool_call_id": true, "call_id": true, "previous_response_id": true,
+	"finish_reason": true, "stop_reason": true, "status": true, "system_fingerprint": true, "service_tier": true,
+	"url": true, "image_url": true, "file_id": true, "data": true, "b64_json": true, "embedding": true,
+	"mime_type": true, "media_type": true, "format": true, "detail": true, "signature": true,
+	"encoding_format": true, "voice": true, "response_format": true, "tool_choice": true, "reasoning_effort": true,
+}
+
+// GuardrailSession 单个请求的内容安全检测会话
+type GuardrailSession struct {
+	PolicyName string
+	Policy     *operation_setting.GuardrailPolicy
+	Violations []types.GuardrailViolation
+
+	// 可逆脱敏的占位符与原文，仅保存在内存中，不记录日志
+	placeholders *guardrailPlaceholders
+}
+
+// NewGuardrailSession 根据令牌与分组确定检测策略，未启用或无需检测时返回 nil
+func NewGuardrailSession(tokenId int, tokenKey string, group string) *GuardrailSession {
+	guardrailSetting := operation_setting.GetGuardrailSetting()
+	if !guardrailSetting.Enabled {
+		return nil
+	}
+	// 判定模型的请求经由网关自身转发，跳过以免递归检测
+	if judgeKey := strings.TrimPrefix(guardrailSetting.JudgeApiKey, "sk-"); judgeKey != "" && judgeKey == tokenKey {
+		return nil
+	}
+	name, policy := guardrailSetting.ResolvePolicy(tokenId, group)
+	if policy == nil {
+		return nil
+	}
+	return &GuardrailSession{PolicyName: name, Policy: policy}
+}
+
+// NewSensitiveWordsOutputGuardrail 未启用内容安全流水线时，按敏感词设置检测输出内容：
+// 开启 StopOnSensitiveEnabled 时拦截，否则替换敏感词后继续输出
+func NewSensitiveWordsOutputGuardrail() *GuardrailSession {
+	stage := operation_setting.GuardrailStage{
+		Name:        "sensitive_words",
+		Type:        operation_setting.GuardrailStageKeyword,
+		Phase:       operation_setting.GuardrailPhaseOutput,
+		Action:      operation_setting.GuardrailActionRedact,
+		Replacement: "**###**",
+	}
+	if setting.StopOnSensitiveEnabled {
+		stage.Action = operation_setting.GuardrailActionBlock
+	}
+	return &GuardrailSession{
+		PolicyName: "sensitive_words",
+		Policy:     &operation_setting.GuardrailPolicy{Stages: []operation_setting.GuardrailStage{stage}},
+	}
+}
+
+// HasPhase 策略中是否有作用于指定方向的阶段
+func (s *GuardrailSession) HasPhase(phase string) bool {
+	if s == nil {
+		return false
+	}
+	for i := range s.Policy.Stages {
+		if s.Policy.Stages[i].AppliesTo(phase) {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsOutput 是否需要处理响应：存在输出阶段，或需要还原可逆脱敏的占位符
+func (s *GuardrailSession) NeedsOutput() bool {
+	return s.HasPhase(operation_setting.GuardrailPhaseOutput) || s.NeedsRestore()
+}
+
+// PhaseViolations 返回指定方向的命中记录
+func (s *GuardrailSession) PhaseViolations(phase string) []types.GuardrailViolation {
+	var violations []types.GuardrailViolation
+	for _, v := range s.Violations {
+		if v.Phase == phase {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+type guardrailSpan struct {
+	start int
+	end   int
+	label string
+}
+
+// CheckTexts 依次执行作用于 phase 的阶段。canRedact 为 false 时（如无法改写的请求体）脱敏按拦截处理。
+// 返回处理后的文本、是否有改动以及拦截的阶段（未拦截时为 nil）
+func (s *GuardrailSession) CheckTexts(ctx context.Context, phase string, texts []string, canRedact bool) ([]string, bool, *types.GuardrailViolation) {
+	texts = append([]string(nil), texts...)
+	changed := false
+	for i := range s.Policy.Stages {
+		stage := &s.Policy.Stages[i]
+		// 提示词注入检测需要区分消息来源，由 CheckInjection 处理
+		if !stage.AppliesTo(phase) || stage.Type == operation_setting.GuardrailStagePromptInjection {
+			continue
+		}
+		violation := types.GuardrailViolation{
+			Policy: s.PolicyName,
+			Stage:  stage.Name,
+			Type:   stage.Type,
+			Phase:  phase,
+			Action: stage.Action,
+		}
+		if stage.Type == operation_setting.GuardrailStageLLMJudge {
+			violated, labels, err := guardrailJudge(ctx, stage, strings.Join(texts, "\n"))
+			if err != nil {
+				common.SysError(fmt.Sprintf("guardrail judge %s failed: %s", stage.Name, err.Error()))
+				if !stage.FailClosed {
+					continue
+				}
+				violated, violation.Reason = true, "judge unavailable"
+			}
+			if !violated {
+				continue
+			}
+			violation.Labels = labels
+		} else {
+			hit := false
+			labels := map[string]bool{}
+			for j, text := range texts {
+				spans := matchGuardrailStage(stage, text)
+				if len(spans) == 0 {
+					continue
+				}
+				hit = true
+				for _, span := range spans {
+					labels[span.label] = true
+				}
+				if stage.Action == operation_setting.GuardrailActionRedact && canRedact {
+					texts[j] = s.redactSpans(text, spans, stage, phase)
+					changed = true
+				}
+			}
+			if !hit {
+				continue
+			}
+			violation.Labels = sortedKeys(labels)
+		}
+		if stage.Action == operation_setting.GuardrailActionBlock ||
+			(stage.Action == operation_setting.GuardrailActionRedact && !canRedact) {
+			violation.Action = operation_setting.GuardrailActionBlock
+			s.Violations = append(s.Violations, violation)
+			return texts, changed, &s.Violations[len(s.Violations)-1]
+		}
+		s.Violations = append(s.Violations, violation)
+	}
+	return texts, changed, nil
+}
+
+// CheckJSON 对 JSON 文档中的用户内容字符串执行检测，脱敏时原地替换字符串值，其余内容保持不变
+func (s *GuardrailSession) CheckJSON(ctx context.Context, phase string, body []byte) ([]byte, bool, *types.GuardrailViolation, error) {
+	leaves, err := collectJSONStringLeaves(body)
+	if err != nil {
+		return body, false, nil, err
+	}
+	texts := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		texts[i] = leaf.value
+	}
+	result, changed, blocked := s.CheckTexts(ctx, phase, texts, true)
+	if blocked != nil || !changed {
+		return body, false, blocked, nil
+	}
+	newBody, err := spliceJSONLeaves(body, leaves, result)
+	if err != nil {
+		return body, false, nil, err
+	}
+	return newBody, true, nil, nil
+}
+
+// spliceJSONLeaves 将有改动的字符串值写回原文，其余内容保持不变
+func spliceJSONLeaves(body []byte, leaves []jsonStringLeaf, values []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(body))
+	last := 0
+	for i, leaf := range leaves {
+		if values[i] == leaf.value {
+			continue
+		}
+		encoded, err := common.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(body[last:leaf.start])
+		buf.Write(encoded)
+		last = leaf.end
+	}
+	buf.Write(body[last:])
+	return buf.Bytes(), nil
+}
+
+type jsonStringLeaf struct {
+	start int
+	end   int
+	value string
+}
+
+type jsonFrame struct {
+	isObject  bool
+	expectKey bool
+	key       string
+}
+
+// collectJSONStringLeaves 按出现顺序收集需要检测的字符串值及其在原文中的字节范围
+func collectJSONStringLeaves(body []byte) ([]jsonStringLeaf, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var stack []*jsonFrame
+	var leaves []jsonStringLeaf
+	// 当前值所属的字段名，数组元素沿用外层对象的字段名
+	currentKey := func() string {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].isObject {
+				return stack[i].key
+			}
+		}
+		return ""
+	}
+	valueDone := func() {
+		if len(stack) > 0 && stack[len(stack)-1].isObject {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, &jsonFrame{isObject: true, expectKey: true})
+			case '[':
+				stack = append(stack, &jsonFrame{})
+			default:
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+		case string:
+			if len(stack) > 0 && stack[len(stack)-1].isObject && stack[len(stack)-1].expectKey {
+				stack[len(stack)-1].key = t
+				stack[len(stack)-1].expectKey = false
+				continue
+			}
+			key := currentKey()
+			if t != "" && !guardrailSkipKeys[key] && !strings.HasPrefix(t, "data:") {
+				start := bytes.IndexByte(body[offset:], '"')
+				if start < 0 {
+					return nil, errors.New("unexpected json string position")
+				}
+				leaves = append(leaves, jsonStringLeaf{start: offset + start, end: int(decoder.InputOffset()), value: t})
+			}
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+	return leaves, nil
+}
+
+// RecordGuardrailViolations 记录无法随消费日志保存的命中：请求被拦截，或对模型输出的检测结果
+func RecordGuardrailViolations(c *gin.Context, relayInfo *relaycommon.RelayInfo, violations []types.GuardrailViolation, blocked *types.GuardrailViolation) {
+	if len(violations) == 0 {
+		return
+	}
+	var content string
+	if blocked != nil {
+		content = fmt.Sprintf("内容安全策略 %s 的阶段 %s 拦截了%s", blocked.Policy, blocked.Stage, guardrailPhaseName(blocked.Phase))
+	} else {
+		content = fmt.Sprintf("内容安全策略 %s 命中%s", violations[0].Policy, guardrailPhaseName(violations[0].Phase))
+	}
+	other := map[string]interface{}{"guardrail": violations}
+	appendRequestPath(c, relayInfo, other)
+	model.RecordGuardrailLog(c, relayInfo.UserId, relayInfo.OriginModelName, c.GetString("token_name"), relayInfo.TokenId, relayInfo.UsingGroup, content, other)
+}
+
+func guardrailPhaseName(phase string) string {
+	if phase == operation_setting.GuardrailPhaseOutput {
+		return "模型输出"
+	}
+	return "请求内容"
+}
+
+// guardrailMatchers 缓存编译后的正则表达式
+var guardrailMatchers sync.Map
+
+func compileGuardrailPattern(pattern string) *regexp.Regexp {
+	if cached, ok := guardrailMatchers.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid guardrail pattern %q: %s", pattern, err.Error()))
+		re = nil
+	}
+	guardrailMatchers.Store(pattern, re)
+	return re
+}
+
+func matchGuardrailStage(stage *operation_setting.GuardrailStage, text string) []guardrailSpan {
+	if text == "" {
+		return nil
+	}
+	var spans []guardrailSpan
+	switch stage.Type {
+	case operation_setting.GuardrailStageKeyword:
+		words := stage.Patterns
+		if len(words) == 0 {
+			words = setting.SensitiveWords
+		}
+		spans = matchKeywords(text, words)
+	case operation_setting.GuardrailStageRegex:
+		for _, pattern := range stage.Patterns {
+			re := compileGuardrailPattern(pattern)
+			if re == nil {
+				continue
+			}
+			for _, loc := range re.FindAllStringIndex(text, -1) {
+				if loc[1] > loc[0] {
+					spans = append(spans, guardrailSpan{start: loc[0], end: loc[1], label: pattern})
+				}
+			}
+		}
+	case operation_setting.GuardrailStagePII:
+		for _, m := range DetectPII(text, stage.PiiTypes, stage.Locales) {
+			spans = append(spans, guardrailSpan{start: m.Start, end: m.End, label: m.Type})
+		}
+	}
+	return spans
+}
+
+// matchKeywords 忽略大小写匹配关键词，逐字符转小写以保证位置与原文一致
+func matchKeywords(text string, words []string) []guardrailSpan {
+	dict := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			dict = append(dict, word)
+		}
+	}
+	m := getOrBuildAC(dict)
+	if m == nil {
+		return nil
+	}
+	runes := []rune(strings.Map(unicode.ToLower, text))
+	hits := m.MultiPatternSearch(runes, false)
+	if len(hits) == 0 {
+		return nil
+	}
+	// rune 下标转字节偏移
+	offsets := make([]int, 0, len(runes)+1)
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(text))
+	spans := make([]guardrailSpan, 0, len(hits))
+	for _, hit := range hits {
+		end := hit.Pos + len(hit.Word)
+		if hit.Pos < 0 || end >= len(offsets) {
+			continue
+		}
+		spans = append(spans, guardrailSpan{start: offsets[hit.Pos], end: offsets[end], label: string(hit.Word)})
+	}
+	return spans
+}
+
+func (s *GuardrailSession) redactSpans(text string, spans []guardrailSpan, stage *operation_setting.GuardrailStage, phase string) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var builder strings.Builder
+	builder.Grow(len(text))
+	last := 0
+	for _, span := range spans {
+		if span.start < last {
+			// 与上一处重叠，合并到上一处替换
+			if span.end > last {
+				last = span.end
+			}
+			continue
+		}
+		builder.WriteString(text[last:span.start])
+		if stage.Reversible && phase == operation_setting.GuardrailPhaseInput {
+			builder.WriteString(s.placeholder(stage, span.label, text[span.start:span.end]))
+		} else {
+			builder.WriteString(guardrailReplacement(stage, span.label))
+		}
+		last = span.end
+	}
+	builder.WriteString(text[last:])
+	return builder.String()
+}
+
+func guardrailReplacement(stage *operation_setting.GuardrailStage, label string) string {
+	if stage.Replacement != "" {
+		return stage.Replacement
+	}
+	if stage.Type == operation_setting.GuardrailStagePII {
+		return "[" + strings.ToUpper(label) + "]"
+	}
+	return defaultGuardrailReplacement
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// guardrailJudge 调用判定模型，测试时可替换
+var guardrailJudge = callGuardrailJudge
+
+func guardrailJudgeBaseURL(guardrailSetting *operation_setting.GuardrailSetting) string {
+	if guardrailSetting.JudgeBaseURL != "" {
+		return strings.TrimRight(guardrailSetting.JudgeBaseURL, "/")
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", *common.Port)
+}
+
+// callGuardrailJudge 通过网关自身调用审核或分类模型，返回是否违规及违规类别
+func callGuardrailJudge(ctx context.Context, stage *operation_setting.GuardrailStage, text string) (bool, []string, error) {
+	guardrailSetting := operation_setting.GetGuardrailSetting()
+	if guardrailSetting.JudgeApiKey == "" {
+		return false, nil, errors.New("judge api key is not configured")
+	}
+	if strings.TrimSpace(text) == "" {
+		return false, nil, nil
+	}
+	if maxChars := guardrailSetting.JudgeMaxChars; maxChars > 0 {
+		if runes := []rune(text); len(runes) > maxChars {
+			text = string(runes[:maxChars])
+		}
+	}
+	timeout := time.Duration(guardrailSetting.JudgeTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var path string
+	var payload any
+	if stage.JudgeMode == operation_setting.GuardrailJudgeModeClassifier {
+		prompt := stage.JudgePrompt
+		if prompt == "" {
+			prompt = defaultGuardrailJudgePrompt
+		}
+		path = "/v1/chat/completions"
+		payload = map[string]any{
+			"model": stage.JudgeModel,
+			"messages": []map[string]string{
+				{"role": "system", "content": prompt},
+				{"role": "user", "content": text},
+			},
+			"temperature": 0,
+			"max_tokens":  20,
+			"stream":      false,
+		}
+	} else {
+		path = "/v1/moderations"
+		payload = map[string]any{"model": stage.JudgeModel, "input": text}
+	}
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return false, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, guardrailJudgeBaseURL(guardrailSetting)+path, bytes.NewReader(body))
+	if err != nil {
+		return false, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+guardrailSetting.JudgeApiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("judge returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if stage.JudgeMode == operation_setting.GuardrailJudgeModeClassifier {
+		return parseClassifierVerdict(respBody)
+	}
+	return parseModerationVerdict(respBody, stage.JudgeCategories)
+}
+
+func parseModerationVerdict(body []byte, categories []string) (bool, []string, error) {
+	var result struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := common.Unmarshal(body, &result); err != nil {
+		return false, nil, err
+	}
+	labels := map[string]bool{}
+	violated := false
+	for _, r := range result.Results {
+		for category, flagged := range r.Categories {
+			if flagged && (len(categories) == 0 || containsFold(categories, category)) {
+				labels[category] = true
+				violated = true
+			}
+		}
+		if r.Flagged && len(categories) == 0 {
+			violated = true
+		}
+	}
+	return violated, sortedKeys(labels), nil
+}
+
+func parseClassifierVerdict(body []byte) (bool, []string, error) {
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := common.Unmarshal(body, &result); err != nil {
+		return false, nil, err
+	}
+	if len(result.Choices) == 0 {
+		return false, nil, errors.New("judge returned no choices")
+	}
+	fields := strings.Fields(result.Choices[0].Message.Content)
+	if len(fields) == 0 {
+		return false, nil, errors.New("judge returned empty verdict")
+	}
+	verdict := strings.ToUpper(strings.Trim(fields[0], ".,:;"))
+	switch verdict {
+	case "SAFE":
+		return false, nil, nil
+	case "UNSAFE":
+		var labels []string
+		if len(fields) > 1 {
+			labels = []string{strings.Trim(strings.Join(fields[1:], " "), ".,:; ")}
+		}
+		return true, labels, nil
+	}
+	return false, nil, fmt.Errorf("unexpected judge verdict: %s", fields[0])
+}
+
+func containsFold(list []string, target string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// PiiMatch 文本中检测到的一处个人敏感信息，Start/End 为字节偏移
+type PiiMatch struct {
+	Type  string
+	Start int
+	End   int
+}
+
+type piiDetector struct {
+	piiType string
+	// locale 为空表示与地区无关
+	locale  string
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+// 检测顺序即优先级，位置重叠时保留先检测到的类型
+var piiDetectors = []piiDetector{
+	{piiType: "api_key", pattern: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_\-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abposr]-[A-Za-z0-9\-]{10,}|AIza[0-9A-Za-z_\-]{35})`)},
+	{piiType: "email", pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)},
+	{piiType: "id_card", locale: "cn", pattern: regexp.MustCompile(`\b[1-9]\d{16}[\dXx]\b`), valid: validChineseIdCard},
+	{piiType: "id_card", locale: "us", pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), valid: validUSSocialSecurityNumber},
+	{piiType: "phone", locale: "cn", pattern: regexp.MustCompile(`(?:\+?86[ \-]?)?\b1[3-9]\d{9}\b`)},
+	{piiType: "phone", locale: "intl", pattern: regexp.MustCompile(`\+[1-9]\d{0,2}[ \-]?\(?\d{1,4}\)?(?:[ \-]?\d{2,4}){2,4}\b`)},
+	{piiType: "phone", locale: "us", pattern: regexp.MustCompile(`(?:\(\b[2-9]\d{2}\)[ \-.]?|\b[2-9]\d{2}[ \-.])\d{3}[ \-.]\d{4}\b`)},
+	{piiType: "credit_card", pattern: regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`), valid: validLuhn},
+	{piiType: "ipv4", pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)},
+}
+
+func digitsOf(s string) []int {
+	digits := make([]int, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	return digits
+}
+
+func validLuhn(match string) bool {
+	digits := digitsOf(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func validChineseIdCard(match string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checkCodes := "10X98765432"
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(match[i]-'0') * weights[i]
+	}
+	return checkCodes[sum%11] == strings.ToUpper(match[17:])[0]
+}
+
+// validUSSocialSecurityNumber 排除不会发放的号段（000、666、9xx 开头，组号 00，序号 0000）
+func validUSSocialSecurityNumber(match string) bool {
+	area, group, serial := match[0:3], match[4:6], match[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// DetectPII 检测文本中的个人敏感信息，piiTypes 为空时检测全部类型，locales 为空时检测全部地区的格式。
+// 返回的匹配按位置排序且互不重叠
+func DetectPII(text string, piiTypes []string, locales []string) []PiiMatch {
+	if text == "" {
+		return nil
+	}
+	var matches []PiiMatch
+	for _, detector := range piiDetectors {
+		if len(piiTypes) > 0 && !lo.Contains(piiTypes, detector.piiType) {
+			continue
+		}
+		if detector.locale != "" && len(locales) > 0 && !lo.Contains(locales, detector.locale) {
+			continue
+		}
+		for _, loc := range detector.pattern.FindAllStringIndex(text, -1) {
+			if detector.valid != nil && !detector.valid(text[loc[0]:loc[1]]) {
+				continue
+			}
+			overlapped := false
+			for _, m := range matches {
+				if loc[0] < m.End && m.Start < loc[1] {
+					overlapped = true
+					break
+				}
+			}
+			if !overlapped {
+				matches = append(matches, PiiMatch{Type: detector.piiType, Start: loc[0], End: loc[1]})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// guardrailPlaceholders 可逆脱敏的占位符。占位符按原文在请求中首次出现的顺序编号，
+// 多轮对话中重复发送的历史消息因此得到相同的占位符
+type guardrailPlaceholders struct {
+	// byValue 类型与原文 -> 占位符
+	byValue map[string]string
+	counts  map[string]int
+	// originals 需要在响应中还原的占位符 -> 原文
+	originals map[string]string
+}
+
+var guardrailPlaceholderPattern = regexp.MustCompile(`\[[A-Z][A-Z_]*_\d+\]`)
+
+// maxGuardrailPlaceholderLen 占位符的最大长度，流式输出的窗口不小于该长度
+const maxGuardrailPlaceholderLen = 32
+
+func (s *GuardrailSession) placeholder(stage *operation_setting.GuardrailStage, label string, original string) string {
+	if s.placeholders == nil {
+		s.placeholders = &guardrailPlaceholders{
+			byValue:   map[string]string{},
+			counts:    map[string]int{},
+			originals: map[string]string{},
+		}
+	}
+	p := s.placeholders
+	key := label + "\x00" + original
+	placeholder, ok := p.byValue[key]
+	if !ok {
+		p.counts[label]++
+		placeholder = fmt.Sprintf("[%s_%d]", strings.ToUpper(label), p.counts[label])
+		p.byValue[key] = placeholder
+	}
+	if stage.Restore {
+		p.originals[placeholder] = original
+	}
+	return placeholder
+}
+
+// NeedsRestore 请求中是否有需要在响应中还原的占位符
+func (s *GuardrailSession) NeedsRestore() bool {
+	return s != nil && s.placeholders != nil && len(s.placeholders.originals) > 0
+}
+
+// RestoreText 将文本中的占位符还原为原文，未知的占位符保持不变
+func (s *GuardrailSession) RestoreText(text string) string {
+	if !s.NeedsRestore() || !strings.Contains(text, "[") {
+		return text
+	}
+	return guardrailPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, ok := s.placeholders.originals[placeholder]; ok {
+			return original
+		}
+		return placeholder
+	})
+}
+
+// RestoreJSON 还原 JSON 文档字符串值中的占位符，其余内容保持不变
+func (s *GuardrailSession) RestoreJSON(body []byte) ([]byte, bool, error) {
+	leaves, err := collectJSONStringLeaves(body)
+	if err != nil {
+		return body, false, err
+	}
+	values := make([]string, len(leaves))
+	changed := false
+	for i, leaf := range leaves {
+		values[i] = s.RestoreText(leaf.value)
+		if values[i] != leaf.value {
+			changed = true
+		}
+	}
+	if !changed {
+		return body, false, nil
+	}
+	newBody, err := spliceJSONLeaves(body, leaves, values)
+	if err != nil {
+		return body, false, err
+	}
+	return newBody, true, nil
+}
@@ -0,0 +1,717 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// guardrailStreamJudgeMinText 流式输出中模型判定的最小批量（字节），积累到该长度或流结束时才调用判定模型
+const guardrailStreamJudgeMinText = 512
+
+const (
+	streamFormatOpenAI    = "openai"
+	streamFormatClaude    = "claude"
+	streamFormatGemini    = "gemini"
+	streamFormatResponses = "responses"
+)
+
+var claudeStreamEventTypes = map[string]bool{
+	"message_start": true, "message_delta": true, "message_stop": true, "ping": true,
+	"content_block_start": true, "content_block_delta": true, "content_block_stop": true,
+}
+
+// guardrailStreamPiece 上游数据块中的一段输出文本。scan 为 false 的文本（如思考内容）只用于统计已下发的 token
+type guardrailStreamPiece struct {
+	path string
+	text string
+	scan bool
+	// key Responses 输出文本所属的 item_id:content_index，用于同步 done/completed 事件中的完整文本
+	key string
+}
+
+type guardrailStreamChunk struct {
+	data   string
+	event  string
+	pieces []guardrailStreamPiece
+	dirty  bool
+	// judged 已经过模型判定，配置了输出阶段的模型判定时只下发已判定的数据块
+	judged bool
+}
+
+func (chunk *guardrailStreamChunk) hasScanText() bool {
+	for _, piece := range chunk.pieces {
+		if piece.scan && piece.text != "" {
+			return true
+		}
+	}
+	return false
+}
+
+type guardrailPieceRef struct {
+	chunk *guardrailStreamChunk
+	piece int
+	start int
+	end   int
+}
+
+// GuardrailStreamFilter 流式输出检测。上游数据按原格式进入滑动窗口，窗口内的文本经检测后才下发；
+// 命中脱敏时原地改写数据块中的文本，命中拦截时丢弃未下发的数据并由 Finish 生成对应格式的结束事件。
+// 下发前还原请求中可逆脱敏的占位符（仅文本与思考内容，不含工具调用参数）。
+// 模型判定阶段按批执行：未判定的文本积累到 guardrailStreamJudgeMinText 或流结束时判定，判定前的数据块不下发
+type GuardrailStreamFilter struct {
+	c         *gin.Context
+	session   *GuardrailSession
+	info      *relaycommon.RelayInfo
+	window    int
+	minChunks int
+	judges    []*operation_setting.GuardrailStage
+
+	queue     []*guardrailStreamChunk
+	format    string
+	stopped   bool
+	finished  bool
+	blocked   *types.GuardrailViolation
+	delivered strings.Builder
+	// 每个阶段在 session.Violations 中的位置，避免滑动窗口重复扫描时重复记录
+	violationIndex map[string]int
+
+	// 用于生成结束事件的上游状态
+	responseId      string
+	model           string
+	created         int64
+	promptTokens    int
+	claudeOpenBlock int
+	sequenceNumber  int64
+	responseRaw     string
+	responsesText   map[string]*strings.Builder
+	responsesEdited map[string]bool
+}
+
+// NewGuardrailStreamFilter 创建流式输出检测器，未配置输出阶段时返回 nil
+func NewGuardrailStreamFilter(c *gin.Context, session *GuardrailSession, info *relaycommon.RelayInfo) *GuardrailStreamFilter {
+	if !session.NeedsOutput() {
+		return nil
+	}
+	window := operation_setting.GetGuardrailSetting().StreamWindowSize
+	if window < 0 {
+		window = 0
+	}
+	// 保证窗口能容纳完整的占位符
+	if session.NeedsRestore() && window < maxGuardrailPlaceholderLen {
+		window = maxGuardrailPlaceholderLen
+	}
+	var judges []*operation_setting.GuardrailStage
+	for i := range session.Policy.Stages {
+		stage := &session.Policy.Stages[i]
+		if stage.Type == operation_setting.GuardrailStageLLMJudge && stage.AppliesTo(operation_setting.GuardrailPhaseOutput) {
+			judges = append(judges, stage)
+		}
+	}
+	return &GuardrailStreamFilter{
+		c:               c,
+		judges:          judges,
+		session:         session,
+		info:            info,
+		window:          window,
+		minChunks:       setting.StreamCacheQueueLength,
+		violationIndex:  map[string]int{},
+		claudeOpenBlock: -1,
+		responsesText:   map[string]*strings.Builder{},
+		responsesEdited: map[string]bool{},
+	}
+}
+
+// Push 接收一条上游数据，返回可以下发的数据；stop 为 true 时应终止流并下发 Finish 的结果
+func (f *GuardrailStreamFilter) Push(data string) ([]string, bool) {
+	if f.stopped {
+		return nil, true
+	}
+	f.queue = append(f.queue, f.parseChunk(data))
+	if blocked := f.scan(false); blocked != nil {
+		f.stop(blocked)
+		return nil, true
+	}
+	return f.release(false), false
+}
+
+// Flush 上游正常结束时检测并返回仍在窗口中的数据
+func (f *GuardrailStreamFilter) Flush() ([]string, bool) {
+	if f.stopped {
+		return nil, true
+	}
+	if blocked := f.scan(true); blocked != nil {
+		f.stop(blocked)
+		return nil, true
+	}
+	f.stopped = true
+	f.publish()
+	return f.release(true), false
+}
+
+// publish 将输出检测的命中写入 RelayInfo，随消费日志记录
+func (f *GuardrailStreamFilter) publish() {
+	f.info.GuardrailViolations = append(f.info.GuardrailViolations, f.session.PhaseViolations(operation_setting.GuardrailPhaseOutput)...)
+}
+
+// Blocked 返回终止流的命中，未拦截时返回 nil
+func (f *GuardrailStreamFilter) Blocked() *types.GuardrailViolation {
+	return f.blocked
+}
+
+// stop 丢弃窗口中未下发的数据，并标记拦截原因供消费日志记录
+func (f *GuardrailStreamFilter) stop(blocked *types.GuardrailViolation) {
+	violation := *blocked
+	f.stopped = true
+	f.blocked = &violation
+	f.queue = nil
+	f.publish()
+	if f.c != nil {
+		common.SetContextKey(f.c, constant.ContextKeyAdminRejectReason, fmt.Sprintf("guardrail=%s/%s", blocked.Policy, blocked.Stage))
+	}
+}
+
+func (f *GuardrailStreamFilter) parseChunk(data string) *guardrailStreamChunk {
+	chunk := &guardrailStreamChunk{data: data}
+	root := gjson.Parse(data)
+	if !root.IsObject() {
+		return chunk
+	}
+	if seq := root.Get("sequence_number"); seq.Exists() {
+		f.sequenceNumber = seq.Int()
+	}
+	eventType := root.Get("type").String()
+	switch {
+	case root.Get("choices").Exists():
+		f.format = streamFormatOpenAI
+		if id := root.Get("id").String(); id != "" {
+			f.responseId = id
+		}
+		if model := root.Get("model").String(); model != "" {
+			f.model = model
+		}
+		if created := root.Get("created").Int(); created != 0 {
+			f.created = created
+		}
+		for i, choice := range root.Get("choices").Array() {
+			if content := choice.Get("delta.content"); content.Type == gjson.String {
+				chunk.pieces = append(chunk.pieces, guardrailStreamPiece{path: fmt.Sprintf("choices.%d.delta.content", i), text: content.String(), scan: true})
+			}
+			for _, field := range []string{"reasoning_content", "reasoning"} {
+				if reasoning := choice.Get("delta." + field); reasoning.Type == gjson.String {
+					chunk.pieces = append(chunk.pieces, guardrailStreamPiece{path: fmt.Sprintf("choices.%d.delta.%s", i, field), text: reasoning.String()})
+				}
+			}
+		}
+	case root.Get("candidates").Exists() || root.Get("usageMetadata").Exists():
+		f.format = streamFormatGemini
+		if model := root.Get("modelVersion").String(); model != "" {
+			f.model = model
+		}
+		if prompt := root.Get("usageMetadata.promptTokenCount").Int(); prompt != 0 {
+			f.promptTokens = int(prompt)
+		}
+		for i, candidate := range root.Get("candidates").Array() {
+			for j, part := range candidate.Get("content.parts").Array() {
+				if text := part.Get("text"); text.Type == gjson.String {
+					chunk.pieces = append(chunk.pieces, guardrailStreamPiece{
+						path: fmt.Sprintf("candidates.%d.content.parts.%d.text", i, j),
+						text: text.String(),
+						scan: !part.Get("thought").Bool(),
+					})
+				}
+			}
+		}
+	case strings.HasPrefix(eventType, "response."):
+		f.format = streamFormatResponses
+		chunk.event = eventType
+		if response := root.Get("response"); response.IsObject() {
+			f.responseRaw = response.Raw
+		}
+		switch eventType {
+		case "response.output_text.delta":
+			chunk.pieces = append(chunk.pieces, guardrailStreamPiece{
+				path: "delta",
+				text: root.Get("delta").String(),
+				scan: true,
+				key:  root.Get("item_id").String() + ":" + root.Get("content_index").String(),
+			})
+		case "response.reasoning_text.delta", "response.reasoning_summary_text.delta":
+			chunk.pieces = append(chunk.pieces, guardrailStreamPiece{path: "delta", text: root.Get("delta").String()})
+		}
+	case claudeStreamEventTypes[eventType]:
+		f.format = streamFormatClaude
+		chunk.event = eventType
+		switch eventType {
+		case "message_start":
+			f.responseId = root.Get("message.id").String()
+			f.model = root.Get("message.model").String()
+			f.promptTokens = int(root.Get("message.usage.input_tokens").Int())
+		case "content_block_delta":
+			if text := root.Get("delta.text"); text.Type == gjson.String {
+				chunk.pieces = append(chunk.pieces, guardrailStreamPiece{path: "delta.text", text: text.String(), scan: true})
+			}
+			if thinking := root.Get("delta.thinking"); thinking.Type == gjson.String {
+				chunk.pieces = append(chunk.pieces, guardrailStreamPiece{path: "delta.thinking", text: thinking.String()})
+			}
+		}
+	}
+	return chunk
+}
+
+// pendingText 拼接窗口中待检测的文本，并返回每段文本在拼接结果中的位置
+func (f *GuardrailStreamFilter) pendingText() (string, []guardrailPieceRef) {
+	var builder strings.Builder
+	var refs []guardrailPieceRef
+	for _, chunk := range f.queue {
+		for i, piece := range chunk.pieces {
+			if !piece.scan || piece.text == "" {
+				continue
+			}
+			start := builder.Len()
+			builder.WriteString(piece.text)
+			refs = append(refs, guardrailPieceRef{chunk: chunk, piece: i, start: start, end: builder.Len()})
+		}
+	}
+	return builder.String(), refs
+}
+
+// releasable 返回可以下发的数据块数量：之后仍有足够的待检测文本（窗口）且满足最小缓存块数，
+// 不含文本的数据块随前面的数据块一起下发；配置了模型判定时不超过已判定的数据块
+func (f *GuardrailStreamFilter) releasable(final bool) int {
+	if len(f.judges) > 0 {
+		judged := 0
+		for judged < len(f.queue) && f.queue[judged].judged {
+			judged++
+		}
+		return min(f.windowReleasable(final), judged)
+	}
+	return f.windowReleasable(final)
+}
+
+func (f *GuardrailStreamFilter) windowReleasable(final bool) int {
+	if final {
+		return len(f.queue)
+	}
+	total := 0
+	for _, chunk := range f.queue {
+		for _, piece := range chunk.pieces {
+			if piece.scan {
+				total += len(piece.text)
+			}
+		}
+	}
+	consumed := 0
+	count := 0
+	for i, chunk := range f.queue {
+		if chunk.hasScanText() {
+			for _, piece := range chunk.pieces {
+				if piece.scan {
+					consumed += len(piece.text)
+				}
+			}
+			if total-consumed < f.window || len(f.queue)-i-1 < f.minChunks {
+				break
+			}
+		}
+		count = i + 1
+	}
+	return count
+}
+
+// releaseBoundary 前 n 个数据块的文本在拼接结果中的结束位置
+func (f *GuardrailStreamFilter) releaseBoundary(refs []guardrailPieceRef, n int) int {
+	boundary := 0
+	for _, ref := range refs {
+		for _, chunk := range f.queue[:n] {
+			if ref.chunk == chunk {
+				boundary = ref.end
+				break
+			}
+		}
+	}
+	return boundary
+}
+
+func (f *GuardrailStreamFilter) scan(final bool) *types.GuardrailViolation {
+	for i := range f.session.Policy.Stages {
+		stage := &f.session.Policy.Stages[i]
+		if !stage.AppliesTo(operation_setting.GuardrailPhaseOutput) || stage.Type == operation_setting.GuardrailStageLLMJudge {
+			continue
+		}
+		text, refs := f.pendingText()
+		if text == "" {
+			continue
+		}
+		boundary := f.releaseBoundary(refs, f.releasable(final))
+		var spans []guardrailSpan
+		for _, span := range matchGuardrailStage(stage, text) {
+			// 位于窗口末尾的匹配可能随后续文本延长，等到后面有文本或即将下发时再处理
+			if final || span.end < len(text) || span.start < boundary {
+				spans = append(spans, span)
+			}
+		}
+		if len(spans) == 0 {
+			continue
+		}
+		violation := f.record(stage, spans)
+		switch stage.Action {
+		case operation_setting.GuardrailActionBlock:
+			return violation
+		case operation_setting.GuardrailActionRedact:
+			f.redact(stage, refs, spans)
+		}
+	}
+	return f.judge(final)
+}
+
+// judge 对窗口中尚未判定的文本执行模型判定。窗口允许下发未判定的数据块时，
+// 未判定文本达到 guardrailStreamJudgeMinText 或流结束才调用判定模型，判定通过后窗口中的数据块均标记为已判定
+func (f *GuardrailStreamFilter) judge(final bool) *types.GuardrailViolation {
+	if len(f.judges) == 0 {
+		return nil
+	}
+	n := f.windowReleasable(final)
+	waiting := false
+	for _, chunk := range f.queue[:n] {
+		if !chunk.judged {
+			waiting = true
+			break
+		}
+	}
+	if !waiting {
+		return nil
+	}
+	var builder strings.Builder
+	for _, chunk := range f.queue {
+		if chunk.judged {
+			continue
+		}
+		for _, piece := range chunk.pieces {
+			if piece.scan {
+				builder.WriteString(piece.text)
+			}
+		}
+	}
+	text := builder.String()
+	if !final && len(text) < guardrailStreamJudgeMinText {
+		return nil
+	}
+	if text != "" {
+		ctx := context.Background()
+		if f.c != nil && f.c.Request != nil {
+			ctx = f.c.Request.Context()
+		}
+		for _, stage := range f.judges {
+			violated, labels, err := guardrailJudge(ctx, stage, text)
+			reason := ""
+			if err != nil {
+				common.SysError(fmt.Sprintf("guardrail judge %s failed: %s", stage.Name, err.Error()))
+				if !stage.FailClosed {
+					continue
+				}
+				violated, reason = true, "judge unavailable"
+			}
+			if !violated {
+				continue
+			}
+			violation := f.recordJudge(stage, labels, reason)
+			if stage.Action == operation_setting.GuardrailActionBlock {
+				return violation
+			}
+		}
+	}
+	for _, chunk := range f.queue {
+		chunk.judged = true
+	}
+	return nil
+}
+
+func (f *GuardrailStreamFilter) recordJudge(stage *operation_setting.GuardrailStage, labels []string, reason string) *types.GuardrailViolation {
+	violation := f.record(stage, nil)
+	labelSet := map[string]bool{}
+	for _, label := range violation.Labels {
+		labelSet[label] = true
+	}
+	for _, label := range labels {
+		labelSet[label] = true
+	}
+	violation.Labels = sortedKeys(labelSet)
+	if reason != "" {
+		violation.Reason = reason
+	}
+	return violation
+}
+
+func (f *GuardrailStreamFilter) record(stage *operation_setting.GuardrailStage, spans []guardrailSpan) *types.GuardrailViolation {
+	idx, ok := f.violationIndex[stage.Name]
+	if !ok {
+		f.session.Violations = append(f.session.Violations, types.GuardrailViolation{
+			Policy: f.session.PolicyName,
+			Stage:  stage.Name,
+			Type:   stage.Type,
+			Phase:  operation_setting.GuardrailPhaseOutput,
+			Action: stage.Action,
+		})
+		idx = len(f.session.Violations) - 1
+		f.violationIndex[stage.Name] = idx
+	}
+	violation := &f.session.Violations[idx]
+	labels := map[string]bool{}
+	for _, label := range violation.Labels {
+		labels[label] = true
+	}
+	for _, span := range spans {
+		labels[span.label] = true
+	}
+	violation.Labels = sortedKeys(labels)
+	return violation
+}
+
+func (f *GuardrailStreamFilter) redact(stage *operation_setting.GuardrailStage, refs []guardrailPieceRef, spans []guardrailSpan) {
+	f.replaceSpans(refs, spans, func(span guardrailSpan) string { return guardrailReplacement(stage, span.label) })
+}
+
+// replaceSpans 替换拼接文本中的片段，跨多个数据块的片段只在起始处写入替换文本
+func (f *GuardrailStreamFilter) replaceSpans(refs []guardrailPieceRef, spans []guardrailSpan, replacement func(span guardrailSpan) string) {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := spans[:0:0]
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.start < merged[n-1].end {
+			if span.end > merged[n-1].end {
+				merged[n-1].end = span.end
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	for _, ref := range refs {
+		piece := &ref.chunk.pieces[ref.piece]
+		var builder strings.Builder
+		pos := ref.start
+		changed := false
+		for _, span := range merged {
+			if span.end <= ref.start || span.start >= ref.end {
+				continue
+			}
+			start, end := max(span.start, ref.start), min(span.end, ref.end)
+			builder.WriteString(piece.text[pos-ref.start : start-ref.start])
+			if span.start >= ref.start {
+				builder.WriteString(replacement(span))
+			}
+			pos = end
+			changed = true
+		}
+		if changed {
+			builder.WriteString(piece.text[pos-ref.start:])
+			piece.text = builder.String()
+			ref.chunk.dirty = true
+		}
+	}
+}
+
+func (f *GuardrailStreamFilter) release(final bool) []string {
+	n := f.releasable(final)
+	if n == 0 {
+		return nil
+	}
+	if f.session.NeedsRestore() {
+		f.restore(n)
+	}
+	out := make([]string, 0, n)
+	for _, chunk := range f.queue[:n] {
+		out = append(out, f.emit(chunk))
+	}
+	f.queue = f.queue[n:]
+	return out
+}
+
+// restore 还原即将下发的 n 个数据块中的占位符。窗口不小于占位符的最大长度，起始于下发范围内的占位符
+// 在窗口中是完整的；跨数据块的占位符在起始处写入原文，其余部分从后续数据块中移除
+func (f *GuardrailStreamFilter) restore(n int) {
+	text, refs := f.pendingText()
+	boundary := f.releaseBoundary(refs, n)
+	var spans []guardrailSpan
+	for _, loc := range guardrailPlaceholderPattern.FindAllStringIndex(text, -1) {
+		if loc[0] >= boundary {
+			break
+		}
+		if original, ok := f.session.placeholders.originals[text[loc[0]:loc[1]]]; ok {
+			spans = append(spans, guardrailSpan{start: loc[0], end: loc[1], label: original})
+		}
+	}
+	f.replaceSpans(refs, spans, func(span guardrailSpan) string { return span.label })
+	// 思考内容等不检测的文本逐段还原
+	for _, chunk := range f.queue[:n] {
+		for i := range chunk.pieces {
+			piece := &chunk.pieces[i]
+			if piece.scan {
+				continue
+			}
+			if restored := f.session.RestoreText(piece.text); restored != piece.text {
+				piece.text = restored
+				chunk.dirty = true
+			}
+		}
+	}
+}
+
+// emit 生成下发的数据：写回脱敏后的文本，并记录已下发的内容
+func (f *GuardrailStreamFilter) emit(chunk *guardrailStreamChunk) string {
+	data := chunk.data
+	for _, piece := range chunk.pieces {
+		f.delivered.WriteString(piece.text)
+		if chunk.dirty {
+			if updated, err := sjson.Set(data, piece.path, piece.text); err == nil {
+				data = updated
+			}
+		}
+		if piece.key != "" {
+			builder := f.responsesText[piece.key]
+			if builder == nil {
+				builder = &strings.Builder{}
+				f.responsesText[piece.key] = builder
+			}
+			builder.WriteString(piece.text)
+			if chunk.dirty {
+				f.responsesEdited[piece.key] = true
+			}
+		}
+	}
+	switch chunk.event {
+	case "content_block_start":
+		f.claudeOpenBlock = int(gjson.Get(data, "index").Int())
+	case "content_block_stop":
+		f.claudeOpenBlock = -1
+	case "response.output_text.done", "response.content_part.done", "response.output_item.done", "response.completed":
+		if len(f.responsesEdited) > 0 {
+			data = f.syncResponsesText(chunk.event, data)
+		}
+	}
+	return data
+}
+
+// syncResponsesText 将 Responses 结束事件中的完整文本替换为已下发的脱敏文本
+func (f *GuardrailStreamFilter) syncResponsesText(event string, data string) string {
+	set := func(data string, path string, key string) string {
+		if !f.responsesEdited[key] {
+			return data
+		}
+		if updated, err := sjson.Set(data, path, f.responsesText[key].String()); err == nil {
+			return updated
+		}
+		return data
+	}
+	root := gjson.Parse(data)
+	switch event {
+	case "response.output_text.done":
+		return set(data, "text", root.Get("item_id").String()+":"+root.Get("content_index").String())
+	case "response.content_part.done":
+		return set(data, "part.text", root.Get("item_id").String()+":"+root.Get("content_index").String())
+	case "response.output_item.done":
+		itemId := root.Get("item.id").String()
+		for k := range root.Get("item.content").Array() {
+			data = set(data, fmt.Sprintf("item.content.%d.text", k), fmt.Sprintf("%s:%d", itemId, k))
+		}
+	case "response.completed":
+		for i, item := range root.Get("response.output").Array() {
+			itemId := item.Get("id").String()
+			for k := range item.Get("content").Array() {
+				data = set(data, fmt.Sprintf("response.output.%d.content.%d.text", i, k), fmt.Sprintf("%s:%d", itemId, k))
+			}
+		}
+	}
+	return data
+}
+
+func (f *GuardrailStreamFilter) deliveredTokens() int {
+	return CountTextToken(f.delivered.String(), f.info.UpstreamModelName)
+}
+
+func (f *GuardrailStreamFilter) promptTokenCount() int {
+	if f.promptTokens > 0 {
+		return f.promptTokens
+	}
+	return f.info.GetEstimatePromptTokens()
+}
+
+// Finish 返回终止流时补发的结束事件（上游格式），由原有的格式转换逻辑转换为客户端格式。
+// 结束事件中的用量只计算已下发的内容
+func (f *GuardrailStreamFilter) Finish() []string {
+	if f.finished {
+		return nil
+	}
+	f.finished = true
+	marshal := func(v any) string {
+		data, _ := common.Marshal(v)
+		return string(data)
+	}
+	switch f.format {
+	case streamFormatOpenAI:
+		// 不带用量，由处理器按已下发的文本计算
+		return []string{marshal(map[string]any{
+			"id":      f.responseId,
+			"object":  "chat.completion.chunk",
+			"created": f.created,
+			"model":   f.model,
+			"choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "content_filter"}},
+		})}
+	case streamFormatClaude:
+		var events []string
+		if f.claudeOpenBlock >= 0 {
+			events = append(events, marshal(map[string]any{"type": "content_block_stop", "index": f.claudeOpenBlock}))
+		}
+		return append(events,
+			marshal(map[string]any{
+				"type":  "message_delta",
+				"delta": map[string]any{"stop_reason": "refusal", "stop_sequence": nil},
+				"usage": map[string]any{"input_tokens": f.promptTokenCount(), "output_tokens": f.deliveredTokens()},
+			}),
+			marshal(map[string]any{"type": "message_stop"}),
+		)
+	case streamFormatGemini:
+		completion := f.deliveredTokens()
+		return []string{marshal(map[string]any{
+			"candidates": []map[string]any{{
+				"content":      map[string]any{"role": "model", "parts": []any{}},
+				"finishReason": "SAFETY",
+				"index":        0,
+			}},
+			"usageMetadata": map[string]any{
+				"promptTokenCount":     f.promptTokenCount(),
+				"candidatesTokenCount": completion,
+				"totalTokenCount":      f.promptTokenCount() + completion,
+			},
+			"modelVersion": f.model,
+		})}
+	case streamFormatResponses:
+		response := f.responseRaw
+		if response == "" {
+			response = "{}"
+		}
+		completion := f.deliveredTokens()
+		response, _ = sjson.Set(response, "status", "incomplete")
+		response, _ = sjson.Set(response, "incomplete_details", map[string]any{"reason": "content_filter"})
+		response, _ = sjson.Set(response, "usage", map[string]any{
+			"input_tokens":  f.promptTokenCount(),
+			"output_tokens": completion,
+			"total_tokens":  f.promptTokenCount() + completion,
+		})
+		event, _ := sjson.SetRaw(`{"type":"response.incomplete"}`, "response", response)
+		event, _ = sjson.Set(event, "sequence_number", f.sequenceNumber+1)
+		return []string{event}
+	}
+	return nil
+}
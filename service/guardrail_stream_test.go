@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newTestStreamFilter(t *testing.T, window int, stages ...operation_setting.GuardrailStage) (*GuardrailStreamFilter, *gin.Context, *relaycommon.RelayInfo) {
+	guardrailSetting := operation_setting.GetGuardrailSetting()
+	original := guardrailSetting.StreamWindowSize
+	guardrailSetting.StreamWindowSize = window
+	t.Cleanup(func() { guardrailSetting.StreamWindowSize = original })
+
+	for i := range stages {
+		stages[i].Phase = operation_setting.GuardrailPhaseOutput
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gpt-4o"}}
+	filter := NewGuardrailStreamFilter(c, newTestGuardrail(stages...), info)
+	require.NotNil(t, filter)
+	return filter, c, info
+}
+
+func openaiStreamChunk(content string) string {
+	return fmt.Sprintf(`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":%q}}]}`, content)
+}
+
+// pushAll 依次推送数据，返回下发的数据与是否被终止
+func pushAll(filter *GuardrailStreamFilter, chunks ...string) ([]string, bool) {
+	var out []string
+	for _, chunk := range chunks {
+		released, stop := filter.Push(chunk)
+		out = append(out, released...)
+		if stop {
+			return out, true
+		}
+	}
+	released, stop := filter.Flush()
+	return append(out, released...), stop
+}
+
+func TestGuardrailStreamRedactAcrossChunks(t *testing.T) {
+	filter, _, info := newTestStreamFilter(t, 8, operation_setting.GuardrailStage{
+		Name: "words", Type: operation_setting.GuardrailStageKeyword, Action: operation_setting.GuardrailActionRedact, Patterns: []string{"secret"},
+	})
+	out, stop := pushAll(filter,
+		openaiStreamChunk("the sec"), openaiStreamChunk("ret is "), openaiStreamChunk("out, no more "), openaiStreamChunk("Secret"))
+	require.False(t, stop)
+	require.Len(t, out, 4)
+
+	var text strings.Builder
+	for _, data := range out {
+		text.WriteString(gjson.Get(data, "choices.0.delta.content").String())
+		require.Equal(t, "chatcmpl-1", gjson.Get(data, "id").String())
+	}
+	require.Equal(t, "the [REDACTED] is out, no more [REDACTED]", text.String())
+	// 替换文本只写入匹配起始的数据块
+	require.Equal(t, " is ", gjson.Get(out[1], "choices.0.delta.content").String())
+	require.Len(t, info.GuardrailViolations, 1)
+	require.Nil(t, filter.Blocked())
+}
+
+func TestGuardrailStreamBlockOpenAI(t *testing.T) {
+	filter, c, info := newTestStreamFilter(t, 4, operation_setting.GuardrailStage{
+		Name: "words", Type: operation_setting.GuardrailStageKeyword, Action: operation_setting.GuardrailActionBlock, Patterns: []string{"forbidden"},
+	})
+	out, stop := pushAll(filter, openaiStreamChunk("hello "), openaiStreamChunk("world "), openaiStreamChunk("this is forb"), openaiStreamChunk("idden"))
+	require.True(t, stop)
+	require.Len(t, out, 2)
+
+	finish := filter.Finish()
+	require.Len(t, finish, 1)
+	require.Equal(t, "content_filter", gjson.Get(finish[0], "choices.0.finish_reason").String())
+	require.Equal(t, "chatcmpl-1", gjson.Get(finish[0], "id").String())
+	require.Nil(t, filter.Finish())
+
+	require.NotNil(t, filter.Blocked())
+	require.Equal(t, "words", filter.Blocked().Stage)
+	require.Equal(t, "guardrail=test/words", common.GetContextKeyString(c, constant.ContextKeyAdminRejectReason))
+	require.Len(t, info.GuardrailViolations, 1)
+	require.Equal(t, "hello world ", filter.delivered.String())
+}
+
+func TestGuardrailStreamBlockClaude(t *testing.T) {
+	filter, _, _ := newTestStreamFilter(t, 0, operation_setting.GuardrailStage{
+		Name: "pii", Type: operation_setting.GuardrailStagePII, Action: operation_setting.GuardrailActionBlock,
+	})
+	_, stop := pushAll(filter,
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi, "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"mail bob@example.com "}}`,
+	)
+	require.True(t, stop)
+
+	finish := filter.Finish()
+	require.Len(t, finish, 3)
+	require.Equal(t, "content_block_stop", gjson.Get(finish[0], "type").String())
+	require.Equal(t, int64(0), gjson.Get(finish[0], "index").Int())
+	require.Equal(t, "message_delta", gjson.Get(finish[1], "type").String())
+	require.Equal(t, "refusal", gjson.Get(finish[1], "delta.stop_reason").String())
+	require.Equal(t, int64(12), gjson.Get(finish[1], "usage.input_tokens").Int())
+	require.Equal(t, int64(CountTextToken("hi, ", "gpt-4o")), gjson.Get(finish[1], "usage.output_tokens").Int())
+	require.Equal(t, "message_stop", gjson.Get(finish[2], "type").String())
+}
+
+func TestGuardrailStreamBlockGemini(t *testing.T) {
+	filter, _, _ := newTestStreamFilter(t, 0, operation_setting.GuardrailStage{
+		Name: "words", Type: operation_setting.GuardrailStageKeyword, Action: operation_setting.GuardrailActionBlock, Patterns: []string{"forbidden"},
+	})
+	_, stop := pushAll(filter,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"forbidden","thought":true}]}}],"usageMetadata":{"promptTokenCount":7},"modelVersion":"gemini-2.5-pro"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"ok "}]}}],"usageMetadata":{"promptTokenCount":7}}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"forbidden"}]}}],"usageMetadata":{"promptTokenCount":7}}`,
+	)
+	// 思考内容不检测
+	require.True(t, stop)
+
+	finish := filter.Finish()
+	require.Len(t, finish, 1)
+	require.Equal(t, "SAFETY", gjson.Get(finish[0], "candidates.0.finishReason").String())
+	require.Equal(t, int64(7), gjson.Get(finish[0], "usageMetadata.promptTokenCount").Int())
+	require.Equal(t, "gemini-2.5-pro", gjson.Get(finish[0], "modelVersion").String())
+}
+
+func TestGuardrailStreamResponses(t *testing.T) {
+	filter, _, _ := newTestStreamFilter(t, 0, operation_setting.GuardrailStage{
+		Name: "words", Type: operation_setting.GuardrailStageKeyword, Action: operation_setting.GuardrailActionRedact, Patterns: []string{"secret"},
+	})
+	out, stop := pushAll(filter,
+		`{"type":"response.created","sequence_number":0,"response":{"id":"resp_1","status":"in_progress"}}`,
+		`{"type":"response.output_text.delta","sequence_number":1,"item_id":"msg_1","output_index":0,"content_index":0,"delta":"a secret"}`,
+		`{"type":"response.output_text.done","sequence_number":2,"item_id":"msg_1","output_index":0,"content_index":0,"text":"a secret"}`,
+		`{"type":"response.completed","sequence_number":3,"response":{"id":"resp_1","status":"completed","output":[{"id":"msg_1","type":"message","content":[{"type":"output_text","text":"a secret"}]}]}}`,
+	)
+	require.False(t, stop)
+	require.Len(t, out, 4)
+	require.Equal(t, "a [REDACTED]", gjson.Get(out[1], "delta").String())
+	require.Equal(t, "a [REDACTED]", gjson.Get(out[2], "text").String())
+	require.Equal(t, "a [REDACTED]", gjson.Get(out[3], "response.output.0.content.0.text").String())
+
+	filter, _, _ = newTestStreamFilter(t, 0, operation_setting.GuardrailStage{
+		Name: "words", Type: operation_setting.GuardrailStageKeyword, Action: operation_setting.GuardrailActionBlock, Patterns: []string{"secret"},
+	})
+	_, stop = pushAll(filter,
+		`{"type":"response.created","sequence_number":0,"response":{"id":"resp_1","status":"in_progress"}}`,
+		`{"type":"response.output_text.delta","sequence_number":1,"item_id":"msg_1","output_index":0,"content_index":0,"delta":"a secret"}`,
+	)
+	require.True(t, stop)
+	finish := filter.Finish()
+	require.Len(t, finish, 1)
+	require.Equal(t, "response.incomplete", gjson.Get(finish[0], "type").String())
+	require.Equal(t, int64(2), gjson.Get(finish[0], "sequence_number").Int())
+	require.Equal(t, "resp_1", gjson.Get(finish[0], "response.id").String())
+	require.Equal(t, "incomplete", gjson.Get(finish[0], "response.status").String())
+	require.Equal(t, "content_filter", gjson.Get(finish[0], "response.incomplete_details.reason").String())
+	require.Equal(t, int64(0), gjson.Get(finish[0], "response.usage.output_tokens").Int())
+}
+
+func TestGuardrailStreamRestorePlaceholders(t *testing.T) {
+	guardrail := newTestGuardrail(operation_setting.GuardrailStage{
+		Name: "pii", Type: operation_setting.GuardrailStagePII, Action: operation_setting.GuardrailActionRedact, Reversible: true, Restore: true,
+	})
+	_, _, blocked := guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput, []string{"bob@example.com"}, true)
+	require.Nil(t, blocked)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gpt-4o"}}
+	// 没有输出阶段时也需要创建检测器以还原占位符
+	filter := NewGuardrailStreamFilter(c, guardrail, info)
+	require.NotNil(t, filter)
+	require.GreaterOrEqual(t, filter.window, maxGuardrailPlaceholderLen)
+
+	out, stop := pushAll(filter, openaiStreamChunk("write to [EMA"), openaiStreamChunk("IL_1] and [EMAIL_2]"), openaiStreamChunk(" done"))
+	require.False(t, stop)
+	require.Len(t, out, 3)
+	require.Equal(t, "write to bob@example.com", gjson.Get(out[0], "choices.0.delta.content").String())
+	require.Equal(t, " and [EMAIL_2]", gjson.Get(out[1], "choices.0.delta.content").String())
+	require.Equal(t, " done", gjson.Get(out[2], "choices.0.delta.content").String())
+}
+
+func TestGuardrailStreamLLMJudge(t *testing.T) {
+	original := guardrailJudge
+	t.Cleanup(func() { guardrailJudge = original })
+	var judged []string
+	guardrailJudge = func(ctx context.Context, stage *operation_setting.GuardrailStage, text string) (bool, []string, error) {
+		judged = append(judged, text)
+		return strings.Contains(text, "attack"), []string{"violence"}, nil
+	}
+	filter, _, info := newTestStreamFilter(t, 0, operation_setting.GuardrailStage{
+		Name: "judge", Type: operation_setting.GuardrailStageLLMJudge, Action: operation_setting.GuardrailActionBlock, JudgeModel: "omni-moderation-latest",
+	})
+	filter.minChunks = 0
+
+	// 未判定的文本不足批量时不下发
+	released, stop := filter.Push(openaiStreamChunk("hello "))
+	require.False(t, stop)
+	require.Empty(t, released)
+	require.Empty(t, judged)
+
+	// 积累到批量后判定并下发
+	released, stop = filter.Push(openaiStreamChunk(strings.Repeat("a", guardrailStreamJudgeMinText)))
+	require.False(t, stop)
+	require.Len(t, released, 2)
+	require.Len(t, judged, 1)
+
+	// 流结束时判定剩余文本，命中拦截后不下发
+	released, stop = filter.Push(openaiStreamChunk("plan the attack"))
+	require.False(t, stop)
+	require.Empty(t, released)
+	released, stop = filter.Flush()
+	require.True(t, stop)
+	require.Empty(t, released)
+	require.Equal(t, "plan the attack", judged[1])
+	require.NotNil(t, filter.Blocked())
+	require.Equal(t, []string{"violence"}, filter.Blocked().Labels)
+	require.Len(t, info.GuardrailViolations, 1)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGuardrail(stages ...operation_setting.GuardrailStage) *GuardrailSession {
+	return &GuardrailSession{PolicyName: "test", Policy: &operation_setting.GuardrailPolicy{Stages: stages}}
+}
+
+func TestDetectPII(t *testing.T) {
+	text := "mail bob@example.com, 手机13812345678, card 4111 1111 1111 1111, bad 4111111111111112, key sk-abcdefghijklmnopqrstuvwx"
+	matches := DetectPII(text, nil, nil)
+	var found []string
+	for _, m := range matches {
+		found = append(found, m.Type+"="+text[m.Start:m.End])
+	}
+	require.Equal(t, []string{
+		"email=bob@example.com",
+		"phone=13812345678",
+		"credit_card=4111 1111 1111 1111",
+		"api_key=sk-abcdefghijklmnopqrstuvwx",
+	}, found)
+
+	require.Len(t, DetectPII(text, []string{"email"}, nil), 1)
+
+	text = "ssn 123-45-6789, bad 666-45-6789, call (415) 555-2671 or 13812345678"
+	found = nil
+	for _, m := range DetectPII(text, nil, []string{"us"}) {
+		found = append(found, m.Type+"="+text[m.Start:m.End])
+	}
+	require.Equal(t, []string{"id_card=123-45-6789", "phone=(415) 555-2671"}, found)
+	require.Len(t, DetectPII(text, nil, []string{"cn"}), 1)
+	require.True(t, validChineseIdCard("11010519491231002X"))
+	require.False(t, validChineseIdCard("110105194912310021"))
+}
+
+func TestGuardrailStagesInOrder(t *testing.T) {
+	guardrail := newTestGuardrail(
+		operation_setting.GuardrailStage{Name: "pii", Type: operation_setting.GuardrailStagePII, Action: operation_setting.GuardrailActionRedact},
+		operation_setting.GuardrailStage{Name: "words", Type: operation_setting.GuardrailStageKeyword, Action: operation_setting.GuardrailActionRedact, Patterns: []string{"Secret"}},
+		operation_setting.GuardrailStage{Name: "audit", Type: operation_setting.GuardrailStageRegex, Action: operation_setting.GuardrailActionFlag, Patterns: []string{`(?i)password`}},
+		operation_setting.GuardrailStage{Name: "out", Type: operation_setting.GuardrailStageRegex, Phase: operation_setting.GuardrailPhaseOutput, Action: operation_setting.GuardrailActionBlock, Patterns: []string{`.`}},
+	)
+
+	texts, changed, blocked := guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput,
+		[]string{"我的 SECRET 是 bob@example.com", "password"}, true)
+	require.Nil(t, blocked)
+	require.True(t, changed)
+	require.Equal(t, []string{"我的 [REDACTED] 是 [EMAIL]", "password"}, texts)
+	require.Len(t, guardrail.Violations, 3)
+	require.Equal(t, []string{"email"}, guardrail.Violations[0].Labels)
+	require.Equal(t, []string{"secret"}, guardrail.Violations[1].Labels)
+	require.Equal(t, operation_setting.GuardrailActionFlag, guardrail.Violations[2].Action)
+
+	// 无法改写时脱敏按拦截处理
+	guardrail.Violations = nil
+	_, _, blocked = guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput, []string{"a secret"}, false)
+	require.NotNil(t, blocked)
+	require.Equal(t, "words", blocked.Stage)
+	require.Equal(t, operation_setting.GuardrailActionBlock, blocked.Action)
+}
+
+func TestGuardrailCheckJSONKeepsStructure(t *testing.T) {
+	guardrail := newTestGuardrail(operation_setting.GuardrailStage{
+		Name: "pii", Type: operation_setting.GuardrailStagePII, Action: operation_setting.GuardrailActionRedact, Phase: operation_setting.GuardrailPhaseBoth,
+	})
+	body := []byte(`{"model":"gpt-4o","seed":12345678901234567890,"messages":[{"role":"user","content":[{"type":"text","text":"call +86 13812345678"},{"type":"image_url","image_url":{"url":"data:image/png;base64,bob@example.com"}}]}],"stop":["x"]}`)
+	newBody, changed, blocked, err := guardrail.CheckJSON(context.Background(), operation_setting.GuardrailPhaseInput, body)
+	require.NoError(t, err)
+	require.Nil(t, blocked)
+	require.True(t, changed)
+	require.Equal(t, `{"model":"gpt-4o","seed":12345678901234567890,"messages":[{"role":"user","content":[{"type":"text","text":"call [PHONE]"},{"type":"image_url","image_url":{"url":"data:image/png;base64,bob@example.com"}}]}],"stop":["x"]}`, string(newBody))
+
+	_, changed, _, err = guardrail.CheckJSON(context.Background(), operation_setting.GuardrailPhaseOutput, []byte(`{"id":"bob@example.com","choices":[]}`))
+	require.NoError(t, err)
+	require.False(t, changed)
+}
+
+func TestGuardrailReversibleRedaction(t *testing.T) {
+	guardrail := newTestGuardrail(operation_setting.GuardrailStage{
+		Name: "pii", Type: operation_setting.GuardrailStagePII, Action: operation_setting.GuardrailActionRedact,
+		PiiTypes: []string{"email", "phone"}, Reversible: true, Restore: true,
+	})
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"I am bob@example.com"},{"role":"assistant","content":"ok"},{"role":"user","content":"mail bob@example.com, amy@example.com or 13812345678"}]}`)
+	newBody, changed, blocked, err := guardrail.CheckJSON(context.Background(), operation_setting.GuardrailPhaseInput, body)
+	require.NoError(t, err)
+	require.Nil(t, blocked)
+	require.True(t, changed)
+	require.Equal(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"I am [EMAIL_1]"},{"role":"assistant","content":"ok"},{"role":"user","content":"mail [EMAIL_1], [EMAIL_2] or [PHONE_1]"}]}`, string(newBody))
+	require.True(t, guardrail.NeedsRestore())
+	require.True(t, guardrail.NeedsOutput())
+
+	response := []byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"Sent to [EMAIL_2], not [EMAIL_9]","tool_calls":[{"id":"call_1","type":"function","function":{"name":"send","arguments":"{\"to\":\"[PHONE_1]\"}"}}]}}]}`)
+	restored, changed, err := guardrail.RestoreJSON(response)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"Sent to amy@example.com, not [EMAIL_9]","tool_calls":[{"id":"call_1","type":"function","function":{"name":"send","arguments":"{\"to\":\"13812345678\"}"}}]}}]}`, string(restored))
+
+	// 未开启还原时只替换为占位符
+	guardrail = newTestGuardrail(operation_setting.GuardrailStage{
+		Name: "pii", Type: operation_setting.GuardrailStagePII, Action: operation_setting.GuardrailActionRedact, Reversible: true,
+	})
+	texts, _, _ := guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput, []string{"bob@example.com"}, true)
+	require.Equal(t, []string{"[EMAIL_1]"}, texts)
+	require.False(t, guardrail.NeedsRestore())
+	require.Equal(t, "[EMAIL_1]", guardrail.RestoreText("[EMAIL_1]"))
+}
+
+func TestGuardrailLLMJudge(t *testing.T) {
+	original := guardrailJudge
+	defer func() { guardrailJudge = original }()
+
+	var judged string
+	guardrailJudge = func(ctx context.Context, stage *operation_setting.GuardrailStage, text string) (bool, []string, error) {
+		judged = text
+		return true, []string{"violence"}, nil
+	}
+	guardrail := newTestGuardrail(operation_setting.GuardrailStage{
+		Name: "judge", Type: operation_setting.GuardrailStageLLMJudge, Action: operation_setting.GuardrailActionBlock, JudgeModel: "omni-moderation-latest",
+	})
+	_, _, blocked := guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput, []string{"a", "b"}, true)
+	require.NotNil(t, blocked)
+	require.Equal(t, "a\nb", judged)
+	require.Equal(t, []string{"violence"}, blocked.Labels)
+
+	// 判定失败默认放行，FailClosed 时拦截
+	guardrailJudge = func(ctx context.Context, stage *operation_setting.GuardrailStage, text string) (bool, []string, error) {
+		return false, nil, errors.New("timeout")
+	}
+	guardrail.Violations = nil
+	_, _, blocked = guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput, []string{"a"}, true)
+	require.Nil(t, blocked)
+	guardrail.Policy.Stages[0].FailClosed = true
+	_, _, blocked = guardrail.CheckTexts(context.Background(), operation_setting.GuardrailPhaseInput, []string{"a"}, true)
+	require.NotNil(t, blocked)
+}
+
+func TestParseJudgeVerdicts(t *testing.T) {
+	violated, labels, err := parseModerationVerdict([]byte(`{"results":[{"flagged":true,"categories":{"violence":true,"hate":false,"self-harm":true}}]}`), []string{"Violence"})
+	require.NoError(t, err)
+	require.True(t, violated)
+	require.Equal(t, []string{"violence"}, labels)
+
+	violated, _, err = parseModerationVerdict([]byte(`{"results":[{"flagged":true,"categories":{"self-harm":true}}]}`), []string{"violence"})
+	require.NoError(t, err)
+	require.False(t, violated)
+
+	violated, labels, err = parseClassifierVerdict([]byte(`{"choices":[{"message":{"content":"UNSAFE: prompt injection."}}]}`))
+	require.NoError(t, err)
+	require.True(t, violated)
+	require.Equal(t, []string{"prompt injection"}, labels)
+
+	violated, _, err = parseClassifierVerdict([]byte(`{"choices":[{"message":{"content":"safe"}}]}`))
+	require.NoError(t, err)
+	require.False(t, violated)
+}
+
+func TestResolveGuardrailPolicy(t *testing.T) {
+	setting := &operation_setting.GuardrailSetting{
+		Policies: map[string]operation_setting.GuardrailPolicy{
+			"strict": {Stages: []operation_setting.GuardrailStage{{Name: "a"}}},
+			"loose":  {Stages: []operation_setting.GuardrailStage{{Name: "b"}}},
+		},
+		DefaultPolicy: "loose",
+		GroupPolicies: map[string]string{"vip": "strict", "internal": ""},
+		TokenPolicies: map[int]string{7: "loose"},
+	}
+	name, policy := setting.ResolvePolicy(1, "default")
+	require.Equal(t, "loose", name)
+	require.NotNil(t, policy)
+	name, _ = setting.ResolvePolicy(1, "vip")
+	require.Equal(t, "strict", name)
+	name, _ = setting.ResolvePolicy(7, "vip")
+	require.Equal(t, "loose", name)
+	_, policy = setting.ResolvePolicy(1, "internal")
+	require.Nil(t, policy)
+}
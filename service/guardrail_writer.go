@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GuardrailResponseWriter 缓冲非流式响应，输出检测完成后再写给客户端。
+// 若响应实际为 SSE 流，则立即切换为直接写出
+type GuardrailResponseWriter struct {
+	gin.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+// StartGuardrailOutput 包装响应写入器以缓冲响应体
+func StartGuardrailOutput(c *gin.Context) *GuardrailResponseWriter {
+	w := &GuardrailResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	return w
+}
+
+func (w *GuardrailResponseWriter) startPassthrough() {
+	w.passthrough = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *GuardrailResponseWriter) checkStream() {
+	if !w.passthrough && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.startPassthrough()
+	}
+}
+
+func (w *GuardrailResponseWriter) WriteHeader(code int) {
+	w.checkStream()
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *GuardrailResponseWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *GuardrailResponseWriter) Write(p []byte) (int, error) {
+	w.checkStream()
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *GuardrailResponseWriter) WriteString(s string) (int, error) {
+	w.checkStream()
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.buf.WriteString(s)
+}
+
+func (w *GuardrailResponseWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *GuardrailResponseWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+	return w.status != 0 || w.buf.Len() > 0
+}
+
+func (w *GuardrailResponseWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	if !w.Written() {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *GuardrailResponseWriter) Flush() {
+	w.checkStream()
+	if w.passthrough {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Finish 恢复原响应写入器。apply 为 true 时对缓冲的成功 JSON 响应执行输出检测并还原占位符，
+// 被拦截时丢弃响应并返回拦截的阶段，由调用方写出错误
+func (w *GuardrailResponseWriter) Finish(c *gin.Context, session *GuardrailSession, apply bool) *types.GuardrailViolation {
+	c.Writer = w.ResponseWriter
+	if w.passthrough {
+		return nil
+	}
+	body := w.buf.Bytes()
+	status := w.Status()
+	if apply && status >= 200 && status < 300 && len(body) > 0 &&
+		strings.Contains(w.Header().Get("Content-Type"), "json") {
+		newBody, changed, blocked, err := session.CheckJSON(c.Request.Context(), operation_setting.GuardrailPhaseOutput, body)
+		if err != nil {
+			common.SysError("guardrail output check failed: " + err.Error())
+		}
+		if blocked != nil {
+			w.Header().Del("Content-Length")
+			return blocked
+		}
+		if changed {
+			body = newBody
+		}
+		// 检测完成后再还原可逆脱敏的占位符，原文不参与输出检测
+		if session.NeedsRestore() {
+			restored, restoredChanged, err := session.RestoreJSON(body)
+			if err != nil {
+				common.SysError("guardrail restore placeholders failed: " + err.Error())
+			}
+			if restoredChanged {
+				body, changed = restored, true
+			}
+		}
+		if changed && w.Header().Get("Content-Length") != "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(body) > 0 {
+		_, _ = w.ResponseWriter.Write(body)
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-pdf/fpdf"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	InvoiceFormatPDF  = "pdf"
+	InvoiceFormatHTML = "html"
+)
+
+// ErrInvoicePDFFontRequired 发票包含内置字体无法显示的字符（如中文），需要配置 INVOICE_PDF_FONT
+var ErrInvoicePDFFontRequired = errors.New("invoice contains characters the built-in PDF font cannot render, set INVOICE_PDF_FONT")
+
+// InvoiceAmounts 含税金额拆分结果
+type InvoiceAmounts struct {
+	Subtotal  float64
+	TaxAmount float64
+	Total     float64
+}
+
+// SplitInvoiceAmount 支付金额视为含税价：subtotal = total / (1 + rate/100)，税额为差值
+func SplitInvoiceAmount(total float64, taxRate float64) InvoiceAmounts {
+	dTotal := decimal.NewFromFloat(total).Round(2)
+	if taxRate <= 0 {
+		return InvoiceAmounts{Subtotal: dTotal.InexactFloat64(), Total: dTotal.InexactFloat64()}
+	}
+	divisor := decimal.NewFromInt(1).Add(decimal.NewFromFloat(taxRate).Div(decimal.NewFromInt(100)))
+	dSubtotal := dTotal.Div(divisor).Round(2)
+	return InvoiceAmounts{
+		Subtotal:  dSubtotal.InexactFloat64(),
+		TaxAmount: dTotal.Sub(dSubtotal).InexactFloat64(),
+		Total:     dTotal.InexactFloat64(),
+	}
+}
+
+func getInvoiceSeller(setting *operation_setting.InvoiceSetting) model.InvoiceParty {
+	return model.InvoiceParty{
+		Name:    setting.SellerName,
+		TaxId:   setting.SellerTaxId,
+		Address: setting.SellerAddress,
+		Email:   setting.SellerEmail,
+	}
+}
+
+func getInvoiceBuyer(userId int) model.InvoiceParty {
+	profile, err := model.GetUserBillingProfile(userId)
+	if err != nil {
+		profile = &model.UserBillingProfile{UserId: userId}
+	}
+	party := profile.ToParty()
+	if party.Name == "" && party.Company == "" {
+		if user, err := model.GetUserById(userId, false); err == nil {
+			party.Name = user.Username
+			if party.Email == "" {
+				party.Email = user.Email
+			}
+		}
+	}
+	return party
+}
+
+// IssueInvoiceForPayment 为已支付成功的充值或订阅订单开具发票，重复调用返回同一张发票
+func IssueInvoiceForPayment(sourceType string, tradeNo string) (*model.Invoice, error) {
+	setting := operation_setting.GetInvoiceSetting()
+	var (
+		userId        int
+		money         float64
+		paymentMethod string
+		currency      string
+		description   string
+	)
+	switch sourceType {
+	case model.InvoiceSourceTopUp:
+		topUp := model.GetTopUpByTradeNo(tradeNo)
+		if topUp == nil {
+			return nil, errors.New("充值订单不存在")
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return nil, errors.New("订单尚未支付成功")
+		}
+		userId = topUp.UserId
+		money = topUp.Money
+		paymentMethod = topUp.PaymentMethod
+		currency = setting.GetCurrency(paymentMethod)
+		// 发票正文为英文，明细描述同样使用英文，避免内置 PDF 字体无法显示
+		description = fmt.Sprintf("Account top-up: %s", logger.FormatQuota(int(getTopUpQuota(topUp))))
+	case model.InvoiceSourceSubscription:
+		order := model.GetSubscriptionOrderByTradeNo(tradeNo)
+		if order == nil {
+			return nil, errors.New("订阅订单不存在")
+		}
+		if order.Status != common.TopUpStatusSuccess {
+			return nil, errors.New("订单尚未支付成功")
+		}
+		userId = order.UserId
+		money = order.Money
+		paymentMethod = order.PaymentMethod
+		currency = setting.GetCurrency(paymentMethod)
+		description = "Subscription"
+		if plan, err := model.GetSubscriptionPlanById(order.PlanId); err == nil {
+			description = "Subscription: " + plan.Title
+			if plan.Currency != "" {
+				currency = strings.ToUpper(plan.Currency)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported invoice source %q", sourceType)
+	}
+	if money <= 0 {
+		return nil, errors.New("订单金额为 0，无需开票")
+	}
+
+	amounts := SplitInvoiceAmount(money, setting.TaxRate)
+	return model.IssueInvoice(model.IssueInvoiceParams{
+		Type:          model.InvoiceTypeInvoice,
+		Prefix:        setting.InvoicePrefix,
+		UserId:        userId,
+		SourceType:    sourceType,
+		TradeNo:       tradeNo,
+		PaymentMethod: paymentMethod,
+		Currency:      currency,
+		Subtotal:      amounts.Subtotal,
+		TaxName:       setting.TaxName,
+		TaxRate:       setting.TaxRate,
+		TaxAmount:     amounts.TaxAmount,
+		Total:         amounts.Total,
+		Description:   description,
+		Seller:        getInvoiceSeller(setting),
+		Buyer:         getInvoiceBuyer(userId),
+	})
+}
+
+// IssueInvoiceForPaymentAsync 支付回调中调用，开票失败不影响支付流程
+func IssueInvoiceForPaymentAsync(sourceType string, tradeNo string) {
+	if !operation_setting.GetInvoiceSetting().Enabled || tradeNo == "" {
+		return
+	}
+	gopool.Go(func() {
+		if _, err := IssueInvoiceForPayment(sourceType, tradeNo); err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("failed to issue invoice for %s %s: %v", sourceType, tradeNo, err))
+		}
+	})
+}
+
+// CreateCreditNote 为发票开具红字发票（退款凭证），amount 为含税退款金额；deductQuota 为 true 时按比例扣回充值额度
+func CreateCreditNote(invoiceId int, amount float64, reason string, deductQuota bool) (*model.Invoice, error) {
+	original, err := model.GetInvoiceById(invoiceId, 0)
+	if err != nil {
+		return nil, errors.New("发票不存在")
+	}
+	if original.Type != model.InvoiceTypeInvoice {
+		return nil, errors.New("只能为发票开具红字发票")
+	}
+	if amount <= 0 {
+		return nil, errors.New("退款金额必须大于 0")
+	}
+	setting := operation_setting.GetInvoiceSetting()
+	amounts := SplitInvoiceAmount(amount, original.TaxRate)
+	note, err := model.IssueInvoice(model.IssueInvoiceParams{
+		Type:             model.InvoiceTypeCreditNote,
+		Prefix:           setting.CreditNotePrefix,
+		UserId:           original.UserId,
+		SourceType:       original.SourceType,
+		TradeNo:          original.TradeNo,
+		PaymentMethod:    original.PaymentMethod,
+		RelatedInvoiceId: original.Id,
+		Currency:         original.Currency,
+		Subtotal:         amounts.Subtotal,
+		TaxName:          original.TaxName,
+		TaxRate:          original.TaxRate,
+		TaxAmount:        amounts.TaxAmount,
+		Total:            amounts.Total,
+		Description:      fmt.Sprintf("Refund of %s", original.Number),
+		Reason:           reason,
+		Seller:           original.GetSeller(),
+		Buyer:            original.GetBuyer(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deductQuota && original.SourceType == model.InvoiceSourceTopUp {
+		if topUp := model.GetTopUpByTradeNo(original.TradeNo); topUp != nil && original.Total > 0 {
+			quota := decimal.NewFromInt(getTopUpQuota(topUp)).
+				Mul(decimal.NewFromFloat(note.Total)).Div(decimal.NewFromFloat(original.Total)).IntPart()
+			if quota > 0 {
+				if err := model.DecreaseUserQuota(original.UserId, int(quota)); err != nil {
+					return note, fmt.Errorf("红字发票已开具，但扣回额度失败: %w", err)
+				}
+				model.RecordLog(original.UserId, model.LogTypeManage, fmt.Sprintf("退款 %s，扣回额度 %s", note.Number, logger.LogQuota(int(quota))))
+			}
+		}
+	}
+	return note, nil
+}
+
+// getTopUpQuota 充值订单到账额度，与各支付方式的入账逻辑保持一致
+func getTopUpQuota(topUp *model.TopUp) int64 {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart()
+	case "creem":
+		return topUp.Amount
+	default:
+		return decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart()
+	}
+}
+
+type invoiceView struct {
+	*model.Invoice
+	Title      string
+	Seller     model.InvoiceParty
+	Buyer      model.InvoiceParty
+	Related    string
+	IssuedDate string
+	Footer     string
+}
+
+func newInvoiceView(invoice *model.Invoice) invoiceView {
+	view := invoiceView{
+		Invoice:    invoice,
+		Title:      "INVOICE / RECEIPT",
+		Seller:     invoice.GetSeller(),
+		Buyer:      invoice.GetBuyer(),
+		IssuedDate: time.Unix(invoice.IssuedAt, 0).Format("2006-01-02"),
+		Footer:     operation_setting.GetInvoiceSetting().FooterNote,
+	}
+	if invoice.Type == model.InvoiceTypeCreditNote {
+		view.Title = "CREDIT NOTE"
+		if related, err := model.GetInvoiceById(invoice.RelatedInvoiceId, 0); err == nil {
+			view.Related = related.Number
+		}
+	}
+	return view
+}
+
+func formatInvoiceMoney(currency string, amount float64) string {
+	return fmt.Sprintf("%s %.2f", currency, amount)
+}
+
+var invoiceHTMLTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": formatInvoiceMoney,
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}} {{.Number}}</title>
+<style>
+body{font-family:Helvetica,Arial,sans-serif;color:#222;max-width:760px;margin:32px auto}
+h1{font-size:22px;margin:0 0 16px}table{width:100%;border-collapse:collapse}
+td,th{padding:6px 8px;text-align:left}.items th{border-bottom:1px solid #999}
+.num{text-align:right}.parties td{vertical-align:top;width:50%}.footer{margin-top:32px;color:#666;font-size:12px}
+</style></head><body>
+<h1>{{.Title}}</h1>
+<table>
+<tr><td>Number: <b>{{.Number}}</b></td><td class="num">Date: {{.IssuedDate}}</td></tr>
+{{if .Related}}<tr><td>Original invoice: {{.Related}}</td><td></td></tr>{{end}}
+<tr><td>Order: {{.TradeNo}}</td><td class="num">Payment: {{.PaymentMethod}}</td></tr>
+</table>
+<table class="parties"><tr>
+<td><b>Seller</b><br>{{.Seller.Name}}{{with .Seller.Address}}<br>{{.}}{{end}}{{with .Seller.TaxId}}<br>Tax ID: {{.}}{{end}}{{with .Seller.Email}}<br>{{.}}{{end}}</td>
+<td><b>Bill to</b><br>{{with .Buyer.Company}}{{.}}<br>{{end}}{{.Buyer.Name}}{{with .Buyer.Address}}<br>{{.}}{{end}}{{with .Buyer.Country}}<br>{{.}}{{end}}{{with .Buyer.TaxId}}<br>Tax ID: {{.}}{{end}}{{with .Buyer.Email}}<br>{{.}}{{end}}</td>
+</tr></table>
+<table class="items">
+<tr><th>Description</th><th class="num">Amount</th></tr>
+<tr><td>{{.Description}}{{with .Reason}}<br><small>{{.}}</small>{{end}}</td><td class="num">{{money .Currency .Subtotal}}</td></tr>
+<tr><td class="num">Subtotal</td><td class="num">{{money .Currency .Subtotal}}</td></tr>
+<tr><td class="num">{{.TaxName}} ({{.TaxRate}}%)</td><td class="num">{{money .Currency .TaxAmount}}</td></tr>
+<tr><td class="num"><b>Total</b></td><td class="num"><b>{{money .Currency .Total}}</b></td></tr>
+</table>
+{{with .Footer}}<div class="footer">{{.}}</div>{{end}}
+</body></html>
+`))
+
+// RenderInvoice 以 HTML 或 PDF 格式渲染发票
+func RenderInvoice(w io.Writer, invoice *model.Invoice, format string) error {
+	switch format {
+	case InvoiceFormatHTML:
+		return invoiceHTMLTemplate.Execute(w, newInvoiceView(invoice))
+	case InvoiceFormatPDF:
+		return renderInvoicePDF(w, newInvoiceView(invoice))
+	default:
+		return fmt.Errorf("unsupported invoice format %q", format)
+	}
+}
+
+// renderInvoicePDF 默认使用内置 Helvetica 字体（仅支持西文字符），内容含无法显示的字符时
+// 返回 ErrInvoicePDFFontRequired 而不是输出乱码；需要中文等字符时通过 INVOICE_PDF_FONT 指定 UTF-8 TrueType 字体文件
+func renderInvoicePDF(w io.Writer, view invoiceView) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	family := "Helvetica"
+	cp1252 := pdf.UnicodeTranslatorFromDescriptor("")
+	unsupported := false
+	tr := func(s string) string {
+		for _, r := range s {
+			if r >= 0x80 && cp1252(string(r)) == "." {
+				unsupported = true
+				break
+			}
+		}
+		return cp1252(s)
+	}
+	if fontPath := common.GetEnvOrDefaultString("INVOICE_PDF_FONT", ""); fontPath != "" {
+		family = "InvoiceFont"
+		pdf.AddUTF8Font(family, "", fontPath)
+		pdf.AddUTF8Font(family, "B", fontPath)
+		tr = func(s string) string { return s }
+	}
+	pdf.SetMargins(18, 18, 18)
+	pdf.AddPage()
+	money := func(amount float64) string { return tr(formatInvoiceMoney(view.Currency, amount)) }
+
+	pdf.SetFont(family, "B", 18)
+	pdf.CellFormat(0, 10, tr(view.Title), "", 1, "L", false, 0, "")
+	pdf.SetFont(family, "", 10)
+	pdf.CellFormat(100, 6, tr("Number: "+view.Number), "", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 6, tr("Date: "+view.IssuedDate), "", 1, "R", false, 0, "")
+	if view.Related != "" {
+		pdf.CellFormat(0, 6, tr("Original invoice: "+view.Related), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(100, 6, tr("Order: "+view.TradeNo), "", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 6, tr("Payment: "+view.PaymentMethod), "", 1, "R", false, 0, "")
+	pdf.Ln(4)
+
+	partyLines := func(label string, party model.InvoiceParty) []string {
+		lines := []string{label}
+		for _, s := range []string{party.Company, party.Name, party.Address, party.Country} {
+			if s != "" {
+				lines = append(lines, s)
+			}
+		}
+		if party.TaxId != "" {
+			lines = append(lines, "Tax ID: "+party.TaxId)
+		}
+		if party.Email != "" {
+			lines = append(lines, party.Email)
+		}
+		return lines
+	}
+	seller := partyLines("Seller", view.Seller)
+	buyer := partyLines("Bill to", view.Buyer)
+	for i := 0; i < len(seller) || i < len(buyer); i++ {
+		style := ""
+		if i == 0 {
+			style = "B"
+		}
+		pdf.SetFont(family, style, 10)
+		left, right := "", ""
+		if i < len(seller) {
+			left = seller[i]
+		}
+		if i < len(buyer) {
+			right = buyer[i]
+		}
+		pdf.CellFormat(87, 5, tr(left), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, tr(right), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont(family, "B", 10)
+	pdf.CellFormat(124, 7, tr("Description"), "B", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 7, tr("Amount"), "B", 1, "R", false, 0, "")
+	pdf.SetFont(family, "", 10)
+	pdf.CellFormat(124, 7, tr(view.Description), "", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 7, money(view.Subtotal), "", 1, "R", false, 0, "")
+	if view.Reason != "" {
+		pdf.SetFont(family, "", 8)
+		pdf.MultiCell(124, 4, tr(view.Reason), "", "L", false)
+		pdf.SetFont(family, "", 10)
+	}
+	pdf.Ln(2)
+	pdf.CellFormat(124, 6, tr("Subtotal"), "T", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 6, money(view.Subtotal), "T", 1, "R", false, 0, "")
+	pdf.CellFormat(124, 6, tr(fmt.Sprintf("%s (%s%%)", view.TaxName, decimal.NewFromFloat(view.TaxRate).String())), "", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 6, money(view.TaxAmount), "", 1, "R", false, 0, "")
+	pdf.SetFont(family, "B", 11)
+	pdf.CellFormat(124, 8, tr("Total"), "", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 8, money(view.Total), "", 1, "R", false, 0, "")
+
+	if view.Footer != "" {
+		pdf.Ln(10)
+		pdf.SetFont(family, "", 8)
+		pdf.MultiCell(0, 4, tr(view.Footer), "", "L", false)
+	}
+
+	if unsupported {
+		return ErrInvoicePDFFontRequired
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// InvoiceFileName 下载时使用的文件名
+func InvoiceFileName(invoice *model.Invoice, format string) string {
+	return invoice.Number + "." + format
+}
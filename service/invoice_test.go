@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitInvoiceAmount(t *testing.T) {
+	amounts := SplitInvoiceAmount(119, 19)
+	require.Equal(t, 100.0, amounts.Subtotal)
+	require.Equal(t, 19.0, amounts.TaxAmount)
+	require.Equal(t, 119.0, amounts.Total)
+
+	amounts = SplitInvoiceAmount(10, 6)
+	require.Equal(t, 9.43, amounts.Subtotal)
+	require.Equal(t, 0.57, amounts.TaxAmount)
+
+	amounts = SplitInvoiceAmount(5.5, 0)
+	require.Equal(t, 5.5, amounts.Subtotal)
+	require.Zero(t, amounts.TaxAmount)
+}
+
+func TestRenderInvoice(t *testing.T) {
+	invoice := &model.Invoice{
+		Number:      "INV-2026-000001",
+		Type:        model.InvoiceTypeInvoice,
+		TradeNo:     "T1",
+		Currency:    "USD",
+		Subtotal:    100,
+		TaxName:     "VAT",
+		TaxRate:     19,
+		TaxAmount:   19,
+		Total:       119,
+		Description: "Top-up",
+		Seller:      common.GetJsonString(model.InvoiceParty{Name: "Seller Inc"}),
+		Buyer:       common.GetJsonString(model.InvoiceParty{Name: "<b>Buyer</b>"}),
+	}
+
+	var html bytes.Buffer
+	require.NoError(t, RenderInvoice(&html, invoice, InvoiceFormatHTML))
+	require.Contains(t, html.String(), "INV-2026-000001")
+	require.Contains(t, html.String(), "USD 119.00")
+	require.Contains(t, html.String(), "&lt;b&gt;Buyer&lt;/b&gt;")
+
+	var pdf bytes.Buffer
+	require.NoError(t, RenderInvoice(&pdf, invoice, InvoiceFormatPDF))
+	require.True(t, bytes.HasPrefix(pdf.Bytes(), []byte("%PDF")))
+
+	require.Error(t, RenderInvoice(&bytes.Buffer{}, invoice, "docx"))
+
+	// 内置字体无法显示中文时拒绝输出 PDF，HTML 不受影响
+	invoice.Description = "Subscription: 专业版"
+	require.ErrorIs(t, RenderInvoice(&bytes.Buffer{}, invoice, InvoiceFormatPDF), ErrInvoicePDFFontRequired)
+	html.Reset()
+	require.NoError(t, RenderInvoice(&html, invoice, InvoiceFormatHTML))
+	require.Contains(t, html.String(), "专业版")
+
+	// 西文扩展字符由 cp1252 支持
+	invoice.Description = "Café top-up €5"
+	require.NoError(t, RenderInvoice(&bytes.Buffer{}, invoice, InvoiceFormatPDF))
+}
@@ -0,0 +1,652 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	logExportQueueDir = "queue"
+	logExportDeadDir  = "dead"
+
+	// logExportMaxPending 内存中待落盘事件的上限，超过后立即落盘
+	logExportMaxPending = 5000
+	logExportMaxBackoff = 5 * time.Minute
+)
+
+var (
+	logExportSinkNameRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+	logExportSegmentRegex  = regexp.MustCompile(`^\d+-\d+\.ndjson$`)
+)
+
+// LogExportEvent 导出到外部系统的日志事件
+type LogExportEvent struct {
+	EventId          string          `json:"event_id"`
+	Source           string          `json:"source"`
+	Type             int             `json:"type"`
+	CreatedAt        int64           `json:"created_at"`
+	UserId           int             `json:"user_id"`
+	Username         string          `json:"username"`
+	TokenId          int             `json:"token_id"`
+	TokenName        string          `json:"token_name"`
+	ModelName        string          `json:"model_name"`
+	ChannelId        int             `json:"channel_id"`
+	Group            string          `json:"group"`
+	Quota            int             `json:"quota"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	UseTime          int             `json:"use_time"`
+	IsStream         bool            `json:"is_stream"`
+	RequestId        string          `json:"request_id,omitempty"`
+	Ip               string          `json:"ip,omitempty"`
+	Content          string          `json:"content,omitempty"`
+	Other            json.RawMessage `json:"other,omitempty"`
+}
+
+// LogExporter 日志导出目标，Export 返回 nil 表示整批投递成功
+type LogExporter interface {
+	Export(ctx context.Context, events [][]byte) error
+	Close() error
+}
+
+// LogExportSinkStatus 导出目标运行状态
+// PendingEvents 为尚未落盘的内存事件，进程崩溃时会丢失；DroppedEvents 为落盘失败而丢弃的事件数
+type LogExportSinkStatus struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	PendingEvents  int    `json:"pending_events"`
+	DroppedEvents  int64  `json:"dropped_events"`
+	QueueSegments  int    `json:"queue_segments"`
+	DeadSegments   int    `json:"dead_segments"`
+	Delivered      int64  `json:"delivered"`
+	LastError      string `json:"last_error,omitempty"`
+	LastErrorAt    int64  `json:"last_error_at,omitempty"`
+	LastDeliveryAt int64  `json:"last_delivery_at,omitempty"`
+}
+
+// LogExportDeadLetter 死信分段
+type LogExportDeadLetter struct {
+	Segment   string `json:"segment"`
+	Events    int    `json:"events"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+	Error     string `json:"error"`
+}
+
+func newLogExportEvent(source string, log *model.Log) LogExportEvent {
+	event := LogExportEvent{
+		EventId:          common.GetUUID(),
+		Source:           source,
+		Type:             log.Type,
+		CreatedAt:        log.CreatedAt,
+		UserId:           log.UserId,
+		Username:         log.Username,
+		TokenId:          log.TokenId,
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		ChannelId:        log.ChannelId,
+		Group:            log.Group,
+		Quota:            log.Quota,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		UseTime:          log.UseTime,
+		IsStream:         log.IsStream,
+		RequestId:        log.RequestId,
+		Ip:               log.Ip,
+		Content:          log.Content,
+	}
+	if log.Other != "" && json.Valid([]byte(log.Other)) {
+		event.Other = json.RawMessage(log.Other)
+	}
+	return event
+}
+
+// logExportSpool 本地持久化缓冲，每个分段文件为一批 NDJSON 事件，投递成功后删除
+type logExportSpool struct {
+	dir string
+	seq atomic.Int64
+}
+
+func newLogExportSpool(dir string) (*logExportSpool, error) {
+	for _, sub := range []string{logExportQueueDir, logExportDeadDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &logExportSpool{dir: dir}, nil
+}
+
+func (s *logExportSpool) write(events [][]byte) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(event)
+		buf.WriteByte('\n')
+	}
+	name := fmt.Sprintf("%d-%06d.ndjson", time.Now().UnixNano(), s.seq.Add(1)%1000000)
+	tmpPath := filepath.Join(s.dir, logExportQueueDir, "."+name+".tmp")
+	if err := writeFileSync(tmpPath, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(s.dir, logExportQueueDir, name))
+}
+
+// writeFileSync 写入并 fsync，保证分段在重命名前已持久化
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *logExportSpool) list(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, sub))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && logExportSegmentRegex.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *logExportSpool) read(sub string, name string) ([][]byte, error) {
+	file, err := os.Open(filepath.Join(s.dir, sub, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		events = append(events, append([]byte(nil), line...))
+	}
+	return events, scanner.Err()
+}
+
+func (s *logExportSpool) moveToDead(name string, reason string) error {
+	if err := os.Rename(filepath.Join(s.dir, logExportQueueDir, name), filepath.Join(s.dir, logExportDeadDir, name)); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, logExportDeadDir, name+".error"), []byte(reason), 0600)
+}
+
+func (s *logExportSpool) requeue(name string) error {
+	if !logExportSegmentRegex.MatchString(name) {
+		return fmt.Errorf("invalid segment %q", name)
+	}
+	if err := os.Rename(filepath.Join(s.dir, logExportDeadDir, name), filepath.Join(s.dir, logExportQueueDir, name)); err != nil {
+		return err
+	}
+	_ = os.Remove(filepath.Join(s.dir, logExportDeadDir, name+".error"))
+	return nil
+}
+
+func (s *logExportSpool) removeDead(name string) error {
+	if !logExportSegmentRegex.MatchString(name) {
+		return fmt.Errorf("invalid segment %q", name)
+	}
+	if err := os.Remove(filepath.Join(s.dir, logExportDeadDir, name)); err != nil {
+		return err
+	}
+	_ = os.Remove(filepath.Join(s.dir, logExportDeadDir, name+".error"))
+	return nil
+}
+
+// logExportRunner 单个导出目标的缓冲与投递状态
+// 事件先在内存中缓冲，每个周期（FlushIntervalSeconds）或积累到 logExportMaxPending 条时落盘，
+// 落盘后的事件至少投递一次；进程收到 SIGTERM 等信号退出时由 FlushLogExport 落盘，仅进程崩溃会丢失尚未落盘的事件
+type logExportRunner struct {
+	cfg      operation_setting.LogExportSinkConfig
+	exporter LogExporter
+	spool    *logExportSpool
+
+	mu      sync.Mutex
+	pending [][]byte
+	closed  bool
+
+	deliverMu      sync.Mutex
+	attempts       map[string]int
+	nextAttemptAt  time.Time
+	lastError      string
+	lastErrorAt    int64
+	lastDeliveryAt int64
+	delivered      atomic.Int64
+	dropped        atomic.Int64
+}
+
+func (r *logExportRunner) add(event []byte) {
+	r.mu.Lock()
+	if r.closed {
+		// 配置重载期间到达的事件直接落盘，由新的导出目标继续投递
+		r.mu.Unlock()
+		if err := r.spool.write([][]byte{event}); err != nil {
+			r.dropped.Add(1)
+			common.SysError(fmt.Sprintf("log export sink %s: failed to spool event: %s", r.cfg.Name, err.Error()))
+		}
+		return
+	}
+	r.pending = append(r.pending, event)
+	full := len(r.pending) >= logExportMaxPending
+	r.mu.Unlock()
+	if full {
+		r.flushPending()
+	}
+}
+
+// flushPending 将内存中的事件按批大小切分写入本地缓冲
+func (r *logExportRunner) flushPending() {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	batchSize := r.cfg.GetBatchSize()
+	for start := 0; start < len(pending); start += batchSize {
+		end := min(start+batchSize, len(pending))
+		if err := r.spool.write(pending[start:end]); err != nil {
+			r.dropped.Add(int64(end - start))
+			common.SysError(fmt.Sprintf("log export sink %s: failed to spool %d events: %s", r.cfg.Name, end-start, err.Error()))
+		}
+	}
+}
+
+// deliver 按顺序投递本地缓冲中的分段，失败时指数退避，超过重试次数后转入死信
+func (r *logExportRunner) deliver(ctx context.Context) {
+	r.deliverMu.Lock()
+	defer r.deliverMu.Unlock()
+
+	if time.Now().Before(r.nextAttemptAt) {
+		return
+	}
+	segments, err := r.spool.list(logExportQueueDir)
+	if err != nil {
+		common.SysError(fmt.Sprintf("log export sink %s: failed to list spool: %s", r.cfg.Name, err.Error()))
+		return
+	}
+	for _, segment := range segments {
+		events, err := r.spool.read(logExportQueueDir, segment)
+		if err == nil && len(events) > 0 {
+			err = r.exporter.Export(ctx, events)
+		}
+		if err != nil {
+			r.attempts[segment]++
+			attempts := r.attempts[segment]
+			r.lastError = err.Error()
+			r.lastErrorAt = common.GetTimestamp()
+			if attempts >= r.cfg.GetMaxRetries() {
+				logger.LogWarn(ctx, fmt.Sprintf("log export sink %s: segment %s moved to dead letter after %d attempts: %v", r.cfg.Name, segment, attempts, err))
+				if moveErr := r.spool.moveToDead(segment, err.Error()); moveErr != nil {
+					common.SysError(fmt.Sprintf("log export sink %s: failed to move segment %s to dead letter: %s", r.cfg.Name, segment, moveErr.Error()))
+				}
+				delete(r.attempts, segment)
+				continue
+			}
+			backoff := min(time.Duration(1<<min(attempts, 16))*time.Second, logExportMaxBackoff)
+			r.nextAttemptAt = time.Now().Add(backoff)
+			logger.LogWarn(ctx, fmt.Sprintf("log export sink %s: delivery failed (attempt %d), retry in %s: %v", r.cfg.Name, attempts, backoff, err))
+			return
+		}
+		if err := os.Remove(filepath.Join(r.spool.dir, logExportQueueDir, segment)); err != nil {
+			common.SysError(fmt.Sprintf("log export sink %s: failed to remove delivered segment %s: %s", r.cfg.Name, segment, err.Error()))
+		}
+		delete(r.attempts, segment)
+		r.delivered.Add(int64(len(events)))
+		r.lastDeliveryAt = common.GetTimestamp()
+	}
+}
+
+func (r *logExportRunner) status() LogExportSinkStatus {
+	r.mu.Lock()
+	pending := len(r.pending)
+	r.mu.Unlock()
+	queue, _ := r.spool.list(logExportQueueDir)
+	dead, _ := r.spool.list(logExportDeadDir)
+
+	r.deliverMu.Lock()
+	defer r.deliverMu.Unlock()
+	return LogExportSinkStatus{
+		Name:           r.cfg.Name,
+		Type:           r.cfg.Type,
+		PendingEvents:  pending,
+		DroppedEvents:  r.dropped.Load(),
+		QueueSegments:  len(queue),
+		DeadSegments:   len(dead),
+		Delivered:      r.delivered.Load(),
+		LastError:      r.lastError,
+		LastErrorAt:    r.lastErrorAt,
+		LastDeliveryAt: r.lastDeliveryAt,
+	}
+}
+
+func (r *logExportRunner) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.flushPending()
+	r.deliverMu.Lock()
+	defer r.deliverMu.Unlock()
+	if err := r.exporter.Close(); err != nil {
+		common.SysError(fmt.Sprintf("log export sink %s: failed to close exporter: %s", r.cfg.Name, err.Error()))
+	}
+}
+
+type logExportManager struct {
+	mu        sync.RWMutex
+	runners   map[string]*logExportRunner
+	configKey string
+}
+
+var (
+	logExportStartOnce sync.Once
+	logExportRunning   atomic.Bool
+	logExport          = &logExportManager{runners: map[string]*logExportRunner{}}
+)
+
+// getLogExportSpoolDir 本地缓冲目录，可通过 LOG_EXPORT_SPOOL_DIR 指定持久化目录
+func getLogExportSpoolDir() string {
+	if dir := common.GetEnvOrDefaultString("LOG_EXPORT_SPOOL_DIR", ""); dir != "" {
+		return dir
+	}
+	return filepath.Join(common.GetDiskCacheDir(), "log-export")
+}
+
+func newLogExporter(cfg operation_setting.LogExportSinkConfig) (LogExporter, error) {
+	switch cfg.Type {
+	case operation_setting.LogExportSinkTypeWebhook:
+		return newWebhookLogExporter(cfg)
+	case operation_setting.LogExportSinkTypeFile:
+		return newFileLogExporter(cfg)
+	case operation_setting.LogExportSinkTypeKafka:
+		return newKafkaLogExporter(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported log export sink type %q", cfg.Type)
+	}
+}
+
+// reconcile 配置变化时重建导出目标，移除的目标会先将内存中的事件落盘
+func (m *logExportManager) reconcile() {
+	setting := operation_setting.GetLogExportSetting()
+	data, _ := json.Marshal(setting)
+	configKey := string(data)
+
+	m.mu.RLock()
+	unchanged := configKey == m.configKey
+	m.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	runners := make(map[string]*logExportRunner)
+	if setting.Enabled {
+		for _, cfg := range setting.Sinks {
+			if !cfg.Enabled {
+				continue
+			}
+			if !logExportSinkNameRegex.MatchString(cfg.Name) {
+				common.SysError(fmt.Sprintf("log export sink name %q is invalid", cfg.Name))
+				continue
+			}
+			if _, ok := runners[cfg.Name]; ok {
+				common.SysError(fmt.Sprintf("log export sink name %q is duplicated", cfg.Name))
+				continue
+			}
+			exporter, err := newLogExporter(cfg)
+			if err != nil {
+				common.SysError(fmt.Sprintf("log export sink %s: %s", cfg.Name, err.Error()))
+				continue
+			}
+			spool, err := newLogExportSpool(filepath.Join(getLogExportSpoolDir(), cfg.Name))
+			if err != nil {
+				_ = exporter.Close()
+				common.SysError(fmt.Sprintf("log export sink %s: failed to create spool: %s", cfg.Name, err.Error()))
+				continue
+			}
+			runners[cfg.Name] = &logExportRunner{
+				cfg:      cfg,
+				exporter: exporter,
+				spool:    spool,
+				attempts: map[string]int{},
+			}
+		}
+	}
+
+	m.mu.Lock()
+	old := m.runners
+	m.runners = runners
+	m.configKey = configKey
+	m.mu.Unlock()
+
+	for _, runner := range old {
+		runner.close()
+	}
+	common.SysLog(fmt.Sprintf("log export sinks reloaded: %d active", len(runners)))
+}
+
+func (m *logExportManager) getRunner(name string) *logExportRunner {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.runners[name]
+}
+
+func (m *logExportManager) snapshot() []*logExportRunner {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	runners := make([]*logExportRunner, 0, len(m.runners))
+	for _, runner := range m.runners {
+		runners = append(runners, runner)
+	}
+	sort.Slice(runners, func(i, j int) bool {
+		return runners[i].cfg.Name < runners[j].cfg.Name
+	})
+	return runners
+}
+
+// dispatch 将日志事件分发到匹配过滤条件的导出目标
+func (m *logExportManager) dispatch(source string, log *model.Log) {
+	if !operation_setting.GetLogExportSetting().Enabled {
+		return
+	}
+	var data []byte
+	for _, runner := range m.snapshot() {
+		if !runner.cfg.Match(source, log.UserId, log.Group, log.ModelName) {
+			continue
+		}
+		if data == nil {
+			var err error
+			data, err = common.Marshal(newLogExportEvent(source, log))
+			if err != nil {
+				common.SysError("failed to marshal log export event: " + err.Error())
+				return
+			}
+		}
+		runner.add(data)
+	}
+}
+
+func (m *logExportManager) tick() {
+	if !logExportRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer logExportRunning.Store(false)
+
+	m.reconcile()
+	for _, runner := range m.snapshot() {
+		runner.flushPending()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		runner.deliver(ctx)
+		cancel()
+	}
+}
+
+// StartLogExportTask 注册日志导出回调并定期投递本地缓冲中的事件
+// 每个节点独立导出本节点产生的日志
+func StartLogExportTask() {
+	logExportStartOnce.Do(func() {
+		model.SetLogExportHook(logExport.dispatch)
+		gopool.Go(func() {
+			interval := time.Duration(max(operation_setting.GetLogExportSetting().FlushIntervalSeconds, 1)) * time.Second
+			logger.LogInfo(context.Background(), fmt.Sprintf("log export task started: tick=%s", interval))
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				logExport.tick()
+			}
+		})
+	})
+}
+
+// FlushLogExport 将内存中的事件落盘，用于进程退出前保证事件不丢失
+func FlushLogExport() {
+	for _, runner := range logExport.snapshot() {
+		runner.flushPending()
+	}
+}
+
+// GetLogExportStatus 获取所有导出目标的运行状态
+func GetLogExportStatus() []LogExportSinkStatus {
+	runners := logExport.snapshot()
+	statuses := make([]LogExportSinkStatus, 0, len(runners))
+	for _, runner := range runners {
+		statuses = append(statuses, runner.status())
+	}
+	return statuses
+}
+
+func getLogExportSpool(sink string) (*logExportSpool, error) {
+	if runner := logExport.getRunner(sink); runner != nil {
+		return runner.spool, nil
+	}
+	// 已停用的导出目标仍可查看和处理遗留的死信
+	if !logExportSinkNameRegex.MatchString(sink) {
+		return nil, errors.New("invalid sink name")
+	}
+	dir := filepath.Join(getLogExportSpoolDir(), sink)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("sink %s not found", sink)
+	}
+	return &logExportSpool{dir: dir}, nil
+}
+
+// ListLogExportDeadLetters 列出导出目标的死信分段
+func ListLogExportDeadLetters(sink string) ([]LogExportDeadLetter, error) {
+	spool, err := getLogExportSpool(sink)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := spool.list(logExportDeadDir)
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]LogExportDeadLetter, 0, len(segments))
+	for _, segment := range segments {
+		letter := LogExportDeadLetter{Segment: segment}
+		if info, err := os.Stat(filepath.Join(spool.dir, logExportDeadDir, segment)); err == nil {
+			letter.Size = info.Size()
+			letter.CreatedAt = info.ModTime().Unix()
+		}
+		if events, err := spool.read(logExportDeadDir, segment); err == nil {
+			letter.Events = len(events)
+		}
+		if reason, err := os.ReadFile(filepath.Join(spool.dir, logExportDeadDir, segment+".error")); err == nil {
+			letter.Error = string(reason)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// GetLogExportDeadLetterEvents 读取死信分段中的事件
+func GetLogExportDeadLetterEvents(sink string, segment string) ([]json.RawMessage, error) {
+	if !logExportSegmentRegex.MatchString(segment) {
+		return nil, fmt.Errorf("invalid segment %q", segment)
+	}
+	spool, err := getLogExportSpool(sink)
+	if err != nil {
+		return nil, err
+	}
+	events, err := spool.read(logExportDeadDir, segment)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]json.RawMessage, 0, len(events))
+	for _, event := range events {
+		result = append(result, event)
+	}
+	return result, nil
+}
+
+// RetryLogExportDeadLetters 将死信分段放回投递队列，segments 为空时重试全部
+func RetryLogExportDeadLetters(sink string, segments []string) (int, error) {
+	return handleLogExportDeadLetters(sink, segments, (*logExportSpool).requeue)
+}
+
+// DeleteLogExportDeadLetters 删除死信分段，segments 为空时删除全部
+func DeleteLogExportDeadLetters(sink string, segments []string) (int, error) {
+	return handleLogExportDeadLetters(sink, segments, (*logExportSpool).removeDead)
+}
+
+func handleLogExportDeadLetters(sink string, segments []string, handle func(*logExportSpool, string) error) (int, error) {
+	spool, err := getLogExportSpool(sink)
+	if err != nil {
+		return 0, err
+	}
+	if len(segments) == 0 {
+		segments, err = spool.list(logExportDeadDir)
+		if err != nil {
+			return 0, err
+		}
+	}
+	count := 0
+	var errs []string
+	for _, segment := range segments {
+		if err := handle(spool, segment); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", segment, err))
+			continue
+		}
+		count++
+	}
+	if len(errs) > 0 {
+		return count, errors.New(strings.Join(errs, "; "))
+	}
+	return count, nil
+}
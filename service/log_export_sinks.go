@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/tidwall/gjson"
+)
+
+// webhookLogExporter 以签名的 HTTP 批量请求投递事件
+type webhookLogExporter struct {
+	name    string
+	url     string
+	secret  string
+	headers map[string]string
+}
+
+// LogExportWebhookPayload webhook 批量投递的负载
+type LogExportWebhookPayload struct {
+	Sink      string            `json:"sink"`
+	Events    []json.RawMessage `json:"events"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+func newWebhookLogExporter(cfg operation_setting.LogExportSinkConfig) (LogExporter, error) {
+	if cfg.Url == "" {
+		return nil, errors.New("webhook url is required")
+	}
+	return &webhookLogExporter{name: cfg.Name, url: cfg.Url, secret: cfg.Secret, headers: cfg.Headers}, nil
+}
+
+func (e *webhookLogExporter) Export(ctx context.Context, events [][]byte) error {
+	payload := LogExportWebhookPayload{
+		Sink:      e.name,
+		Events:    make([]json.RawMessage, 0, len(events)),
+		Timestamp: time.Now().Unix(),
+	}
+	for _, event := range events {
+		payload.Events = append(payload.Events, event)
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+
+	// SSRF防护：验证Webhook URL
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(e.url, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("request reject: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	if e.secret != "" {
+		req.Header.Set("X-Webhook-Signature", generateSignature(e.secret, payloadBytes))
+	}
+
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook request: %v", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *webhookLogExporter) Close() error {
+	return nil
+}
+
+// fileLogExporter 将事件追加到 NDJSON 文件，按大小轮转
+type fileLogExporter struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newFileLogExporter(cfg operation_setting.LogExportSinkConfig) (LogExporter, error) {
+	if cfg.FilePath == "" {
+		return nil, errors.New("file path is required")
+	}
+	maxFileMB := cfg.MaxFileMB
+	if maxFileMB <= 0 {
+		maxFileMB = 100
+	}
+	maxFiles := cfg.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = 10
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.FilePath), 0755); err != nil {
+		return nil, err
+	}
+	return &fileLogExporter{path: cfg.FilePath, maxBytes: int64(maxFileMB) << 20, maxFiles: maxFiles}, nil
+}
+
+func (e *fileLogExporter) open() error {
+	if e.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(e.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	e.file = file
+	e.size = info.Size()
+	return nil
+}
+
+// rotate 将当前文件重命名为带时间戳的归档，并删除超出数量的旧归档
+func (e *fileLogExporter) rotate() error {
+	if e.file != nil {
+		if err := e.file.Close(); err != nil {
+			return err
+		}
+		e.file = nil
+	}
+	archive := fmt.Sprintf("%s.%s", e.path, time.Now().Format("20060102-150405.000000000"))
+	if err := os.Rename(e.path, archive); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	archives, err := filepath.Glob(e.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(archives)
+	for len(archives) > e.maxFiles {
+		_ = os.Remove(archives[0])
+		archives = archives[1:]
+	}
+	return nil
+}
+
+func (e *fileLogExporter) Export(ctx context.Context, events [][]byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.open(); err != nil {
+		return err
+	}
+	if e.size > 0 && e.size >= e.maxBytes {
+		if err := e.rotate(); err != nil {
+			return err
+		}
+		if err := e.open(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(event)
+		buf.WriteByte('\n')
+	}
+	n, err := e.file.Write(buf.Bytes())
+	e.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return e.file.Sync()
+}
+
+func (e *fileLogExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// kafkaLogExporter 使用 Kafka 协议投递事件，以 user_id 作为消息 key 保证同一用户的事件有序
+type kafkaLogExporter struct {
+	writer *kafka.Writer
+}
+
+func newKafkaLogExporter(cfg operation_setting.LogExportSinkConfig) (LogExporter, error) {
+	brokers := make([]string, 0, len(cfg.Brokers))
+	for _, broker := range cfg.Brokers {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka brokers are required")
+	}
+	if cfg.Topic == "" {
+		return nil, errors.New("kafka topic is required")
+	}
+	return &kafkaLogExporter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    cfg.GetBatchSize(),
+			BatchTimeout: 50 * time.Millisecond,
+			MaxAttempts:  1,
+		},
+	}, nil
+}
+
+func (e *kafkaLogExporter) Export(ctx context.Context, events [][]byte) error {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, kafka.Message{
+			Key:   []byte(gjson.GetBytes(event, "user_id").String()),
+			Value: event,
+		})
+	}
+	return e.writer.WriteMessages(ctx, messages...)
+}
+
+func (e *kafkaLogExporter) Close() error {
+	return e.writer.Close()
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLogExporter struct {
+	err     error
+	batches [][][]byte
+}
+
+func (e *fakeLogExporter) Export(ctx context.Context, events [][]byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.batches = append(e.batches, events)
+	return nil
+}
+
+func (e *fakeLogExporter) Close() error {
+	return nil
+}
+
+func newTestLogExportRunner(t *testing.T, exporter LogExporter, cfg operation_setting.LogExportSinkConfig) *logExportRunner {
+	t.Helper()
+	spool, err := newLogExportSpool(t.TempDir())
+	require.NoError(t, err)
+	return &logExportRunner{cfg: cfg, exporter: exporter, spool: spool, attempts: map[string]int{}}
+}
+
+func TestLogExportRunnerDeliversInBatches(t *testing.T) {
+	t.Parallel()
+
+	exporter := &fakeLogExporter{}
+	runner := newTestLogExportRunner(t, exporter, operation_setting.LogExportSinkConfig{Name: "test", BatchSize: 2})
+	for _, event := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		runner.add([]byte(event))
+	}
+	runner.flushPending()
+	runner.deliver(context.Background())
+
+	require.Len(t, exporter.batches, 2)
+	require.Len(t, exporter.batches[0], 2)
+	require.Equal(t, `{"n":3}`, string(exporter.batches[1][0]))
+	require.EqualValues(t, 3, runner.delivered.Load())
+
+	segments, err := runner.spool.list(logExportQueueDir)
+	require.NoError(t, err)
+	require.Empty(t, segments)
+}
+
+func TestLogExportRunnerDeadLetterAndRetry(t *testing.T) {
+	t.Parallel()
+
+	exporter := &fakeLogExporter{err: errors.New("unavailable")}
+	runner := newTestLogExportRunner(t, exporter, operation_setting.LogExportSinkConfig{Name: "test", MaxRetries: 2})
+	runner.add([]byte(`{"n":1}`))
+	runner.flushPending()
+
+	runner.deliver(context.Background())
+	require.Equal(t, 1, runner.status().QueueSegments)
+	require.True(t, runner.nextAttemptAt.After(time.Now()))
+
+	runner.nextAttemptAt = time.Time{}
+	runner.deliver(context.Background())
+	status := runner.status()
+	require.Equal(t, 0, status.QueueSegments)
+	require.Equal(t, 1, status.DeadSegments)
+	require.Equal(t, "unavailable", status.LastError)
+
+	dead, err := runner.spool.list(logExportDeadDir)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	reason, err := os.ReadFile(filepath.Join(runner.spool.dir, logExportDeadDir, dead[0]+".error"))
+	require.NoError(t, err)
+	require.Equal(t, "unavailable", string(reason))
+
+	require.Error(t, runner.spool.requeue("../escape.ndjson"))
+	require.NoError(t, runner.spool.requeue(dead[0]))
+	exporter.err = nil
+	runner.nextAttemptAt = time.Time{}
+	runner.deliver(context.Background())
+	require.Len(t, exporter.batches, 1)
+	require.Equal(t, 0, runner.status().DeadSegments)
+}
+
+func TestLogExportRunnerCountsDroppedEvents(t *testing.T) {
+	t.Parallel()
+
+	runner := newTestLogExportRunner(t, &fakeLogExporter{}, operation_setting.LogExportSinkConfig{Name: "test", BatchSize: 2})
+	for _, event := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		runner.add([]byte(event))
+	}
+	require.Equal(t, 3, runner.status().PendingEvents)
+
+	require.NoError(t, os.RemoveAll(filepath.Join(runner.spool.dir, logExportQueueDir)))
+	runner.flushPending()
+	status := runner.status()
+	require.Equal(t, 0, status.PendingEvents)
+	require.EqualValues(t, 3, status.DroppedEvents)
+}
+
+func TestFileLogExporterRotates(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "export.ndjson")
+	exporter, err := newFileLogExporter(operation_setting.LogExportSinkConfig{FilePath: path, MaxFiles: 1})
+	require.NoError(t, err)
+	fileExporter := exporter.(*fileLogExporter)
+	fileExporter.maxBytes = 10
+	defer exporter.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, exporter.Export(context.Background(), [][]byte{[]byte(`{"n":12345}`)}))
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"n\":12345}\n", string(data))
+
+	archives, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, archives, 1)
+}
+
+func TestLogExportSinkMatch(t *testing.T) {
+	t.Parallel()
+
+	cfg := operation_setting.LogExportSinkConfig{
+		Sources:    []string{"consume"},
+		ModelNames: []string{"gpt-4*", "claude-3-haiku"},
+	}
+	require.True(t, cfg.Match("consume", 1, "default", "gpt-4o"))
+	require.True(t, cfg.Match("consume", 1, "default", "claude-3-haiku"))
+	require.False(t, cfg.Match("error", 1, "default", "gpt-4o"))
+	require.False(t, cfg.Match("consume", 1, "default", "claude-3-opus"))
+}
@@ -50,6 +50,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if len(relayInfo.GuardrailViolations) > 0 {
+		other["guardrail"] = relayInfo.GuardrailViolations
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
@@ -69,6 +73,7 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	AppendPayloadCaptureAdminInfo(ctx, adminInfo)
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
@@ -88,6 +93,16 @@ func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interf
 	if relayInfo.UserSetting.BillingPreference != "" {
 		other["billing_preference"] = relayInfo.UserSetting.BillingPreference
 	}
+	// service_tier / pricing_tier: 命中的分段计价规则，便于用户核对扣费
+	if relayInfo.PriceData.ServiceTier != "" {
+		other["service_tier"] = relayInfo.PriceData.ServiceTier
+	}
+	if relayInfo.PriceData.PricingTier != nil {
+		other["pricing_tier"] = relayInfo.PriceData.PricingTier
+	}
+	if relayInfo.PriceData.PricingSchedule != nil {
+		other["pricing_schedule"] = relayInfo.PriceData.PricingSchedule
+	}
 	if relayInfo.BillingSource == "subscription" {
 		if relayInfo.SubscriptionId != 0 {
 			other["subscription_id"] = relayInfo.SubscriptionId
@@ -211,6 +226,9 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.Price
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	if priceData.PricingSchedule != nil {
+		other["pricing_schedule"] = priceData.PricingSchedule
+	}
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
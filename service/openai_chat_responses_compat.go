@@ -1,7 +1,10 @@
 package service
 
 import (
+	"encoding/json"
+
 	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/service/openaicompat"
 )
 
@@ -16,3 +19,15 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	return openaicompat.ExtractOutputTextFromResponses(resp)
 }
+
+func ExtractFunctionCallsFromResponses(resp *dto.OpenAIResponsesResponse) []dto.ToolCallResponse {
+	return openaicompat.ExtractFunctionCallsFromResponses(resp)
+}
+
+func ParseResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	return openaicompat.ParseResponsesInput(input)
+}
+
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
+	return openaicompat.ResponsesRequestToChatCompletionsRequest(req, shouldCarryReasoningContent(info))
+}
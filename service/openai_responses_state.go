@@ -0,0 +1,323 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/samber/hot"
+)
+
+const (
+	responsesStateNamespace   = "new-api:responses_state:v2"
+	responsesStateMemoryLimit = 10_000
+	// responsesStateMaxDepth previous_response_id 链的最大展开深度，防止异常数据导致无限循环
+	responsesStateMaxDepth = 512
+)
+
+var ErrResponsesStateNotFound = errors.New("responses state not found")
+
+var (
+	responsesStateCacheOnce sync.Once
+	responsesStateCache     *cachex.HybridCache[ResponsesState]
+)
+
+// ResponsesState 网关保存的单个响应，按令牌隔离
+type ResponsesState struct {
+	UserId    int `json:"user_id"`
+	TokenId   int `json:"token_id"`
+	ChannelId int `json:"channel_id"`
+	// ChannelKeyIndex 多密钥渠道使用的密钥序号，不同密钥可能对应不同的上游账号
+	ChannelKeyIndex    int    `json:"channel_key_index"`
+	Model              string `json:"model"`
+	PreviousResponseId string `json:"previous_response_id,omitempty"`
+	// UpstreamStore 上游是否也保存了该响应
+	UpstreamStore bool `json:"upstream_store"`
+	// Input 本轮请求的输入项，历史输入沿 PreviousResponseId 向前查找
+	Input     []json.RawMessage `json:"input"`
+	Response  json.RawMessage   `json:"response"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+// heldBy 续接请求命中保存该响应的同一上游账号时，可直接透传 previous_response_id
+func (s *ResponsesState) heldBy(info *relaycommon.RelayInfo) bool {
+	if !s.UpstreamStore || s.ChannelId != info.ChannelId {
+		return false
+	}
+	return !info.ChannelIsMultiKey || s.ChannelKeyIndex == info.ChannelMultiKeyIndex
+}
+
+// OutputItems 响应的输出项
+func (s *ResponsesState) OutputItems() []json.RawMessage {
+	var response struct {
+		Output []json.RawMessage `json:"output"`
+	}
+	if err := common.Unmarshal(s.Response, &response); err != nil {
+		return nil
+	}
+	return response.Output
+}
+
+func getResponsesStateCache() *cachex.HybridCache[ResponsesState] {
+	responsesStateCacheOnce.Do(func() {
+		retention := operation_setting.GetResponsesStateSetting().GetRetention()
+		responsesStateCache = cachex.NewHybridCache[ResponsesState](cachex.HybridCacheConfig[ResponsesState]{
+			Namespace: cachex.Namespace(responsesStateNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponsesState]{},
+			Memory: func() *hot.HotCache[string, ResponsesState] {
+				return hot.NewHotCache[string, ResponsesState](hot.LRU, responsesStateMemoryLimit).
+					WithTTL(retention).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responsesStateCache
+}
+
+// ResponsesRequestStore 请求是否要求保存响应，未指定时默认保存
+func ResponsesRequestStore(request *dto.OpenAIResponsesRequest) bool {
+	store := true
+	if common.GetJsonType(request.Store) == "boolean" {
+		_ = common.Unmarshal(request.Store, &store)
+	}
+	return store
+}
+
+// GetResponsesState 读取令牌保存的响应，其他令牌的响应视为不存在
+func GetResponsesState(tokenId int, responseId string) (*ResponsesState, bool, error) {
+	state, found, err := getResponsesStateCache().Get(responseId)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	if state.TokenId != tokenId {
+		return nil, false, nil
+	}
+	return &state, true, nil
+}
+
+// DeleteResponsesState 删除令牌保存的响应，上游保存的副本不受影响
+func DeleteResponsesState(tokenId int, responseId string) (bool, error) {
+	_, found, err := GetResponsesState(tokenId, responseId)
+	if err != nil || !found {
+		return false, err
+	}
+	if _, err := getResponsesStateCache().DeleteMany([]string{responseId}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetResponsesHistory 沿 previous_response_id 链展开完整上下文：依次为每一轮的输入项与输出项
+func GetResponsesHistory(tokenId int, responseId string) ([]json.RawMessage, error) {
+	var chain []*ResponsesState
+	visited := make(map[string]bool)
+	for id := responseId; id != ""; {
+		if visited[id] || len(chain) >= responsesStateMaxDepth {
+			return nil, fmt.Errorf("previous_response_id chain of '%s' is too deep or cyclic", responseId)
+		}
+		visited[id] = true
+		state, found, err := GetResponsesState(tokenId, id)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrResponsesStateNotFound
+		}
+		chain = append(chain, state)
+		id = state.PreviousResponseId
+	}
+
+	var items []json.RawMessage
+	for i := len(chain) - 1; i >= 0; i-- {
+		items = append(items, chain[i].Input...)
+		items = append(items, chain[i].OutputItems()...)
+	}
+	return items, nil
+}
+
+// PrepareResponsesState 记录原生 Responses 请求的会话信息。续接的响应不在当前上游账号时，
+// 由网关展开历史作为完整输入发送，不再依赖上游保存的状态
+func PrepareResponsesState(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) error {
+	if !operation_setting.GetResponsesStateSetting().Enabled {
+		return nil
+	}
+	input, err := ParseResponsesInput(request.Input)
+	if err != nil {
+		// 输入格式交由上游校验，本轮不保存会话状态
+		return nil
+	}
+	info.ResponsesStateInfo = &relaycommon.ResponsesStateInfo{
+		PreviousResponseId: request.PreviousResponseID,
+		Input:              input,
+		Store:              ResponsesRequestStore(request),
+		UpstreamStore:      true,
+	}
+	if request.PreviousResponseID == "" {
+		return nil
+	}
+
+	state, found, err := GetResponsesState(info.TokenId, request.PreviousResponseID)
+	if err != nil {
+		return err
+	}
+	if !found || state.heldBy(info) {
+		return nil
+	}
+	history, err := GetResponsesHistory(info.TokenId, request.PreviousResponseID)
+	if errors.Is(err, ErrResponsesStateNotFound) {
+		// 历史不完整时原样转发，由上游决定能否续接
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	items, err := portableResponsesItems(history)
+	if err != nil {
+		return err
+	}
+	request.Input, err = common.Marshal(append(items, input...))
+	if err != nil {
+		return err
+	}
+	request.PreviousResponseID = ""
+	return nil
+}
+
+// portableResponsesItems 去掉历史项的 ID，并丢弃没有 encrypted_content 的推理项：
+// 这些 ID 只在原上游账号保存了响应时有效，发送到其他账号会被拒绝
+func portableResponsesItems(items []json.RawMessage) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var fields map[string]json.RawMessage
+		if err := common.Unmarshal(item, &fields); err != nil {
+			return nil, err
+		}
+		var itemType string
+		_ = common.Unmarshal(fields["type"], &itemType)
+		if itemType == "reasoning" && common.GetJsonType(fields["encrypted_content"]) != "string" {
+			continue
+		}
+		delete(fields, "id")
+		data, err := common.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+// MarkResponsesUpstreamStore 按最终发往上游的请求体判断上游是否保存响应，部分渠道会强制关闭 store
+func MarkResponsesUpstreamStore(info *relaycommon.RelayInfo, requestBody []byte) {
+	if info.ResponsesStateInfo == nil {
+		return
+	}
+	var body struct {
+		Store *bool `json:"store"`
+	}
+	if err := common.Unmarshal(requestBody, &body); err == nil && body.Store != nil {
+		info.ResponsesStateInfo.UpstreamStore = *body.Store
+	}
+}
+
+// RecordResponsesStateResponse 记录最终响应对象，未启用会话状态时忽略
+func RecordResponsesStateResponse(info *relaycommon.RelayInfo, response json.RawMessage) {
+	if info == nil || info.ResponsesStateInfo == nil || len(response) == 0 {
+		return
+	}
+	info.ResponsesStateInfo.Response = append(json.RawMessage(nil), response...)
+}
+
+func recordResponsesStateResponse(info *relaycommon.RelayInfo, response *dto.OpenAIResponsesResponse) {
+	if info.ResponsesStateInfo == nil {
+		return
+	}
+	data, err := common.Marshal(response)
+	if err != nil {
+		return
+	}
+	RecordResponsesStateResponse(info, data)
+}
+
+// SaveResponsesState 保存本轮输入与响应，store 为 false 的请求不保存
+func SaveResponsesState(info *relaycommon.RelayInfo) error {
+	stateInfo := info.ResponsesStateInfo
+	if stateInfo == nil || !stateInfo.Store || len(stateInfo.Response) == 0 {
+		return nil
+	}
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := common.Unmarshal(stateInfo.Response, &response); err != nil {
+		return err
+	}
+	if response.ID == "" {
+		return nil
+	}
+	return getResponsesStateCache().SetWithTTL(response.ID, ResponsesState{
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		ChannelId:          info.ChannelId,
+		ChannelKeyIndex:    info.ChannelMultiKeyIndex,
+		Model:              info.OriginModelName,
+		PreviousResponseId: stateInfo.PreviousResponseId,
+		UpstreamStore:      stateInfo.UpstreamStore && !stateInfo.Bridged,
+		Input:              stateInfo.Input,
+		Response:           stateInfo.Response,
+		CreatedAt:          common.GetTimestamp(),
+	}, operation_setting.GetResponsesStateSetting().GetRetention())
+}
+
+// ResponsesInputItems 以 input_items 接口的格式返回本轮输入项：字符串内容展开为内容块，缺少 ID 的项按序号生成
+func ResponsesInputItems(responseId string, state *ResponsesState) ([]json.RawMessage, error) {
+	suffix := strings.TrimPrefix(responseId, "resp_")
+	items := make([]json.RawMessage, 0, len(state.Input))
+	for i, item := range state.Input {
+		var fields map[string]json.RawMessage
+		if err := common.Unmarshal(item, &fields); err != nil {
+			return nil, err
+		}
+		var itemType, role string
+		_ = common.Unmarshal(fields["type"], &itemType)
+		_ = common.Unmarshal(fields["role"], &role)
+		if itemType == "" {
+			itemType = "message"
+			fields["type"], _ = common.Marshal(itemType)
+		}
+		if itemType == "message" && common.GetJsonType(fields["content"]) == "string" {
+			var text string
+			_ = common.Unmarshal(fields["content"], &text)
+			partType := "input_text"
+			if role == "assistant" {
+				partType = "output_text"
+			}
+			fields["content"], _ = common.Marshal([]map[string]string{{"type": partType, "text": text}})
+		}
+		if common.GetJsonType(fields["id"]) != "string" {
+			prefix := "item"
+			if itemType == "message" {
+				prefix = "msg"
+			}
+			fields["id"], _ = common.Marshal(fmt.Sprintf("%s_%s_in%d", prefix, suffix, i))
+		}
+		data, err := common.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, data)
+	}
+	return items, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+// enableResponsesState 原生 Responses 会话状态默认关闭，测试中临时开启
+func enableResponsesState(t *testing.T) {
+	t.Helper()
+	setting := operation_setting.GetResponsesStateSetting()
+	saved := setting.Enabled
+	setting.Enabled = true
+	t.Cleanup(func() { setting.Enabled = saved })
+}
+
+func newResponsesStateRelayInfo(tokenId int, channelId int) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		UserId:          1,
+		TokenId:         tokenId,
+		OriginModelName: "gpt-5",
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelId: channelId,
+		},
+	}
+}
+
+// runResponsesTurn simulates one native Responses request on the given channel and saves its state.
+func runResponsesTurn(t *testing.T, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, responseId string, output string) {
+	t.Helper()
+	enableResponsesState(t)
+	require.NoError(t, PrepareResponsesState(info, request))
+	RecordResponsesStateResponse(info, json.RawMessage(fmt.Sprintf(`{"id":%q,"object":"response","output":%s}`, responseId, output)))
+	require.NoError(t, SaveResponsesState(info))
+}
+
+func TestResponsesStateRebuildsContextOnOtherChannel(t *testing.T) {
+	tokenId := 9101
+	first := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"hello"`)}
+	runResponsesTurn(t, newResponsesStateRelayInfo(tokenId, 1), first, "resp_state_1",
+		`[{"type":"reasoning","id":"rs_1","summary":[]},{"type":"message","id":"msg_1","role":"assistant","content":[{"type":"output_text","text":"hi"}]}]`)
+
+	// Same channel: the upstream holds the response, so previous_response_id is passed through.
+	sameChannel := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"again"`), PreviousResponseID: "resp_state_1"}
+	require.NoError(t, PrepareResponsesState(newResponsesStateRelayInfo(tokenId, 1), sameChannel))
+	require.Equal(t, "resp_state_1", sameChannel.PreviousResponseID)
+	require.JSONEq(t, `"again"`, string(sameChannel.Input))
+
+	// Other channel: the gateway expands the history without upstream item IDs.
+	second := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"how are you"`), PreviousResponseID: "resp_state_1"}
+	info := newResponsesStateRelayInfo(tokenId, 2)
+	require.NoError(t, PrepareResponsesState(info, second))
+	require.Empty(t, second.PreviousResponseID)
+	require.JSONEq(t, `[
+		{"type":"message","role":"user","content":"hello"},
+		{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hi"}]},
+		{"type":"message","role":"user","content":"how are you"}
+	]`, string(second.Input))
+
+	// The saved turn keeps its own input only and links to the previous response.
+	RecordResponsesStateResponse(info, json.RawMessage(`{"id":"resp_state_2","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"fine"}]}]}`))
+	require.NoError(t, SaveResponsesState(info))
+	history, err := GetResponsesHistory(tokenId, "resp_state_2")
+	require.NoError(t, err)
+	require.Len(t, history, 5)
+	require.JSONEq(t, `{"type":"message","role":"user","content":"how are you"}`, string(history[3]))
+}
+
+func TestResponsesStateRebuildsWhenUpstreamDidNotStore(t *testing.T) {
+	enableResponsesState(t)
+	tokenId := 9102
+	info := newResponsesStateRelayInfo(tokenId, 1)
+	first := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"hello"`)}
+	require.NoError(t, PrepareResponsesState(info, first))
+	MarkResponsesUpstreamStore(info, []byte(`{"model":"gpt-5","store":false}`))
+	RecordResponsesStateResponse(info, json.RawMessage(`{"id":"resp_state_3","output":[]}`))
+	require.NoError(t, SaveResponsesState(info))
+
+	follow := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"again"`), PreviousResponseID: "resp_state_3"}
+	require.NoError(t, PrepareResponsesState(newResponsesStateRelayInfo(tokenId, 1), follow))
+	require.Empty(t, follow.PreviousResponseID)
+}
+
+func TestResponsesStateScopedByToken(t *testing.T) {
+	request := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"hello"`), Store: json.RawMessage(`true`)}
+	runResponsesTurn(t, newResponsesStateRelayInfo(9103, 1), request, "resp_state_4", `[]`)
+
+	_, found, err := GetResponsesState(9104, "resp_state_4")
+	require.NoError(t, err)
+	require.False(t, found)
+	deleted, err := DeleteResponsesState(9104, "resp_state_4")
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	deleted, err = DeleteResponsesState(9103, "resp_state_4")
+	require.NoError(t, err)
+	require.True(t, deleted)
+	_, found, err = GetResponsesState(9103, "resp_state_4")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestResponsesStateSkipsStoreFalse(t *testing.T) {
+	request := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"hello"`), Store: json.RawMessage(`false`)}
+	runResponsesTurn(t, newResponsesStateRelayInfo(9105, 1), request, "resp_state_5", `[]`)
+
+	_, found, err := GetResponsesState(9105, "resp_state_5")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestResponsesStateDisabledByDefault(t *testing.T) {
+	require.False(t, operation_setting.GetResponsesStateSetting().Enabled)
+	info := newResponsesStateRelayInfo(9106, 1)
+	request := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: json.RawMessage(`"hello"`)}
+	require.NoError(t, PrepareResponsesState(info, request))
+	require.Nil(t, info.ResponsesStateInfo)
+}
+
+func TestResponsesInputItems(t *testing.T) {
+	state := &ResponsesState{Input: []json.RawMessage{
+		json.RawMessage(`{"role":"user","content":"hello"}`),
+		json.RawMessage(`{"type":"function_call_output","call_id":"call_1","output":"ok"}`),
+		json.RawMessage(`{"type":"message","id":"msg_client","role":"user","content":[{"type":"input_text","text":"hi"}]}`),
+	}}
+	items, err := ResponsesInputItems("resp_abc", state)
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	require.JSONEq(t, `{"id":"msg_abc_in0","type":"message","role":"user","content":[{"type":"input_text","text":"hello"}]}`, string(items[0]))
+	require.JSONEq(t, `{"id":"item_abc_in1","type":"function_call_output","call_id":"call_1","output":"ok"}`, string(items[1]))
+
+	var third map[string]any
+	require.NoError(t, common.Unmarshal(items[2], &third))
+	require.Equal(t, "msg_client", third["id"])
+}
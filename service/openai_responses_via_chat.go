@@ -0,0 +1,404 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/samber/lo"
+)
+
+const (
+	responsesStatusInProgress = "in_progress"
+	responsesStatusCompleted  = "completed"
+	responsesStatusIncomplete = "incomplete"
+)
+
+// NewResponsesConvertInfo 按 Responses 请求参数初始化转换状态，响应 ID 由网关生成
+func NewResponsesConvertInfo(request *dto.OpenAIResponsesRequest, model string) *relaycommon.ResponsesConvertInfo {
+	response := &dto.OpenAIResponsesResponse{
+		Object:             "response",
+		Model:              model,
+		Output:             []dto.ResponsesOutput{},
+		ParallelToolCalls:  true,
+		PreviousResponseID: json.RawMessage("null"),
+		Reasoning:          request.Reasoning,
+		Store:              ResponsesRequestStore(request),
+		Temperature:        lo.FromPtrOr(request.Temperature, 1),
+		TopP:               lo.FromPtrOr(request.TopP, 1),
+		ToolChoice:         json.RawMessage(`"auto"`),
+		Tools:              request.GetToolsMap(),
+		Truncation:         json.RawMessage(`"disabled"`),
+		User:               request.User,
+		Metadata:           request.Metadata,
+		MaxOutputTokens:    int(lo.FromPtrOr(request.MaxOutputTokens, 0)),
+	}
+	if common.GetJsonType(request.Instructions) == "string" {
+		_ = common.Unmarshal(request.Instructions, &response.Instructions)
+	}
+	if request.PreviousResponseID != "" {
+		response.PreviousResponseID, _ = common.Marshal(request.PreviousResponseID)
+	}
+	if common.GetJsonType(request.ParallelToolCalls) == "boolean" {
+		_ = common.Unmarshal(request.ParallelToolCalls, &response.ParallelToolCalls)
+	}
+	if len(request.ToolChoice) > 0 {
+		response.ToolChoice = request.ToolChoice
+	}
+	if response.Tools == nil {
+		response.Tools = []map[string]any{}
+	}
+	if len(response.Metadata) == 0 {
+		response.Metadata = json.RawMessage("{}")
+	}
+
+	return &relaycommon.ResponsesConvertInfo{
+		ResponseId: "resp_" + strings.ReplaceAll(common.GetUUID(), "-", ""),
+		CreatedAt:  common.GetTimestamp(),
+		Response:   response,
+		ToolItems:  make(map[int]int),
+	}
+}
+
+// responsesItemID 输出项 ID 由响应 ID 与输出序号派生，保证同一响应内唯一
+func responsesItemID(state *relaycommon.ResponsesConvertInfo, prefix string, outputIndex int) string {
+	return fmt.Sprintf("%s_%s_%d", prefix, strings.TrimPrefix(state.ResponseId, "resp_"), outputIndex)
+}
+
+func newResponsesEvent(state *relaycommon.ResponsesConvertInfo, eventType string) *dto.ResponsesStreamResponse {
+	event := &dto.ResponsesStreamResponse{
+		Type:           eventType,
+		SequenceNumber: state.SequenceNumber,
+	}
+	state.SequenceNumber++
+	return event
+}
+
+// responsesSnapshot 生成当前状态下的响应对象
+func responsesSnapshot(state *relaycommon.ResponsesConvertInfo, status string, usage *dto.Usage) *dto.OpenAIResponsesResponse {
+	response := *state.Response
+	response.ID = state.ResponseId
+	response.CreatedAt = int(state.CreatedAt)
+	response.Status, _ = common.Marshal(status)
+	response.Output = []dto.ResponsesOutput{}
+	if status != responsesStatusInProgress {
+		response.Output = append(response.Output, state.Output...)
+		response.Usage = responsesUsageFromChat(usage)
+		switch state.FinishReason {
+		case constant.FinishReasonLength:
+			response.IncompleteDetails = &dto.IncompleteDetails{Reason: "max_output_tokens"}
+		case constant.FinishReasonContentFilter:
+			response.IncompleteDetails = &dto.IncompleteDetails{Reason: "content_filter"}
+		}
+	}
+	return &response
+}
+
+// responsesFinishStatus length 与 content_filter 结束的响应在 Responses 中为 incomplete
+func responsesFinishStatus(finishReason string) string {
+	switch finishReason {
+	case constant.FinishReasonLength, constant.FinishReasonContentFilter:
+		return responsesStatusIncomplete
+	}
+	return responsesStatusCompleted
+}
+
+func responsesUsageFromChat(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &dto.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		InputTokensDetails: &dto.InputTokenDetails{
+			CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		},
+		OutputTokensDetails: &dto.OutputTokenDetails{
+			ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+// openResponsesItem 返回末尾仍未结束的指定类型输出项序号，不存在时返回 -1
+func openResponsesItem(state *relaycommon.ResponsesConvertInfo, itemType string) int {
+	last := len(state.Output) - 1
+	if last >= 0 && state.Output[last].Type == itemType && !state.ItemDone[last] {
+		return last
+	}
+	return -1
+}
+
+func addResponsesItem(state *relaycommon.ResponsesConvertInfo, item dto.ResponsesOutput) (int, *dto.ResponsesStreamResponse) {
+	outputIndex := len(state.Output)
+	state.Output = append(state.Output, item)
+	state.ItemDone = append(state.ItemDone, false)
+	event := newResponsesEvent(state, dto.ResponsesOutputTypeItemAdded)
+	event.OutputIndex = common.GetPointer(outputIndex)
+	added := item
+	event.Item = &added
+	return outputIndex, event
+}
+
+// closeResponsesItem 结束一个输出项，依类型补发 done 事件
+func closeResponsesItem(state *relaycommon.ResponsesConvertInfo, outputIndex int) []*dto.ResponsesStreamResponse {
+	if state.ItemDone[outputIndex] {
+		return nil
+	}
+	state.ItemDone[outputIndex] = true
+	item := &state.Output[outputIndex]
+	var events []*dto.ResponsesStreamResponse
+	switch item.Type {
+	case "message":
+		text := item.Content[0].Text
+		event := newResponsesEvent(state, "response.output_text.done")
+		event.ItemID = item.ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.ContentIndex = common.GetPointer(0)
+		event.Text = text
+		events = append(events, event)
+		event = newResponsesEvent(state, "response.content_part.done")
+		event.ItemID = item.ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.ContentIndex = common.GetPointer(0)
+		event.Part = &dto.ResponsesReasoningSummaryPart{Type: "output_text", Text: text}
+		events = append(events, event)
+	case "reasoning":
+		text := item.Summary[0].Text
+		event := newResponsesEvent(state, "response.reasoning_summary_text.done")
+		event.ItemID = item.ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.SummaryIndex = common.GetPointer(0)
+		event.Text = text
+		events = append(events, event)
+		event = newResponsesEvent(state, "response.reasoning_summary_part.done")
+		event.ItemID = item.ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.SummaryIndex = common.GetPointer(0)
+		event.Part = &dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: text}
+		events = append(events, event)
+	case "function_call":
+		event := newResponsesEvent(state, "response.function_call_arguments.done")
+		event.ItemID = item.ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.Arguments = item.Arguments
+		events = append(events, event)
+	}
+	if item.Type != "reasoning" {
+		item.Status = responsesStatusCompleted
+	}
+	event := newResponsesEvent(state, dto.ResponsesOutputTypeItemDone)
+	event.OutputIndex = common.GetPointer(outputIndex)
+	done := *item
+	event.Item = &done
+	return append(events, event)
+}
+
+// closeResponsesTextItems 开始新的输出项前结束仍在输出的推理与消息项，函数调用项保持打开直到流结束
+func closeResponsesTextItems(state *relaycommon.ResponsesConvertInfo) []*dto.ResponsesStreamResponse {
+	var events []*dto.ResponsesStreamResponse
+	for i := range state.Output {
+		if state.Output[i].Type == "function_call" {
+			continue
+		}
+		events = append(events, closeResponsesItem(state, i)...)
+	}
+	return events
+}
+
+func appendResponsesReasoning(state *relaycommon.ResponsesConvertInfo, delta string) []*dto.ResponsesStreamResponse {
+	var events []*dto.ResponsesStreamResponse
+	outputIndex := openResponsesItem(state, "reasoning")
+	if outputIndex < 0 {
+		events = append(events, closeResponsesTextItems(state)...)
+		var added *dto.ResponsesStreamResponse
+		outputIndex, added = addResponsesItem(state, dto.ResponsesOutput{
+			Type:    "reasoning",
+			ID:      responsesItemID(state, "rs", len(state.Output)),
+			Summary: []dto.ResponsesReasoningSummaryPart{},
+		})
+		events = append(events, added)
+		state.Output[outputIndex].Summary = []dto.ResponsesReasoningSummaryPart{{Type: "summary_text"}}
+		event := newResponsesEvent(state, "response.reasoning_summary_part.added")
+		event.ItemID = state.Output[outputIndex].ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.SummaryIndex = common.GetPointer(0)
+		event.Part = &dto.ResponsesReasoningSummaryPart{Type: "summary_text"}
+		events = append(events, event)
+	}
+	item := &state.Output[outputIndex]
+	item.Summary[0].Text += delta
+	event := newResponsesEvent(state, "response.reasoning_summary_text.delta")
+	event.ItemID = item.ID
+	event.OutputIndex = common.GetPointer(outputIndex)
+	event.SummaryIndex = common.GetPointer(0)
+	event.Delta = delta
+	return append(events, event)
+}
+
+func appendResponsesText(state *relaycommon.ResponsesConvertInfo, delta string) []*dto.ResponsesStreamResponse {
+	var events []*dto.ResponsesStreamResponse
+	outputIndex := openResponsesItem(state, "message")
+	if outputIndex < 0 {
+		events = append(events, closeResponsesTextItems(state)...)
+		var added *dto.ResponsesStreamResponse
+		outputIndex, added = addResponsesItem(state, dto.ResponsesOutput{
+			Type:   "message",
+			ID:     responsesItemID(state, "msg", len(state.Output)),
+			Status: responsesStatusInProgress,
+			Role:   "assistant",
+		})
+		events = append(events, added)
+		state.Output[outputIndex].Content = []dto.ResponsesOutputContent{{Type: "output_text", Annotations: []interface{}{}}}
+		event := newResponsesEvent(state, "response.content_part.added")
+		event.ItemID = state.Output[outputIndex].ID
+		event.OutputIndex = common.GetPointer(outputIndex)
+		event.ContentIndex = common.GetPointer(0)
+		event.Part = &dto.ResponsesReasoningSummaryPart{Type: "output_text"}
+		events = append(events, event)
+	}
+	item := &state.Output[outputIndex]
+	item.Content[0].Text += delta
+	event := newResponsesEvent(state, "response.output_text.delta")
+	event.ItemID = item.ID
+	event.OutputIndex = common.GetPointer(outputIndex)
+	event.ContentIndex = common.GetPointer(0)
+	event.Delta = delta
+	return append(events, event)
+}
+
+func appendResponsesToolCall(state *relaycommon.ResponsesConvertInfo, toolCall dto.ToolCallResponse) []*dto.ResponsesStreamResponse {
+	var events []*dto.ResponsesStreamResponse
+	toolIndex := lo.FromPtrOr(toolCall.Index, 0)
+	outputIndex, ok := state.ToolItems[toolIndex]
+	if !ok {
+		events = append(events, closeResponsesTextItems(state)...)
+		callID := toolCall.ID
+		if callID == "" {
+			callID = fmt.Sprintf("call_%s_%d", strings.TrimPrefix(state.ResponseId, "resp_"), toolIndex)
+		}
+		var added *dto.ResponsesStreamResponse
+		outputIndex, added = addResponsesItem(state, dto.ResponsesOutput{
+			Type:   "function_call",
+			ID:     responsesItemID(state, "fc", len(state.Output)),
+			Status: responsesStatusInProgress,
+			CallId: callID,
+			Name:   toolCall.Function.Name,
+		})
+		state.ToolItems[toolIndex] = outputIndex
+		events = append(events, added)
+	}
+	if toolCall.Function.Arguments == "" {
+		return events
+	}
+	item := &state.Output[outputIndex]
+	item.Arguments += toolCall.Function.Arguments
+	event := newResponsesEvent(state, "response.function_call_arguments.delta")
+	event.ItemID = item.ID
+	event.OutputIndex = common.GetPointer(outputIndex)
+	event.Delta = toolCall.Function.Arguments
+	return append(events, event)
+}
+
+func startResponsesStream(state *relaycommon.ResponsesConvertInfo) []*dto.ResponsesStreamResponse {
+	state.Started = true
+	created := newResponsesEvent(state, "response.created")
+	created.Response = responsesSnapshot(state, responsesStatusInProgress, nil)
+	inProgress := newResponsesEvent(state, "response.in_progress")
+	inProgress.Response = responsesSnapshot(state, responsesStatusInProgress, nil)
+	return []*dto.ResponsesStreamResponse{created, inProgress}
+}
+
+// StreamResponseOpenAI2Responses 将 Chat Completions 流响应转换为 Responses 流事件，仅转换第一个候选
+func StreamResponseOpenAI2Responses(streamResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ResponsesStreamResponse {
+	state := info.ResponsesConvertInfo
+	if state.Done {
+		return nil
+	}
+	var events []*dto.ResponsesStreamResponse
+	if !state.Started {
+		events = append(events, startResponsesStream(state)...)
+	}
+	for _, choice := range streamResponse.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			events = append(events, appendResponsesReasoning(state, reasoning)...)
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			events = append(events, appendResponsesText(state, text)...)
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			events = append(events, appendResponsesToolCall(state, toolCall)...)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			state.FinishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+// FinishResponsesStream 上游流结束后结束所有输出项，并发送带最终用量的 response.completed 或 response.incomplete
+func FinishResponsesStream(info *relaycommon.RelayInfo, usage *dto.Usage) []*dto.ResponsesStreamResponse {
+	state := info.ResponsesConvertInfo
+	if state.Done {
+		return nil
+	}
+	var events []*dto.ResponsesStreamResponse
+	if !state.Started {
+		events = append(events, startResponsesStream(state)...)
+	}
+	for i := range state.Output {
+		events = append(events, closeResponsesItem(state, i)...)
+	}
+	state.Done = true
+	status := responsesFinishStatus(state.FinishReason)
+	event := newResponsesEvent(state, "response."+status)
+	event.Response = responsesSnapshot(state, status, usage)
+	recordResponsesStateResponse(info, event.Response)
+	return append(events, event)
+}
+
+// ResponseOpenAI2Responses 将 Chat Completions 非流式响应转换为 Responses 响应对象
+func ResponseOpenAI2Responses(response *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.OpenAIResponsesResponse {
+	state := info.ResponsesConvertInfo
+	for _, choice := range response.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			appendResponsesReasoning(state, reasoning)
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			appendResponsesText(state, text)
+		}
+		for i, toolCall := range choice.Message.ParseToolCalls() {
+			appendResponsesToolCall(state, dto.ToolCallResponse{
+				Index: common.GetPointer(i),
+				ID:    toolCall.ID,
+				Function: dto.FunctionResponse{
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				},
+			})
+		}
+		state.FinishReason = choice.FinishReason
+	}
+	for i := range state.Output {
+		closeResponsesItem(state, i)
+	}
+	state.Done = true
+	responsesResponse := responsesSnapshot(state, responsesFinishStatus(state.FinishReason), &response.Usage)
+	recordResponsesStateResponse(info, responsesResponse)
+	return responsesResponse
+}
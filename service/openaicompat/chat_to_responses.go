@@ -234,10 +234,22 @@ func ChatCompletionsRequestToResponsesRequest(req *dto.GeneralOpenAIRequest) (*d
 					"input_audio": part.InputAudio,
 				})
 			case dto.ContentTypeFile:
-				contentParts = append(contentParts, map[string]any{
+				// Responses: {"type":"input_file","filename":"...","file_data":"data:..."} or {"type":"input_file","file_id":"..."}
+				filePart := map[string]any{
 					"type": "input_file",
-					"file": part.File,
-				})
+				}
+				if file := part.GetFile(); file != nil {
+					if file.FileId != "" {
+						filePart["file_id"] = file.FileId
+					}
+					if file.FileName != "" {
+						filePart["filename"] = file.FileName
+					}
+					if file.FileData != "" {
+						filePart["file_data"] = file.FileData
+					}
+				}
+				contentParts = append(contentParts, filePart)
 			case dto.ContentTypeVideoUrl:
 				contentParts = append(contentParts, map[string]any{
 					"type":      "input_video",
@@ -0,0 +1,461 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// responsesInputItem Responses 请求 input 中的单个输入项，覆盖消息、函数调用、函数输出与推理项
+type responsesInputItem struct {
+	Type      string                              `json:"type"`
+	ID        string                              `json:"id"`
+	Role      string                              `json:"role"`
+	Content   json.RawMessage                     `json:"content"`
+	CallID    string                              `json:"call_id"`
+	Name      string                              `json:"name"`
+	Arguments string                              `json:"arguments"`
+	Output    json.RawMessage                     `json:"output"`
+	Summary   []dto.ResponsesReasoningSummaryPart `json:"summary"`
+}
+
+type responsesContentPart struct {
+	Type       string                 `json:"type"`
+	Text       string                 `json:"text"`
+	Refusal    string                 `json:"refusal"`
+	ImageURL   string                 `json:"image_url"`
+	Detail     string                 `json:"detail"`
+	FileID     string                 `json:"file_id"`
+	FileData   string                 `json:"file_data"`
+	FileURL    string                 `json:"file_url"`
+	Filename   string                 `json:"filename"`
+	InputAudio *dto.MessageInputAudio `json:"input_audio"`
+}
+
+// ParseResponsesInput 将 input 规范化为输入项数组，字符串输入视为一条用户消息
+func ParseResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	case "null", "":
+		return nil, nil
+	default:
+		return nil, errors.New("input must be a string or an array")
+	}
+}
+
+// ResponsesRequestToChatCompletionsRequest 将 Responses 请求转换为 Chat Completions 请求，
+// 用于只支持 Chat Completions 的上游。carryReasoning 为 true 时历史推理摘要以 reasoning_content 回传
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest, carryReasoning bool) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.Model == "" {
+		return nil, errors.New("model is required")
+	}
+
+	items, err := ParseResponsesInput(req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]dto.Message, 0, len(items)+1)
+	if common.GetJsonType(req.Instructions) == "string" {
+		var instructions string
+		_ = common.Unmarshal(req.Instructions, &instructions)
+		if strings.TrimSpace(instructions) != "" {
+			messages = append(messages, dto.Message{
+				Role:    "system",
+				Content: instructions,
+			})
+		}
+	}
+	itemMessages, err := responsesItemsToChatMessages(items, carryReasoning)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, itemMessages...)
+
+	out := &dto.GeneralOpenAIRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Stream:      req.Stream,
+		MaxTokens:   req.MaxOutputTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		User:        req.User,
+	}
+	if req.Reasoning != nil {
+		out.ReasoningEffort = req.Reasoning.Effort
+	}
+	if common.GetJsonType(req.ParallelToolCalls) == "boolean" {
+		var parallel bool
+		_ = common.Unmarshal(req.ParallelToolCalls, &parallel)
+		out.ParallelTooCalls = &parallel
+	}
+	if common.GetJsonType(req.PromptCacheKey) == "string" {
+		_ = common.Unmarshal(req.PromptCacheKey, &out.PromptCacheKey)
+	}
+
+	out.Tools = responsesToolsToChat(req.Tools)
+	if len(out.Tools) > 0 {
+		out.ToolChoice = responsesToolChoiceToChat(req.ToolChoice)
+	}
+	out.ResponseFormat = responsesTextFormatToChat(req.Text)
+
+	return out, nil
+}
+
+func responsesItemsToChatMessages(items []json.RawMessage, carryReasoning bool) ([]dto.Message, error) {
+	messages := make([]dto.Message, 0, len(items))
+	// 推理项与随后的助手消息、函数调用合并为同一条 assistant 消息
+	var reasoning strings.Builder
+	var assistant *dto.Message
+	var toolCalls []dto.ToolCallResponse
+
+	flushAssistant := func() {
+		if assistant == nil && len(toolCalls) == 0 {
+			reasoning.Reset()
+			return
+		}
+		if assistant == nil {
+			assistant = &dto.Message{Role: "assistant", Content: ""}
+		}
+		if len(toolCalls) > 0 {
+			assistant.SetToolCalls(toolCalls)
+		}
+		if carryReasoning && reasoning.Len() > 0 {
+			assistant.ReasoningContent = reasoning.String()
+		}
+		messages = append(messages, *assistant)
+		assistant = nil
+		toolCalls = nil
+		reasoning.Reset()
+	}
+
+	for _, raw := range items {
+		var item responsesInputItem
+		if err := common.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("invalid input item: %w", err)
+		}
+		itemType := item.Type
+		if itemType == "" && item.Role != "" {
+			itemType = "message"
+		}
+
+		switch itemType {
+		case "message":
+			role := strings.TrimSpace(item.Role)
+			if role == "assistant" {
+				text := responsesContentText(item.Content)
+				if assistant != nil || len(toolCalls) > 0 {
+					flushAssistant()
+				}
+				assistant = &dto.Message{Role: "assistant", Content: text}
+				continue
+			}
+			flushAssistant()
+			if role == "developer" {
+				// 大多数 Chat Completions 上游不识别 developer 角色
+				role = "system"
+			}
+			message, err := responsesMessageToChat(role, item.Content)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		case "function_call":
+			callID := strings.TrimSpace(item.CallID)
+			if callID == "" {
+				callID = item.ID
+			}
+			toolCalls = append(toolCalls, dto.ToolCallResponse{
+				ID:   callID,
+				Type: "function",
+				Function: dto.FunctionResponse{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			})
+		case "function_call_output":
+			flushAssistant()
+			messages = append(messages, dto.Message{
+				Role:       "tool",
+				ToolCallId: item.CallID,
+				Content:    responsesFunctionOutputText(item.Output),
+			})
+		case "reasoning":
+			if assistant != nil || len(toolCalls) > 0 {
+				flushAssistant()
+			}
+			for _, part := range item.Summary {
+				if part.Text == "" {
+					continue
+				}
+				if reasoning.Len() > 0 {
+					reasoning.WriteString("\n\n")
+				}
+				reasoning.WriteString(part.Text)
+			}
+		case "item_reference":
+			return nil, fmt.Errorf("input item type %q is not supported by this channel", itemType)
+		default:
+			// 内置工具调用记录等上游无法理解的输入项直接忽略
+			continue
+		}
+	}
+	flushAssistant()
+	return messages, nil
+}
+
+func responsesMessageToChat(role string, content json.RawMessage) (dto.Message, error) {
+	message := dto.Message{Role: role}
+	switch common.GetJsonType(content) {
+	case "string":
+		var text string
+		_ = common.Unmarshal(content, &text)
+		message.Content = text
+		return message, nil
+	case "array":
+	default:
+		message.Content = ""
+		return message, nil
+	}
+
+	var parts []responsesContentPart
+	if err := common.Unmarshal(content, &parts); err != nil {
+		return message, fmt.Errorf("invalid message content: %w", err)
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: part.Text,
+			})
+		case "input_image":
+			if part.ImageURL == "" {
+				continue
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{
+					Url:    part.ImageURL,
+					Detail: part.Detail,
+				},
+			})
+		case "input_file":
+			if part.FileData == "" && part.FileID == "" {
+				if part.FileURL != "" {
+					mediaContents = append(mediaContents, dto.MediaContent{
+						Type: dto.ContentTypeText,
+						Text: fmt.Sprintf("File: %s", part.FileURL),
+					})
+				}
+				continue
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{
+					FileName: part.Filename,
+					FileData: part.FileData,
+					FileId:   part.FileID,
+				},
+			})
+		case "input_audio":
+			if part.InputAudio == nil {
+				continue
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:       dto.ContentTypeInputAudio,
+				InputAudio: part.InputAudio,
+			})
+		}
+	}
+	// 纯文本内容合并为字符串，兼容不支持多模态数组的上游
+	if len(mediaContents) > 0 && len(mediaContents) == countTextContents(mediaContents) {
+		var sb strings.Builder
+		for i, mediaContent := range mediaContents {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(mediaContent.Text)
+		}
+		message.Content = sb.String()
+		return message, nil
+	}
+	message.SetMediaContent(mediaContents)
+	return message, nil
+}
+
+func countTextContents(contents []dto.MediaContent) int {
+	count := 0
+	for _, content := range contents {
+		if content.Type == dto.ContentTypeText {
+			count++
+		}
+	}
+	return count
+}
+
+// responsesContentText 提取助手消息中的文本，拒答内容按文本处理
+func responsesContentText(content json.RawMessage) string {
+	switch common.GetJsonType(content) {
+	case "string":
+		var text string
+		_ = common.Unmarshal(content, &text)
+		return text
+	case "array":
+		var parts []responsesContentPart
+		_ = common.Unmarshal(content, &parts)
+		var sb strings.Builder
+		for _, part := range parts {
+			if part.Text != "" {
+				sb.WriteString(part.Text)
+			} else if part.Refusal != "" {
+				sb.WriteString(part.Refusal)
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+func responsesFunctionOutputText(output json.RawMessage) string {
+	switch common.GetJsonType(output) {
+	case "string":
+		var text string
+		_ = common.Unmarshal(output, &text)
+		return text
+	case "array":
+		var parts []responsesContentPart
+		if err := common.Unmarshal(output, &parts); err == nil {
+			var sb strings.Builder
+			for _, part := range parts {
+				sb.WriteString(part.Text)
+			}
+			if sb.Len() > 0 {
+				return sb.String()
+			}
+		}
+	case "null", "":
+		return ""
+	}
+	return string(output)
+}
+
+// responsesToolsToChat 仅保留函数工具，内置工具（web_search、file_search 等）在 Chat Completions 上游不可用
+func responsesToolsToChat(toolsRaw json.RawMessage) []dto.ToolCallRequest {
+	if len(toolsRaw) == 0 {
+		return nil
+	}
+	var tools []struct {
+		Type        string `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Parameters  any    `json:"parameters"`
+	}
+	if err := common.Unmarshal(toolsRaw, &tools); err != nil {
+		return nil
+	}
+	chatTools := make([]dto.ToolCallRequest, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "function" || tool.Name == "" {
+			continue
+		}
+		chatTools = append(chatTools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return chatTools
+}
+
+func responsesToolChoiceToChat(toolChoiceRaw json.RawMessage) any {
+	switch common.GetJsonType(toolChoiceRaw) {
+	case "string":
+		var choice string
+		_ = common.Unmarshal(toolChoiceRaw, &choice)
+		return choice
+	case "object":
+		var choice struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		_ = common.Unmarshal(toolChoiceRaw, &choice)
+		if choice.Type == "function" && choice.Name != "" {
+			return map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": choice.Name,
+				},
+			}
+		}
+	}
+	return nil
+}
+
+// responsesTextFormatToChat 将 text.format 转换为 response_format，json_schema 的字段在 Responses 中是平铺的
+func responsesTextFormatToChat(textRaw json.RawMessage) *dto.ResponseFormat {
+	if len(textRaw) == 0 {
+		return nil
+	}
+	var text struct {
+		Format *struct {
+			Type        string          `json:"type"`
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			Schema      any             `json:"schema"`
+			Strict      json.RawMessage `json:"strict"`
+		} `json:"format"`
+	}
+	if err := common.Unmarshal(textRaw, &text); err != nil || text.Format == nil {
+		return nil
+	}
+	switch text.Format.Type {
+	case "json_object":
+		return &dto.ResponseFormat{Type: "json_object"}
+	case "json_schema":
+		jsonSchema, err := common.Marshal(dto.FormatJsonSchema{
+			Name:        text.Format.Name,
+			Description: text.Format.Description,
+			Schema:      text.Format.Schema,
+			Strict:      text.Format.Strict,
+		})
+		if err != nil {
+			return nil
+		}
+		return &dto.ResponseFormat{
+			Type:       "json_schema",
+			JsonSchema: jsonSchema,
+		}
+	}
+	return nil
+}
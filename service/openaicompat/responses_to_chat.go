@@ -42,28 +42,8 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 	created := resp.CreatedAt
 
 	var toolCalls []dto.ToolCallResponse
-	if text == "" && len(resp.Output) > 0 {
-		for _, out := range resp.Output {
-			if out.Type != "function_call" {
-				continue
-			}
-			name := strings.TrimSpace(out.Name)
-			if name == "" {
-				continue
-			}
-			callId := strings.TrimSpace(out.CallId)
-			if callId == "" {
-				callId = strings.TrimSpace(out.ID)
-			}
-			toolCalls = append(toolCalls, dto.ToolCallResponse{
-				ID:   callId,
-				Type: "function",
-				Function: dto.FunctionResponse{
-					Name:      name,
-					Arguments: out.Arguments,
-				},
-			})
-		}
+	if text == "" {
+		toolCalls = ExtractFunctionCallsFromResponses(resp)
 	}
 
 	finishReason := "stop"
@@ -72,8 +52,9 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 	}
 
 	msg := dto.Message{
-		Role:    "assistant",
-		Content: text,
+		Role:             "assistant",
+		Content:          text,
+		ReasoningContent: ExtractReasoningSummaryFromResponses(resp),
 	}
 	if len(toolCalls) > 0 {
 		msg.SetToolCalls(toolCalls)
@@ -131,3 +112,52 @@ func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	}
 	return sb.String()
 }
+
+// ExtractFunctionCallsFromResponses 提取响应中的函数调用
+func ExtractFunctionCallsFromResponses(resp *dto.OpenAIResponsesResponse) []dto.ToolCallResponse {
+	if resp == nil {
+		return nil
+	}
+	var toolCalls []dto.ToolCallResponse
+	for _, out := range resp.Output {
+		if out.Type != "function_call" {
+			continue
+		}
+		name := strings.TrimSpace(out.Name)
+		if name == "" {
+			continue
+		}
+		callId := strings.TrimSpace(out.CallId)
+		if callId == "" {
+			callId = strings.TrimSpace(out.ID)
+		}
+		toolCalls = append(toolCalls, dto.ToolCallResponse{
+			ID:   callId,
+			Type: "function",
+			Function: dto.FunctionResponse{
+				Name:      name,
+				Arguments: out.Arguments,
+			},
+		})
+	}
+	return toolCalls
+}
+
+// ExtractReasoningSummaryFromResponses 提取推理摘要，多段摘要以空行分隔，与流式转换一致
+func ExtractReasoningSummaryFromResponses(resp *dto.OpenAIResponsesResponse) string {
+	if resp == nil {
+		return ""
+	}
+	var parts []string
+	for _, out := range resp.Output {
+		if out.Type != "reasoning" {
+			continue
+		}
+		for _, summary := range out.Summary {
+			if summary.Text != "" {
+				parts = append(parts, summary.Text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,576 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	payloadCaptureReasonUser   = "user"
+	payloadCaptureReasonToken  = "token"
+	payloadCaptureReasonSample = "sample"
+
+	payloadCaptureRedactedText = "[REDACTED]"
+	payloadCaptureDiskDir      = "payload-capture"
+
+	payloadCaptureCleanupInterval  = 10 * time.Minute
+	payloadCaptureCleanupBatchSize = 200
+)
+
+// PayloadStore 载荷存储后端，默认使用磁盘缓存目录，可注册对象存储等实现
+type PayloadStore interface {
+	Name() string
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+var (
+	payloadStoresMu sync.RWMutex
+	payloadStores   = map[string]PayloadStore{
+		operation_setting.PayloadCaptureStorageDisk: diskPayloadStore{},
+	}
+)
+
+// RegisterPayloadStore 注册载荷存储后端，同名后端会被覆盖
+func RegisterPayloadStore(store PayloadStore) {
+	if store == nil {
+		return
+	}
+	payloadStoresMu.Lock()
+	defer payloadStoresMu.Unlock()
+	payloadStores[store.Name()] = store
+}
+
+func getPayloadStore(name string) (PayloadStore, error) {
+	if name == "" {
+		name = operation_setting.PayloadCaptureStorageDisk
+	}
+	payloadStoresMu.RLock()
+	defer payloadStoresMu.RUnlock()
+	store, ok := payloadStores[name]
+	if !ok {
+		return nil, fmt.Errorf("payload store %s is not registered", name)
+	}
+	return store, nil
+}
+
+// diskPayloadStore 将载荷保存在磁盘缓存目录的独立子目录中，不参与请求体缓存的过期清理
+type diskPayloadStore struct{}
+
+var payloadStoreKeyPattern = regexp.MustCompile(`[^A-Za-z0-9_\-.]`)
+
+func (diskPayloadStore) Name() string {
+	return operation_setting.PayloadCaptureStorageDisk
+}
+
+func (diskPayloadStore) path(key string) string {
+	return filepath.Join(common.GetDiskCacheDir(), payloadCaptureDiskDir, payloadStoreKeyPattern.ReplaceAllString(key, "_"))
+}
+
+func (s diskPayloadStore) Put(key string, data []byte) error {
+	dir := filepath.Join(common.GetDiskCacheDir(), payloadCaptureDiskDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create payload capture directory: %w", err)
+	}
+	return os.WriteFile(s.path(key), data, 0600)
+}
+
+func (s diskPayloadStore) Get(key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+func (s diskPayloadStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// payloadCaptureBuffer 带上限的缓冲区，超出上限的部分丢弃并标记截断
+type payloadCaptureBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	// uncaptured 非空时表示该请求体未被抓取及原因
+	uncaptured string
+}
+
+func (b *payloadCaptureBuffer) write(p []byte) {
+	remain := b.limit - b.buf.Len()
+	if remain <= 0 {
+		if len(p) > 0 {
+			b.truncated = true
+		}
+		return
+	}
+	if len(p) > remain {
+		p = p[:remain]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+}
+
+// payloadCaptureWriter 包装 gin.ResponseWriter，在写给客户端的同时保留一份副本
+type payloadCaptureWriter struct {
+	gin.ResponseWriter
+	mu  sync.Mutex
+	out payloadCaptureBuffer
+}
+
+func (w *payloadCaptureWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.out.write(p)
+	w.mu.Unlock()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *payloadCaptureWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	w.out.write([]byte(s))
+	w.mu.Unlock()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// PayloadCaptureSession 单个请求的载荷抓取会话
+type PayloadCaptureSession struct {
+	reason   string
+	limit    int
+	started  time.Time
+	inbound  payloadCaptureBuffer
+	mu       sync.Mutex
+	upstream []*payloadCaptureBuffer
+	writer   *payloadCaptureWriter
+}
+
+type payloadCaptureBody struct {
+	Body       string `json:"body"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Uncaptured string `json:"uncaptured,omitempty"`
+}
+
+type payloadCaptureStream struct {
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	ToolArguments    string `json:"tool_arguments,omitempty"`
+	Events           int    `json:"events"`
+}
+
+type payloadCaptureResponse struct {
+	payloadCaptureBody
+	StatusCode  int                   `json:"status_code"`
+	ContentType string                `json:"content_type,omitempty"`
+	Stream      *payloadCaptureStream `json:"stream,omitempty"`
+}
+
+// PayloadCaptureDocument 保存到存储后端的载荷文档
+type PayloadCaptureDocument struct {
+	RequestId        string                 `json:"request_id"`
+	CapturedAt       int64                  `json:"captured_at"`
+	DurationMs       int64                  `json:"duration_ms"`
+	InboundRequest   payloadCaptureBody     `json:"inbound_request"`
+	UpstreamRequests []payloadCaptureBody   `json:"upstream_requests"`
+	Response         payloadCaptureResponse `json:"response"`
+}
+
+func payloadCaptureRequestId(c *gin.Context) string {
+	if requestId := c.GetHeader("X-Request-ID"); requestId != "" {
+		return requestId
+	}
+	return c.GetString(common.RequestIdKey)
+}
+
+func decidePayloadCapture(setting *operation_setting.PayloadCaptureSetting, userId int, tokenId int) string {
+	if !setting.Enabled {
+		return ""
+	}
+	if userId > 0 && setting.IsPayloadCaptureTarget(userId, 0) {
+		return payloadCaptureReasonUser
+	}
+	if tokenId > 0 && setting.IsPayloadCaptureTarget(0, tokenId) {
+		return payloadCaptureReasonToken
+	}
+	if setting.SampleRate > 0 && rand.Float64()*100 < setting.SampleRate {
+		return payloadCaptureReasonSample
+	}
+	return ""
+}
+
+// StartPayloadCapture 根据配置决定是否抓取当前请求，命中时包装响应写入器并返回会话
+func StartPayloadCapture(c *gin.Context) *PayloadCaptureSession {
+	setting := operation_setting.GetPayloadCaptureSetting()
+	reason := decidePayloadCapture(setting, common.GetContextKeyInt(c, constant.ContextKeyUserId), common.GetContextKeyInt(c, constant.ContextKeyTokenId))
+	if reason == "" {
+		return nil
+	}
+	limit := setting.GetMaxBodyBytes()
+	session := &PayloadCaptureSession{
+		reason:  reason,
+		limit:   limit,
+		started: time.Now(),
+		inbound: payloadCaptureBuffer{limit: limit},
+	}
+	if storage, err := common.GetBodyStorage(c); err == nil {
+		if data, err := storage.Bytes(); err == nil {
+			session.inbound.write(data)
+		}
+	}
+	session.writer = &payloadCaptureWriter{
+		ResponseWriter: c.Writer,
+		out:            payloadCaptureBuffer{limit: limit},
+	}
+	c.Writer = session.writer
+	common.SetContextKey(c, constant.ContextKeyPayloadCapture, session)
+	return session
+}
+
+// IsPayloadCaptureActive 当前请求是否处于载荷抓取中
+func IsPayloadCaptureActive(c *gin.Context) bool {
+	_, ok := common.GetContextKeyType[*PayloadCaptureSession](c, constant.ContextKeyPayloadCapture)
+	return ok
+}
+
+// CapturePayloadUpstreamRequest 记录发往上游的最终请求体（已完成格式转换与参数覆盖），重试时会记录多次
+func CapturePayloadUpstreamRequest(c *gin.Context, body []byte) {
+	session, ok := common.GetContextKeyType[*PayloadCaptureSession](c, constant.ContextKeyPayloadCapture)
+	if !ok || session == nil {
+		return
+	}
+	buf := &payloadCaptureBuffer{limit: session.limit}
+	buf.write(body)
+	session.mu.Lock()
+	session.upstream = append(session.upstream, buf)
+	session.mu.Unlock()
+}
+
+// payloadCaptureTeeWriter 在上游读取请求体的同时写入抓取缓冲，读取发生在 http.Transport 的协程中，需要加锁
+type payloadCaptureTeeWriter struct {
+	session *PayloadCaptureSession
+	buf     *payloadCaptureBuffer
+}
+
+func (w payloadCaptureTeeWriter) Write(p []byte) (int, error) {
+	w.session.mu.Lock()
+	w.buf.write(p)
+	w.session.mu.Unlock()
+	return len(p), nil
+}
+
+// CapturePayloadUpstreamReader 包装流式上游请求体（如 multipart 表单），在发送时边读边记录，不额外读入整个请求体
+func CapturePayloadUpstreamReader(c *gin.Context, body io.Reader) io.Reader {
+	session, ok := common.GetContextKeyType[*PayloadCaptureSession](c, constant.ContextKeyPayloadCapture)
+	if !ok || session == nil || body == nil {
+		return body
+	}
+	buf := &payloadCaptureBuffer{limit: session.limit}
+	session.mu.Lock()
+	session.upstream = append(session.upstream, buf)
+	session.mu.Unlock()
+	return io.TeeReader(body, payloadCaptureTeeWriter{session: session, buf: buf})
+}
+
+// MarkPayloadUpstreamUncaptured 记录一次未抓取请求体的上游请求，例如 WebSocket 连接中转发的消息帧
+func MarkPayloadUpstreamUncaptured(c *gin.Context, reason string) {
+	session, ok := common.GetContextKeyType[*PayloadCaptureSession](c, constant.ContextKeyPayloadCapture)
+	if !ok || session == nil {
+		return
+	}
+	session.mu.Lock()
+	session.upstream = append(session.upstream, &payloadCaptureBuffer{uncaptured: reason})
+	session.mu.Unlock()
+}
+
+// AppendPayloadCaptureAdminInfo 在日志的 admin_info 中标记已抓取载荷
+func AppendPayloadCaptureAdminInfo(c *gin.Context, adminInfo map[string]interface{}) {
+	if adminInfo == nil || !IsPayloadCaptureActive(c) {
+		return
+	}
+	adminInfo["payload_captured"] = true
+}
+
+// FinishPayloadCapture 在请求结束后组装载荷文档并异步写入存储
+func FinishPayloadCapture(c *gin.Context, session *PayloadCaptureSession) {
+	if session == nil {
+		return
+	}
+	setting := operation_setting.GetPayloadCaptureSetting()
+	patterns := getPayloadRedactPatterns(setting.RedactPatterns)
+
+	requestId := payloadCaptureRequestId(c)
+	contentType := session.writer.Header().Get("Content-Type")
+	session.writer.mu.Lock()
+	responseBytes := append([]byte(nil), session.writer.out.buf.Bytes()...)
+	responseTruncated := session.writer.out.truncated
+	session.writer.mu.Unlock()
+
+	doc := PayloadCaptureDocument{
+		RequestId:      requestId,
+		CapturedAt:     common.GetTimestamp(),
+		DurationMs:     time.Since(session.started).Milliseconds(),
+		InboundRequest: newPayloadCaptureBody(session.inbound.buf.Bytes(), session.inbound.truncated, patterns),
+		Response: payloadCaptureResponse{
+			payloadCaptureBody: newPayloadCaptureBody(responseBytes, responseTruncated, patterns),
+			StatusCode:         session.writer.Status(),
+			ContentType:        contentType,
+		},
+	}
+	session.mu.Lock()
+	for _, upstream := range session.upstream {
+		body := newPayloadCaptureBody(upstream.buf.Bytes(), upstream.truncated, patterns)
+		body.Uncaptured = upstream.uncaptured
+		doc.UpstreamRequests = append(doc.UpstreamRequests, body)
+	}
+	session.mu.Unlock()
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		stream := reassemblePayloadStream(responseBytes)
+		stream.Content = redactPayloadText(stream.Content, patterns)
+		stream.ReasoningContent = redactPayloadText(stream.ReasoningContent, patterns)
+		stream.ToolArguments = redactPayloadText(stream.ToolArguments, patterns)
+		doc.Response.Stream = stream
+	}
+
+	record := &model.PayloadCapture{
+		RequestId:   requestId,
+		UserId:      common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		TokenId:     common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		ModelName:   common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		ChannelId:   common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		RequestPath: c.Request.URL.Path,
+		IsStream:    doc.Response.Stream != nil,
+		StatusCode:  doc.Response.StatusCode,
+		Reason:      session.reason,
+		Storage:     setting.Storage,
+		ExpiresAt:   common.GetTimestamp() + setting.GetRetentionSeconds(),
+	}
+	gopool.Go(func() {
+		if err := savePayloadCapture(record, &doc); err != nil {
+			common.SysError(fmt.Sprintf("failed to save payload capture for request %s: %s", requestId, err.Error()))
+		}
+	})
+}
+
+func savePayloadCapture(record *model.PayloadCapture, doc *PayloadCaptureDocument) error {
+	store, err := getPayloadStore(record.Storage)
+	if err != nil {
+		return err
+	}
+	data, err := common.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	record.StorageKey = fmt.Sprintf("%s-%d.json", doc.RequestId, time.Now().UnixNano())
+	record.Size = int64(len(data))
+	if err := store.Put(record.StorageKey, data); err != nil {
+		return err
+	}
+	if err := record.Insert(); err != nil {
+		_ = store.Delete(record.StorageKey)
+		return err
+	}
+	return nil
+}
+
+// LoadPayloadCapture 读取载荷抓取记录对应的载荷文档
+func LoadPayloadCapture(record *model.PayloadCapture) ([]byte, error) {
+	store, err := getPayloadStore(record.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(record.StorageKey)
+}
+
+func newPayloadCaptureBody(data []byte, truncated bool, patterns []*regexp.Regexp) payloadCaptureBody {
+	body := payloadCaptureBody{Truncated: truncated}
+	if !utf8.Valid(data) && !truncated {
+		body.Body = fmt.Sprintf("[binary %d bytes]", len(data))
+		return body
+	}
+	body.Body = redactPayloadText(strings.ToValidUTF8(string(data), ""), patterns)
+	return body
+}
+
+var (
+	payloadRedactMu       sync.Mutex
+	payloadRedactKey      string
+	payloadRedactCompiled []*regexp.Regexp
+)
+
+func getPayloadRedactPatterns(patterns []string) []*regexp.Regexp {
+	key := strings.Join(patterns, "\x00")
+	payloadRedactMu.Lock()
+	defer payloadRedactMu.Unlock()
+	if key == payloadRedactKey && payloadRedactCompiled != nil {
+		return payloadRedactCompiled
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid payload capture redact pattern %q: %s", pattern, err.Error()))
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	payloadRedactKey = key
+	payloadRedactCompiled = compiled
+	return compiled
+}
+
+func redactPayloadText(text string, patterns []*regexp.Regexp) string {
+	if text == "" {
+		return text
+	}
+	for _, re := range patterns {
+		text = re.ReplaceAllString(text, payloadCaptureRedactedText)
+	}
+	return text
+}
+
+// reassemblePayloadStream 将 SSE 响应拼接为完整文本，兼容 OpenAI、Claude、Gemini 与 Responses 格式
+func reassemblePayloadStream(raw []byte) *payloadCaptureStream {
+	stream := &payloadCaptureStream{}
+	var content, reasoning, toolArgs strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 64<<10), len(raw)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" || !gjson.Valid(data) {
+			continue
+		}
+		stream.Events++
+		event := gjson.Parse(data)
+		switch event.Get("type").String() {
+		case "content_block_delta":
+			delta := event.Get("delta")
+			content.WriteString(delta.Get("text").String())
+			reasoning.WriteString(delta.Get("thinking").String())
+			toolArgs.WriteString(delta.Get("partial_json").String())
+			continue
+		case "response.output_text.delta":
+			content.WriteString(event.Get("delta").String())
+			continue
+		case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+			reasoning.WriteString(event.Get("delta").String())
+			continue
+		case "response.function_call_arguments.delta":
+			toolArgs.WriteString(event.Get("delta").String())
+			continue
+		}
+		event.Get("choices").ForEach(func(_, choice gjson.Result) bool {
+			delta := choice.Get("delta")
+			content.WriteString(delta.Get("content").String())
+			reasoning.WriteString(delta.Get("reasoning_content").String())
+			delta.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+				toolArgs.WriteString(call.Get("function.arguments").String())
+				return true
+			})
+			return true
+		})
+		event.Get("candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+			if part.Get("thought").Bool() {
+				reasoning.WriteString(part.Get("text").String())
+			} else {
+				content.WriteString(part.Get("text").String())
+			}
+			return true
+		})
+	}
+	stream.Content = content.String()
+	stream.ReasoningContent = reasoning.String()
+	stream.ToolArguments = toolArgs.String()
+	return stream
+}
+
+var (
+	payloadCaptureCleanupOnce    sync.Once
+	payloadCaptureCleanupRunning atomic.Bool
+)
+
+// StartPayloadCaptureCleanupTask 定期删除超过保留期的载荷
+func StartPayloadCaptureCleanupTask() {
+	payloadCaptureCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("payload capture cleanup task started: tick=%s", payloadCaptureCleanupInterval))
+			ticker := time.NewTicker(payloadCaptureCleanupInterval)
+			defer ticker.Stop()
+
+			runPayloadCaptureCleanupOnce()
+			for range ticker.C {
+				runPayloadCaptureCleanupOnce()
+			}
+		})
+	})
+}
+
+func runPayloadCaptureCleanupOnce() {
+	if !payloadCaptureCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer payloadCaptureCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	total := 0
+	for {
+		captures, err := model.GetExpiredPayloadCaptures(common.GetTimestamp(), payloadCaptureCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("payload capture cleanup task failed: %v", err))
+			return
+		}
+		if len(captures) == 0 {
+			break
+		}
+		ids := make([]int, 0, len(captures))
+		for _, capture := range captures {
+			if store, err := getPayloadStore(capture.Storage); err == nil {
+				if err := store.Delete(capture.StorageKey); err != nil {
+					logger.LogWarn(ctx, fmt.Sprintf("failed to delete payload %s: %v", capture.StorageKey, err))
+				}
+			}
+			ids = append(ids, capture.Id)
+		}
+		if err := model.DeletePayloadCapturesByIds(ids); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("payload capture cleanup task failed: %v", err))
+			return
+		}
+		total += len(captures)
+		if len(captures) < payloadCaptureCleanupBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && total > 0 {
+		logger.LogDebug(ctx, "payload capture cleanup: deleted=%d", total)
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReassemblePayloadStream(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		raw       string
+		content   string
+		reasoning string
+		toolArgs  string
+		events    int
+	}{
+		{
+			name: "openai chat completions",
+			raw: "data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"think\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"function\":{\"arguments\":\"{\\\"a\\\":1}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			content:   "Hello",
+			reasoning: "think",
+			toolArgs:  `{"a":1}`,
+			events:    4,
+		},
+		{
+			name: "claude messages",
+			raw: "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{}}\n\n" +
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"thinking_delta\",\"thinking\":\"hmm\"}}\n\n" +
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n",
+			content:   "Hi",
+			reasoning: "hmm",
+			events:    3,
+		},
+		{
+			name: "openai responses",
+			raw: "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"foo\"}\n\n" +
+				"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"bar\"}\n\n",
+			content: "foobar",
+			events:  2,
+		},
+		{
+			name: "gemini",
+			raw: "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"plan\",\"thought\":true}]}}]}\n\n" +
+				"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"answer\"}]}}]}\n\n",
+			content:   "answer",
+			reasoning: "plan",
+			events:    2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			stream := reassemblePayloadStream([]byte(tc.raw))
+			require.Equal(t, tc.content, stream.Content)
+			require.Equal(t, tc.reasoning, stream.ReasoningContent)
+			require.Equal(t, tc.toolArgs, stream.ToolArguments)
+			require.Equal(t, tc.events, stream.Events)
+		})
+	}
+}
+
+func TestRedactPayloadText(t *testing.T) {
+	t.Parallel()
+
+	patterns := getPayloadRedactPatterns([]string{`sk-[A-Za-z0-9]{16,}`, `\d{3}-\d{4}`, `(`})
+	require.Len(t, patterns, 2)
+
+	got := redactPayloadText(`{"key":"sk-abcdefghijklmnopqrst","phone":"555-1234"}`, patterns)
+	require.Equal(t, `{"key":"[REDACTED]","phone":"[REDACTED]"}`, got)
+}
+
+func TestPayloadCaptureBufferTruncates(t *testing.T) {
+	t.Parallel()
+
+	buf := payloadCaptureBuffer{limit: 4}
+	buf.write([]byte("ab"))
+	buf.write([]byte("cdef"))
+	buf.write([]byte("g"))
+	require.Equal(t, "abcd", buf.buf.String())
+	require.True(t, buf.truncated)
+}
+
+func TestCapturePayloadUpstreamReaderAndUncaptured(t *testing.T) {
+	t.Parallel()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	session := &PayloadCaptureSession{limit: 4}
+	common.SetContextKey(c, constant.ContextKeyPayloadCapture, session)
+
+	data, err := io.ReadAll(CapturePayloadUpstreamReader(c, strings.NewReader("form-data")))
+	require.NoError(t, err)
+	require.Equal(t, "form-data", string(data))
+	MarkPayloadUpstreamUncaptured(c, "websocket frames are not captured")
+
+	require.Len(t, session.upstream, 2)
+	require.Equal(t, "form", session.upstream[0].buf.String())
+	require.True(t, session.upstream[0].truncated)
+	require.Equal(t, "websocket frames are not captured", session.upstream[1].uncaptured)
+}
+
+// 实时会话路由也安装了载荷抓取，包装后的 ResponseWriter 需要支持 WebSocket 升级
+func TestPayloadCaptureWriterSupportsWebSocketUpgrade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/realtime", func(c *gin.Context) {
+		c.Writer = &payloadCaptureWriter{ResponseWriter: c.Writer, out: payloadCaptureBuffer{limit: 16}}
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteMessage(websocket.TextMessage, []byte("ok"))
+	})
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/realtime", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(message))
+}
+
+func TestDecidePayloadCapture(t *testing.T) {
+	t.Parallel()
+
+	setting := &operation_setting.PayloadCaptureSetting{
+		Enabled:  true,
+		UserIds:  []int{7},
+		TokenIds: []int{42},
+	}
+	require.Equal(t, payloadCaptureReasonUser, decidePayloadCapture(setting, 7, 42))
+	require.Equal(t, payloadCaptureReasonToken, decidePayloadCapture(setting, 8, 42))
+	require.Equal(t, "", decidePayloadCapture(setting, 8, 43))
+
+	setting.SampleRate = 100
+	require.Equal(t, payloadCaptureReasonSample, decidePayloadCapture(setting, 8, 43))
+
+	setting.Enabled = false
+	require.Equal(t, "", decidePayloadCapture(setting, 7, 42))
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	postpaidTickInterval = 10 * time.Minute
+	postpaidBatchSize    = 100
+)
+
+var (
+	postpaidTaskOnce    sync.Once
+	postpaidTaskRunning atomic.Bool
+)
+
+// newPostpaidFunding 在钱包余额不足时检查后付费授信额度。
+// 用户没有可用的后付费账户时返回 nil，由调用方按预付费规则处理。
+func newPostpaidFunding(userId int, userQuota int, preConsumedQuota int) (*PostpaidFunding, *types.NewAPIError) {
+	if !operation_setting.GetPostpaidSetting().Enabled {
+		return nil, nil
+	}
+	account, err := model.GetPostpaidAccount(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if !account.IsUsable() {
+		return nil, nil
+	}
+	if userQuota-preConsumedQuota < -account.CreditLimit {
+		return nil, types.NewErrorWithStatusCode(
+			fmt.Errorf("超出授信额度, 用户剩余额度: %s, 授信额度: %s, 需要预扣费额度: %s",
+				logger.FormatQuota(userQuota), logger.FormatQuota(account.CreditLimit), logger.FormatQuota(preConsumedQuota)),
+			types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+			types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	return &PostpaidFunding{
+		WalletFunding: WalletFunding{userId: userId},
+		creditLimit:   account.CreditLimit,
+	}, nil
+}
+
+// checkPostpaidCreditLimit 后付费结算后检查透支额：超出授信额度时暂停账户，达到预警比例时提醒用户
+func checkPostpaidCreditLimit(relayInfo *relaycommon.RelayInfo) {
+	gopool.Go(func() {
+		userId := relayInfo.UserId
+		quota, err := model.GetUserQuota(userId, false)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get user %d quota for postpaid check: %s", userId, err.Error()))
+			return
+		}
+		account, err := model.GetPostpaidAccount(userId)
+		if err != nil || account.CreditLimit <= 0 {
+			return
+		}
+		if quota < -account.CreditLimit {
+			suspended, err := model.SuspendPostpaidAccount(userId, model.PostpaidSuspendReasonCreditLimit)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to suspend postpaid account of user %d: %s", userId, err.Error()))
+				return
+			}
+			if suspended {
+				common.SysLog(fmt.Sprintf("postpaid account of user %d suspended: balance %d exceeds credit limit %d", userId, quota, account.CreditLimit))
+				notifyPostpaidUser(userId, "后付费账户已暂停",
+					fmt.Sprintf("您的透支额度已超过授信额度 %s，当前余额 %s，后付费账户已暂停，请尽快充值",
+						logger.FormatQuota(account.CreditLimit), logger.FormatQuota(quota)))
+			}
+			return
+		}
+		percent := operation_setting.GetPostpaidSetting().WarningPercent
+		if percent <= 0 || quota >= 0 {
+			return
+		}
+		if int64(-quota)*100 < int64(account.CreditLimit)*int64(percent) {
+			return
+		}
+		warned, err := model.MarkPostpaidAccountWarned(userId, account.PeriodStart)
+		if err != nil || !warned {
+			return
+		}
+		notifyPostpaidUser(userId, "授信额度即将用尽",
+			fmt.Sprintf("您已使用授信额度的 %d%%，当前余额 %s，授信额度 %s，超出后账户将被暂停",
+				percent, logger.FormatQuota(quota), logger.FormatQuota(account.CreditLimit)))
+	})
+}
+
+// notifyPostpaidUser 发送后付费相关通知，Email/Webhook 附带充值链接
+func notifyPostpaidUser(userId int, title string, message string) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get user %d for postpaid notify: %s", userId, err.Error()))
+		return
+	}
+	userSetting := user.GetSetting()
+	notifyType := userSetting.NotifyType
+	if notifyType == "" {
+		notifyType = dto.NotifyTypeEmail
+	}
+
+	var content string
+	var values []interface{}
+	if notifyType == dto.NotifyTypeBark || notifyType == dto.NotifyTypeGotify {
+		content = "{{value}}"
+		values = []interface{}{message}
+	} else {
+		topUpLink := fmt.Sprintf("%s/console/topup", system_setting.ServerAddress)
+		content = "{{value}}。<br/>充值链接：<a href='{{value}}'>{{value}}</a>"
+		values = []interface{}{message, topUpLink, topUpLink}
+	}
+	if err := NotifyUser(userId, user.Email, userSetting, dto.NewNotify(dto.NotifyTypePostpaid, title, content, values)); err != nil {
+		common.SysError(fmt.Sprintf("failed to send postpaid notify to user %d: %s", userId, err.Error()))
+	}
+}
+
+// postpaidPeriodCutoff 返回 now 之前（含）最近一个出账日 0 点
+func postpaidPeriodCutoff(now time.Time, billingDay int) time.Time {
+	cutoff := time.Date(now.Year(), now.Month(), billingDay, 0, 0, 0, 0, now.Location())
+	if cutoff.After(now) {
+		cutoff = cutoff.AddDate(0, -1, 0)
+	}
+	return cutoff
+}
+
+// postpaidSettlementPaid 判断结算单是否已结清：出账后的充值足以覆盖期末透支额。
+// 当前余额 = 期末余额 + 出账后充值 - 出账后消费，因此充值 >= 应付额等价于 当前余额 + 出账后消费 >= 0
+func postpaidSettlementPaid(quota int, consumedSincePeriodEnd int) bool {
+	return quota+consumedSincePeriodEnd >= 0
+}
+
+func StartPostpaidSettlementTask() {
+	postpaidTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("postpaid settlement task started: tick=%s", postpaidTickInterval))
+			ticker := time.NewTicker(postpaidTickInterval)
+			defer ticker.Stop()
+
+			runPostpaidSettlementOnce()
+			for range ticker.C {
+				runPostpaidSettlementOnce()
+			}
+		})
+	})
+}
+
+func runPostpaidSettlementOnce() {
+	setting := operation_setting.GetPostpaidSetting()
+	if !setting.Enabled {
+		return
+	}
+	if !postpaidTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer postpaidTaskRunning.Store(false)
+
+	now := time.Now()
+	closePostpaidPeriods(postpaidPeriodCutoff(now, setting.GetBillingDay()).Unix())
+	processPendingPostpaidSettlements(now.Unix(), setting)
+	resumeCreditLimitSuspendedAccounts()
+}
+
+// sumUserConsumedQuota 统计用户在时间区间内的消费额度
+func sumUserConsumedQuota(userId int, start int64, end int64) (int, error) {
+	username, err := model.GetUsernameById(userId, true)
+	if err != nil {
+		return 0, err
+	}
+	stat, err := model.SumUsedQuota(model.LogTypeConsume, start, end, "", username, "", 0, "")
+	if err != nil {
+		return 0, err
+	}
+	return stat.Quota, nil
+}
+
+// closePostpaidPeriods 为账期已结束的账户生成结算单。出账可能晚于账期结束时间，
+// 期末余额由当前余额加回账期结束后的消费得到；账期结束后的充值视为对本期账单的还款，与 postpaidSettlementPaid 一致
+func closePostpaidPeriods(cutoff int64) {
+	ctx := context.Background()
+	for {
+		accounts, err := model.GetPostpaidAccountsDueForSettlement(cutoff, postpaidBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("postpaid settlement task failed: %v", err))
+			return
+		}
+		for _, account := range accounts {
+			now := common.GetTimestamp()
+			quota, err := model.GetUserQuota(account.UserId, true)
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("postpaid settlement: failed to get quota of user %d: %v", account.UserId, err))
+				return
+			}
+			consumed, err := sumUserConsumedQuota(account.UserId, account.PeriodStart, cutoff)
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("postpaid settlement: failed to sum consumption of user %d: %v", account.UserId, err))
+				return
+			}
+			consumedAfter := 0
+			if now > cutoff {
+				consumedAfter, err = sumUserConsumedQuota(account.UserId, cutoff+1, now)
+				if err != nil {
+					logger.LogWarn(ctx, fmt.Sprintf("postpaid settlement: failed to sum consumption of user %d: %v", account.UserId, err))
+					return
+				}
+			}
+			settlement, err := model.ClosePostpaidPeriod(account, cutoff, quota+consumedAfter, consumed)
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("postpaid settlement: failed to close period of user %d: %v", account.UserId, err))
+				return
+			}
+			if settlement == nil || settlement.AmountDue <= 0 {
+				continue
+			}
+			notifyPostpaidUser(account.UserId, "后付费账单已出账",
+				fmt.Sprintf("您 %s 至 %s 的账单已出账，本期消费 %s，应付 %s，请及时充值结清",
+					time.Unix(settlement.PeriodStart, 0).Format("2006-01-02"),
+					time.Unix(settlement.PeriodEnd, 0).Format("2006-01-02"),
+					logger.FormatQuota(settlement.Consumed), logger.FormatQuota(settlement.AmountDue)))
+		}
+		if len(accounts) < postpaidBatchSize {
+			return
+		}
+	}
+}
+
+// processPendingPostpaidSettlements 核销已结清的结算单，对逾期结算单发送催缴或暂停账户
+func processPendingPostpaidSettlements(now int64, setting *operation_setting.PostpaidSetting) {
+	ctx := context.Background()
+	dunningDays := append([]int(nil), setting.DunningDays...)
+	sort.Ints(dunningDays)
+
+	afterId := 0
+	for {
+		settlements, err := model.GetPendingPostpaidSettlements(afterId, postpaidBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("postpaid dunning task failed: %v", err))
+			return
+		}
+		for _, settlement := range settlements {
+			afterId = settlement.Id
+			quota, err := model.GetUserQuota(settlement.UserId, true)
+			if err != nil {
+				continue
+			}
+			consumed, err := sumUserConsumedQuota(settlement.UserId, settlement.PeriodEnd, now)
+			if err != nil {
+				continue
+			}
+			if postpaidSettlementPaid(quota, consumed) {
+				if _, err := SettlePostpaidSettlement(settlement.Id, false); err != nil {
+					logger.LogWarn(ctx, fmt.Sprintf("postpaid: failed to mark settlement %d paid: %v", settlement.Id, err))
+				}
+				continue
+			}
+
+			overdueDays := int((now - settlement.PeriodEnd) / 86400)
+			if setting.SuspendAfterDays > 0 && overdueDays >= setting.SuspendAfterDays {
+				suspended, err := model.SuspendPostpaidAccount(settlement.UserId, model.PostpaidSuspendReasonOverdue)
+				if err == nil && suspended {
+					notifyPostpaidUser(settlement.UserId, "后付费账户已暂停",
+						fmt.Sprintf("您有一笔应付 %s 的账单已逾期 %d 天，后付费账户已暂停，结清后将自动恢复",
+							logger.FormatQuota(settlement.AmountDue), overdueDays))
+				}
+				continue
+			}
+			if settlement.DunningCount >= len(dunningDays) || overdueDays < dunningDays[settlement.DunningCount] {
+				continue
+			}
+			recorded, err := model.RecordPostpaidDunning(settlement.Id, settlement.DunningCount)
+			if err != nil || !recorded {
+				continue
+			}
+			notifyPostpaidUser(settlement.UserId, "后付费账单催缴提醒",
+				fmt.Sprintf("您 %s 出账的账单应付 %s 尚未结清，已出账 %d 天，请尽快充值",
+					time.Unix(settlement.PeriodEnd, 0).Format("2006-01-02"),
+					logger.FormatQuota(settlement.AmountDue), overdueDays))
+		}
+		if len(settlements) < postpaidBatchSize {
+			return
+		}
+	}
+}
+
+// resumeCreditLimitSuspendedAccounts 因超出授信额度暂停的账户在余额回到授信范围内后自动恢复
+func resumeCreditLimitSuspendedAccounts() {
+	afterId := 0
+	for {
+		accounts, err := model.GetSuspendedPostpaidAccounts(model.PostpaidSuspendReasonCreditLimit, afterId, postpaidBatchSize)
+		if err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("postpaid resume task failed: %v", err))
+			return
+		}
+		for _, account := range accounts {
+			afterId = account.Id
+			quota, err := model.GetUserQuota(account.UserId, true)
+			if err != nil || quota < -account.CreditLimit {
+				continue
+			}
+			if resumed, err := model.ResumePostpaidAccount(account.UserId, model.PostpaidSuspendReasonCreditLimit); err == nil && resumed {
+				notifyPostpaidUser(account.UserId, "后付费账户已恢复", "您的余额已回到授信额度范围内，后付费账户已恢复")
+			}
+		}
+		if len(accounts) < postpaidBatchSize {
+			return
+		}
+	}
+}
+
+// SettlePostpaidSettlement 将结算单标记为已支付。credit 为 true 时表示线下收款，
+// 同时为用户增加应付额度以抵消透支。所有结算单结清后恢复因逾期暂停的账户
+func SettlePostpaidSettlement(id int, credit bool) (*model.PostpaidSettlement, error) {
+	settlement, changed, err := model.MarkPostpaidSettlementPaid(id)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return settlement, nil
+	}
+	if credit && settlement.AmountDue > 0 {
+		if err := model.IncreaseUserQuota(settlement.UserId, settlement.AmountDue, true); err != nil {
+			return settlement, err
+		}
+		model.RecordLog(settlement.UserId, model.LogTypeManage,
+			fmt.Sprintf("后付费账单 #%d 线下收款，增加额度 %s", settlement.Id, logger.FormatQuota(settlement.AmountDue)))
+	}
+	pending, err := model.HasPendingPostpaidSettlement(settlement.UserId)
+	if err != nil || pending {
+		return settlement, err
+	}
+	if resumed, err := model.ResumePostpaidAccount(settlement.UserId, model.PostpaidSuspendReasonOverdue); err == nil && resumed {
+		notifyPostpaidUser(settlement.UserId, "后付费账户已恢复", "您的账单已全部结清，后付费账户已恢复")
+	}
+	return settlement, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 出账晚于账期结束时，账期结束后的消费不计入本期期末余额
+func TestClosePostpaidPeriodsUsesBalanceAtCutoff(t *testing.T) {
+	truncate(t)
+	require.NoError(t, model.DB.AutoMigrate(&model.PostpaidAccount{}, &model.PostpaidSettlement{}))
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM postpaid_accounts")
+		model.DB.Exec("DELETE FROM postpaid_settlements")
+	})
+
+	now := common.GetTimestamp()
+	cutoff := now - 3600
+	seedUser(t, 1, 0)
+	account, err := model.UpsertPostpaidAccount(1, true, 10000, "", cutoff-86400)
+	require.NoError(t, err)
+	require.Equal(t, 0, account.OpeningBalance)
+
+	require.NoError(t, model.DB.Create(&model.Log{UserId: 1, Username: "test_user", Type: model.LogTypeConsume, CreatedAt: cutoff - 60, Quota: 300}).Error)
+	require.NoError(t, model.DB.Create(&model.Log{UserId: 1, Username: "test_user", Type: model.LogTypeConsume, CreatedAt: cutoff + 60, Quota: 200}).Error)
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", 1).Update("quota", -500).Error)
+
+	closePostpaidPeriods(cutoff)
+
+	var settlement model.PostpaidSettlement
+	require.NoError(t, model.DB.Where("user_id = ?", 1).First(&settlement).Error)
+	require.Equal(t, 300, settlement.Consumed)
+	require.Equal(t, -300, settlement.ClosingBalance)
+	require.Equal(t, 300, settlement.AmountDue)
+}
+
+// 并发预扣不能共同突破授信额度
+func TestPostpaidFundingPreConsumeEnforcesCreditLimit(t *testing.T) {
+	truncate(t)
+	seedUser(t, 2, 0)
+
+	funding := &PostpaidFunding{WalletFunding: WalletFunding{userId: 2}, creditLimit: 1000}
+	require.NoError(t, funding.PreConsume(800))
+	second := &PostpaidFunding{WalletFunding: WalletFunding{userId: 2}, creditLimit: 1000}
+	require.ErrorIs(t, second.PreConsume(800), model.ErrPostpaidCreditLimitExceeded)
+
+	quota, err := model.GetUserQuota(2, true)
+	require.NoError(t, err)
+	require.Equal(t, -800, quota)
+}
@@ -150,6 +150,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if err != nil {
 		return err
 	}
+	GetRealtimeSession(ctx).RecordSpend(quota)
 	logger.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
 	return nil
 }
@@ -169,6 +170,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	audioRatio := decimal.NewFromFloat(ratio_setting.GetAudioRatio(relayInfo.OriginModelName))
 	audioCompletionRatio := decimal.NewFromFloat(ratio_setting.GetAudioCompletionRatio(modelName))
 
+	relayInfo.ApplyPricingTier(usage.InputTokens)
 	modelRatio := relayInfo.PriceData.ModelRatio
 	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
 	modelPrice := relayInfo.PriceData.ModelPrice
@@ -235,6 +237,128 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	})
 }
 
+// RealtimeBridgeLeg 实时桥接会话中的一个计费环节：语音转写、对话或语音合成
+type RealtimeBridgeLeg struct {
+	Name      string
+	ChannelId int
+	ModelName string
+	Usage     *dto.RealtimeUsage
+	StartTime time.Time
+}
+
+type realtimeBridgeLegPrice struct {
+	modelRatio float64
+	modelPrice float64
+	usePrice   bool
+}
+
+func getRealtimeBridgeLegPrice(relayInfo *relaycommon.RelayInfo, modelName string) (realtimeBridgeLegPrice, error) {
+	modelPrice, usePrice := ratio_setting.GetModelPrice(modelName, false)
+	if usePrice {
+		return realtimeBridgeLegPrice{modelPrice: modelPrice, usePrice: true}, nil
+	}
+	modelRatio, success, matchName := ratio_setting.GetModelRatio(modelName)
+	if !success && !relayInfo.UserSetting.AcceptUnsetRatioModel {
+		return realtimeBridgeLegPrice{}, fmt.Errorf("模型 %s 倍率或价格未配置，请联系管理员设置或开始自用模式；Model %s ratio or price not set, please set or start self-use mode", matchName, matchName)
+	}
+	return realtimeBridgeLegPrice{modelRatio: modelRatio}, nil
+}
+
+// CheckRealtimeBridgeLegPrice 会话开始前确认各环节模型已配置价格，避免上游调用后无法计费
+func CheckRealtimeBridgeLegPrice(relayInfo *relaycommon.RelayInfo, modelName string) error {
+	_, err := getRealtimeBridgeLegPrice(relayInfo, modelName)
+	return err
+}
+
+// ConsumeRealtimeBridgeLegQuota 按环节模型自身的倍率或价格扣费，并以环节的渠道和模型记录消费日志
+func ConsumeRealtimeBridgeLegQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, leg *RealtimeBridgeLeg) error {
+	price, err := getRealtimeBridgeLegPrice(relayInfo, leg.ModelName)
+	if err != nil {
+		return err
+	}
+	usage := leg.Usage
+	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+	quota := calculateAudioQuota(QuotaInfo{
+		InputDetails: TokenDetails{
+			TextTokens:  usage.InputTokenDetails.TextTokens,
+			AudioTokens: usage.InputTokenDetails.AudioTokens,
+		},
+		OutputDetails: TokenDetails{
+			TextTokens:  usage.OutputTokenDetails.TextTokens,
+			AudioTokens: usage.OutputTokenDetails.AudioTokens,
+		},
+		ModelName:  leg.ModelName,
+		UsePrice:   price.usePrice,
+		ModelPrice: price.modelPrice,
+		ModelRatio: price.modelRatio,
+		GroupRatio: groupRatio,
+	})
+
+	completionRatio := ratio_setting.GetCompletionRatio(leg.ModelName)
+	audioRatio := ratio_setting.GetAudioRatio(leg.ModelName)
+	audioCompletionRatio := ratio_setting.GetAudioCompletionRatio(leg.ModelName)
+	var logContent string
+	if !price.usePrice {
+		logContent = fmt.Sprintf("实时桥接 %s 环节，模型倍率 %.2f，补全倍率 %.2f，音频倍率 %.2f，音频补全倍率 %.2f，分组倍率 %.2f",
+			leg.Name, price.modelRatio, completionRatio, audioRatio, audioCompletionRatio, groupRatio)
+	} else {
+		logContent = fmt.Sprintf("实时桥接 %s 环节，模型价格 %.2f，分组倍率 %.2f", leg.Name, price.modelPrice, groupRatio)
+	}
+
+	if quota > 0 {
+		if err := PostConsumeQuota(relayInfo, quota, 0, false); err != nil {
+			return err
+		}
+		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+		model.UpdateChannelUsedQuota(leg.ChannelId, quota)
+		GetRealtimeSession(ctx).RecordSpend(quota)
+	}
+
+	other := GenerateWssOtherInfo(ctx, relayInfo, usage, price.modelRatio, groupRatio,
+		completionRatio, audioRatio, audioCompletionRatio, price.modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	other["realtime_bridge_leg"] = leg.Name
+	other["realtime_model"] = relayInfo.OriginModelName
+	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId:        leg.ChannelId,
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		ModelName:        leg.ModelName,
+		TokenName:        ctx.GetString("token_name"),
+		Quota:            quota,
+		Content:          logContent,
+		TokenId:          relayInfo.TokenId,
+		UseTimeSeconds:   int(time.Since(leg.StartTime).Seconds()),
+		IsStream:         true,
+		Group:            relayInfo.UsingGroup,
+		Other:            other,
+	})
+	return nil
+}
+
+// RecordRealtimeBridgeSessionLog 桥接会话结束后记录会话级日志。额度已计入各环节的消费日志，此处额度记为 0，
+// 会话合计额度写入 other 供查看
+func RecordRealtimeBridgeSessionLog(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) {
+	session := GetRealtimeSession(ctx)
+	content := "实时桥接会话，转写、对话、语音合成各环节已分别计费"
+	if summary := session.Summary(); summary != "" {
+		content += "，" + summary
+	}
+	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
+		ChannelId:      relayInfo.ChannelId,
+		ModelName:      relayInfo.OriginModelName,
+		TokenName:      ctx.GetString("token_name"),
+		Content:        content,
+		TokenId:        relayInfo.TokenId,
+		UseTimeSeconds: int(time.Since(relayInfo.StartTime).Seconds()),
+		IsStream:       true,
+		Group:          relayInfo.UsingGroup,
+		Other: map[string]interface{}{
+			"realtime_bridge_session": true,
+			"realtime_session_quota":  session.SpentQuota(),
+		},
+	})
+}
+
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
 	if usage != nil {
 		ObserveChannelAffinityUsageCacheByRelayFormat(ctx, usage, relayInfo.GetFinalRequestRelayFormat())
@@ -244,6 +368,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
 	modelName := relayInfo.OriginModelName
+	relayInfo.SettlePricingTier(usage, relayInfo.ChannelType != constant.ChannelTypeOpenRouter)
 
 	tokenName := ctx.GetString("token_name")
 	completionRatio := relayInfo.PriceData.CompletionRatio
@@ -372,6 +497,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	audioRatio := decimal.NewFromFloat(ratio_setting.GetAudioRatio(relayInfo.OriginModelName))
 	audioCompletionRatio := decimal.NewFromFloat(ratio_setting.GetAudioCompletionRatio(relayInfo.OriginModelName))
 
+	relayInfo.SettlePricingTier(usage, false)
 	modelRatio := relayInfo.PriceData.ModelRatio
 	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
 	modelPrice := relayInfo.PriceData.ModelPrice
@@ -508,10 +634,24 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
 	}
+	if quota != 0 {
+		checkQuotaConsumed(relayInfo, quota+preConsumedQuota)
+	}
 
 	return nil
 }
 
+// checkQuotaConsumed 扣费完成后统一执行后付费授信检查与消费告警，quota 为本次请求的实际消耗
+func checkQuotaConsumed(relayInfo *relaycommon.RelayInfo, quota int) {
+	if relayInfo == nil || quota <= 0 {
+		return
+	}
+	if relayInfo.BillingSource == BillingSourcePostpaid {
+		checkPostpaidCreditLimit(relayInfo)
+	}
+	CheckSpendAlerts(relayInfo, quota)
+}
+
 func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int) {
 	gopool.Go(func() {
 		userSetting := relayInfo.UserSetting
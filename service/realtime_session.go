@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	RealtimeEndClientClosed = "client_closed"
+	RealtimeEndMaxDuration  = "max_duration"
+	RealtimeEndIdleTimeout  = "idle_timeout"
+	RealtimeEndBudget       = "insufficient_quota"
+
+	realtimeWatchInterval = time.Second
+	// realtimeSlotTTL 会话名额的心跳超时，存活会话由巡检定期刷新心跳，
+	// 进程退出后未释放的名额在超时后被清理
+	realtimeSlotTTL = time.Minute
+)
+
+// RealtimeSessionStop 会话因策略限制被关闭时下发给客户端的错误事件与关闭码
+type RealtimeSessionStop struct {
+	Reason    string
+	Error     types.OpenAIError
+	CloseCode int
+}
+
+// RealtimeSession 单个实时会话的控制：最长时长、空闲超时、令牌并发数与额度硬性截止，结束时记录会话摘要
+type RealtimeSession struct {
+	policy operation_setting.RealtimeSessionPolicy
+	info   *relaycommon.RelayInfo
+	// onStop 下发错误事件并关闭客户端连接，由持有连接的一方提供
+	onStop func(stop *RealtimeSessionStop)
+
+	// enforceBudget 启用会话控制时，剩余额度不足一次回复即关闭会话
+	enforceBudget bool
+
+	startTime time.Time
+	// lastActive 最近一条消息的时间（UnixNano），客户端与上游的消息都计入
+	lastActive atomic.Int64
+	stopped    chan struct{}
+	finished   chan struct{}
+	stopOnce   sync.Once
+	finishOnce sync.Once
+	slotHeld   bool
+	// slotId 占用的会话名额，Redis 中作为有序集合的成员
+	slotId string
+
+	mu            sync.Mutex
+	endReason     string
+	responses     int
+	spentQuota    int
+	responseQuota int
+	maxResponse   int
+}
+
+// StartRealtimeSession 按令牌、分组策略创建会话控制，超过令牌并发数时返回错误。
+// 未启用会话控制时仍返回会话对象，仅用于记录会话摘要
+func StartRealtimeSession(c *gin.Context, info *relaycommon.RelayInfo, onStop func(stop *RealtimeSessionStop)) (*RealtimeSession, *types.NewAPIError) {
+	session := &RealtimeSession{
+		info:      info,
+		onStop:    onStop,
+		startTime: time.Now(),
+		stopped:   make(chan struct{}),
+		finished:  make(chan struct{}),
+		endReason: RealtimeEndClientClosed,
+		slotId:    common.GetUUID(),
+	}
+	if policy := operation_setting.GetRealtimeSessionSetting().ResolvePolicy(info.TokenId, info.UsingGroup); policy != nil {
+		session.policy = *policy
+		session.enforceBudget = true
+	}
+	session.Touch()
+
+	if limit := session.policy.MaxConcurrentSessions; limit > 0 && info.TokenId != 0 {
+		ok, err := acquireRealtimeSlot(info.TokenId, session.slotId, limit)
+		if err != nil {
+			// 计数失败时不阻断会话
+			logger.LogError(c, "acquire realtime session slot failed: "+err.Error())
+		} else if !ok {
+			return nil, types.NewErrorWithStatusCode(
+				fmt.Errorf("too many concurrent realtime sessions for this token, limit is %d", limit),
+				types.ErrorCodeRealtimeSessionLimit, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry())
+		} else {
+			session.slotHeld = true
+		}
+	}
+
+	common.SetContextKey(c, constant.ContextKeyRealtimeSession, session)
+	if session.policy.MaxDurationSeconds > 0 || session.policy.IdleTimeoutSeconds > 0 || session.slotHeld {
+		gopool.Go(func() {
+			session.watch(c)
+		})
+	}
+	return session, nil
+}
+
+// GetRealtimeSession 获取当前请求的会话控制，非实时请求返回 nil，nil 上的方法均可安全调用
+func GetRealtimeSession(c *gin.Context) *RealtimeSession {
+	session, _ := common.GetContextKeyType[*RealtimeSession](c, constant.ContextKeyRealtimeSession)
+	return session
+}
+
+func (s *RealtimeSession) watch(c *gin.Context) {
+	ticker := time.NewTicker(realtimeWatchInterval)
+	defer ticker.Stop()
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-s.finished:
+			return
+		case <-s.stopped:
+			return
+		case now := <-ticker.C:
+			if s.policy.MaxDurationSeconds > 0 && now.Sub(s.startTime) >= time.Duration(s.policy.MaxDurationSeconds)*time.Second {
+				s.Stop(c, &RealtimeSessionStop{
+					Reason: RealtimeEndMaxDuration,
+					Error: types.OpenAIError{
+						Type:    "invalid_request_error",
+						Code:    "session_expired",
+						Message: fmt.Sprintf("Your session hit the maximum duration of %d seconds.", s.policy.MaxDurationSeconds),
+					},
+					CloseCode: websocket.CloseNormalClosure,
+				})
+				return
+			}
+			idle := now.Sub(time.Unix(0, s.lastActive.Load()))
+			if s.policy.IdleTimeoutSeconds > 0 && idle >= time.Duration(s.policy.IdleTimeoutSeconds)*time.Second {
+				s.Stop(c, &RealtimeSessionStop{
+					Reason: RealtimeEndIdleTimeout,
+					Error: types.OpenAIError{
+						Type:    "invalid_request_error",
+						Code:    "session_idle_timeout",
+						Message: fmt.Sprintf("Your session was idle for more than %d seconds.", s.policy.IdleTimeoutSeconds),
+					},
+					CloseCode: websocket.CloseNormalClosure,
+				})
+				return
+			}
+			if s.slotHeld && now.Sub(lastRenew) >= realtimeSlotTTL/3 {
+				renewRealtimeSlot(s.info.TokenId, s.slotId)
+				lastRenew = now
+			}
+		}
+	}
+}
+
+// Touch 记录会话活动，用于空闲超时判断
+func (s *RealtimeSession) Touch() {
+	if s == nil {
+		return
+	}
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+// Done 会话因策略限制被关闭时关闭的通道
+func (s *RealtimeSession) Done() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.stopped
+}
+
+// Stop 下发错误事件与关闭码并关闭客户端连接，仅第一次调用生效
+func (s *RealtimeSession) Stop(c *gin.Context, stop *RealtimeSessionStop) {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		s.endReason = stop.Reason
+		s.mu.Unlock()
+		logger.LogWarn(c, fmt.Sprintf("realtime session stopped: %s, %s", stop.Reason, stop.Error.Message))
+		if s.onStop != nil {
+			s.onStop(stop)
+		}
+		close(s.stopped)
+	})
+}
+
+// RecordSpend 记录会话内已扣除的额度
+func (s *RealtimeSession) RecordSpend(quota int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spentQuota += quota
+	s.responseQuota += quota
+}
+
+// EndResponse 一次回复结算完成，记录其消耗作为下次回复的额度预估
+func (s *RealtimeSession) EndResponse() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses++
+	s.maxResponse = max(s.maxResponse, s.responseQuota)
+	s.responseQuota = 0
+}
+
+// CheckBudget 生成新回复前检查剩余额度能否覆盖一次回复，不足时关闭会话并返回错误
+func (s *RealtimeSession) CheckBudget(c *gin.Context) error {
+	if s == nil || !s.enforceBudget {
+		return nil
+	}
+	s.mu.Lock()
+	required := max(s.policy.MinRemainQuota, s.maxResponse)
+	s.mu.Unlock()
+	if required <= 0 {
+		return nil
+	}
+	remain, err := realtimeRemainQuota(s.info)
+	if err != nil {
+		logger.LogError(c, "get realtime remain quota failed: "+err.Error())
+		return nil
+	}
+	if remain >= required {
+		return nil
+	}
+	message := fmt.Sprintf("Remaining quota %s is not enough for the next response, at least %s is required.",
+		logger.FormatQuota(remain), logger.FormatQuota(required))
+	s.Stop(c, &RealtimeSessionStop{
+		Reason: RealtimeEndBudget,
+		Error: types.OpenAIError{
+			Type:    "insufficient_quota",
+			Code:    "insufficient_quota",
+			Message: message,
+		},
+		CloseCode: websocket.ClosePolicyViolation,
+	})
+	return errors.New(message)
+}
+
+// realtimeRemainQuota 用户钱包与令牌剩余额度中的较小值，订阅计费时只看令牌
+func realtimeRemainQuota(info *relaycommon.RelayInfo) (int, error) {
+	remain := -1
+	if info.BillingSource != BillingSourceSubscription {
+		userQuota, err := model.GetUserQuota(info.UserId, false)
+		if err != nil {
+			return 0, err
+		}
+		remain = userQuota
+	}
+	token, err := model.GetTokenByIds(info.TokenId, info.UserId)
+	if err != nil {
+		return 0, err
+	}
+	if !token.UnlimitedQuota && (remain < 0 || token.RemainQuota < remain) {
+		remain = token.RemainQuota
+	}
+	if remain < 0 {
+		// 订阅计费且令牌不限额度
+		return math.MaxInt, nil
+	}
+	return remain, nil
+}
+
+// Summary 会话摘要，写入消费日志
+func (s *RealtimeSession) Summary() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("实时会话时长 %d 秒，回复 %d 次，结束原因 %s",
+		int(time.Since(s.startTime).Seconds()), s.responses, s.endReason)
+}
+
+// SpentQuota 会话内已扣除的额度
+func (s *RealtimeSession) SpentQuota() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spentQuota
+}
+
+// Finish 结束会话：停止巡检、释放并发计数并记录会话摘要
+func (s *RealtimeSession) Finish(c *gin.Context) {
+	if s == nil {
+		return
+	}
+	s.finishOnce.Do(func() {
+		close(s.finished)
+		if s.slotHeld {
+			releaseRealtimeSlot(s.info.TokenId, s.slotId)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		logger.LogInfo(c, fmt.Sprintf("realtime session summary: model %s, token %d, group %s, duration %s, responses %d, quota %s, end reason %s",
+			s.info.OriginModelName, s.info.TokenId, s.info.UsingGroup, time.Since(s.startTime).Round(time.Second),
+			s.responses, logger.FormatQuota(s.spentQuota), s.endReason))
+	})
+}
+
+var (
+	realtimeSlotMu    sync.Mutex
+	realtimeSlotLocal = make(map[int]map[string]struct{})
+)
+
+func realtimeSlotKey(tokenId int) string {
+	return fmt.Sprintf("realtime_session:token:%d", tokenId)
+}
+
+// acquireRealtimeSlot 占用令牌的一个会话名额。启用 Redis 时名额保存在以心跳时间为分数的有序集合中，
+// 多节点共享，占用前先清理心跳超时的成员
+func acquireRealtimeSlot(tokenId int, slotId string, limit int) (bool, error) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := realtimeSlotKey(tokenId)
+		now := time.Now()
+		pipe := common.RDB.TxPipeline()
+		pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%d", now.Add(-realtimeSlotTTL).Unix()))
+		pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Unix()), Member: slotId})
+		card := pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, realtimeSlotTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return false, err
+		}
+		if card.Val() > int64(limit) {
+			common.RDB.ZRem(ctx, key, slotId)
+			return false, nil
+		}
+		return true, nil
+	}
+	realtimeSlotMu.Lock()
+	defer realtimeSlotMu.Unlock()
+	slots := realtimeSlotLocal[tokenId]
+	if len(slots) >= limit {
+		return false, nil
+	}
+	if slots == nil {
+		slots = make(map[string]struct{})
+		realtimeSlotLocal[tokenId] = slots
+	}
+	slots[slotId] = struct{}{}
+	return true, nil
+}
+
+// renewRealtimeSlot 刷新会话名额的心跳
+func renewRealtimeSlot(tokenId int, slotId string) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := realtimeSlotKey(tokenId)
+		pipe := common.RDB.TxPipeline()
+		pipe.ZAddXX(ctx, key, &redis.Z{Score: float64(time.Now().Unix()), Member: slotId})
+		pipe.Expire(ctx, key, realtimeSlotTTL)
+		_, _ = pipe.Exec(ctx)
+	}
+}
+
+func releaseRealtimeSlot(tokenId int, slotId string) {
+	if common.RedisEnabled {
+		common.RDB.ZRem(context.Background(), realtimeSlotKey(tokenId), slotId)
+		return
+	}
+	realtimeSlotMu.Lock()
+	defer realtimeSlotMu.Unlock()
+	delete(realtimeSlotLocal[tokenId], slotId)
+	if len(realtimeSlotLocal[tokenId]) == 0 {
+		delete(realtimeSlotLocal, tokenId)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func withRealtimeSessionSetting(t *testing.T, setting operation_setting.RealtimeSessionSetting) {
+	t.Helper()
+	current := operation_setting.GetRealtimeSessionSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func newRealtimeTestContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/v1/realtime", nil)
+	return c
+}
+
+func TestRealtimeSessionConcurrencyLimitPerToken(t *testing.T) {
+	withRealtimeSessionSetting(t, operation_setting.RealtimeSessionSetting{
+		Enabled:       true,
+		Default:       operation_setting.RealtimeSessionPolicy{MaxConcurrentSessions: 5},
+		GroupPolicies: map[string]operation_setting.RealtimeSessionPolicy{"vip": {MaxConcurrentSessions: 3}},
+		TokenPolicies: map[int]operation_setting.RealtimeSessionPolicy{7: {MaxConcurrentSessions: 1}},
+	})
+	info := &relaycommon.RelayInfo{TokenId: 7, UsingGroup: "vip"}
+
+	first, apiErr := StartRealtimeSession(newRealtimeTestContext(), info, nil)
+	require.Nil(t, apiErr)
+
+	// The token policy overrides the group and default limits.
+	_, apiErr = StartRealtimeSession(newRealtimeTestContext(), info, nil)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeRealtimeSessionLimit, apiErr.GetErrorCode())
+	require.Equal(t, 429, apiErr.StatusCode)
+
+	// Releasing a slot that is not held (e.g. a stale session id) does not free the live session's slot.
+	releaseRealtimeSlot(7, "stale-session")
+	_, apiErr = StartRealtimeSession(newRealtimeTestContext(), info, nil)
+	require.NotNil(t, apiErr)
+
+	// Another token in the same group has its own slots.
+	other, apiErr := StartRealtimeSession(newRealtimeTestContext(), &relaycommon.RelayInfo{TokenId: 8, UsingGroup: "vip"}, nil)
+	require.Nil(t, apiErr)
+	other.Finish(newRealtimeTestContext())
+
+	first.Finish(newRealtimeTestContext())
+	first.Finish(newRealtimeTestContext())
+	again, apiErr := StartRealtimeSession(newRealtimeTestContext(), info, nil)
+	require.Nil(t, apiErr)
+	again.Finish(newRealtimeTestContext())
+}
+
+func TestRealtimeSessionIdleTimeoutStopsSession(t *testing.T) {
+	withRealtimeSessionSetting(t, operation_setting.RealtimeSessionSetting{
+		Enabled: true,
+		Default: operation_setting.RealtimeSessionPolicy{MaxDurationSeconds: 60, IdleTimeoutSeconds: 1},
+	})
+	stops := make(chan *RealtimeSessionStop, 1)
+	c := newRealtimeTestContext()
+	session, apiErr := StartRealtimeSession(c, &relaycommon.RelayInfo{TokenId: 9}, func(stop *RealtimeSessionStop) {
+		stops <- stop
+	})
+	require.Nil(t, apiErr)
+	require.Same(t, session, GetRealtimeSession(c))
+	defer session.Finish(c)
+
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle session was not stopped")
+	}
+	stop := <-stops
+	require.Equal(t, RealtimeEndIdleTimeout, stop.Reason)
+	require.Equal(t, "session_idle_timeout", stop.Error.Code)
+	require.Equal(t, websocket.CloseNormalClosure, stop.CloseCode)
+	require.Contains(t, session.Summary(), RealtimeEndIdleTimeout)
+}
+
+func TestRealtimeSessionBudgetHardStop(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 1000)
+	seedToken(t, 1, 1, "realtimebudgettoken", 500)
+	withRealtimeSessionSetting(t, operation_setting.RealtimeSessionSetting{
+		Enabled: true,
+		Default: operation_setting.RealtimeSessionPolicy{MinRemainQuota: 100},
+	})
+
+	var stopped *RealtimeSessionStop
+	c := newRealtimeTestContext()
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 1, TokenKey: "sk-realtimebudgettoken"}
+	session, apiErr := StartRealtimeSession(c, info, func(stop *RealtimeSessionStop) {
+		stopped = stop
+	})
+	require.Nil(t, apiErr)
+	defer session.Finish(c)
+
+	require.NoError(t, session.CheckBudget(c))
+
+	// The most expensive response so far becomes the estimate for the next one.
+	session.RecordSpend(200)
+	session.RecordSpend(400)
+	session.EndResponse()
+	require.Error(t, session.CheckBudget(c))
+	require.NotNil(t, stopped)
+	require.Equal(t, RealtimeEndBudget, stopped.Reason)
+	require.Equal(t, "insufficient_quota", stopped.Error.Code)
+	require.Equal(t, websocket.ClosePolicyViolation, stopped.CloseCode)
+	<-session.Done()
+}
+
+func TestRealtimeSessionDisabledOnlyRecordsSummary(t *testing.T) {
+	withRealtimeSessionSetting(t, operation_setting.RealtimeSessionSetting{Enabled: false})
+	c := newRealtimeTestContext()
+	session, apiErr := StartRealtimeSession(c, &relaycommon.RelayInfo{TokenId: 10}, nil)
+	require.Nil(t, apiErr)
+	require.NoError(t, session.CheckBudget(c))
+	session.EndResponse()
+	require.Contains(t, session.Summary(), "回复 1 次")
+	session.Finish(c)
+
+	var missing *RealtimeSession
+	missing.Touch()
+	missing.RecordSpend(1)
+	require.Nil(t, missing.Done())
+	require.NoError(t, missing.CheckBudget(c))
+}
+
+// 桥接会话按环节计费，会话结束时另外记录一条带会话摘要的日志
+func TestRecordRealtimeBridgeSessionLog(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 1000)
+	withRealtimeSessionSetting(t, operation_setting.RealtimeSessionSetting{Enabled: false})
+	c := newRealtimeTestContext()
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 11, OriginModelName: "gpt-realtime-bridge", StartTime: time.Now(), ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 3}}
+	session, apiErr := StartRealtimeSession(c, info, nil)
+	require.Nil(t, apiErr)
+	session.RecordSpend(300)
+	session.EndResponse()
+
+	RecordRealtimeBridgeSessionLog(c, info)
+	session.Finish(c)
+	model.FlushLogSink()
+
+	var log model.Log
+	require.NoError(t, model.DB.Where("user_id = ? and model_name = ?", 1, "gpt-realtime-bridge").First(&log).Error)
+	require.Equal(t, model.LogTypeConsume, log.Type)
+	require.Zero(t, log.Quota)
+	require.Contains(t, log.Content, "回复 1 次")
+	require.Contains(t, log.Other, `"realtime_session_quota":300`)
+}
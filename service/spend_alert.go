@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	SpendAlertRuleDaily         = "daily"
+	SpendAlertRuleHourlySpike   = "hourly_spike"
+	SpendAlertRuleSingleRequest = "single_request"
+	SpendAlertRuleNewModel      = "new_model"
+
+	spendAlertTrailingHours = 24
+)
+
+// spendAlert 一条触发的告警，Period 用于同一周期内去重
+type spendAlert struct {
+	Rule    string
+	Period  string
+	Message string
+}
+
+// spendSnapshot 本次请求结算后的消费统计
+type spendSnapshot struct {
+	Quota     int
+	HourSpend int64
+	DaySpend  int64
+	// TrailingAvg 过去 24 小时的小时均值，按需计算
+	TrailingAvg func() float64
+	Hour        int64
+	Day         string
+}
+
+// evaluateSpendAlerts 根据规则判断本次请求触发的告警
+func evaluateSpendAlerts(rules dto.SpendAlertRules, snapshot spendSnapshot, spikeMinQuota int) []spendAlert {
+	var alerts []spendAlert
+	if rules.SingleRequestQuota > 0 && snapshot.Quota > rules.SingleRequestQuota {
+		alerts = append(alerts, spendAlert{
+			Rule:    SpendAlertRuleSingleRequest,
+			Period:  strconv.FormatInt(snapshot.Hour, 10),
+			Message: fmt.Sprintf("单次请求消费 %s，超过阈值 %s", logger.FormatQuota(snapshot.Quota), logger.FormatQuota(rules.SingleRequestQuota)),
+		})
+	}
+	if rules.DailyQuota > 0 && snapshot.DaySpend > int64(rules.DailyQuota) {
+		alerts = append(alerts, spendAlert{
+			Rule:    SpendAlertRuleDaily,
+			Period:  snapshot.Day,
+			Message: fmt.Sprintf("今日消费 %s，超过阈值 %s", logger.FormatQuota(int(snapshot.DaySpend)), logger.FormatQuota(rules.DailyQuota)),
+		})
+	}
+	if rules.HourlySpikeRatio > 0 && snapshot.HourSpend >= int64(spikeMinQuota) && snapshot.TrailingAvg != nil {
+		avg := snapshot.TrailingAvg()
+		if float64(snapshot.HourSpend) > avg*rules.HourlySpikeRatio {
+			alerts = append(alerts, spendAlert{
+				Rule:   SpendAlertRuleHourlySpike,
+				Period: strconv.FormatInt(snapshot.Hour, 10),
+				Message: fmt.Sprintf("当前小时消费 %s，为过去 24 小时均值 %s 的 %.1f 倍以上",
+					logger.FormatQuota(int(snapshot.HourSpend)), logger.FormatQuota(int(avg)), rules.HourlySpikeRatio),
+			})
+		}
+	}
+	return alerts
+}
+
+// CheckSpendAlerts 在结算后累计用户消费并检查告警规则，异步执行
+func CheckSpendAlerts(relayInfo *relaycommon.RelayInfo, quota int) {
+	setting := operation_setting.GetSpendAlertSetting()
+	if !setting.Enabled || quota <= 0 || relayInfo == nil {
+		return
+	}
+	userRules := relayInfo.UserSetting.SpendAlert
+	hasUserRules := userRules != nil && (userRules.DailyQuota > 0 || userRules.HourlySpikeRatio > 0 || userRules.SingleRequestQuota > 0 || userRules.NewModel)
+	if !hasUserRules && !setting.HasGlobalRules() {
+		return
+	}
+
+	userId := relayInfo.UserId
+	userEmail := relayInfo.UserEmail
+	userSetting := relayInfo.UserSetting
+	modelName := relayInfo.OriginModelName
+	tokenId := relayInfo.TokenId
+	startTime := relayInfo.StartTime.Unix()
+
+	gopool.Go(func() {
+		now := time.Now()
+		snapshot, err := recordUserSpend(userId, quota, now)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to record spend for user %d: %s", userId, err.Error()))
+			return
+		}
+
+		if hasUserRules {
+			alerts := evaluateSpendAlerts(*userRules, snapshot, setting.SpikeMinQuota)
+			if userRules.NewModel && modelName != "" && isNewModelForUser(userId, modelName, startTime) {
+				alerts = append(alerts, spendAlert{
+					Rule:    SpendAlertRuleNewModel,
+					Period:  modelName,
+					Message: fmt.Sprintf("首次使用模型 %s", modelName),
+				})
+			}
+			for _, alert := range alerts {
+				if !claimSpendAlert(fmt.Sprintf("user:%d:%s:%s", userId, alert.Rule, alert.Period)) {
+					continue
+				}
+				sendSpendAlert(userId, userEmail, userSetting, alert, modelName)
+			}
+		}
+
+		if setting.HasGlobalRules() {
+			globalRules := dto.SpendAlertRules{
+				DailyQuota:         setting.GlobalDailyQuota,
+				HourlySpikeRatio:   setting.GlobalHourlySpikeRatio,
+				SingleRequestQuota: setting.GlobalSingleRequestQuota,
+			}
+			for _, alert := range evaluateSpendAlerts(globalRules, snapshot, setting.SpikeMinQuota) {
+				if !claimSpendAlert(fmt.Sprintf("global:%d:%s:%s", userId, alert.Rule, alert.Period)) {
+					continue
+				}
+				content := fmt.Sprintf("用户 %d（令牌 #%d，模型 %s）%s，请确认令牌是否泄露", userId, tokenId, modelName, alert.Message)
+				common.SysLog("spend alert: " + content)
+				NotifyRootUser(dto.NotifyTypeSpendAlert, "全局消费告警", content)
+			}
+		}
+	})
+}
+
+func sendSpendAlert(userId int, userEmail string, userSetting dto.UserSetting, alert spendAlert, modelName string) {
+	content := "{{value}}（模型：{{value}}）"
+	values := []interface{}{alert.Message, modelName}
+	err := NotifyUser(userId, userEmail, userSetting, dto.NewNotify(dto.NotifyTypeSpendAlert, "消费告警", content, values))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send spend alert to user %d: %s", userId, err.Error()))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// 消费统计：启用 Redis 时多节点共享，否则使用进程内存
+// ---------------------------------------------------------------------------
+
+type memorySpend struct {
+	mu       sync.Mutex
+	hours    map[int64]int64
+	day      string
+	dayTotal int64
+	lastHour int64
+	// evicted 已从 memorySpendStore 移除，持有该指针的写入方需要重新获取
+	evicted bool
+}
+
+// seenUserModelTTL 已确认使用过的模型在内存中的缓存时间，过期后重新查库
+const seenUserModelTTL = 24 * time.Hour
+
+var (
+	memorySpendStore  sync.Map // userId -> *memorySpend
+	memorySpendSweep  atomic.Int64
+	memoryAlertClaims sync.Map // key -> expireAt(unix)
+	memoryClaimsSweep atomic.Int64
+	seenUserModels    sync.Map // "userId:model" -> expireAt(unix)
+	seenModelsSweep   atomic.Int64
+)
+
+// sweepExpired 每小时最多清理一次 value 为过期时间（unix）的缓存项
+func sweepExpired(m *sync.Map, lastSweep *atomic.Int64, now int64) {
+	if last := lastSweep.Load(); now-last < 3600 || !lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	m.Range(func(k, v any) bool {
+		if v.(int64) <= now {
+			m.Delete(k)
+		}
+		return true
+	})
+}
+
+// sweepMemorySpend 每小时最多清理一次超过统计窗口未再消费的用户
+func sweepMemorySpend(hour int64) {
+	if last := memorySpendSweep.Load(); hour <= last || !memorySpendSweep.CompareAndSwap(last, hour) {
+		return
+	}
+	memorySpendStore.Range(func(k, v any) bool {
+		spend := v.(*memorySpend)
+		spend.mu.Lock()
+		if spend.lastHour < hour-spendAlertTrailingHours {
+			spend.evicted = true
+			memorySpendStore.Delete(k)
+		}
+		spend.mu.Unlock()
+		return true
+	})
+}
+
+func spendHourKey(userId int, hour int64) string {
+	return fmt.Sprintf("spend_alert:h:%d:%d", userId, hour)
+}
+
+func recordUserSpend(userId int, quota int, now time.Time) (spendSnapshot, error) {
+	hour := now.Unix() / 3600
+	day := now.Format("20060102")
+	snapshot := spendSnapshot{Quota: quota, Hour: hour, Day: day}
+
+	if common.RedisEnabled {
+		ctx := context.Background()
+		hourKey := spendHourKey(userId, hour)
+		dayKey := fmt.Sprintf("spend_alert:d:%d:%s", userId, day)
+		pipe := common.RDB.TxPipeline()
+		hourCmd := pipe.IncrBy(ctx, hourKey, int64(quota))
+		pipe.Expire(ctx, hourKey, (spendAlertTrailingHours+2)*time.Hour)
+		dayCmd := pipe.IncrBy(ctx, dayKey, int64(quota))
+		pipe.Expire(ctx, dayKey, 48*time.Hour)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return snapshot, err
+		}
+		snapshot.HourSpend = hourCmd.Val()
+		snapshot.DaySpend = dayCmd.Val()
+		snapshot.TrailingAvg = func() float64 {
+			keys := make([]string, 0, spendAlertTrailingHours)
+			for i := int64(1); i <= spendAlertTrailingHours; i++ {
+				keys = append(keys, spendHourKey(userId, hour-i))
+			}
+			values, err := common.RDB.MGet(ctx, keys...).Result()
+			if err != nil {
+				return 0
+			}
+			var total int64
+			for _, v := range values {
+				if s, ok := v.(string); ok {
+					n, _ := strconv.ParseInt(s, 10, 64)
+					total += n
+				}
+			}
+			return float64(total) / spendAlertTrailingHours
+		}
+		return snapshot, nil
+	}
+
+	sweepMemorySpend(hour)
+	var spend *memorySpend
+	for {
+		value, _ := memorySpendStore.LoadOrStore(userId, &memorySpend{hours: make(map[int64]int64)})
+		spend = value.(*memorySpend)
+		spend.mu.Lock()
+		if !spend.evicted {
+			break
+		}
+		spend.mu.Unlock()
+	}
+	defer spend.mu.Unlock()
+	if hour > spend.lastHour {
+		spend.lastHour = hour
+	}
+	for h := range spend.hours {
+		if h < hour-spendAlertTrailingHours {
+			delete(spend.hours, h)
+		}
+	}
+	spend.hours[hour] += int64(quota)
+	if spend.day != day {
+		spend.day = day
+		spend.dayTotal = 0
+	}
+	spend.dayTotal += int64(quota)
+
+	snapshot.HourSpend = spend.hours[hour]
+	snapshot.DaySpend = spend.dayTotal
+	var trailing int64
+	for h, v := range spend.hours {
+		if h < hour {
+			trailing += v
+		}
+	}
+	snapshot.TrailingAvg = func() float64 {
+		return float64(trailing) / spendAlertTrailingHours
+	}
+	return snapshot, nil
+}
+
+// claimSpendAlert 同一告警在 24 小时内只发送一次，返回是否抢到发送权
+func claimSpendAlert(key string) bool {
+	const ttl = 24 * time.Hour
+	if common.RedisEnabled {
+		ok, err := common.RDB.SetNX(context.Background(), "spend_alert:sent:"+key, "1", ttl).Result()
+		return err == nil && ok
+	}
+	now := time.Now().Unix()
+	sweepExpired(&memoryAlertClaims, &memoryClaimsSweep, now)
+	if value, loaded := memoryAlertClaims.LoadOrStore(key, now+int64(ttl.Seconds())); loaded {
+		if value.(int64) > now {
+			return false
+		}
+		memoryAlertClaims.Store(key, now+int64(ttl.Seconds()))
+	}
+	return true
+}
+
+// isNewModelForUser 判断用户是否首次使用该模型，已确认使用过的模型在内存中缓存 seenUserModelTTL
+func isNewModelForUser(userId int, modelName string, before int64) bool {
+	key := fmt.Sprintf("%d:%s", userId, modelName)
+	now := time.Now().Unix()
+	sweepExpired(&seenUserModels, &seenModelsSweep, now)
+	if expireAt, ok := seenUserModels.Load(key); ok && expireAt.(int64) > now {
+		return false
+	}
+	first, err := model.MarkUserModelUsed(userId, modelName, before)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to mark model usage for user %d: %s", userId, err.Error()))
+		return false
+	}
+	seenUserModels.Store(key, now+int64(seenUserModelTTL.Seconds()))
+	return first
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func alertRules(alerts []spendAlert) []string {
+	rules := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		rules = append(rules, alert.Rule)
+	}
+	return rules
+}
+
+func TestEvaluateSpendAlerts(t *testing.T) {
+	rules := dto.SpendAlertRules{DailyQuota: 1000, HourlySpikeRatio: 3, SingleRequestQuota: 200}
+	avg := func(v float64) func() float64 { return func() float64 { return v } }
+
+	alerts := evaluateSpendAlerts(rules, spendSnapshot{Quota: 100, HourSpend: 500, DaySpend: 900, TrailingAvg: avg(200)}, 100)
+	require.Empty(t, alerts)
+
+	alerts = evaluateSpendAlerts(rules, spendSnapshot{Quota: 300, HourSpend: 700, DaySpend: 1100, TrailingAvg: avg(200)}, 100)
+	require.Equal(t, []string{SpendAlertRuleSingleRequest, SpendAlertRuleDaily, SpendAlertRuleHourlySpike}, alertRules(alerts))
+
+	// 低于最低小时消费时不做突增检测
+	alerts = evaluateSpendAlerts(rules, spendSnapshot{Quota: 50, HourSpend: 50, TrailingAvg: avg(0)}, 100)
+	require.Empty(t, alerts)
+}
+
+func TestRecordUserSpendMemory(t *testing.T) {
+	userId := 990001
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)
+
+	_, err := recordUserSpend(userId, 240, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	snapshot, err := recordUserSpend(userId, 100, now)
+	require.NoError(t, err)
+	snapshot, err = recordUserSpend(userId, 50, now)
+	require.NoError(t, err)
+
+	require.EqualValues(t, 150, snapshot.HourSpend)
+	require.EqualValues(t, 390, snapshot.DaySpend)
+	require.InDelta(t, 10, snapshot.TrailingAvg(), 0.001)
+
+	snapshot, err = recordUserSpend(userId, 10, now.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 10, snapshot.DaySpend)
+}
+
+func TestClaimSpendAlert(t *testing.T) {
+	require.True(t, claimSpendAlert("test:claim"))
+	require.False(t, claimSpendAlert("test:claim"))
+	require.True(t, claimSpendAlert("test:claim:other"))
+}
+
+func TestMemorySpendEvictsIdleUsers(t *testing.T) {
+	now := time.Date(2027, 1, 5, 8, 0, 0, 0, time.Local)
+	_, err := recordUserSpend(990002, 10, now)
+	require.NoError(t, err)
+	_, ok := memorySpendStore.Load(990002)
+	require.True(t, ok)
+
+	_, err = recordUserSpend(990003, 10, now.Add((spendAlertTrailingHours+2)*time.Hour))
+	require.NoError(t, err)
+	_, ok = memorySpendStore.Load(990002)
+	require.False(t, ok)
+}
+
+// 不经过 SettleBilling 的扣费（Midjourney、违规费用、实时会话）同样计入消费告警
+func TestPostConsumeQuotaRecordsSpend(t *testing.T) {
+	truncate(t)
+	seedUser(t, 990010, 10000)
+	seedToken(t, 990010, 990010, "spendalerttoken", 10000)
+
+	setting := operation_setting.GetSpendAlertSetting()
+	saved := *setting
+	*setting = operation_setting.SpendAlertSetting{Enabled: true, GlobalDailyQuota: 1 << 30}
+	t.Cleanup(func() { *setting = saved })
+
+	info := &relaycommon.RelayInfo{UserId: 990010, TokenId: 990010, TokenKey: "sk-spendalerttoken", StartTime: time.Now()}
+	require.NoError(t, PostConsumeQuota(info, 300, 0, false))
+	require.Eventually(t, func() bool {
+		value, ok := memorySpendStore.Load(990010)
+		if !ok {
+			return false
+		}
+		spend := value.(*memorySpend)
+		spend.mu.Lock()
+		defer spend.mu.Unlock()
+		return spend.dayTotal == 300
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -192,7 +192,11 @@ func updateSunoTasks(ctx context.Context, channelId int, taskIds []string, taskM
 		return errors.New("adaptor not found")
 	}
 	proxy := ch.GetSetting().Proxy
-	resp, err := adaptor.FetchTask(*ch.BaseURL, ch.Key, map[string]any{
+	key, err := ch.GetResolvedKey()
+	if err != nil {
+		return err
+	}
+	resp, err := adaptor.FetchTask(*ch.BaseURL, key, map[string]any{
 		"ids": taskIds,
 	}, proxy)
 	if err != nil {
@@ -329,7 +333,10 @@ func updateVideoTasks(ctx context.Context, platform constant.TaskPlatform, chann
 	info.ChannelMeta = &relaycommon.ChannelMeta{
 		ChannelBaseUrl: cacheGetChannel.GetBaseURL(),
 	}
-	info.ApiKey = cacheGetChannel.Key
+	info.ApiKey, err = cacheGetChannel.GetResolvedKey()
+	if err != nil {
+		return err
+	}
 	adaptor.Init(info)
 	for _, taskId := range taskIds {
 		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
@@ -353,7 +360,10 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 		logger.LogError(ctx, fmt.Sprintf("Task %s not found in taskM", taskId))
 		return fmt.Errorf("task %s not found", taskId)
 	}
-	key := ch.Key
+	key, err := ch.GetResolvedKey()
+	if err != nil {
+		return err
+	}
 
 	privateData := task.PrivateData
 	if privateData.Key != "" {
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	TokenAnomalyNewIpPrefix  = "new_ip_prefix"
+	TokenAnomalyUnusualModel = "unusual_model"
+	TokenAnomalyOffHours     = "off_hours"
+
+	tokenAnomalyFlushInterval = 1 * time.Minute
+	tokenAnomalyIdleEviction  = 1 * time.Hour
+)
+
+// tokenAnomalyState 单个令牌在本节点上的检测状态。画像从数据库异步加载，
+// 本节点观察到的使用数据累积在 delta 中定期合并回画像
+type tokenAnomalyState struct {
+	mu       sync.Mutex
+	userId   int
+	profile  *model.TokenProfileData
+	loading  bool
+	lastSeen int64
+	delta    *model.TokenUsageDelta
+
+	windowStart   int64
+	newNetworks   map[string]struct{}
+	unusualModels int
+	offHours      int
+	triggered     map[string]bool
+}
+
+var (
+	tokenAnomalyStates   sync.Map // tokenId -> *tokenAnomalyState
+	tokenAnomalyTaskOnce sync.Once
+)
+
+func newTokenUsageDelta(userId int) *model.TokenUsageDelta {
+	return &model.TokenUsageDelta{UserId: userId, Networks: map[string]int64{}, Models: map[string]int64{}}
+}
+
+// ipPrefix 将客户端 IP 归并到固定长度的前缀（IPv4 /24、IPv6 /48）。这只是来源网络的启发式近似，
+// 不查询 ASN：同一运营商的不同前缀会被视为陌生网段，同一前缀内的其他主机则无法区分
+func ipPrefix(clientIp string) string {
+	ip := net.ParseIP(clientIp)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%s/24", v4.Mask(net.CIDRMask(24, 32)).String())
+	}
+	return fmt.Sprintf("%s/48", ip.Mask(net.CIDRMask(48, 128)).String())
+}
+
+// isRareShare 判断 count 在 total 中的占比是否低于 percent
+func isRareShare(count int64, total int64, percent float64) bool {
+	if total <= 0 {
+		return true
+	}
+	return float64(count)*100 < float64(total)*percent
+}
+
+func getTokenAnomalyState(tokenId int, userId int) *tokenAnomalyState {
+	value, _ := tokenAnomalyStates.LoadOrStore(tokenId, &tokenAnomalyState{
+		userId: userId,
+		delta:  newTokenUsageDelta(userId),
+	})
+	return value.(*tokenAnomalyState)
+}
+
+// readyLocked 画像已加载且积累了足够的基线数据；同时滚动检测窗口
+func (s *tokenAnomalyState) readyLocked(tokenId int, now int64, setting *operation_setting.TokenAnomalySetting) bool {
+	if s.profile == nil {
+		if !s.loading {
+			s.loading = true
+			gopool.Go(func() { loadTokenAnomalyProfile(tokenId) })
+		}
+		return false
+	}
+	if s.profile.TotalRequests < setting.MinBaselineRequests ||
+		now-s.profile.FirstSeen < int64(setting.MinBaselineHours)*3600 {
+		return false
+	}
+	window := int64(setting.WindowMinutes) * 60
+	if window <= 0 {
+		window = 600
+	}
+	if now-s.windowStart >= window {
+		s.windowStart = now
+		s.newNetworks = map[string]struct{}{}
+		s.unusualModels = 0
+		s.offHours = 0
+		s.triggered = map[string]bool{}
+	}
+	return true
+}
+
+func loadTokenAnomalyProfile(tokenId int) {
+	profile, err := model.GetTokenUsageProfile(tokenId)
+	value, ok := tokenAnomalyStates.Load(tokenId)
+	if !ok {
+		return
+	}
+	state := value.(*tokenAnomalyState)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.loading = false
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load token %d usage profile: %s", tokenId, err.Error()))
+		return
+	}
+	state.profile = &profile
+}
+
+// ObserveTokenRequest 记录令牌鉴权通过的请求并检测陌生网段与罕见时段
+func ObserveTokenRequest(token *model.Token, clientIp string) {
+	setting := operation_setting.GetTokenAnomalySetting()
+	if !setting.Enabled || token == nil {
+		return
+	}
+	now := time.Now()
+	network := ipPrefix(clientIp)
+	hour := now.Hour()
+
+	state := getTokenAnomalyState(token.Id, token.UserId)
+	state.mu.Lock()
+	state.lastSeen = now.Unix()
+	state.delta.Requests++
+	state.delta.HourCounts[hour]++
+	state.delta.LastSeen = now.Unix()
+	if network != "" {
+		state.delta.Networks[network] = now.Unix()
+	}
+
+	var signals []string
+	var detail []string
+	if state.readyLocked(token.Id, now.Unix(), setting) {
+		if network != "" {
+			if !state.isKnownNetworkLocked(network, now.Unix(), setting) {
+				state.newNetworks[network] = struct{}{}
+				if setting.NewIpPrefixThreshold > 0 && len(state.newNetworks) >= setting.NewIpPrefixThreshold && !state.triggered[TokenAnomalyNewIpPrefix] {
+					state.triggered[TokenAnomalyNewIpPrefix] = true
+					signals = append(signals, TokenAnomalyNewIpPrefix)
+					detail = append(detail, fmt.Sprintf("%d 分钟内出现 %d 个陌生网段（最近 %s）", setting.WindowMinutes, len(state.newNetworks), network))
+				}
+			}
+		}
+		var total int64
+		for _, count := range state.profile.HourCounts {
+			total += count
+		}
+		if isRareShare(state.profile.HourCounts[hour], total, setting.RareSharePercent) {
+			state.offHours++
+			if setting.OffHoursThreshold > 0 && state.offHours >= setting.OffHoursThreshold && !state.triggered[TokenAnomalyOffHours] {
+				state.triggered[TokenAnomalyOffHours] = true
+				signals = append(signals, TokenAnomalyOffHours)
+				detail = append(detail, fmt.Sprintf("%d 分钟内在非常用时段（%d 点）请求 %d 次", setting.WindowMinutes, hour, state.offHours))
+			}
+		}
+	}
+	var knownNetworks []string
+	if len(signals) > 0 {
+		knownNetworks = state.knownNetworksLocked(now.Unix(), setting)
+	}
+	state.mu.Unlock()
+
+	for i, signal := range signals {
+		handleTokenAnomaly(token.Id, token.UserId, token.Name, signal, detail[i], knownNetworks)
+	}
+}
+
+// ObserveTokenModel 记录令牌请求的模型并检测罕见模型
+func ObserveTokenModel(tokenId int, userId int, tokenName string, modelName string) {
+	setting := operation_setting.GetTokenAnomalySetting()
+	if !setting.Enabled || tokenId == 0 || modelName == "" {
+		return
+	}
+	now := time.Now().Unix()
+	state := getTokenAnomalyState(tokenId, userId)
+	state.mu.Lock()
+	state.lastSeen = now
+	state.delta.Models[modelName]++
+
+	triggered := false
+	detail := ""
+	if state.readyLocked(tokenId, now, setting) {
+		var total int64
+		for _, count := range state.profile.ModelCounts {
+			total += count
+		}
+		if isRareShare(state.profile.ModelCounts[modelName], total, setting.RareSharePercent) {
+			state.unusualModels++
+			if setting.UnusualModelThreshold > 0 && state.unusualModels >= setting.UnusualModelThreshold && !state.triggered[TokenAnomalyUnusualModel] {
+				state.triggered[TokenAnomalyUnusualModel] = true
+				triggered = true
+				detail = fmt.Sprintf("%d 分钟内请求非常用模型 %d 次（最近 %s）", setting.WindowMinutes, state.unusualModels, modelName)
+			}
+		}
+	}
+	var knownNetworks []string
+	if triggered {
+		knownNetworks = state.knownNetworksLocked(now, setting)
+	}
+	state.mu.Unlock()
+
+	if triggered {
+		handleTokenAnomaly(tokenId, userId, tokenName, TokenAnomalyUnusualModel, detail, knownNetworks)
+	}
+}
+
+// isKnownNetworkLocked 网段已在画像中且首次出现早于学习期，刚出现的网段即使已合并到画像也视为陌生
+func (s *tokenAnomalyState) isKnownNetworkLocked(network string, now int64, setting *operation_setting.TokenAnomalySetting) bool {
+	times, ok := s.profile.Networks[network]
+	return ok && now-times[0] >= int64(setting.IpPrefixLearnHours)*3600
+}
+
+// knownNetworksLocked 返回画像中已过学习期的常用网段
+func (s *tokenAnomalyState) knownNetworksLocked(now int64, setting *operation_setting.TokenAnomalySetting) []string {
+	networks := make([]string, 0, len(s.profile.Networks))
+	for network := range s.profile.Networks {
+		if s.isKnownNetworkLocked(network, now, setting) {
+			networks = append(networks, network)
+		}
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+func tokenAnomalyAction(signal string) string {
+	setting := operation_setting.GetTokenAnomalySetting()
+	switch signal {
+	case TokenAnomalyNewIpPrefix:
+		return setting.NewIpPrefixAction
+	case TokenAnomalyUnusualModel:
+		return setting.UnusualModelAction
+	case TokenAnomalyOffHours:
+		return setting.OffHoursAction
+	}
+	return operation_setting.TokenAnomalyActionNone
+}
+
+// handleTokenAnomaly 按策略处理异常：告警、强制 IP 白名单或隔离令牌，并通知用户与 root 用户
+func handleTokenAnomaly(tokenId int, userId int, tokenName string, signal string, detail string, knownNetworks []string) {
+	action := tokenAnomalyAction(signal)
+	if action == operation_setting.TokenAnomalyActionNone {
+		return
+	}
+	gopool.Go(func() {
+		result := "仅告警"
+		switch action {
+		case operation_setting.TokenAnomalyActionRequireAllowIps:
+			pinned, err := model.PinTokenAllowIps(tokenId, knownNetworks)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to pin allow ips for token %d: %s", tokenId, err.Error()))
+				return
+			}
+			if pinned {
+				result = "已将令牌 IP 白名单限制为历史网段：" + strings.Join(knownNetworks, ", ")
+			}
+		case operation_setting.TokenAnomalyActionQuarantine:
+			quarantined, err := model.QuarantineToken(tokenId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to quarantine token %d: %s", tokenId, err.Error()))
+				return
+			}
+			if !quarantined {
+				return
+			}
+			result = "令牌已被隔离，请轮换密钥后继续使用"
+		}
+
+		message := fmt.Sprintf("令牌「%s」(#%d) 疑似泄露：%s。处理结果：%s", tokenName, tokenId, detail, result)
+		logger.LogWarn(context.Background(), fmt.Sprintf("token anomaly detected: user=%d token=%d signal=%s action=%s detail=%s", userId, tokenId, signal, action, detail))
+		model.RecordLog(userId, model.LogTypeManage, message)
+
+		user, err := model.GetUserById(userId, false)
+		if err == nil {
+			notify := dto.NewNotify(dto.NotifyTypeTokenAnomaly, "令牌异常使用告警", "{{value}}", []interface{}{message})
+			if err := NotifyUser(userId, user.Email, user.GetSetting(), notify); err != nil {
+				common.SysError(fmt.Sprintf("failed to send token anomaly notify to user %d: %s", userId, err.Error()))
+			}
+		}
+		NotifyRootUser(dto.NotifyTypeTokenAnomaly, "令牌异常使用告警", fmt.Sprintf("用户 %d：%s", userId, message))
+	})
+}
+
+// StartTokenAnomalyTask 定期将各节点累积的令牌使用数据合并到画像，所有节点都需要运行
+func StartTokenAnomalyTask() {
+	tokenAnomalyTaskOnce.Do(func() {
+		gopool.Go(func() {
+			ticker := time.NewTicker(tokenAnomalyFlushInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if !operation_setting.GetTokenAnomalySetting().Enabled {
+					continue
+				}
+				flushTokenAnomalyStates(time.Now().Unix())
+			}
+		})
+	})
+}
+
+func flushTokenAnomalyStates(now int64) {
+	tokenAnomalyStates.Range(func(key, value any) bool {
+		tokenId := key.(int)
+		state := value.(*tokenAnomalyState)
+
+		state.mu.Lock()
+		delta := state.delta
+		idle := now-state.lastSeen >= int64(tokenAnomalyIdleEviction.Seconds())
+		state.delta = newTokenUsageDelta(state.userId)
+		state.mu.Unlock()
+
+		if delta.Requests > 0 || len(delta.Models) > 0 {
+			if err := model.MergeTokenUsageDelta(tokenId, delta); err != nil {
+				common.SysError(fmt.Sprintf("failed to merge token %d usage profile: %s", tokenId, err.Error()))
+			}
+		}
+		if idle {
+			tokenAnomalyStates.Delete(tokenId)
+			return true
+		}
+		// 重新加载画像，纳入其他节点的数据
+		loadTokenAnomalyProfile(tokenId)
+		return true
+	})
+}
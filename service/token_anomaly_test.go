@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIpPrefix(t *testing.T) {
+	require.Equal(t, "203.0.113.0/24", ipPrefix("203.0.113.45"))
+	require.Equal(t, "203.0.113.0/24", ipPrefix("::ffff:203.0.113.7"))
+	require.Equal(t, "2001:db8:1::/48", ipPrefix("2001:db8:1:2::1"))
+	require.Equal(t, "", ipPrefix("not-an-ip"))
+}
+
+func TestIsRareShare(t *testing.T) {
+	require.True(t, isRareShare(0, 0, 1))
+	require.True(t, isRareShare(0, 1000, 1))
+	require.True(t, isRareShare(9, 1000, 1))
+	require.False(t, isRareShare(10, 1000, 1))
+}
+
+func TestKnownNetworksRespectLearningPeriod(t *testing.T) {
+	const now = int64(1_000_000)
+	setting := &operation_setting.TokenAnomalySetting{IpPrefixLearnHours: 24}
+	state := &tokenAnomalyState{profile: &model.TokenProfileData{
+		Networks: map[string][2]int64{
+			"198.51.100.0/24": {now - 48*3600, now - 60},
+			"203.0.113.0/24":  {now - 3600, now - 60},
+		},
+	}}
+
+	require.True(t, state.isKnownNetworkLocked("198.51.100.0/24", now, setting))
+	// 学习期内刚出现的网段仍视为陌生，避免攻击者的网段在一次落库后被学习
+	require.False(t, state.isKnownNetworkLocked("203.0.113.0/24", now, setting))
+	require.False(t, state.isKnownNetworkLocked("192.0.2.0/24", now, setting))
+	require.Equal(t, []string{"198.51.100.0/24"}, state.knownNetworksLocked(now, setting))
+}
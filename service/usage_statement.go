@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/parquet-go/parquet-go"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// UsageStatementSyncMaxRange 同步导出允许的最大时间跨度，更大范围需要使用异步任务
+	UsageStatementSyncMaxRange = 31 * 24 * 3600
+	// UsageStatementJobMaxRange 异步任务允许的最大时间跨度
+	UsageStatementJobMaxRange = 366 * 24 * 3600
+
+	usageStatementRetention   = 7 * 24 * 3600
+	usageStatementStaleAfter  = 6 * 3600
+	usageStatementCleanupSize = 100
+)
+
+// UsageStatementLine 对账单中的一行，金额按充值价格与用户分组充值倍率换算
+type UsageStatementLine struct {
+	Date             string  `json:"date" parquet:"date"`
+	UserId           int64   `json:"user_id" parquet:"user_id"`
+	Username         string  `json:"username" parquet:"username"`
+	TokenId          int64   `json:"token_id" parquet:"token_id"`
+	TokenName        string  `json:"token_name" parquet:"token_name"`
+	ModelName        string  `json:"model_name" parquet:"model_name"`
+	Requests         int64   `json:"requests" parquet:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens" parquet:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens" parquet:"completion_tokens"`
+	Quota            int64   `json:"quota" parquet:"quota"`
+	AmountUSD        float64 `json:"amount_usd" parquet:"amount_usd"`
+	Amount           float64 `json:"amount" parquet:"amount"`
+}
+
+var usageStatementCSVHeader = []string{
+	"date", "user_id", "username", "token_id", "token_name", "model_name",
+	"requests", "prompt_tokens", "completion_tokens", "quota", "amount_usd", "amount",
+}
+
+// BuildUsageStatement 汇总用量并换算金额
+//
+//	amount_usd = quota / QuotaPerUnit
+//	amount     = amount_usd * Price * 用户分组充值倍率
+func BuildUsageStatement(query model.UsageStatementQuery) ([]UsageStatementLine, error) {
+	rows, err := model.AggregateUsageStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	topupRatios := make(map[int]float64)
+	getTopupRatio := func(userId int) float64 {
+		if ratio, ok := topupRatios[userId]; ok {
+			return ratio
+		}
+		ratio := 1.0
+		if group, err := model.GetUserGroup(userId, false); err == nil {
+			if r := common.GetTopupGroupRatio(group); r > 0 {
+				ratio = r
+			}
+		}
+		topupRatios[userId] = ratio
+		return ratio
+	}
+
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	dPrice := decimal.NewFromFloat(operation_setting.Price)
+	lines := make([]UsageStatementLine, 0, len(rows))
+	for _, row := range rows {
+		dAmountUSD := decimal.NewFromInt(row.Quota).Div(dQuotaPerUnit)
+		dAmount := dAmountUSD.Mul(dPrice).Mul(decimal.NewFromFloat(getTopupRatio(row.UserId)))
+		lines = append(lines, UsageStatementLine{
+			Date:             row.Date,
+			UserId:           int64(row.UserId),
+			Username:         row.Username,
+			TokenId:          int64(row.TokenId),
+			TokenName:        row.TokenName,
+			ModelName:        row.ModelName,
+			Requests:         row.Requests,
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			Quota:            row.Quota,
+			AmountUSD:        dAmountUSD.Round(6).InexactFloat64(),
+			Amount:           dAmount.Round(6).InexactFloat64(),
+		})
+	}
+	return lines, nil
+}
+
+// WriteUsageStatement 以指定格式写出对账单
+func WriteUsageStatement(w io.Writer, format string, lines []UsageStatementLine) error {
+	switch format {
+	case model.UsageStatementFormatCSV:
+		return writeUsageStatementCSV(w, lines)
+	case model.UsageStatementFormatParquet:
+		return writeUsageStatementParquet(w, lines)
+	default:
+		return fmt.Errorf("unsupported statement format %q", format)
+	}
+}
+
+func writeUsageStatementCSV(w io.Writer, lines []UsageStatementLine) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(usageStatementCSVHeader); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		record := []string{
+			line.Date,
+			strconv.FormatInt(line.UserId, 10),
+			line.Username,
+			strconv.FormatInt(line.TokenId, 10),
+			line.TokenName,
+			line.ModelName,
+			strconv.FormatInt(line.Requests, 10),
+			strconv.FormatInt(line.PromptTokens, 10),
+			strconv.FormatInt(line.CompletionTokens, 10),
+			strconv.FormatInt(line.Quota, 10),
+			strconv.FormatFloat(line.AmountUSD, 'f', 6, 64),
+			strconv.FormatFloat(line.Amount, 'f', 6, 64),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeUsageStatementParquet(w io.Writer, lines []UsageStatementLine) error {
+	writer := parquet.NewGenericWriter[UsageStatementLine](w)
+	if _, err := writer.Write(lines); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// UsageStatementFileName 下载时使用的文件名
+func UsageStatementFileName(query model.UsageStatementQuery, format string) string {
+	start := time.Unix(query.StartTimestamp, 0).Format("20060102")
+	end := time.Unix(query.EndTimestamp, 0).Format("20060102")
+	name := fmt.Sprintf("usage-statement-%s-%s", start, end)
+	if query.UserId != 0 {
+		name += fmt.Sprintf("-user%d", query.UserId)
+	}
+	if query.TokenId != 0 {
+		name += fmt.Sprintf("-token%d", query.TokenId)
+	}
+	return name + "." + format
+}
+
+// ValidateUsageStatementRequest 校验导出参数
+func ValidateUsageStatementRequest(query model.UsageStatementQuery, format string, maxRange int64) error {
+	if format != model.UsageStatementFormatCSV && format != model.UsageStatementFormatParquet {
+		return errors.New("format 仅支持 csv 或 parquet")
+	}
+	if query.StartTimestamp <= 0 || query.EndTimestamp <= 0 || query.EndTimestamp < query.StartTimestamp {
+		return errors.New("请指定有效的时间范围")
+	}
+	if query.EndTimestamp-query.StartTimestamp > maxRange {
+		return fmt.Errorf("时间跨度不能超过 %d 天", maxRange/(24*3600))
+	}
+	return nil
+}
+
+func getUsageStatementDir() string {
+	if dir := common.GetEnvOrDefaultString("USAGE_STATEMENT_DIR", ""); dir != "" {
+		return dir
+	}
+	return filepath.Join(common.GetDiskCacheDir(), "usage-statements")
+}
+
+// CreateUsageStatementJob 创建异步对账单任务
+func CreateUsageStatementJob(creatorId int, query model.UsageStatementQuery, format string) (*model.UsageStatementJob, error) {
+	job := &model.UsageStatementJob{
+		CreatorId:      creatorId,
+		UserId:         query.UserId,
+		TokenId:        query.TokenId,
+		ModelName:      query.ModelName,
+		StartTimestamp: query.StartTimestamp,
+		EndTimestamp:   query.EndTimestamp,
+		Format:         format,
+		Status:         model.UsageStatementStatusPending,
+		CreatedAt:      common.GetTimestamp(),
+	}
+	if err := job.Insert(); err != nil {
+		return nil, err
+	}
+	gopool.Go(func() {
+		runUsageStatementJob(job, query)
+	})
+	gopool.Go(cleanupUsageStatementJobs)
+	return job, nil
+}
+
+func runUsageStatementJob(job *model.UsageStatementJob, query model.UsageStatementQuery) {
+	ctx := context.Background()
+	job.Status = model.UsageStatementStatusRunning
+	if err := job.Update(); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to update usage statement job %d: %v", job.Id, err))
+	}
+
+	rows, size, path, err := generateUsageStatementFile(job, query)
+	job.FinishedAt = common.GetTimestamp()
+	if err != nil {
+		job.Status = model.UsageStatementStatusFailed
+		job.Error = err.Error()
+		logger.LogWarn(ctx, fmt.Sprintf("usage statement job %d failed: %v", job.Id, err))
+	} else {
+		job.Status = model.UsageStatementStatusSucceeded
+		job.Rows = rows
+		job.Size = size
+		job.FilePath = path
+		job.ExpiresAt = job.FinishedAt + usageStatementRetention
+	}
+	if err := job.Update(); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to update usage statement job %d: %v", job.Id, err))
+	}
+}
+
+func generateUsageStatementFile(job *model.UsageStatementJob, query model.UsageStatementQuery) (int, int64, string, error) {
+	lines, err := BuildUsageStatement(query)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	dir := getUsageStatementDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, 0, "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d-%s.%s", job.Id, common.GetRandomString(8), job.Format))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if err := WriteUsageStatement(file, job.Format, lines); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return 0, 0, "", err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(path)
+		return 0, 0, "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return len(lines), info.Size(), path, nil
+}
+
+// OpenUsageStatementFile 打开已生成的对账单文件
+func OpenUsageStatementFile(job *model.UsageStatementJob) (*os.File, error) {
+	if job.Status != model.UsageStatementStatusSucceeded || job.FilePath == "" {
+		return nil, errors.New("对账单尚未生成完成")
+	}
+	file, err := os.Open(job.FilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("对账单文件不存在，可能已过期或不在当前节点")
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+var usageStatementCleanupMu sync.Mutex
+
+// cleanupUsageStatementJobs 删除过期的对账单文件与任务，并将中断的任务标记为失败
+func cleanupUsageStatementJobs() {
+	if !usageStatementCleanupMu.TryLock() {
+		return
+	}
+	defer usageStatementCleanupMu.Unlock()
+
+	ctx := context.Background()
+	now := common.GetTimestamp()
+	if err := model.FailStaleUsageStatementJobs(now - usageStatementStaleAfter); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to mark stale usage statement jobs: %v", err))
+	}
+	jobs, err := model.GetExpiredUsageStatementJobs(now, usageStatementCleanupSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to query expired usage statement jobs: %v", err))
+		return
+	}
+	ids := make([]int, 0, len(jobs))
+	for _, job := range jobs {
+		if job.FilePath != "" {
+			if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to remove usage statement file %s: %v", job.FilePath, err))
+			}
+		}
+		ids = append(ids, job.Id)
+	}
+	if err := model.DeleteUsageStatementJobsByIds(ids); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("failed to delete expired usage statement jobs: %v", err))
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteUsageStatement(t *testing.T) {
+	t.Parallel()
+
+	lines := []UsageStatementLine{
+		{Date: "2026-03-01", UserId: 1, Username: "alice", TokenId: 10, TokenName: "prod, eu", ModelName: "gpt-4o", Requests: 2, Quota: 500000, AmountUSD: 1, Amount: 7.3},
+	}
+
+	var csvBuf bytes.Buffer
+	require.NoError(t, WriteUsageStatement(&csvBuf, model.UsageStatementFormatCSV, lines))
+	require.Equal(t,
+		"date,user_id,username,token_id,token_name,model_name,requests,prompt_tokens,completion_tokens,quota,amount_usd,amount\n"+
+			"2026-03-01,1,alice,10,\"prod, eu\",gpt-4o,2,0,0,500000,1.000000,7.300000\n",
+		csvBuf.String())
+
+	var parquetBuf bytes.Buffer
+	require.NoError(t, WriteUsageStatement(&parquetBuf, model.UsageStatementFormatParquet, lines))
+	rows, err := parquet.Read[UsageStatementLine](bytes.NewReader(parquetBuf.Bytes()), int64(parquetBuf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, lines, rows)
+
+	require.Error(t, WriteUsageStatement(&csvBuf, "xlsx", lines))
+}
@@ -32,10 +32,15 @@ func (p ChatCompletionsToResponsesPolicy) IsChannelEnabled(channelID int, channe
 	return false
 }
 
+// ResponsesToChatCompletionsPolicy 控制哪些渠道将 /v1/responses 请求转换为 Chat Completions 发送，
+// 字段含义与 ChatCompletionsToResponsesPolicy 相同。仅支持 Chat Completions 的渠道类型无需配置，始终转换
+type ResponsesToChatCompletionsPolicy = ChatCompletionsToResponsesPolicy
+
 type GlobalSettings struct {
 	PassThroughRequestEnabled        bool                             `json:"pass_through_request_enabled"`
 	ThinkingModelBlacklist           []string                         `json:"thinking_model_blacklist"`
 	ChatCompletionsToResponsesPolicy ChatCompletionsToResponsesPolicy `json:"chat_completions_to_responses_policy"`
+	ResponsesToChatCompletionsPolicy ResponsesToChatCompletionsPolicy `json:"responses_to_chat_completions_policy"`
 }
 
 // 默认配置
@@ -49,6 +54,10 @@ var defaultOpenaiSettings = GlobalSettings{
 		Enabled:     false,
 		AllChannels: true,
 	},
+	ResponsesToChatCompletionsPolicy: ResponsesToChatCompletionsPolicy{
+		Enabled:     false,
+		AllChannels: false,
+	},
 }
 
 // 全局实例
@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// CountTokensSetting token 计数接口（Anthropic count_tokens、Gemini countTokens）配置
+type CountTokensSetting struct {
+	// UpstreamEnabled 渠道支持时请求上游计数，关闭或上游失败时使用本地估算
+	UpstreamEnabled bool `json:"upstream_enabled"`
+	// Price 每次调用的价格（美元），按分组倍率折算，0 表示免费
+	Price float64 `json:"price"`
+}
+
+// 默认配置
+var countTokensSetting = CountTokensSetting{
+	UpstreamEnabled: true,
+	Price:           0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("count_tokens_setting", &countTokensSetting)
+}
+
+// GetCountTokensSetting 获取 token 计数接口配置
+func GetCountTokensSetting() *CountTokensSetting {
+	return &countTokensSetting
+}
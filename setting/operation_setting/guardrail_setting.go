@@ -0,0 +1,279 @@
+package operation_setting
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+
+	"github.com/samber/lo"
+)
+
+const (
+	GuardrailStageKeyword  = "keyword"
+	GuardrailStageRegex    = "regex"
+	GuardrailStagePII      = "pii"
+	GuardrailStageLLMJudge = "llm_judge"
+	// GuardrailStagePromptInjection 对用户内容与工具结果做提示词注入评分
+	GuardrailStagePromptInjection = "prompt_injection"
+
+	GuardrailPhaseInput  = "input"
+	GuardrailPhaseOutput = "output"
+	GuardrailPhaseBoth   = "both"
+
+	GuardrailActionBlock  = "block"
+	GuardrailActionRedact = "redact"
+	GuardrailActionFlag   = "flag"
+	// GuardrailActionWrap 用防御性说明包裹可疑内容，仅用于 prompt_injection
+	GuardrailActionWrap = "wrap"
+
+	GuardrailJudgeModeModeration = "moderation"
+	GuardrailJudgeModeClassifier = "classifier"
+
+	GuardrailSourceUser = "user"
+	GuardrailSourceTool = "tool"
+)
+
+// GuardrailStage 内容安全流水线中的一个检测阶段，按配置顺序依次执行
+type GuardrailStage struct {
+	Name string `json:"name"`
+	// Type keyword / regex / pii / llm_judge / prompt_injection
+	Type string `json:"type"`
+	// Phase 作用于输入（input）、输出（output）或两者（both），默认 input
+	Phase string `json:"phase"`
+	// Action 命中后的处理方式：block 拦截、redact 脱敏、flag 放行并记录（标记请求）、wrap 包裹可疑内容
+	Action string `json:"action"`
+	// Patterns keyword 为关键词列表（为空时使用全局敏感词），regex 为正则表达式列表，
+	// prompt_injection 为附加的注入特征正则（命中即视为注入）
+	Patterns []string `json:"patterns,omitempty"`
+	// PiiTypes pii 检测的类型，为空表示全部类型
+	PiiTypes []string `json:"pii_types,omitempty"`
+	// Replacement 脱敏替换文本，为空时使用默认值
+	Replacement string `json:"replacement,omitempty"`
+	// Locales pii 检测的地区格式（手机号、证件号），为空表示全部地区
+	Locales []string `json:"locales,omitempty"`
+	// Reversible pii 输入脱敏使用编号占位符（如 [EMAIL_1]），同一请求中相同内容使用相同占位符
+	Reversible bool `json:"reversible,omitempty"`
+	// Restore 将响应中的占位符还原为原文后再返回给调用方，需同时开启 Reversible
+	Restore bool `json:"restore,omitempty"`
+
+	// JudgeModel llm_judge 调用的模型，请求经由网关自身转发
+	JudgeModel string `json:"judge_model,omitempty"`
+	// JudgeMode moderation 调用 /v1/moderations；classifier 调用 /v1/chat/completions，由模型回答是否违规
+	JudgeMode string `json:"judge_mode,omitempty"`
+	// JudgePrompt classifier 模式的系统提示词，为空时使用默认提示词
+	JudgePrompt string `json:"judge_prompt,omitempty"`
+	// JudgeCategories moderation 模式下视为违规的类别，为空表示任意类别被标记即违规
+	JudgeCategories []string `json:"judge_categories,omitempty"`
+	// FailClosed 判定模型调用失败时视为违规，默认放行
+	FailClosed bool `json:"fail_closed,omitempty"`
+
+	// Sources prompt_injection 检测的内容来源：user 用户消息、tool 工具结果，为空表示全部
+	Sources []string `json:"sources,omitempty"`
+	// Threshold prompt_injection 的评分阈值（0-1），评分不低于阈值视为命中，默认 0.5
+	Threshold float64 `json:"threshold,omitempty"`
+	// Notice wrap 时置于可疑内容之前的说明，为空时使用默认说明
+	Notice string `json:"notice,omitempty"`
+}
+
+// GuardrailPolicy 一组有序的检测阶段
+type GuardrailPolicy struct {
+	Stages []GuardrailStage `json:"stages"`
+}
+
+// GuardrailSetting 内容安全流水线配置。启用后替代原有的提示词敏感词检查，
+// 令牌指定的策略优先于分组策略，分组策略优先于默认策略
+type GuardrailSetting struct {
+	Enabled bool `json:"enabled"`
+	// Policies 策略名 -> 策略
+	Policies map[string]GuardrailPolicy `json:"policies"`
+	// DefaultPolicy 未单独指定时使用的策略，为空表示不检测
+	DefaultPolicy string `json:"default_policy"`
+	// GroupPolicies 分组 -> 策略名，策略名为空表示该分组不检测
+	GroupPolicies map[string]string `json:"group_policies"`
+	// TokenPolicies 令牌 ID -> 策略名，策略名为空表示该令牌不检测
+	TokenPolicies map[int]string `json:"token_policies"`
+
+	// JudgeBaseURL llm_judge 请求的网关地址，为空时使用本机监听端口
+	JudgeBaseURL string `json:"judge_base_url"`
+	// JudgeApiKey llm_judge 请求使用的网关令牌，该令牌自身的请求不做检测
+	JudgeApiKey string `json:"judge_api_key"`
+	// JudgeTimeoutSeconds 判定请求超时时间
+	JudgeTimeoutSeconds int `json:"judge_timeout_seconds"`
+	// JudgeMaxChars 送检文本的最大字符数，超出部分截断
+	JudgeMaxChars int `json:"judge_max_chars"`
+	// StreamWindowSize 流式输出检测保留在窗口中的文本长度（字节），窗口内的文本检测通过后才下发
+	StreamWindowSize int `json:"stream_window_size"`
+}
+
+// 默认配置
+var guardrailSetting = GuardrailSetting{
+	Enabled:             false,
+	Policies:            map[string]GuardrailPolicy{},
+	GroupPolicies:       map[string]string{},
+	TokenPolicies:       map[int]string{},
+	JudgeTimeoutSeconds: 10,
+	JudgeMaxChars:       20000,
+	StreamWindowSize:    64,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+// GetGuardrailSetting 获取内容安全流水线配置
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
+
+// ResolvePolicy 按令牌、分组、默认的顺序确定请求使用的策略，返回 nil 表示不检测
+func (s *GuardrailSetting) ResolvePolicy(tokenId int, group string) (string, *GuardrailPolicy) {
+	name := s.DefaultPolicy
+	if groupPolicy, ok := s.GroupPolicies[group]; ok && group != "" {
+		name = groupPolicy
+	}
+	if tokenPolicy, ok := s.TokenPolicies[tokenId]; ok && tokenId != 0 {
+		name = tokenPolicy
+	}
+	if name == "" {
+		return "", nil
+	}
+	policy, ok := s.Policies[name]
+	if !ok || len(policy.Stages) == 0 {
+		return name, nil
+	}
+	return name, &policy
+}
+
+// AppliesTo 阶段是否作用于指定方向
+func (stage *GuardrailStage) AppliesTo(phase string) bool {
+	switch stage.Phase {
+	case "", GuardrailPhaseInput:
+		return phase == GuardrailPhaseInput
+	case GuardrailPhaseBoth:
+		return true
+	}
+	return stage.Phase == phase
+}
+
+// Validate 校验阶段配置
+func (stage *GuardrailStage) Validate() error {
+	switch stage.Phase {
+	case "", GuardrailPhaseInput, GuardrailPhaseOutput, GuardrailPhaseBoth:
+	default:
+		return fmt.Errorf("阶段 %s 的作用方向无效: %s", stage.Name, stage.Phase)
+	}
+	switch stage.Action {
+	case GuardrailActionBlock, GuardrailActionRedact, GuardrailActionFlag:
+	case GuardrailActionWrap:
+		if stage.Type != GuardrailStagePromptInjection {
+			return fmt.Errorf("阶段 %s 的处理方式 wrap 仅用于提示词注入检测", stage.Name)
+		}
+	default:
+		return fmt.Errorf("阶段 %s 的处理方式无效: %s", stage.Name, stage.Action)
+	}
+	switch stage.Type {
+	case GuardrailStageKeyword:
+	case GuardrailStageRegex:
+		if len(stage.Patterns) == 0 {
+			return fmt.Errorf("阶段 %s 未配置正则表达式", stage.Name)
+		}
+		for _, pattern := range stage.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("阶段 %s 的正则表达式无效: %s", stage.Name, err.Error())
+			}
+		}
+	case GuardrailStagePII:
+		for _, piiType := range stage.PiiTypes {
+			if !IsGuardrailPiiType(piiType) {
+				return fmt.Errorf("阶段 %s 的 PII 类型无效: %s", stage.Name, piiType)
+			}
+		}
+		for _, locale := range stage.Locales {
+			if !lo.Contains(GuardrailPiiLocales, locale) {
+				return fmt.Errorf("阶段 %s 的地区无效: %s", stage.Name, locale)
+			}
+		}
+		if stage.Reversible && stage.Action != GuardrailActionRedact {
+			return fmt.Errorf("阶段 %s 的可逆脱敏需要处理方式为 redact", stage.Name)
+		}
+	case GuardrailStageLLMJudge:
+		if stage.JudgeModel == "" {
+			return fmt.Errorf("阶段 %s 未配置判定模型", stage.Name)
+		}
+		switch stage.JudgeMode {
+		case "", GuardrailJudgeModeModeration, GuardrailJudgeModeClassifier:
+		default:
+			return fmt.Errorf("阶段 %s 的判定方式无效: %s", stage.Name, stage.JudgeMode)
+		}
+		if stage.Action == GuardrailActionRedact {
+			return fmt.Errorf("阶段 %s 为模型判定，不支持脱敏", stage.Name)
+		}
+	case GuardrailStagePromptInjection:
+		if stage.Phase != "" && stage.Phase != GuardrailPhaseInput {
+			return fmt.Errorf("阶段 %s 为提示词注入检测，仅作用于输入", stage.Name)
+		}
+		if stage.Action == GuardrailActionRedact {
+			return fmt.Errorf("阶段 %s 为提示词注入检测，不支持脱敏", stage.Name)
+		}
+		if stage.Threshold < 0 || stage.Threshold > 1 {
+			return fmt.Errorf("阶段 %s 的评分阈值需在 0 到 1 之间", stage.Name)
+		}
+		for _, source := range stage.Sources {
+			if source != GuardrailSourceUser && source != GuardrailSourceTool {
+				return fmt.Errorf("阶段 %s 的内容来源无效: %s", stage.Name, source)
+			}
+		}
+		for _, pattern := range stage.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("阶段 %s 的正则表达式无效: %s", stage.Name, err.Error())
+			}
+		}
+	default:
+		return fmt.Errorf("阶段 %s 的类型无效: %s", stage.Name, stage.Type)
+	}
+	if stage.Reversible && stage.Type != GuardrailStagePII {
+		return fmt.Errorf("阶段 %s 仅 pii 类型支持可逆脱敏", stage.Name)
+	}
+	if stage.Restore && !stage.Reversible {
+		return fmt.Errorf("阶段 %s 还原原文需要开启可逆脱敏", stage.Name)
+	}
+	return nil
+}
+
+// GuardrailPiiTypes 支持的 PII 类型
+var GuardrailPiiTypes = []string{"email", "phone", "id_card", "credit_card", "ipv4", "api_key"}
+
+// GuardrailPiiLocales 支持的地区格式：cn 中国大陆、us 美国、intl 带国际区号的手机号
+var GuardrailPiiLocales = []string{"cn", "us", "intl"}
+
+// IsGuardrailPiiType 是否为支持的 PII 类型
+func IsGuardrailPiiType(piiType string) bool {
+	for _, t := range GuardrailPiiTypes {
+		if t == piiType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGuardrailPolicies 校验策略配置
+func ValidateGuardrailPolicies(jsonStr string) error {
+	var policies map[string]GuardrailPolicy
+	if err := common.UnmarshalJsonStr(jsonStr, &policies); err != nil {
+		return err
+	}
+	for name, policy := range policies {
+		if name == "" {
+			return fmt.Errorf("策略名不能为空")
+		}
+		for i := range policy.Stages {
+			if err := policy.Stages[i].Validate(); err != nil {
+				return fmt.Errorf("策略 %s: %s", name, err.Error())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// InvoiceSetting 发票/收据配置
+type InvoiceSetting struct {
+	// Enabled 支付成功后是否自动开具发票
+	Enabled bool `json:"enabled"`
+	// InvoicePrefix 发票编号前缀，编号格式为 {prefix}{year}-{seq:06d}
+	InvoicePrefix string `json:"invoice_prefix"`
+	// CreditNotePrefix 红字发票（退款凭证）编号前缀
+	CreditNotePrefix string `json:"credit_note_prefix"`
+
+	// 销售方信息
+	SellerName    string `json:"seller_name"`
+	SellerAddress string `json:"seller_address"`
+	SellerTaxId   string `json:"seller_tax_id"`
+	SellerEmail   string `json:"seller_email"`
+
+	// Currency 充值订单默认币种
+	Currency string `json:"currency"`
+	// PaymentMethodCurrencies 按支付方式指定币种，例如 {"stripe":"USD"}
+	PaymentMethodCurrencies map[string]string `json:"payment_method_currencies"`
+
+	// TaxName 税种名称，例如 VAT、GST
+	TaxName string `json:"tax_name"`
+	// TaxRate 税率（百分比），支付金额视为含税价，开票时拆分出税额
+	TaxRate float64 `json:"tax_rate"`
+
+	// FooterNote 发票底部备注
+	FooterNote string `json:"footer_note"`
+}
+
+// 默认配置
+var invoiceSetting = InvoiceSetting{
+	Enabled:                 false,
+	InvoicePrefix:           "INV-",
+	CreditNotePrefix:        "CN-",
+	Currency:                "CNY",
+	PaymentMethodCurrencies: map[string]string{"stripe": "USD", "creem": "USD"},
+	TaxName:                 "VAT",
+	TaxRate:                 0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("invoice_setting", &invoiceSetting)
+}
+
+// GetInvoiceSetting 获取发票配置
+func GetInvoiceSetting() *InvoiceSetting {
+	return &invoiceSetting
+}
+
+// GetCurrency 获取支付方式对应的币种
+func (s *InvoiceSetting) GetCurrency(paymentMethod string) string {
+	if currency, ok := s.PaymentMethodCurrencies[paymentMethod]; ok && currency != "" {
+		return strings.ToUpper(currency)
+	}
+	if s.Currency == "" {
+		return "CNY"
+	}
+	return strings.ToUpper(s.Currency)
+}
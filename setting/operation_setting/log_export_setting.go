@@ -0,0 +1,119 @@
+package operation_setting
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	LogExportSinkTypeWebhook = "webhook"
+	LogExportSinkTypeFile    = "file"
+	LogExportSinkTypeKafka   = "kafka"
+)
+
+// LogExportSinkConfig 单个日志导出目标
+type LogExportSinkConfig struct {
+	// Name 唯一名称，同时作为本地缓冲目录名
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+
+	// 过滤条件，为空表示不过滤
+	// Sources 事件来源：consume / error / task_billing
+	Sources    []string `json:"sources"`
+	UserIds    []int    `json:"user_ids"`
+	Groups     []string `json:"groups"`
+	ModelNames []string `json:"model_names"` // 支持以 * 结尾的前缀匹配
+
+	// webhook
+	Url     string            `json:"url"`
+	Secret  string            `json:"secret"`
+	Headers map[string]string `json:"headers"`
+
+	// file
+	FilePath  string `json:"file_path"`
+	MaxFileMB int    `json:"max_file_mb"`
+	MaxFiles  int    `json:"max_files"`
+
+	// kafka
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+
+	// BatchSize 单次投递的最大事件数
+	BatchSize int `json:"batch_size"`
+	// MaxRetries 投递失败的最大重试次数，超过后进入死信
+	MaxRetries int `json:"max_retries"`
+}
+
+// LogExportSetting 日志流式导出配置
+type LogExportSetting struct {
+	Enabled bool                  `json:"enabled"`
+	Sinks   []LogExportSinkConfig `json:"sinks"`
+	// FlushIntervalSeconds 本地缓冲落盘与投递的间隔
+	FlushIntervalSeconds int `json:"flush_interval_seconds"`
+}
+
+// 默认配置
+var logExportSetting = LogExportSetting{
+	Enabled:              false,
+	Sinks:                []LogExportSinkConfig{},
+	FlushIntervalSeconds: 2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_export_setting", &logExportSetting)
+}
+
+// GetLogExportSetting 获取日志导出配置
+func GetLogExportSetting() *LogExportSetting {
+	return &logExportSetting
+}
+
+// GetBatchSize 获取单次投递的最大事件数
+func (s *LogExportSinkConfig) GetBatchSize() int {
+	if s.BatchSize <= 0 {
+		return 200
+	}
+	return s.BatchSize
+}
+
+// GetMaxRetries 获取最大重试次数
+func (s *LogExportSinkConfig) GetMaxRetries() int {
+	if s.MaxRetries <= 0 {
+		return 10
+	}
+	return s.MaxRetries
+}
+
+// Match 判断事件是否满足过滤条件
+func (s *LogExportSinkConfig) Match(source string, userId int, group string, modelName string) bool {
+	if len(s.Sources) > 0 && !slices.Contains(s.Sources, source) {
+		return false
+	}
+	if len(s.UserIds) > 0 && !slices.Contains(s.UserIds, userId) {
+		return false
+	}
+	if len(s.Groups) > 0 && !slices.Contains(s.Groups, group) {
+		return false
+	}
+	if len(s.ModelNames) > 0 {
+		matched := false
+		for _, pattern := range s.ModelNames {
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+				matched = strings.HasPrefix(modelName, prefix)
+			} else {
+				matched = pattern == modelName
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
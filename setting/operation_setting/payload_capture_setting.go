@@ -0,0 +1,82 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PayloadCaptureSetting 请求/响应载荷抓取配置（用于排查问题）
+type PayloadCaptureSetting struct {
+	// Enabled 总开关，关闭时不抓取任何载荷
+	Enabled bool `json:"enabled"`
+	// UserIds 指定抓取的用户
+	UserIds []int `json:"user_ids"`
+	// TokenIds 指定抓取的令牌
+	TokenIds []int `json:"token_ids"`
+	// SampleRate 对其余请求的抽样百分比（0-100）
+	SampleRate float64 `json:"sample_rate"`
+	// MaxBodyKB 单个载荷最大保存大小（KB），超出部分截断
+	MaxBodyKB int `json:"max_body_kb"`
+	// RetentionHours 载荷保留时长（小时）
+	RetentionHours int `json:"retention_hours"`
+	// Storage 存储后端名称，默认 disk
+	Storage string `json:"storage"`
+	// RedactPatterns 脱敏正则，匹配内容将被替换
+	RedactPatterns []string `json:"redact_patterns"`
+}
+
+const PayloadCaptureStorageDisk = "disk"
+
+// 默认配置
+var payloadCaptureSetting = PayloadCaptureSetting{
+	Enabled:        false,
+	UserIds:        []int{},
+	TokenIds:       []int{},
+	SampleRate:     0,
+	MaxBodyKB:      256,
+	RetentionHours: 72,
+	Storage:        PayloadCaptureStorageDisk,
+	RedactPatterns: []string{
+		`sk-[A-Za-z0-9_\-]{16,}`,
+		`(?i)bearer\s+[A-Za-z0-9._\-]{16,}`,
+		`AIza[0-9A-Za-z_\-]{35}`,
+	},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payload_capture_setting", &payloadCaptureSetting)
+}
+
+// GetPayloadCaptureSetting 获取载荷抓取配置
+func GetPayloadCaptureSetting() *PayloadCaptureSetting {
+	return &payloadCaptureSetting
+}
+
+// IsPayloadCaptureTarget 判断用户或令牌是否在显式抓取名单中
+func (s *PayloadCaptureSetting) IsPayloadCaptureTarget(userId int, tokenId int) bool {
+	if userId > 0 && slices.Contains(s.UserIds, userId) {
+		return true
+	}
+	if tokenId > 0 && slices.Contains(s.TokenIds, tokenId) {
+		return true
+	}
+	return false
+}
+
+// GetMaxBodyBytes 获取单个载荷最大字节数
+func (s *PayloadCaptureSetting) GetMaxBodyBytes() int {
+	if s.MaxBodyKB <= 0 {
+		return 256 << 10
+	}
+	return s.MaxBodyKB << 10
+}
+
+// GetRetentionSeconds 获取载荷保留秒数
+func (s *PayloadCaptureSetting) GetRetentionSeconds() int64 {
+	if s.RetentionHours <= 0 {
+		return 72 * 3600
+	}
+	return int64(s.RetentionHours) * 3600
+}
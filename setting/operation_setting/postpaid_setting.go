@@ -0,0 +1,47 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// PostpaidSetting 后付费（授信额度）账户配置
+type PostpaidSetting struct {
+	// Enabled 总开关，关闭后所有后付费账户回退为预付费
+	Enabled bool `json:"enabled"`
+	// BillingDay 每月出账日（1-28），账期在该日 0 点结束
+	BillingDay int `json:"billing_day"`
+	// DunningDays 出账后第 N 天发送催缴通知
+	DunningDays []int `json:"dunning_days"`
+	// SuspendAfterDays 出账后超过 N 天仍未结清则暂停账户，0 表示不因逾期暂停
+	SuspendAfterDays int `json:"suspend_after_days"`
+	// WarningPercent 授信额度使用达到该百分比时提醒用户，0 表示不提醒
+	WarningPercent int `json:"warning_percent"`
+}
+
+// 默认配置
+var postpaidSetting = PostpaidSetting{
+	Enabled:          false,
+	BillingDay:       1,
+	DunningDays:      []int{3, 7, 14},
+	SuspendAfterDays: 30,
+	WarningPercent:   80,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("postpaid_setting", &postpaidSetting)
+}
+
+// GetPostpaidSetting 获取后付费配置
+func GetPostpaidSetting() *PostpaidSetting {
+	return &postpaidSetting
+}
+
+// GetBillingDay 返回合法范围内的出账日
+func (s *PostpaidSetting) GetBillingDay() int {
+	if s.BillingDay < 1 {
+		return 1
+	}
+	if s.BillingDay > 28 {
+		return 28
+	}
+	return s.BillingDay
+}
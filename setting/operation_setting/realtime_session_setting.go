@@ -0,0 +1,112 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// RealtimeSessionPolicy 实时会话（/v1/realtime）限制，时长与数量限制为 0 表示不限制
+type RealtimeSessionPolicy struct {
+	// MaxDurationSeconds 单个会话的最长时长（秒）
+	MaxDurationSeconds int `json:"max_duration_seconds"`
+	// IdleTimeoutSeconds 客户端与上游均无消息超过该时长（秒）后关闭会话
+	IdleTimeoutSeconds int `json:"idle_timeout_seconds"`
+	// MaxConcurrentSessions 同一令牌同时打开的会话数上限
+	MaxConcurrentSessions int `json:"max_concurrent_sessions"`
+	// MinRemainQuota 生成新回复前用户与令牌至少需保留的额度。会话中已有回复时，
+	// 取其与单次回复最高消耗中的较大值，剩余额度不足时关闭会话
+	MinRemainQuota int `json:"min_remain_quota"`
+}
+
+// RealtimeSessionSetting 实时会话控制配置，令牌策略优先于分组策略，分组策略优先于默认策略
+type RealtimeSessionSetting struct {
+	Enabled bool                  `json:"enabled"`
+	Default RealtimeSessionPolicy `json:"default"`
+	// GroupPolicies 分组 -> 策略
+	GroupPolicies map[string]RealtimeSessionPolicy `json:"group_policies"`
+	// TokenPolicies 令牌 ID -> 策略
+	TokenPolicies map[int]RealtimeSessionPolicy `json:"token_policies"`
+}
+
+// 默认配置
+var realtimeSessionSetting = RealtimeSessionSetting{
+	Enabled: false,
+	Default: RealtimeSessionPolicy{
+		MaxDurationSeconds: 3600,
+		IdleTimeoutSeconds: 300,
+	},
+	GroupPolicies: map[string]RealtimeSessionPolicy{},
+	TokenPolicies: map[int]RealtimeSessionPolicy{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime_session_setting", &realtimeSessionSetting)
+}
+
+// GetRealtimeSessionSetting 获取实时会话控制配置
+func GetRealtimeSessionSetting() *RealtimeSessionSetting {
+	return &realtimeSessionSetting
+}
+
+// ResolvePolicy 按令牌、分组、默认的顺序确定会话使用的策略，未启用时返回 nil
+func (s *RealtimeSessionSetting) ResolvePolicy(tokenId int, group string) *RealtimeSessionPolicy {
+	if !s.Enabled {
+		return nil
+	}
+	policy := s.Default
+	if groupPolicy, ok := s.GroupPolicies[group]; ok && group != "" {
+		policy = groupPolicy
+	}
+	if tokenPolicy, ok := s.TokenPolicies[tokenId]; ok && tokenId != 0 {
+		policy = tokenPolicy
+	}
+	return &policy
+}
+
+// Validate 校验策略配置
+func (p *RealtimeSessionPolicy) Validate() error {
+	if p.MaxDurationSeconds < 0 || p.IdleTimeoutSeconds < 0 || p.MaxConcurrentSessions < 0 || p.MinRemainQuota < 0 {
+		return fmt.Errorf("实时会话限制不能为负数")
+	}
+	return nil
+}
+
+// ValidateRealtimeSessionPolicy 校验默认策略配置
+func ValidateRealtimeSessionPolicy(jsonStr string) error {
+	var policy RealtimeSessionPolicy
+	if err := common.UnmarshalJsonStr(jsonStr, &policy); err != nil {
+		return err
+	}
+	return policy.Validate()
+}
+
+// ValidateRealtimeSessionGroupPolicies 校验分组策略配置
+func ValidateRealtimeSessionGroupPolicies(jsonStr string) error {
+	var policies map[string]RealtimeSessionPolicy
+	if err := common.UnmarshalJsonStr(jsonStr, &policies); err != nil {
+		return err
+	}
+	for group, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("分组 %s: %s", group, err.Error())
+		}
+	}
+	return nil
+}
+
+// ValidateRealtimeSessionTokenPolicies 校验令牌策略配置
+func ValidateRealtimeSessionTokenPolicies(jsonStr string) error {
+	var policies map[int]RealtimeSessionPolicy
+	if err := common.UnmarshalJsonStr(jsonStr, &policies); err != nil {
+		return err
+	}
+	for tokenId, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("令牌 %d: %s", tokenId, err.Error())
+		}
+	}
+	return nil
+}
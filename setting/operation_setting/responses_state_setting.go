@@ -0,0 +1,42 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponsesStateSetting 网关侧 Responses 会话状态配置
+type ResponsesStateSetting struct {
+	// Enabled 保存原生 Responses 渠道返回的响应，续接请求落到其他渠道时由网关重建上下文。默认关闭：
+	// 开启后每个未显式 store=false 的请求都会将完整的输入与输出保存在 Redis（未启用时为内存）中直到过期，
+	// Redis 侧没有容量上限，需按请求量与保留时长评估内存占用，并注意对话内容的隐私与合规要求。
+	// 转换到 Chat Completions 上游的响应不受此开关影响，始终保存
+	Enabled bool `json:"enabled"`
+	// RetentionHours 响应保留时长（小时），同时决定上述存储占用
+	RetentionHours int `json:"retention_hours"`
+}
+
+// 默认配置
+var responsesStateSetting = ResponsesStateSetting{
+	Enabled:        false,
+	RetentionHours: 720,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("responses_state_setting", &responsesStateSetting)
+}
+
+// GetResponsesStateSetting 获取 Responses 会话状态配置
+func GetResponsesStateSetting() *ResponsesStateSetting {
+	return &responsesStateSetting
+}
+
+// GetRetention 响应保留时长，未配置时与 OpenAI 保存响应的时长一致
+func (s *ResponsesStateSetting) GetRetention() time.Duration {
+	if s.RetentionHours <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(s.RetentionHours) * time.Hour
+}
@@ -0,0 +1,39 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// SpendAlertSetting 消费告警配置。用户规则在个人设置中配置，
+// 全局规则对所有用户生效并通知 root 用户，用于及时发现泄露的令牌
+type SpendAlertSetting struct {
+	// Enabled 总开关，关闭后用户规则与全局规则均不生效
+	Enabled bool `json:"enabled"`
+	// SpikeMinQuota 小时突增检测的最低小时消费额度，避免低消费用户误报
+	SpikeMinQuota int `json:"spike_min_quota"`
+	// GlobalDailyQuota 全局规则：用户当日消费超过该额度，0 表示不启用
+	GlobalDailyQuota int `json:"global_daily_quota"`
+	// GlobalHourlySpikeRatio 全局规则：用户当前小时消费超过过去 24 小时均值的倍数，0 表示不启用
+	GlobalHourlySpikeRatio float64 `json:"global_hourly_spike_ratio"`
+	// GlobalSingleRequestQuota 全局规则：单次请求消费超过该额度，0 表示不启用
+	GlobalSingleRequestQuota int `json:"global_single_request_quota"`
+}
+
+// 默认配置
+var spendAlertSetting = SpendAlertSetting{
+	Enabled:       true,
+	SpikeMinQuota: 500000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("spend_alert_setting", &spendAlertSetting)
+}
+
+// GetSpendAlertSetting 获取消费告警配置
+func GetSpendAlertSetting() *SpendAlertSetting {
+	return &spendAlertSetting
+}
+
+// HasGlobalRules 是否配置了全局规则
+func (s *SpendAlertSetting) HasGlobalRules() bool {
+	return s.GlobalDailyQuota > 0 || s.GlobalHourlySpikeRatio > 0 || s.GlobalSingleRequestQuota > 0
+}
@@ -0,0 +1,75 @@
+package operation_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	TokenAnomalyActionNone            = ""
+	TokenAnomalyActionAlert           = "alert"
+	TokenAnomalyActionRequireAllowIps = "require_allow_ips"
+	TokenAnomalyActionQuarantine      = "quarantine"
+)
+
+// TokenAnomalySetting 令牌泄露检测配置。检测基于令牌的历史使用画像，
+// 画像积累到足够数据后，在检测窗口内统计异常请求并按策略处理
+type TokenAnomalySetting struct {
+	Enabled bool `json:"enabled"`
+	// MinBaselineRequests 画像累计请求数达到该值后才开始检测
+	MinBaselineRequests int64 `json:"min_baseline_requests"`
+	// MinBaselineHours 画像建立超过该小时数后才开始检测
+	MinBaselineHours int `json:"min_baseline_hours"`
+	// WindowMinutes 异常计数窗口（分钟）
+	WindowMinutes int `json:"window_minutes"`
+	// RareSharePercent 历史占比低于该百分比的模型或时段视为罕见
+	RareSharePercent float64 `json:"rare_share_percent"`
+	// IpPrefixLearnHours IP 前缀首次出现超过该小时数后才视为常用网段
+	IpPrefixLearnHours int `json:"ip_prefix_learn_hours"`
+
+	// NewIpPrefixThreshold 窗口内出现的陌生 IP 前缀（IPv4 /24、IPv6 /48，非 ASN）数量阈值
+	NewIpPrefixThreshold int    `json:"new_ip_prefix_threshold"`
+	NewIpPrefixAction    string `json:"new_ip_prefix_action"`
+	// UnusualModelThreshold 窗口内请求罕见模型的次数阈值
+	UnusualModelThreshold int    `json:"unusual_model_threshold"`
+	UnusualModelAction    string `json:"unusual_model_action"`
+	// OffHoursThreshold 窗口内在罕见时段请求的次数阈值
+	OffHoursThreshold int    `json:"off_hours_threshold"`
+	OffHoursAction    string `json:"off_hours_action"`
+}
+
+// 默认配置
+var tokenAnomalySetting = TokenAnomalySetting{
+	Enabled:               false,
+	MinBaselineRequests:   500,
+	MinBaselineHours:      72,
+	WindowMinutes:         10,
+	RareSharePercent:      1,
+	IpPrefixLearnHours:    24,
+	NewIpPrefixThreshold:  3,
+	NewIpPrefixAction:     TokenAnomalyActionAlert,
+	UnusualModelThreshold: 20,
+	UnusualModelAction:    TokenAnomalyActionAlert,
+	OffHoursThreshold:     50,
+	OffHoursAction:        TokenAnomalyActionAlert,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("token_anomaly_setting", &tokenAnomalySetting)
+}
+
+// GetTokenAnomalySetting 获取令牌泄露检测配置
+func GetTokenAnomalySetting() *TokenAnomalySetting {
+	return &tokenAnomalySetting
+}
+
+// ValidateTokenAnomalyAction 校验异常处理策略
+func ValidateTokenAnomalyAction(action string) error {
+	switch action {
+	case TokenAnomalyActionNone, TokenAnomalyActionAlert, TokenAnomalyActionRequireAllowIps, TokenAnomalyActionQuarantine:
+		return nil
+	}
+	return fmt.Errorf("不支持的处理策略: %s", action)
+}
@@ -5,11 +5,18 @@ import "github.com/QuantumNous/new-api/setting/config"
 // TokenSetting 令牌相关配置
 type TokenSetting struct {
 	MaxUserTokens int `json:"max_user_tokens"` // 每用户最大令牌数量
+
+	// 轮换密钥时旧密钥的默认过渡期与最长过渡期（分钟），过渡期内新旧密钥同时有效
+	RotationGraceMinutes    int `json:"rotation_grace_minutes"`
+	MaxRotationGraceMinutes int `json:"max_rotation_grace_minutes"`
 }
 
 // 默认配置
 var tokenSetting = TokenSetting{
 	MaxUserTokens: 1000, // 默认每用户最多 1000 个令牌
+
+	RotationGraceMinutes:    60,
+	MaxRotationGraceMinutes: 7 * 24 * 60,
 }
 
 func init() {
@@ -26,3 +33,19 @@ func GetTokenSetting() *TokenSetting {
 func GetMaxUserTokens() int {
 	return GetTokenSetting().MaxUserTokens
 }
+
+// GetRotationGraceSeconds 计算轮换密钥的过渡期（秒）。minutes 为 nil 时使用默认过渡期，超过上限时截断
+func GetRotationGraceSeconds(minutes *int) int64 {
+	setting := GetTokenSetting()
+	grace := setting.RotationGraceMinutes
+	if minutes != nil {
+		grace = *minutes
+	}
+	if grace > setting.MaxRotationGraceMinutes {
+		grace = setting.MaxRotationGraceMinutes
+	}
+	if grace <= 0 {
+		return 0
+	}
+	return int64(grace) * 60
+}
@@ -0,0 +1,323 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// PricingSchedule 定时/促销价格计划，在生效时间内将模型倍率或价格乘以 Multiplier
+type PricingSchedule struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Models 适用模型，以 * 结尾表示前缀匹配，为空表示所有模型
+	Models []string `json:"models"`
+	// Groups 适用分组，为空表示所有分组
+	Groups []string `json:"groups"`
+	// StartTime / EndTime 生效日期范围（Unix 秒），0 表示不限制
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+	// Weekdays 每周生效的日期（0 为周日），为空表示每天
+	Weekdays []int `json:"weekdays"`
+	// WindowStart / WindowEnd 每日生效时段，格式 HH:MM，结束早于开始表示跨零点，均为空表示全天
+	WindowStart string `json:"window_start"`
+	WindowEnd   string `json:"window_end"`
+	// Timezone 时段所在时区，例如 Asia/Shanghai，默认 UTC
+	Timezone string `json:"timezone"`
+	// Multiplier 价格系数，0.5 表示五折，0 表示免费
+	Multiplier float64 `json:"multiplier"`
+}
+
+// PricingScheduleSetting 价格计划配置，按配置顺序第一个命中的计划生效
+type PricingScheduleSetting struct {
+	Enabled   bool              `json:"enabled"`
+	Schedules []PricingSchedule `json:"schedules"`
+}
+
+// PricingScheduleWindow 价格计划的一次生效区间，EndsAt 为 0 表示长期有效
+type PricingScheduleWindow struct {
+	Name       string   `json:"name"`
+	Models     []string `json:"models"`
+	Groups     []string `json:"groups"`
+	Multiplier float64  `json:"multiplier"`
+	StartsAt   int64    `json:"starts_at"`
+	EndsAt     int64    `json:"ends_at"`
+	Active     bool     `json:"active"`
+}
+
+// 默认配置
+var pricingScheduleSetting = PricingScheduleSetting{
+	Enabled:   false,
+	Schedules: []PricingSchedule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("pricing_schedule_setting", &pricingScheduleSetting)
+}
+
+// GetPricingScheduleSetting 获取价格计划配置
+func GetPricingScheduleSetting() *PricingScheduleSetting {
+	return &pricingScheduleSetting
+}
+
+func (s *PricingSchedule) matchModel(modelName string) bool {
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, pattern := range s.Models {
+		if pattern == modelName || pattern == "*" {
+			return true
+		}
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(modelName, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PricingSchedule) matchGroup(group string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+	for _, g := range s.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PricingSchedule) matchAnyGroup(groups map[string]string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+	for _, g := range s.Groups {
+		if _, ok := groups[g]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PricingSchedule) recurring() bool {
+	return s.WindowStart != "" || s.WindowEnd != "" || len(s.Weekdays) > 0
+}
+
+func (s *PricingSchedule) location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s *PricingSchedule) matchWeekday(day time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range s.Weekdays {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseScheduleClock 解析 HH:MM，返回距零点的分钟数，允许 24:00
+func parseScheduleClock(value string, defaultMinutes int) (int, error) {
+	if value == "" {
+		return defaultMinutes, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	total := hour*60 + minute
+	if hour < 0 || minute < 0 || minute >= 60 || total > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return total, nil
+}
+
+// Validate 校验时段与时区配置
+func (s *PricingSchedule) Validate() error {
+	if s.Multiplier < 0 {
+		return fmt.Errorf("schedule %s: multiplier must not be negative", s.Name)
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("schedule %s: %w", s.Name, err)
+		}
+	}
+	if _, err := parseScheduleClock(s.WindowStart, 0); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	if _, err := parseScheduleClock(s.WindowEnd, 24*60); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	for _, d := range s.Weekdays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("schedule %s: invalid weekday %d", s.Name, d)
+		}
+	}
+	if s.StartTime > 0 && s.EndTime > 0 && s.EndTime <= s.StartTime {
+		return fmt.Errorf("schedule %s: end_time must be after start_time", s.Name)
+	}
+	return nil
+}
+
+// windows 返回与 [from, to) 重叠的生效区间，end 为零值表示长期有效
+func (s *PricingSchedule) windows(from, to time.Time) [][2]time.Time {
+	var validFrom, validTo time.Time
+	if s.StartTime > 0 {
+		validFrom = time.Unix(s.StartTime, 0)
+	}
+	if s.EndTime > 0 {
+		validTo = time.Unix(s.EndTime, 0)
+	}
+	overlaps := func(start, end time.Time) bool {
+		return start.Before(to) && (end.IsZero() || end.After(from))
+	}
+
+	if !s.recurring() {
+		if overlaps(validFrom, validTo) {
+			return [][2]time.Time{{validFrom, validTo}}
+		}
+		return nil
+	}
+
+	startMinutes, err := parseScheduleClock(s.WindowStart, 0)
+	if err != nil {
+		return nil
+	}
+	endMinutes, err := parseScheduleClock(s.WindowEnd, 24*60)
+	if err != nil {
+		return nil
+	}
+	loc := s.location()
+	local := from.In(loc)
+	// 从前一天开始，以覆盖跨零点的时段
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+	var result [][2]time.Time
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !s.matchWeekday(day.Weekday()) {
+			continue
+		}
+		start := day.Add(time.Duration(startMinutes) * time.Minute)
+		end := day.Add(time.Duration(endMinutes) * time.Minute)
+		if endMinutes <= startMinutes {
+			end = end.Add(24 * time.Hour)
+		}
+		if !validFrom.IsZero() && start.Before(validFrom) {
+			start = validFrom
+		}
+		if !validTo.IsZero() && end.After(validTo) {
+			end = validTo
+		}
+		if !end.After(start) {
+			continue
+		}
+		if overlaps(start, end) {
+			result = append(result, [2]time.Time{start, end})
+		}
+	}
+	return result
+}
+
+// activeWindow 返回包含 now 的生效区间
+func (s *PricingSchedule) activeWindow(now time.Time) ([2]time.Time, bool) {
+	for _, w := range s.windows(now, now.Add(time.Second)) {
+		if !w[0].After(now) && (w[1].IsZero() || w[1].After(now)) {
+			return w, true
+		}
+	}
+	return [2]time.Time{}, false
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Resolve 返回当前对该模型与分组生效的价格计划
+func (s *PricingScheduleSetting) Resolve(modelName string, group string, now time.Time) (PricingScheduleWindow, bool) {
+	if !s.Enabled {
+		return PricingScheduleWindow{}, false
+	}
+	for i := range s.Schedules {
+		schedule := &s.Schedules[i]
+		if !schedule.Enabled || !schedule.matchModel(modelName) || !schedule.matchGroup(group) {
+			continue
+		}
+		if w, ok := schedule.activeWindow(now); ok {
+			return PricingScheduleWindow{
+				Name:       schedule.Name,
+				Models:     schedule.Models,
+				Groups:     schedule.Groups,
+				Multiplier: schedule.Multiplier,
+				StartsAt:   unixOrZero(w[0]),
+				EndsAt:     unixOrZero(w[1]),
+				Active:     true,
+			}, true
+		}
+	}
+	return PricingScheduleWindow{}, false
+}
+
+// Windows 列出 [now, now+horizon) 内正在生效与即将生效的区间，仅包含适用于 groups 中任一分组的计划
+func (s *PricingScheduleSetting) Windows(groups map[string]string, now time.Time, horizon time.Duration) []PricingScheduleWindow {
+	result := make([]PricingScheduleWindow, 0)
+	if !s.Enabled {
+		return result
+	}
+	for i := range s.Schedules {
+		schedule := &s.Schedules[i]
+		if !schedule.Enabled || !schedule.matchAnyGroup(groups) {
+			continue
+		}
+		for _, w := range schedule.windows(now, now.Add(horizon)) {
+			result = append(result, PricingScheduleWindow{
+				Name:       schedule.Name,
+				Models:     schedule.Models,
+				Groups:     schedule.Groups,
+				Multiplier: schedule.Multiplier,
+				StartsAt:   unixOrZero(w[0]),
+				EndsAt:     unixOrZero(w[1]),
+				Active:     !w[0].After(now),
+			})
+		}
+	}
+	return result
+}
+
+// ValidatePricingSchedules 校验 pricing_schedule_setting.schedules 配置
+func ValidatePricingSchedules(jsonStr string) error {
+	var schedules []PricingSchedule
+	if err := common.UnmarshalJsonStr(jsonStr, &schedules); err != nil {
+		return err
+	}
+	for i := range schedules {
+		if err := schedules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
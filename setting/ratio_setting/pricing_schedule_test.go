@@ -0,0 +1,71 @@
+package ratio_setting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPricingScheduleResolve(t *testing.T) {
+	launch := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	setting := PricingScheduleSetting{
+		Enabled: true,
+		Schedules: []PricingSchedule{
+			{Name: "disabled", Multiplier: 0.1},
+			{Name: "launch", Enabled: true, Models: []string{"model-x"}, StartTime: launch.Unix(), EndTime: launch.AddDate(0, 0, 7).Unix(), Multiplier: 0},
+			{Name: "off-peak", Enabled: true, Models: []string{"model-*"}, Groups: []string{"default"}, WindowStart: "22:00", WindowEnd: "08:00", Multiplier: 0.5},
+		},
+	}
+
+	w, ok := setting.Resolve("model-x", "vip", launch.Add(time.Hour))
+	require.True(t, ok)
+	require.Equal(t, "launch", w.Name)
+	require.Zero(t, w.Multiplier)
+	require.Equal(t, launch.AddDate(0, 0, 7).Unix(), w.EndsAt)
+
+	// 跨零点时段：前一天 22:00 开始，当天 08:00 结束
+	now := time.Date(2026, 6, 2, 3, 0, 0, 0, time.UTC)
+	w, ok = setting.Resolve("model-y", "default", now)
+	require.True(t, ok)
+	require.Equal(t, "off-peak", w.Name)
+	require.Equal(t, time.Date(2026, 6, 1, 22, 0, 0, 0, time.UTC).Unix(), w.StartsAt)
+	require.Equal(t, time.Date(2026, 6, 2, 8, 0, 0, 0, time.UTC).Unix(), w.EndsAt)
+
+	_, ok = setting.Resolve("model-y", "vip", now)
+	require.False(t, ok)
+	_, ok = setting.Resolve("model-y", "default", now.Add(6*time.Hour))
+	require.False(t, ok)
+}
+
+func TestPricingScheduleWindowsAndWeekdays(t *testing.T) {
+	setting := PricingScheduleSetting{
+		Enabled: true,
+		Schedules: []PricingSchedule{
+			{Name: "weekend", Enabled: true, Weekdays: []int{0, 6}, Timezone: "Asia/Shanghai", Multiplier: 0.8},
+		},
+	}
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	// 2026-06-05 为周五
+	now := time.Date(2026, 6, 5, 12, 0, 0, 0, loc)
+
+	windows := setting.Windows(map[string]string{"default": ""}, now, 7*24*time.Hour)
+	require.Len(t, windows, 2)
+	require.False(t, windows[0].Active)
+	require.Equal(t, time.Date(2026, 6, 6, 0, 0, 0, 0, loc).Unix(), windows[0].StartsAt)
+	require.Equal(t, time.Date(2026, 6, 7, 0, 0, 0, 0, loc).Unix(), windows[0].EndsAt)
+
+	_, ok := setting.Resolve("any", "default", now)
+	require.False(t, ok)
+	_, ok = setting.Resolve("any", "default", now.AddDate(0, 0, 1))
+	require.True(t, ok)
+}
+
+func TestValidatePricingSchedules(t *testing.T) {
+	require.NoError(t, ValidatePricingSchedules(`[{"name":"a","window_start":"00:00","window_end":"24:00","timezone":"UTC","multiplier":0.5}]`))
+	require.Error(t, ValidatePricingSchedules(`[{"name":"a","window_start":"25:00"}]`))
+	require.Error(t, ValidatePricingSchedules(`[{"name":"a","timezone":"Mars/Base"}]`))
+	require.Error(t, ValidatePricingSchedules(`[{"name":"a","weekdays":[7]}]`))
+	require.Error(t, ValidatePricingSchedules(`[{"name":"a","multiplier":-1}]`))
+}
@@ -0,0 +1,106 @@
+package ratio_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// TieredRatioRule 分段计价规则，按提示 tokens 区间与 service_tier 选择倍率
+type TieredRatioRule struct {
+	// Name 规则名称，记录在日志中便于核对
+	Name string `json:"name"`
+	// PromptTokensAbove 提示 tokens 超过该值时生效，0 表示不限制
+	PromptTokensAbove int `json:"prompt_tokens_above"`
+	// ServiceTier 匹配请求的 service_tier（如 priority、flex、batch），为空匹配任意层级
+	ServiceTier string `json:"service_tier"`
+
+	// 以下倍率为 0 时沿用模型的基础倍率
+	ModelRatio         float64 `json:"model_ratio"`
+	CompletionRatio    float64 `json:"completion_ratio"`
+	CacheRatio         float64 `json:"cache_ratio"`
+	CacheCreationRatio float64 `json:"cache_creation_ratio"`
+	// Multiplier 在模型倍率基础上再乘以该系数，0 表示不调整，适合按 service_tier 统一打折或加价
+	Multiplier float64 `json:"multiplier"`
+}
+
+// TieredRatioSetting 分段计价配置
+type TieredRatioSetting struct {
+	Enabled bool `json:"enabled"`
+	// Rules 模型名到规则列表的映射，模型名以 * 结尾表示前缀匹配，"*" 匹配所有模型
+	Rules map[string][]TieredRatioRule `json:"rules"`
+}
+
+// 默认配置
+var tieredRatioSetting = TieredRatioSetting{
+	Enabled: false,
+	Rules:   map[string][]TieredRatioRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("tiered_ratio_setting", &tieredRatioSetting)
+}
+
+// GetTieredRatioSetting 获取分段计价配置
+func GetTieredRatioSetting() *TieredRatioSetting {
+	return &tieredRatioSetting
+}
+
+func (s *TieredRatioSetting) rulesForModel(modelName string) []TieredRatioRule {
+	if rules, ok := s.Rules[modelName]; ok {
+		return rules
+	}
+	if rules, ok := s.Rules[FormatMatchingModelName(modelName)]; ok {
+		return rules
+	}
+	bestPrefix := -1
+	var matched []TieredRatioRule
+	for pattern, rules := range s.Rules {
+		if !strings.HasSuffix(pattern, "*") {
+			continue
+		}
+		prefix := strings.TrimSuffix(pattern, "*")
+		if strings.HasPrefix(modelName, prefix) && len(prefix) > bestPrefix {
+			bestPrefix = len(prefix)
+			matched = rules
+		}
+	}
+	return matched
+}
+
+// Match 选择命中的规则：指定了 service_tier 的规则优先于通用规则，同类规则中阈值最高者优先
+func (s *TieredRatioSetting) Match(modelName string, promptTokens int, serviceTier string) (TieredRatioRule, bool) {
+	if !s.Enabled {
+		return TieredRatioRule{}, false
+	}
+	serviceTier = strings.ToLower(strings.TrimSpace(serviceTier))
+	var best *TieredRatioRule
+	rules := s.rulesForModel(modelName)
+	for i := range rules {
+		rule := &rules[i]
+		if rule.ServiceTier != "" && !strings.EqualFold(rule.ServiceTier, serviceTier) {
+			continue
+		}
+		if rule.PromptTokensAbove > 0 && promptTokens <= rule.PromptTokensAbove {
+			continue
+		}
+		if best == nil {
+			best = rule
+			continue
+		}
+		if (rule.ServiceTier != "") != (best.ServiceTier != "") {
+			if rule.ServiceTier != "" {
+				best = rule
+			}
+			continue
+		}
+		if rule.PromptTokensAbove > best.PromptTokensAbove {
+			best = rule
+		}
+	}
+	if best == nil {
+		return TieredRatioRule{}, false
+	}
+	return *best, true
+}
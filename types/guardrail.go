@@ -0,0 +1,13 @@
+package types
+
+// GuardrailViolation records one guardrail stage hit; it is stored in Log.Other["guardrail"].
+type GuardrailViolation struct {
+	Policy string   `json:"policy"`
+	Stage  string   `json:"stage"`
+	Type   string   `json:"type"`
+	Phase  string   `json:"phase"`
+	Action string   `json:"action"`
+	Labels []string `json:"labels,omitempty"` // matched keywords, PII types or judge categories
+	Reason string   `json:"reason,omitempty"`
+	Score  float64  `json:"score,omitempty"` // prompt injection score
+}
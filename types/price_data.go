@@ -25,6 +25,92 @@ type PriceData struct {
 	Quota                int // 按次计费的最终额度（MJ / Task）
 	QuotaToPreConsume    int // 按量计费的预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	ServiceTier          string               // 请求的 service_tier，仅在渠道允许透传时记录
+	PricingTier          *PricingTierInfo     // 命中的分段计价规则
+	PricingSchedule      *PricingScheduleInfo // 命中的定时/促销价格计划
+	baseRatios           *PricingTierRatios
+}
+
+// PricingTierRatios 分段计价使用的倍率，0 表示沿用基础倍率
+type PricingTierRatios struct {
+	ModelRatio           float64
+	CompletionRatio      float64
+	CacheRatio           float64
+	CacheCreationRatio   float64
+	CacheCreation5mRatio float64
+	CacheCreation1hRatio float64
+	Multiplier           float64
+}
+
+// PricingTierInfo 命中的分段计价规则，记录在日志中供用户核对
+type PricingTierInfo struct {
+	Name              string  `json:"name,omitempty"`
+	ServiceTier       string  `json:"service_tier,omitempty"`
+	PromptTokensAbove int     `json:"prompt_tokens_above,omitempty"`
+	PromptTokens      int     `json:"prompt_tokens"`
+	ModelRatio        float64 `json:"model_ratio"`
+	CompletionRatio   float64 `json:"completion_ratio"`
+}
+
+// PricingScheduleInfo 命中的定时/促销价格计划，请求开始时确定，结算沿用
+type PricingScheduleInfo struct {
+	Name       string  `json:"name"`
+	Multiplier float64 `json:"multiplier"`
+	EndsAt     int64   `json:"ends_at,omitempty"`
+}
+
+// ApplyPricingTier 在基础倍率上应用分段规则与价格计划；tier 为 nil 时恢复基础倍率。
+// 预扣费与结算可能命中不同区间，因此每次都从基础倍率重新计算。
+func (p *PriceData) ApplyPricingTier(tier *PricingTierInfo, ratios PricingTierRatios) {
+	if p.baseRatios == nil {
+		p.baseRatios = &PricingTierRatios{
+			ModelRatio:           p.ModelRatio,
+			CompletionRatio:      p.CompletionRatio,
+			CacheRatio:           p.CacheRatio,
+			CacheCreationRatio:   p.CacheCreationRatio,
+			CacheCreation5mRatio: p.CacheCreation5mRatio,
+			CacheCreation1hRatio: p.CacheCreation1hRatio,
+		}
+	}
+	base := *p.baseRatios
+	p.ModelRatio = base.ModelRatio
+	p.CompletionRatio = base.CompletionRatio
+	p.CacheRatio = base.CacheRatio
+	p.CacheCreationRatio = base.CacheCreationRatio
+	p.CacheCreation5mRatio = base.CacheCreation5mRatio
+	p.CacheCreation1hRatio = base.CacheCreation1hRatio
+	p.PricingTier = tier
+	if tier != nil {
+		p.applyTierRatios(tier, ratios, base)
+	}
+	if p.PricingSchedule != nil {
+		p.ModelRatio *= p.PricingSchedule.Multiplier
+	}
+}
+
+func (p *PriceData) applyTierRatios(tier *PricingTierInfo, ratios PricingTierRatios, base PricingTierRatios) {
+	if ratios.ModelRatio > 0 {
+		p.ModelRatio = ratios.ModelRatio
+	}
+	if ratios.Multiplier > 0 {
+		p.ModelRatio *= ratios.Multiplier
+	}
+	if ratios.CompletionRatio > 0 {
+		p.CompletionRatio = ratios.CompletionRatio
+	}
+	if ratios.CacheRatio > 0 {
+		p.CacheRatio = ratios.CacheRatio
+	}
+	if ratios.CacheCreationRatio > 0 {
+		// 1h 缓存写入与 5m 保持原有比例
+		if base.CacheCreationRatio > 0 {
+			p.CacheCreation1hRatio = base.CacheCreation1hRatio * ratios.CacheCreationRatio / base.CacheCreationRatio
+		}
+		p.CacheCreationRatio = ratios.CacheCreationRatio
+		p.CacheCreation5mRatio = ratios.CacheCreationRatio
+	}
+	tier.ModelRatio = p.ModelRatio
+	tier.CompletionRatio = p.CompletionRatio
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
@@ -885,6 +885,14 @@ const EditChannelModal = (props) => {
           data.allow_inference_geo =
             parsedSettings.allow_inference_geo || false;
           data.claude_beta_query = parsedSettings.claude_beta_query || false;
+          data.realtime_bridge_transcription_model =
+            parsedSettings.realtime_bridge_transcription_model || '';
+          data.realtime_bridge_chat_model =
+            parsedSettings.realtime_bridge_chat_model || '';
+          data.realtime_bridge_speech_model =
+            parsedSettings.realtime_bridge_speech_model || '';
+          data.realtime_bridge_voice =
+            parsedSettings.realtime_bridge_voice || '';
           data.upstream_model_update_check_enabled =
             parsedSettings.upstream_model_update_check_enabled === true;
           data.upstream_model_update_auto_sync_enabled =
@@ -914,6 +922,10 @@ const EditChannelModal = (props) => {
           data.allow_include_obfuscation = false;
           data.allow_inference_geo = false;
           data.claude_beta_query = false;
+          data.realtime_bridge_transcription_model = '';
+          data.realtime_bridge_chat_model = '';
+          data.realtime_bridge_speech_model = '';
+          data.realtime_bridge_voice = '';
           data.upstream_model_update_check_enabled = false;
           data.upstream_model_update_auto_sync_enabled = false;
           data.upstream_model_update_last_check_time = 0;
@@ -2945,6 +2957,74 @@ const EditChannelModal = (props) => {
                         </>
                       )}
 
+                      {inputs.type === 58 && (
+                        <>
+                          <Banner
+                            type='info'
+                            description={t(
+                              'Realtime 桥接渠道将实时会话拆分为转写、对话、语音合成三个环节，各环节模型需在同一分组下配置 OpenAI 兼容渠道，并按各自模型计费；本渠道密钥不会被使用',
+                            )}
+                            className='!rounded-lg'
+                          />
+                          <div>
+                            <Form.Input
+                              field='realtime_bridge_transcription_model'
+                              label={t('转写模型')}
+                              placeholder={t('例如：whisper-1')}
+                              onChange={(value) =>
+                                handleChannelOtherSettingsChange(
+                                  'realtime_bridge_transcription_model',
+                                  value,
+                                )
+                              }
+                              showClear
+                            />
+                          </div>
+                          <div>
+                            <Form.Input
+                              field='realtime_bridge_chat_model'
+                              label={t('对话模型')}
+                              placeholder={t('例如：gpt-4o-mini')}
+                              onChange={(value) =>
+                                handleChannelOtherSettingsChange(
+                                  'realtime_bridge_chat_model',
+                                  value,
+                                )
+                              }
+                              showClear
+                            />
+                          </div>
+                          <div>
+                            <Form.Input
+                              field='realtime_bridge_speech_model'
+                              label={t('语音合成模型，为空则仅输出文本')}
+                              placeholder={t('例如：tts-1')}
+                              onChange={(value) =>
+                                handleChannelOtherSettingsChange(
+                                  'realtime_bridge_speech_model',
+                                  value,
+                                )
+                              }
+                              showClear
+                            />
+                          </div>
+                          <div>
+                            <Form.Input
+                              field='realtime_bridge_voice'
+                              label={t('固定音色，为空则使用客户端指定的音色')}
+                              placeholder={t('例如：alloy')}
+                              onChange={(value) =>
+                                handleChannelOtherSettingsChange(
+                                  'realtime_bridge_voice',
+                                  value,
+                                )
+                              }
+                              showClear
+                            />
+                          </div>
+                        </>
+                      )}
+
                       {inputs.type === 8 && (
                         <>
                           <Banner
@@ -584,6 +584,25 @@ export const useLogsData = () => {
           value: other.request_path,
         });
       }
+      if (isAdminUser && Array.isArray(other?.guardrail) && other.guardrail.length > 0) {
+        const guardrailLines = other.guardrail
+          .map((v) =>
+            [
+              `${v.policy}/${v.stage}`,
+              v.phase,
+              v.action,
+              v.score ? `${t('评分')} ${v.score}` : '',
+              (v.labels || []).join(', '),
+            ]
+              .filter(Boolean)
+              .join(' · '),
+          )
+          .join('\n');
+        expandDataLocal.push({
+          key: t('内容安全'),
+          value: <div style={{ whiteSpace: 'pre-line' }}>{guardrailLines}</div>,
+        });
+      }
       if (other?.billing_source === 'subscription') {
         const planId = other?.subscription_plan_id;
         const planTitle = other?.subscription_plan_title || '';
@@ -66,10 +66,22 @@ const chatCompletionsToResponsesPolicyAllChannelsExample = JSON.stringify(
   2,
 );
 
+const responsesToChatCompletionsPolicyExample = JSON.stringify(
+  {
+    enabled: true,
+    all_channels: false,
+    channel_ids: [3],
+    model_patterns: ['^qwen.*$', '^glm-.*$'],
+  },
+  null,
+  2,
+);
+
 const defaultGlobalSettingInputs = {
   'global.pass_through_request_enabled': false,
   'global.thinking_model_blacklist': '[]',
   'global.chat_completions_to_responses_policy': '{}',
+  'global.responses_to_chat_completions_policy': '{}',
   'general_setting.ping_interval_enabled': false,
   'general_setting.ping_interval_seconds': 60,
 };
@@ -83,6 +95,8 @@ export default function SettingGlobalModel(props) {
   const [inputsRow, setInputsRow] = useState(defaultGlobalSettingInputs);
   const chatCompletionsToResponsesPolicyKey =
     'global.chat_completions_to_responses_policy';
+  const responsesToChatCompletionsPolicyKey =
+    'global.responses_to_chat_completions_policy';
 
   const setChatCompletionsToResponsesPolicyValue = (value) => {
     setInputs((prev) => ({
@@ -99,7 +113,10 @@ export default function SettingGlobalModel(props) {
       const text = typeof value === 'string' ? value.trim() : '';
       return text === '' ? '[]' : value;
     }
-    if (key === 'global.chat_completions_to_responses_policy') {
+    if (
+      key === 'global.chat_completions_to_responses_policy' ||
+      key === 'global.responses_to_chat_completions_policy'
+    ) {
       const text = typeof value === 'string' ? value.trim() : '';
       return text === '' ? '{}' : value;
     }
@@ -156,7 +173,10 @@ export default function SettingGlobalModel(props) {
             value = defaultGlobalSettingInputs[key];
           }
         }
-        if (key === 'global.chat_completions_to_responses_policy') {
+        if (
+          key === 'global.chat_completions_to_responses_policy' ||
+          key === 'global.responses_to_chat_completions_policy'
+        ) {
           try {
             value =
               value && String(value).trim() !== ''
@@ -355,6 +375,47 @@ export default function SettingGlobalModel(props) {
               </Row>
             </Form.Section>
 
+            <Form.Section
+              text={
+                <span style={{ fontSize: 14, fontWeight: 600 }}>
+                  {t('Responses→ChatCompletions 兼容配置')}
+                </span>
+              }
+            >
+              <Row style={{ marginTop: 10, marginBottom: 16 }}>
+                <Col span={24}>
+                  <Form.TextArea
+                    label={t('参数配置')}
+                    field={responsesToChatCompletionsPolicyKey}
+                    placeholder={
+                      t('例如（指定渠道）：') +
+                      '\n' +
+                      responsesToChatCompletionsPolicyExample
+                    }
+                    rows={6}
+                    rules={[
+                      {
+                        validator: (rule, value) => {
+                          if (!value || value.trim() === '') return true;
+                          return verifyJSON(value);
+                        },
+                        message: t('不是合法的 JSON 字符串'),
+                      },
+                    ]}
+                    extraText={t(
+                      '命中的渠道会将 /v1/responses 请求转换为 Chat Completions 发送，previous_response_id 的上下文由网关保存；DeepSeek、Moonshot 等不支持 Responses 的渠道始终转换',
+                    )}
+                    onChange={(value) =>
+                      setInputs((prev) => ({
+                        ...prev,
+                        [responsesToChatCompletionsPolicyKey]: value,
+                      }))
+                    }
+                  />
+                </Col>
+              </Row>
+            </Form.Section>
+
             <Form.Section
               text={
                 <span style={{ fontSize: 14, fontWeight: 600 }}>